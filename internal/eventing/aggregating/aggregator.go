@@ -0,0 +1,649 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aggregating
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/samber/lo"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fieldNameWindowStart = "window_start"
+	fieldNameWindowEnd   = "window_end"
+	fieldNameCount       = "count"
+)
+
+var defaultFunctions = []config.AggregateFunction{
+	config.MinAggregate, config.MaxAggregate, config.AvgAggregate, config.CountAggregate, config.LastAggregate,
+}
+
+var fieldFunctions = []config.AggregateFunction{
+	config.MinAggregate, config.MaxAggregate, config.AvgAggregate, config.LastAggregate,
+}
+
+// Window is a closed aggregation window of a single group, ready to be
+// emitted. Key and Value aren't wrapped into envelopes yet.
+type Window struct {
+	TopicName   string
+	KeySchema   schema.Struct
+	ValueSchema schema.Struct
+	Key         schema.Struct
+	Value       schema.Struct
+}
+
+type aggregation struct {
+	tableFilter *tablefiltering.TableFilter
+	groupBy     []string
+	fields      []string
+	functions   []config.AggregateFunction
+	timeColumn  string
+	window      time.Duration
+	lateness    time.Duration
+	rows        bool
+}
+
+// Aggregator buffers inserts into the selected tables over tumbling
+// windows, aligned on the time column, and turns them into aggregate
+// events (min, max, avg, count, last) per group. Windows are closed
+// when the watermark, derived from the commit time of the replicated
+// transactions, passes the end of the window plus the allowed lateness.
+type Aggregator struct {
+	nameGenerator    schema.NameGenerator
+	aggregations     []*aggregation
+	protectedColumns *protectedColumns
+
+	mutex     sync.Mutex
+	watermark time.Time
+	matches   map[string]*aggregation
+	tables    map[string]*tableAggregator
+	closed    []closedWindow
+}
+
+type closedWindow struct {
+	window   Window
+	firstLSN pgtypes.LSN
+}
+
+// NewAggregatorFromConfig creates the aggregator from the configured
+// sink.aggregates. It returns nil if no aggregation is configured.
+func NewAggregatorFromConfig(
+	c *config.Config, nameGenerator schema.NameGenerator,
+) (*Aggregator, error) {
+
+	if len(c.Sink.Aggregates) == 0 {
+		return nil, nil
+	}
+
+	aggregations := make([]*aggregation, 0, len(c.Sink.Aggregates))
+	for i, aggregateConfig := range c.Sink.Aggregates {
+		aggregation, err := newAggregation(aggregateConfig)
+		if err != nil {
+			return nil, errors.Errorf("sink.aggregates[%d]: %s", i, err.Error())
+		}
+		aggregations = append(aggregations, aggregation)
+	}
+
+	protectedColumns, err := newProtectedColumns(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Aggregator{
+		nameGenerator:    nameGenerator,
+		aggregations:     aggregations,
+		protectedColumns: protectedColumns,
+		matches:          make(map[string]*aggregation),
+		tables:           make(map[string]*tableAggregator),
+	}, nil
+}
+
+func newAggregation(
+	aggregateConfig config.AggregateConfig,
+) (*aggregation, error) {
+
+	if aggregateConfig.Window <= 0 {
+		return nil, errors.Errorf("window must be greater than 0")
+	}
+	if aggregateConfig.Lateness < 0 {
+		return nil, errors.Errorf("lateness must not be negative")
+	}
+
+	functions := aggregateConfig.Functions
+	if len(functions) == 0 {
+		functions = defaultFunctions
+	}
+	for _, function := range functions {
+		if !slices.Contains(defaultFunctions, function) {
+			return nil, errors.Errorf("illegal aggregate function '%s'", function)
+		}
+	}
+
+	if len(aggregateConfig.Fields) == 0 && !slices.Contains(functions, config.CountAggregate) {
+		return nil, errors.Errorf("at least one field or the count function is required")
+	}
+
+	tableFilter, err := tablefiltering.NewTableFilter(
+		aggregateConfig.Tables.Excludes, aggregateConfig.Tables.Includes, false,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aggregation{
+		tableFilter: tableFilter,
+		groupBy:     aggregateConfig.GroupBy,
+		fields:      aggregateConfig.Fields,
+		functions:   functions,
+		timeColumn:  aggregateConfig.TimeColumn,
+		window:      time.Duration(aggregateConfig.Window) * time.Millisecond,
+		lateness:    time.Duration(aggregateConfig.Lateness) * time.Millisecond,
+		rows:        lo.FromPtrOr(aggregateConfig.Rows, false),
+	}, nil
+}
+
+// Matches returns true if inserts into the table are aggregated, and
+// if the inserted rows are still emitted as events of their own.
+func (a *Aggregator) Matches(
+	table schema.TableAlike,
+) (aggregated, rows bool) {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	aggregation := a.match(table)
+	if aggregation == nil {
+		return false, true
+	}
+	return true, aggregation.rows
+}
+
+// Add buffers the inserted row into its window. The time is read from
+// the raw values, while groups and aggregates use the converted values.
+// Rows of already closed windows are dropped, in which case false is
+// returned.
+func (a *Aggregator) Add(
+	table schema.TableAlike, lsn pgtypes.LSN, rawValues, values map[string]any,
+) (accepted bool, err error) {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	tableAggregator, err := a.tableAggregator(table)
+	if err != nil {
+		return false, err
+	}
+	if tableAggregator == nil {
+		return false, nil
+	}
+	return tableAggregator.add(a.watermark, lsn, rawValues, values)
+}
+
+// Advance moves the watermark forward and returns all windows closed by
+// it, as well as previously closed windows which weren't flushed yet.
+// Closed windows hold back the low watermark until Flushed is called.
+func (a *Aggregator) Advance(
+	watermark time.Time,
+) []Window {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if watermark.After(a.watermark) {
+		a.watermark = watermark
+		for _, tableAggregator := range a.tables {
+			a.closed = append(a.closed, tableAggregator.close(watermark)...)
+		}
+	}
+
+	return lo.Map(a.closed, func(closed closedWindow, _ int) Window {
+		return closed.window
+	})
+}
+
+// Flushed marks all windows returned by Advance as emitted.
+func (a *Aggregator) Flushed() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.closed = nil
+}
+
+// LowWatermark returns the lowest LSN of all rows buffered in open
+// windows. Positions at or beyond that LSN must not be acknowledged.
+func (a *Aggregator) LowWatermark() (lsn pgtypes.LSN, open bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, closed := range a.closed {
+		if !open || closed.firstLSN < lsn {
+			lsn = closed.firstLSN
+			open = true
+		}
+	}
+	for _, tableAggregator := range a.tables {
+		for _, window := range tableAggregator.windows {
+			if !open || window.firstLSN < lsn {
+				lsn = window.firstLSN
+				open = true
+			}
+		}
+	}
+	return lsn, open
+}
+
+func (a *Aggregator) match(
+	table schema.TableAlike,
+) *aggregation {
+
+	canonicalName := table.CanonicalName()
+	if aggregation, present := a.matches[canonicalName]; present {
+		return aggregation
+	}
+
+	var match *aggregation
+	for _, aggregation := range a.aggregations {
+		if aggregation.tableFilter.Enabled(table) {
+			match = aggregation
+			break
+		}
+	}
+	a.matches[canonicalName] = match
+	return match
+}
+
+func (a *Aggregator) tableAggregator(
+	table schema.TableAlike,
+) (*tableAggregator, error) {
+
+	canonicalName := table.CanonicalName()
+	if tableAggregator, present := a.tables[canonicalName]; present {
+		return tableAggregator, nil
+	}
+
+	aggregation := a.match(table)
+	if aggregation == nil {
+		return nil, nil
+	}
+
+	tableAggregator, err := newTableAggregator(a.nameGenerator, a.protectedColumns, aggregation, table)
+	if err != nil {
+		return nil, err
+	}
+	a.tables[canonicalName] = tableAggregator
+	return tableAggregator, nil
+}
+
+type windowKey struct {
+	start int64
+	group string
+}
+
+type fieldState struct {
+	min      float64
+	max      float64
+	sum      float64
+	count    int64
+	last     any
+	lastTime time.Time
+	hasLast  bool
+}
+
+type windowState struct {
+	start    time.Time
+	end      time.Time
+	firstLSN pgtypes.LSN
+	group    map[string]any
+	count    int64
+	fields   map[string]*fieldState
+}
+
+type tableAggregator struct {
+	aggregation *aggregation
+	timeColumn  string
+	topicName   string
+	keySchema   schema.Struct
+	valueSchema schema.Struct
+	windows     map[windowKey]*windowState
+}
+
+func newTableAggregator(
+	nameGenerator schema.NameGenerator, protectedColumns *protectedColumns,
+	aggregation *aggregation, table schema.TableAlike,
+) (*tableAggregator, error) {
+
+	columns := lo.SliceToMap(table.TableColumns(), func(column schema.ColumnAlike) (string, schema.ColumnAlike) {
+		return column.Name(), column
+	})
+
+	timeColumn := aggregation.timeColumn
+	if timeColumn == "" {
+		timeColumn = timeDimension(table)
+		if timeColumn == "" {
+			return nil, errors.Errorf(
+				"table %s has no time dimension, a time column must be configured", table.CanonicalName(),
+			)
+		}
+	}
+
+	aggregatedColumns := append(append([]string{timeColumn}, aggregation.groupBy...), aggregation.fields...)
+	for _, column := range aggregatedColumns {
+		if _, present := columns[column]; !present {
+			return nil, errors.Errorf("column '%s' doesn't exist in table %s", column, table.CanonicalName())
+		}
+	}
+
+	// Aggregates would expose the values of encrypted or masked columns
+	if err := protectedColumns.check(table, aggregatedColumns); err != nil {
+		return nil, err
+	}
+
+	schemaTopicName := nameGenerator.SchemaTopicName(table)
+
+	keySchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName(fmt.Sprintf("%s.AggregateKey", schemaTopicName)).
+		Required().
+		Field(fieldNameWindowStart, 0, schema.String().Required())
+
+	valueSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName(fmt.Sprintf("%s.Aggregate", schemaTopicName)).
+		Required().
+		Field(fieldNameWindowStart, 0, schema.String().Required()).
+		Field(fieldNameWindowEnd, 1, schema.String().Required())
+
+	index := 2
+	for i, column := range aggregation.groupBy {
+		keySchema.Field(column, i+1, columns[column].SchemaBuilder())
+		valueSchema.Field(column, index, columns[column].SchemaBuilder())
+		index++
+	}
+
+	if slices.Contains(aggregation.functions, config.CountAggregate) {
+		valueSchema.Field(fieldNameCount, index, schema.Int64().Required())
+		index++
+	}
+
+	for _, field := range aggregation.fields {
+		for _, function := range fieldFunctions {
+			if !slices.Contains(aggregation.functions, function) {
+				continue
+			}
+			fieldSchema := schema.Float64().Optional()
+			if function == config.LastAggregate {
+				fieldSchema = columns[field].SchemaBuilder().Clone().Optional()
+			}
+			valueSchema.Field(aggregateFieldName(field, function), index, fieldSchema)
+			index++
+		}
+	}
+
+	return &tableAggregator{
+		aggregation: aggregation,
+		timeColumn:  timeColumn,
+		topicName:   fmt.Sprintf("%s.aggregate", nameGenerator.EventTopicName(table)),
+		keySchema:   keySchema.Build(),
+		valueSchema: valueSchema.Build(),
+		windows:     make(map[windowKey]*windowState),
+	}, nil
+}
+
+func (t *tableAggregator) add(
+	watermark time.Time, lsn pgtypes.LSN, rawValues, values map[string]any,
+) (bool, error) {
+
+	timestamp, ok := rawValues[t.timeColumn].(time.Time)
+	if !ok {
+		return false, errors.Errorf(
+			"value of time column '%s' isn't a timestamp: %v", t.timeColumn, rawValues[t.timeColumn],
+		)
+	}
+
+	start := alignWindow(timestamp, t.aggregation.window)
+	end := start.Add(t.aggregation.window)
+
+	// Windows already closed by the watermark don't accept late rows
+	if !end.Add(t.aggregation.lateness).After(watermark) {
+		return false, nil
+	}
+
+	group := make(map[string]any, len(t.aggregation.groupBy))
+	groupKey := make([]string, len(t.aggregation.groupBy))
+	for i, column := range t.aggregation.groupBy {
+		group[column] = values[column]
+		groupKey[i] = fmt.Sprintf("%v", values[column])
+	}
+
+	key := windowKey{start: start.UnixMicro(), group: strings.Join(groupKey, "\x00")}
+	window, present := t.windows[key]
+	if !present {
+		window = &windowState{
+			start:    start,
+			end:      end,
+			firstLSN: lsn,
+			group:    group,
+			fields:   make(map[string]*fieldState, len(t.aggregation.fields)),
+		}
+		t.windows[key] = window
+	}
+
+	window.count++
+	if lsn < window.firstLSN {
+		window.firstLSN = lsn
+	}
+
+	for _, field := range t.aggregation.fields {
+		state, present := window.fields[field]
+		if !present {
+			state = &fieldState{min: math.Inf(1), max: math.Inf(-1)}
+			window.fields[field] = state
+		}
+
+		value := values[field]
+		if !state.hasLast || !timestamp.Before(state.lastTime) {
+			state.last = value
+			state.lastTime = timestamp
+			state.hasLast = true
+		}
+
+		if value == nil {
+			continue
+		}
+
+		number, err := toFloat64(value)
+		if err != nil {
+			return false, errors.Errorf("value of field '%s' isn't numeric: %v", field, value)
+		}
+		state.min = math.Min(state.min, number)
+		state.max = math.Max(state.max, number)
+		state.sum += number
+		state.count++
+	}
+	return true, nil
+}
+
+func (t *tableAggregator) close(
+	watermark time.Time,
+) []closedWindow {
+
+	closed := make([]*windowState, 0)
+	for key, window := range t.windows {
+		if !window.end.Add(t.aggregation.lateness).After(watermark) {
+			closed = append(closed, window)
+			delete(t.windows, key)
+		}
+	}
+
+	// Emit windows in order of their start, and their first row per window
+	slices.SortFunc(closed, func(this, other *windowState) int {
+		if c := this.start.Compare(other.start); c != 0 {
+			return c
+		}
+		return cmp.Compare(this.firstLSN, other.firstLSN)
+	})
+
+	windows := make([]closedWindow, len(closed))
+	for i, window := range closed {
+		windows[i] = closedWindow{window: t.toWindow(window), firstLSN: window.firstLSN}
+	}
+	return windows
+}
+
+func (t *tableAggregator) toWindow(
+	window *windowState,
+) Window {
+
+	windowStart := window.start.In(time.UTC).Format(time.RFC3339Nano)
+	windowEnd := window.end.In(time.UTC).Format(time.RFC3339Nano)
+
+	key := schema.Struct{fieldNameWindowStart: windowStart}
+	value := schema.Struct{
+		fieldNameWindowStart: windowStart,
+		fieldNameWindowEnd:   windowEnd,
+	}
+
+	for column, groupValue := range window.group {
+		key[column] = groupValue
+		value[column] = groupValue
+	}
+
+	functions := t.aggregation.functions
+	if slices.Contains(functions, config.CountAggregate) {
+		value[fieldNameCount] = window.count
+	}
+
+	for _, field := range t.aggregation.fields {
+		state := window.fields[field]
+		for _, function := range fieldFunctions {
+			if !slices.Contains(functions, function) {
+				continue
+			}
+			value[aggregateFieldName(field, function)] = state.result(function)
+		}
+	}
+
+	return Window{
+		TopicName:   t.topicName,
+		KeySchema:   t.keySchema,
+		ValueSchema: t.valueSchema,
+		Key:         key,
+		Value:       value,
+	}
+}
+
+func (f *fieldState) result(
+	function config.AggregateFunction,
+) any {
+
+	if function == config.LastAggregate {
+		return f.last
+	}
+
+	// Null values aren't aggregated, just like in SQL
+	if f.count == 0 {
+		return nil
+	}
+
+	switch function {
+	case config.MinAggregate:
+		return f.min
+	case config.MaxAggregate:
+		return f.max
+	default:
+		return f.sum / float64(f.count)
+	}
+}
+
+func aggregateFieldName(
+	field string, function config.AggregateFunction,
+) string {
+
+	return fmt.Sprintf("%s_%s", field, function)
+}
+
+// alignWindow aligns the window on the unix epoch, the same way
+// TimescaleDB's time_bucket does without an origin
+func alignWindow(
+	timestamp time.Time, window time.Duration,
+) time.Time {
+
+	micros := timestamp.UnixMicro()
+	size := window.Microseconds()
+	start := micros - micros%size
+	if micros%size < 0 {
+		start -= size
+	}
+	return time.UnixMicro(start)
+}
+
+func timeDimension(
+	table schema.TableAlike,
+) string {
+
+	hypertable, ok := table.(*systemcatalog.Hypertable)
+	if !ok {
+		return ""
+	}
+
+	for _, column := range hypertable.Columns() {
+		if column.IsDimension() && lo.FromPtr(column.DimensionType()) == "time" {
+			return column.Name()
+		}
+	}
+	return ""
+}
+
+func toFloat64(
+	value any,
+) (float64, error) {
+
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int8:
+		return float64(v), nil
+	case int16:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint8:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	}
+	return 0, errors.Errorf("illegal numeric value %v", value)
+}
@@ -0,0 +1,372 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aggregating
+
+import (
+	namingstrategyimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/namingstrategy"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var baseTime = time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+
+func Test_Aggregator_Not_Configured(
+	t *testing.T,
+) {
+
+	aggregator, err := NewAggregatorFromConfig(&config.Config{}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, aggregator)
+}
+
+func Test_Aggregator_Illegal_Configuration(
+	t *testing.T,
+) {
+
+	_, err := NewAggregatorFromConfig(makeConfig(config.AggregateConfig{
+		Tables: config.IncludedTablesConfig{Includes: []string{"public.metrics"}},
+		Fields: []string{"temperature"},
+	}), nil)
+	assert.ErrorContains(t, err, "window must be greater than 0")
+
+	_, err = NewAggregatorFromConfig(makeConfig(config.AggregateConfig{
+		Tables:    config.IncludedTablesConfig{Includes: []string{"public.metrics"}},
+		Fields:    []string{"temperature"},
+		Functions: []config.AggregateFunction{"median"},
+		Window:    10000,
+	}), nil)
+	assert.ErrorContains(t, err, "illegal aggregate function 'median'")
+
+	_, err = NewAggregatorFromConfig(makeConfig(config.AggregateConfig{
+		Tables:    config.IncludedTablesConfig{Includes: []string{"public.metrics"}},
+		Functions: []config.AggregateFunction{config.MinAggregate},
+		Window:    10000,
+	}), nil)
+	assert.ErrorContains(t, err, "at least one field or the count function is required")
+}
+
+func Test_Aggregator_Rejects_Encrypted_Columns(
+	t *testing.T,
+) {
+
+	c := makeConfig(config.AggregateConfig{
+		Tables: config.IncludedTablesConfig{Includes: []string{"public.metrics"}},
+		Fields: []string{"temperature"},
+		Window: 10000,
+	})
+	c.Sink.Encryption.Columns = []string{"public.metrics.temperature"}
+	aggregator := makeAggregatorWithConfig(t, c)
+
+	_, err := aggregator.Add(makeMetrics(), 100, rawValues(1, "a", 20.0), values("a", 20.0))
+	assert.ErrorContains(t, err, "column 'temperature' of table \"public\".\"metrics\" is encrypted")
+
+	// The plaintext value is never buffered, hence never emitted as an aggregate
+	assert.Empty(t, aggregator.Advance(baseTime.Add(time.Hour)))
+	_, open := aggregator.LowWatermark()
+	assert.False(t, open)
+}
+
+func Test_Aggregator_Rejects_Masked_Columns(
+	t *testing.T,
+) {
+
+	c := makeConfig(config.AggregateConfig{
+		Tables:  config.IncludedTablesConfig{Includes: []string{"public.metrics"}},
+		GroupBy: []string{"device"},
+		Fields:  []string{"temperature"},
+		Window:  10000,
+	})
+	c.Sink.Transforms = []config.TransformConfig{
+		{
+			Type:   config.MaskTransform,
+			Tables: &config.IncludedTablesConfig{Includes: []string{"public.other"}},
+			Fields: []string{"temperature"},
+		},
+		{Type: config.MaskTransform, Fields: []string{"device"}},
+	}
+	aggregator := makeAggregatorWithConfig(t, c)
+
+	_, err := aggregator.Add(makeMetrics(), 100, rawValues(1, "a", 20.0), values("a", 20.0))
+	assert.ErrorContains(t, err, "column 'device' of table \"public\".\"metrics\" is affected by a mask transform")
+	assert.Empty(t, aggregator.Advance(baseTime.Add(time.Hour)))
+}
+
+func Test_Aggregator_Matches(
+	t *testing.T,
+) {
+
+	aggregator := makeAggregator(t, config.AggregateConfig{
+		Tables: config.IncludedTablesConfig{Includes: []string{"public.metrics"}},
+		Fields: []string{"temperature"},
+		Window: 10000,
+		Rows:   lo.ToPtr(true),
+	})
+
+	aggregated, rows := aggregator.Matches(makeMetrics())
+	assert.True(t, aggregated)
+	assert.True(t, rows)
+
+	aggregated, rows = aggregator.Matches(systemcatalog.NewPgTable(1, "public", "other", pgtypes.DEFAULT))
+	assert.False(t, aggregated)
+	assert.True(t, rows)
+}
+
+func Test_Aggregator_Tumbling_Windows(
+	t *testing.T,
+) {
+
+	aggregator := makeAggregator(t, config.AggregateConfig{
+		Tables:  config.IncludedTablesConfig{Includes: []string{"public.metrics"}},
+		GroupBy: []string{"device"},
+		Fields:  []string{"temperature"},
+		Window:  10000,
+	})
+	metrics := makeMetrics()
+
+	addRow(t, aggregator, metrics, 100, 1, "a", 20.0)
+	addRow(t, aggregator, metrics, 200, 3, "b", 30.0)
+	addRow(t, aggregator, metrics, 300, 5, "a", 10.0)
+	addRow(t, aggregator, metrics, 400, 12, "a", 40.0)
+
+	lsn, open := aggregator.LowWatermark()
+	assert.True(t, open)
+	assert.Equal(t, pgtypes.LSN(100), lsn)
+
+	// Windows close when the watermark reaches their end
+	assert.Empty(t, aggregator.Advance(baseTime.Add(9*time.Second)))
+
+	windows := aggregator.Advance(baseTime.Add(10 * time.Second))
+	assert.Len(t, windows, 2)
+
+	assert.Equal(t, "foobar.public.metrics.aggregate", windows[0].TopicName)
+	assert.Equal(t, "foobar.public.metrics.AggregateKey", windows[0].KeySchema[schema.FieldNameName])
+	assert.Equal(t, "foobar.public.metrics.Aggregate", windows[0].ValueSchema[schema.FieldNameName])
+
+	assert.Equal(t, schema.Struct{
+		fieldNameWindowStart: "2023-07-01T12:00:00Z",
+		"device":             "a",
+	}, windows[0].Key)
+	assert.Equal(t, schema.Struct{
+		fieldNameWindowStart: "2023-07-01T12:00:00Z",
+		fieldNameWindowEnd:   "2023-07-01T12:00:10Z",
+		"device":             "a",
+		"count":              int64(2),
+		"temperature_min":    10.0,
+		"temperature_max":    20.0,
+		"temperature_avg":    15.0,
+		"temperature_last":   10.0,
+	}, windows[0].Value)
+	assert.Equal(t, "b", windows[1].Value["device"])
+	assert.Equal(t, int64(1), windows[1].Value["count"])
+
+	// Closed windows hold back the low watermark until they're flushed
+	lsn, _ = aggregator.LowWatermark()
+	assert.Equal(t, pgtypes.LSN(100), lsn)
+
+	aggregator.Flushed()
+	lsn, open = aggregator.LowWatermark()
+	assert.True(t, open)
+	assert.Equal(t, pgtypes.LSN(400), lsn)
+
+	// Rows of closed windows are dropped
+	accepted, err := aggregator.Add(metrics, 500, rawValues(2, "a", 50.0), values("a", 50.0))
+	assert.NoError(t, err)
+	assert.False(t, accepted)
+
+	windows = aggregator.Advance(baseTime.Add(20 * time.Second))
+	assert.Len(t, windows, 1)
+	assert.Equal(t, 40.0, windows[0].Value["temperature_avg"])
+	aggregator.Flushed()
+
+	_, open = aggregator.LowWatermark()
+	assert.False(t, open)
+}
+
+func Test_Aggregator_Lateness_And_Functions(
+	t *testing.T,
+) {
+
+	aggregator := makeAggregator(t, config.AggregateConfig{
+		Tables:    config.IncludedTablesConfig{Includes: []string{"public.metrics"}},
+		Fields:    []string{"temperature"},
+		Functions: []config.AggregateFunction{config.MaxAggregate, config.LastAggregate},
+		Window:    10000,
+		Lateness:  5000,
+	})
+	metrics := makeMetrics()
+
+	addRow(t, aggregator, metrics, 100, 8, "a", 20.0)
+	assert.Empty(t, aggregator.Advance(baseTime.Add(12*time.Second)))
+
+	// Late rows are accepted within the allowed lateness, last is ordered by time
+	addRow(t, aggregator, metrics, 200, 4, "a", 30.0)
+	addRow(t, aggregator, metrics, 300, 6, "a", nil)
+
+	windows := aggregator.Advance(baseTime.Add(15 * time.Second))
+	assert.Len(t, windows, 1)
+	assert.Equal(t, schema.Struct{
+		fieldNameWindowStart: "2023-07-01T12:00:00Z",
+		fieldNameWindowEnd:   "2023-07-01T12:00:10Z",
+		"temperature_max":    30.0,
+		"temperature_last":   20.0,
+	}, windows[0].Value)
+}
+
+func Test_Aggregator_Requires_Time_Column(
+	t *testing.T,
+) {
+
+	aggregator := makeAggregator(t, config.AggregateConfig{
+		Tables: config.IncludedTablesConfig{Includes: []string{"public.readings"}},
+		Fields: []string{"temperature"},
+		Window: 10000,
+	})
+
+	readings := systemcatalog.NewPgTable(1, "public", "readings", pgtypes.DEFAULT)
+	readings.ApplyTableSchema([]systemcatalog.Column{
+		systemcatalog.NewColumn("ts", 1184, -1, timestampType, false, nil),
+		systemcatalog.NewColumn("temperature", 701, -1, float64Type, true, nil),
+	})
+
+	_, err := aggregator.Add(readings, 100, rawValues(1, "a", 1.0), values("a", 1.0))
+	assert.ErrorContains(t, err, "a time column must be configured")
+}
+
+func Test_Align_Window(
+	t *testing.T,
+) {
+
+	window := time.Minute
+	assert.Equal(t, baseTime, alignWindow(baseTime.Add(59*time.Second), window).In(time.UTC))
+	assert.Equal(t,
+		time.Date(1969, 12, 31, 23, 59, 0, 0, time.UTC),
+		alignWindow(time.Date(1969, 12, 31, 23, 59, 30, 0, time.UTC), window).In(time.UTC),
+	)
+}
+
+func addRow(
+	t *testing.T, aggregator *Aggregator, table schema.TableAlike,
+	lsn pgtypes.LSN, second int, device string, temperature any,
+) {
+
+	accepted, err := aggregator.Add(table, lsn, rawValues(second, device, temperature), values(device, temperature))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, accepted)
+}
+
+func rawValues(
+	second int, device string, temperature any,
+) map[string]any {
+
+	return map[string]any{
+		"ts":          baseTime.Add(time.Duration(second) * time.Second),
+		"device":      device,
+		"temperature": temperature,
+	}
+}
+
+func values(
+	device string, temperature any,
+) map[string]any {
+
+	return map[string]any{
+		"device":      device,
+		"temperature": temperature,
+	}
+}
+
+func makeAggregator(
+	t *testing.T, aggregateConfig config.AggregateConfig,
+) *Aggregator {
+
+	return makeAggregatorWithConfig(t, makeConfig(aggregateConfig))
+}
+
+func makeAggregatorWithConfig(
+	t *testing.T, c *config.Config,
+) *Aggregator {
+
+	namingStrategy, err := namingstrategyimpl.NewNamingStrategy("debezium", &config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aggregator, err := NewAggregatorFromConfig(c, schema.NewNameGenerator("foobar", namingStrategy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aggregator
+}
+
+func makeConfig(
+	aggregateConfig config.AggregateConfig,
+) *config.Config {
+
+	return &config.Config{
+		Sink: config.SinkConfig{
+			Aggregates: []config.AggregateConfig{aggregateConfig},
+		},
+	}
+}
+
+func makeMetrics() *systemcatalog.Hypertable {
+	hypertable := systemcatalog.NewHypertable(
+		1, "public", "metrics", "_timescaledb_internal", "_hyper_1", nil, 0, nil, nil, pgtypes.DEFAULT,
+	)
+	hypertable.ApplyTableSchema([]systemcatalog.Column{
+		systemcatalog.NewIndexColumn(
+			"ts", 1184, -1, timestampType, false, false, nil, nil, false, nil,
+			systemcatalog.ASC, systemcatalog.NULLS_LAST, true, true, lo.ToPtr("time"), lo.ToPtr(1), nil,
+		),
+		systemcatalog.NewColumn("device", 25, -1, textType, false, nil),
+		systemcatalog.NewColumn("temperature", 701, -1, float64Type, true, nil),
+	})
+	return hypertable
+}
+
+var (
+	timestampType = &testPgType{oid: 1184, schemaType: schema.STRING}
+	textType      = &testPgType{oid: 25, schemaType: schema.STRING}
+	float64Type   = &testPgType{oid: 701, schemaType: schema.FLOAT64}
+)
+
+type testPgType struct {
+	pgtypes.PgType
+	oid        uint32
+	schemaType schema.Type
+}
+
+func (t *testPgType) Oid() uint32 {
+	return t.oid
+}
+
+func (t *testPgType) SchemaType() schema.Type {
+	return t.schemaType
+}
+
+func (t *testPgType) SchemaBuilder() schema.Builder {
+	return schema.NewSchemaBuilder(t.schemaType)
+}
@@ -0,0 +1,113 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aggregating
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"slices"
+)
+
+// protectedColumns selects the columns which are encrypted, masked, or
+// dropped from the events of their table. Aggregates are emitted without
+// passing the transform chain, hence these columns must not be aggregated.
+type protectedColumns struct {
+	encrypted  *tablefiltering.ColumnFilter
+	transforms []protectingTransform
+}
+
+type protectingTransform struct {
+	transformType config.TransformType
+	tableFilter   *tablefiltering.TableFilter
+	fields        []string
+}
+
+func newProtectedColumns(
+	c *config.Config,
+) (*protectedColumns, error) {
+
+	columns := config.GetOrDefault(c, config.PropertySinkEncryptionColumns, []string{})
+
+	var encrypted *tablefiltering.ColumnFilter
+	if len(columns) > 0 {
+		columnFilter, err := tablefiltering.NewColumnFilter([]string{}, columns)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		encrypted = columnFilter
+	}
+
+	transforms := make([]protectingTransform, 0)
+	for _, transformConfig := range c.Sink.Transforms {
+		if transformConfig.Type != config.MaskTransform && transformConfig.Type != config.DropTransform {
+			continue
+		}
+
+		var tableFilter *tablefiltering.TableFilter
+		if transformConfig.Tables != nil {
+			var err error
+			tableFilter, err = tablefiltering.NewTableFilter(
+				transformConfig.Tables.Excludes, transformConfig.Tables.Includes,
+				len(transformConfig.Tables.Includes) == 0,
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		transforms = append(transforms, protectingTransform{
+			transformType: transformConfig.Type,
+			tableFilter:   tableFilter,
+			fields:        transformConfig.Fields,
+		})
+	}
+
+	return &protectedColumns{
+		encrypted:  encrypted,
+		transforms: transforms,
+	}, nil
+}
+
+// check returns an error if any of the given columns of the table
+// is encrypted, masked, or dropped
+func (p *protectedColumns) check(
+	table schema.TableAlike, columns []string,
+) error {
+
+	for _, column := range columns {
+		if p.encrypted != nil && p.encrypted.Matches(table, column) {
+			return errors.Errorf(
+				"column '%s' of table %s is encrypted and can't be aggregated", column, table.CanonicalName(),
+			)
+		}
+		for _, transform := range p.transforms {
+			if transform.tableFilter != nil && !transform.tableFilter.Enabled(table) {
+				continue
+			}
+			if slices.Contains(transform.fields, column) {
+				return errors.Errorf(
+					"column '%s' of table %s is affected by a %s transform and can't be aggregated",
+					column, table.CanonicalName(), transform.transformType,
+				)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"os"
+	"strings"
+)
+
+const (
+	// Algorithm is the name of the encryption algorithm,
+	// as added to the schema of encrypted fields
+	Algorithm = "AES-GCM"
+
+	// FrameVersion is the version of the ciphertext framing, the
+	// first byte of every value encrypted by the keyring
+	FrameVersion byte = 1
+
+	// DefaultKeyEnv is the environment variable the keys are
+	// read from, if the env key source doesn't define one
+	DefaultKeyEnv = "TIMESCALEDB_EVENT_STREAMER_ENCRYPTION_KEYS"
+)
+
+// Keyring holds the keys used to encrypt and decrypt values,
+// identified by their key id. New values are always encrypted
+// with the active key, while all keys can be used to decrypt.
+type Keyring struct {
+	activeKeyId string
+	ciphers     map[string]cipher.AEAD
+	nonceKeys   map[string][]byte
+}
+
+// NewKeyringFromConfig reads the keys from the configured key source.
+// Key files contain a JSON object of key ids to base64 encoded keys,
+// environment variables a comma separated list of keyid:base64key
+// pairs. Keys must be 16, 24, or 32 bytes long (AES-128, AES-192,
+// or AES-256).
+func NewKeyringFromConfig(
+	c *config.Config,
+) (*Keyring, error) {
+
+	source := config.GetOrDefault(c, config.PropertySinkEncryptionKeySource, config.FileEncryptionKeySource)
+	activeKeyId := config.GetOrDefault(c, config.PropertySinkEncryptionKeyActive, "")
+
+	var encodedKeys map[string]string
+	switch source {
+	case config.FileEncryptionKeySource:
+		keyFile := config.GetOrDefault(c, config.PropertySinkEncryptionKeyFile, "")
+		if keyFile == "" {
+			return nil, errors.Errorf("encryption key file not configured")
+		}
+		content, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		if err := json.Unmarshal(content, &encodedKeys); err != nil {
+			return nil, errors.Errorf("failed parsing encryption key file '%s': %s", keyFile, err)
+		}
+	case config.EnvEncryptionKeySource:
+		keyEnv := config.GetOrDefault(c, config.PropertySinkEncryptionKeyEnv, DefaultKeyEnv)
+		encodedKeys = make(map[string]string)
+		for _, pair := range strings.Split(os.Getenv(keyEnv), ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			keyId, encodedKey, found := strings.Cut(pair, ":")
+			if !found {
+				return nil, errors.Errorf("illegal encryption key definition in '%s', expected keyid:key", keyEnv)
+			}
+			encodedKeys[keyId] = encodedKey
+		}
+	default:
+		return nil, errors.Errorf("illegal encryption key source: %s", source)
+	}
+
+	keys := make(map[string][]byte, len(encodedKeys))
+	for keyId, encodedKey := range encodedKeys {
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return nil, errors.Errorf("failed decoding encryption key '%s': %s", keyId, err)
+		}
+		keys[keyId] = key
+	}
+	return NewKeyring(activeKeyId, keys)
+}
+
+// NewKeyring creates a keyring from the given keys. If no active
+// key id is given, the keyring must contain exactly one key.
+func NewKeyring(
+	activeKeyId string, keys map[string][]byte,
+) (*Keyring, error) {
+
+	if len(keys) == 0 {
+		return nil, errors.Errorf("no encryption keys defined")
+	}
+
+	if activeKeyId == "" {
+		if len(keys) > 1 {
+			return nil, errors.Errorf("active encryption key id required with multiple keys")
+		}
+		for keyId := range keys {
+			activeKeyId = keyId
+		}
+	}
+
+	ciphers := make(map[string]cipher.AEAD, len(keys))
+	nonceKeys := make(map[string][]byte, len(keys))
+	for keyId, key := range keys {
+		if len(keyId) == 0 || len(keyId) > 255 {
+			return nil, errors.Errorf("illegal encryption key id '%s', must be 1 to 255 bytes long", keyId)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.Errorf("illegal encryption key '%s': %s", keyId, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		ciphers[keyId] = aead
+		nonceKeys[keyId] = hmacSha256(key, []byte("deterministic-nonce"))
+	}
+
+	if _, present := ciphers[activeKeyId]; !present {
+		return nil, errors.Errorf("active encryption key '%s' doesn't exist", activeKeyId)
+	}
+
+	return &Keyring{
+		activeKeyId: activeKeyId,
+		ciphers:     ciphers,
+		nonceKeys:   nonceKeys,
+	}, nil
+}
+
+// ActiveKeyId returns the id of the key new values are encrypted with
+func (k *Keyring) ActiveKeyId() string {
+	return k.activeKeyId
+}
+
+// Encrypt encrypts the plaintext with the active key and a random
+// nonce. The associated data is authenticated but not encrypted.
+// The result is framed as described by frame.
+func (k *Keyring) Encrypt(
+	plaintext, associatedData []byte,
+) ([]byte, error) {
+
+	nonce := make([]byte, k.ciphers[k.activeKeyId].NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return k.frame(nonce, plaintext, associatedData), nil
+}
+
+// EncryptDeterministic encrypts the plaintext with the active key and
+// a synthetic nonce, derived from the associated data and the plaintext,
+// so that equal values always result in equal ciphertexts (for the same
+// key). This leaks the equality of values, but keeps values usable as
+// keys, e.g. for partitioning. Since different plaintexts result in
+// different nonces, nonces are never reused for different plaintexts.
+func (k *Keyring) EncryptDeterministic(
+	plaintext, associatedData []byte,
+) ([]byte, error) {
+
+	mac := hmac.New(sha256.New, k.nonceKeys[k.activeKeyId])
+	mac.Write(binary.BigEndian.AppendUint32(nil, uint32(len(associatedData))))
+	mac.Write(associatedData)
+	mac.Write(plaintext)
+	nonce := mac.Sum(nil)[:k.ciphers[k.activeKeyId].NonceSize()]
+	return k.frame(nonce, plaintext, associatedData), nil
+}
+
+// frame seals the plaintext with the active key. The result is the
+// frame version, the length of the key id (one byte), the key id, the
+// nonce, and the sealed ciphertext, so that values can be decrypted
+// without any further metadata.
+func (k *Keyring) frame(
+	nonce, plaintext, associatedData []byte,
+) []byte {
+
+	aead := k.ciphers[k.activeKeyId]
+	frame := make([]byte, 0, 2+len(k.activeKeyId)+len(nonce)+len(plaintext)+aead.Overhead())
+	frame = append(frame, FrameVersion, byte(len(k.activeKeyId)))
+	frame = append(frame, k.activeKeyId...)
+	frame = append(frame, nonce...)
+	return aead.Seal(frame, nonce, plaintext, associatedData)
+}
+
+// Decrypt decrypts a value previously encrypted by a keyring, using
+// the key referenced by the ciphertext, and verifies the associated data.
+func (k *Keyring) Decrypt(
+	ciphertext, associatedData []byte,
+) ([]byte, error) {
+
+	keyId, remaining, err := KeyIdOf(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	aead, present := k.ciphers[keyId]
+	if !present {
+		return nil, errors.Errorf("encryption key '%s' doesn't exist", keyId)
+	}
+	if len(remaining) < aead.NonceSize() {
+		return nil, errors.Errorf("ciphertext too short")
+	}
+	nonce, sealed := remaining[:aead.NonceSize()], remaining[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, associatedData)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return plaintext, nil
+}
+
+// KeyIdOf returns the id of the key the value was encrypted with,
+// and the remainder of the ciphertext (nonce and sealed ciphertext)
+func KeyIdOf(
+	ciphertext []byte,
+) (string, []byte, error) {
+
+	if len(ciphertext) < 2 {
+		return "", nil, errors.Errorf("ciphertext too short")
+	}
+	if ciphertext[0] != FrameVersion {
+		return "", nil, errors.Errorf("unsupported ciphertext frame version %d", ciphertext[0])
+	}
+	keyIdLength := int(ciphertext[1])
+	if len(ciphertext) < 2+keyIdLength {
+		return "", nil, errors.Errorf("ciphertext too short")
+	}
+	return string(ciphertext[2 : 2+keyIdLength]), ciphertext[2+keyIdLength:], nil
+}
+
+func hmacSha256(
+	key, data []byte,
+) []byte {
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,217 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package encryption
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	key1 = []byte("0123456789abcdef")
+	key2 = []byte("0123456789abcdef0123456789abcdef")
+)
+
+func Test_Keyring_Rotation(
+	t *testing.T,
+) {
+
+	oldKeyring, err := NewKeyring("", map[string][]byte{"k1": key1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "k1", oldKeyring.ActiveKeyId())
+
+	ciphertext, err := oldKeyring.Encrypt([]byte("secret"), []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After rotation, values encrypted with the old key are still readable
+	keyring, err := NewKeyring("k2", map[string][]byte{"k1": key1, "k2": key2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := keyring.Decrypt(ciphertext, []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "secret", string(plaintext))
+
+	ciphertext, err = keyring.Encrypt([]byte("secret"), []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyId, _, err := KeyIdOf(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "k2", keyId)
+	plaintext, err = keyring.Decrypt(ciphertext, []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "secret", string(plaintext))
+}
+
+func Test_Keyring_Deterministic(
+	t *testing.T,
+) {
+
+	keyring, err := NewKeyring("k1", map[string][]byte{"k1": key1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext1, err := keyring.EncryptDeterministic([]byte("secret"), []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext2, err := keyring.EncryptDeterministic([]byte("secret"), []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ciphertext1, ciphertext2)
+
+	// Different plaintexts or associated data result in different nonces
+	other, err := keyring.EncryptDeterministic([]byte("other"), []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, ciphertext1[:2+len("k1")+12], other[:2+len("k1")+12])
+	other, err = keyring.EncryptDeterministic([]byte("secret"), []byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, ciphertext1, other)
+
+	// Randomized encryption never results in equal ciphertexts
+	randomized, err := keyring.Encrypt([]byte("secret"), []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, ciphertext1, randomized)
+
+	plaintext, err := keyring.Decrypt(ciphertext1, []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "secret", string(plaintext))
+}
+
+func Test_Keyring_Errors(
+	t *testing.T,
+) {
+
+	_, err := NewKeyring("", map[string][]byte{})
+	assert.ErrorContains(t, err, "no encryption keys defined")
+
+	_, err = NewKeyring("", map[string][]byte{"k1": key1, "k2": key2})
+	assert.ErrorContains(t, err, "active encryption key id required")
+
+	_, err = NewKeyring("k3", map[string][]byte{"k1": key1})
+	assert.ErrorContains(t, err, "active encryption key 'k3' doesn't exist")
+
+	keyring, err := NewKeyring("k1", map[string][]byte{"k1": key1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := keyring.Encrypt([]byte("secret"), []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = keyring.Decrypt(append([]byte{2}, ciphertext[1:]...), []byte("ad"))
+	assert.ErrorContains(t, err, "unsupported ciphertext frame version 2")
+
+	_, err = keyring.Decrypt(ciphertext[:4], []byte("ad"))
+	assert.ErrorContains(t, err, "ciphertext too short")
+
+	_, err = NewKeyring("k1", map[string][]byte{"k1": []byte("short")})
+	assert.ErrorContains(t, err, "illegal encryption key 'k1'")
+}
+
+func Test_Keyring_File_Source(
+	t *testing.T,
+) {
+
+	keyFile := filepath.Join(t.TempDir(), "keys.json")
+	content := fmt.Sprintf(`{"k1": "%s", "k2": "%s"}`,
+		base64.StdEncoding.EncodeToString(key1), base64.StdEncoding.EncodeToString(key2),
+	)
+	if err := os.WriteFile(keyFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := NewKeyringFromConfig(&config.Config{
+		Sink: config.SinkConfig{
+			Encryption: config.SinkEncryptionConfig{
+				Key: config.EncryptionKeyConfig{
+					Source: config.FileEncryptionKeySource,
+					File:   keyFile,
+					Active: "k2",
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "k2", keyring.ActiveKeyId())
+}
+
+func Test_Keyring_Env_Source(
+	t *testing.T,
+) {
+
+	t.Setenv("TEST_ENCRYPTION_KEYS", fmt.Sprintf("k1:%s, k2:%s",
+		base64.StdEncoding.EncodeToString(key1), base64.StdEncoding.EncodeToString(key2),
+	))
+
+	keyring, err := NewKeyringFromConfig(&config.Config{
+		Sink: config.SinkConfig{
+			Encryption: config.SinkEncryptionConfig{
+				Key: config.EncryptionKeyConfig{
+					Source: config.EnvEncryptionKeySource,
+					Env:    "TEST_ENCRYPTION_KEYS",
+					Active: "k1",
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "k1", keyring.ActiveKeyId())
+
+	t.Setenv("TEST_ENCRYPTION_KEYS", "invalid")
+	_, err = NewKeyringFromConfig(&config.Config{
+		Sink: config.SinkConfig{
+			Encryption: config.SinkEncryptionConfig{
+				Key: config.EncryptionKeyConfig{
+					Source: config.EnvEncryptionKeySource,
+					Env:    "TEST_ENCRYPTION_KEYS",
+				},
+			},
+		},
+	})
+	assert.ErrorContains(t, err, "expected keyid:key")
+}
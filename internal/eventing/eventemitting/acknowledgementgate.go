@@ -0,0 +1,97 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventemitting
+
+import (
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
+	"sync"
+)
+
+type lowWatermarkFn func() (lsn pgtypes.LSN, open bool)
+
+// acknowledgementGate holds back acknowledgements of positions at or
+// beyond the low watermark, the lowest LSN of rows still buffered in
+// open aggregation windows. Held acknowledgements are passed on, in
+// order, as soon as the windows buffering earlier rows are flushed.
+type acknowledgementGate struct {
+	replicationcontext.ReplicationContext
+	lowWatermark lowWatermarkFn
+
+	mutex            sync.Mutex
+	acknowledgements []pendingAcknowledgement
+}
+
+func newAcknowledgementGate(
+	replicationContext replicationcontext.ReplicationContext, lowWatermark lowWatermarkFn,
+) *acknowledgementGate {
+
+	return &acknowledgementGate{
+		ReplicationContext: replicationContext,
+		lowWatermark:       lowWatermark,
+		acknowledgements:   make([]pendingAcknowledgement, 0),
+	}
+}
+
+func (g *acknowledgementGate) AcknowledgeProcessed(
+	xld pgtypes.XLogData, processedLSN *pgtypes.LSN,
+) error {
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.acknowledgements = append(g.acknowledgements, pendingAcknowledgement{xld, processedLSN})
+	return g.release0()
+}
+
+// release passes on all held acknowledgements below the current low watermark
+func (g *acknowledgementGate) release() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.release0()
+}
+
+func (g *acknowledgementGate) release0() error {
+	lowWatermark, open := g.lowWatermark()
+	for len(g.acknowledgements) > 0 {
+		acknowledgement := g.acknowledgements[0]
+		if open && acknowledgedLSN(acknowledgement) > lowWatermark {
+			return nil
+		}
+
+		if err := g.ReplicationContext.AcknowledgeProcessed(
+			acknowledgement.xld, acknowledgement.processedLSN,
+		); err != nil {
+			return err
+		}
+		g.acknowledgements = g.acknowledgements[1:]
+	}
+	return nil
+}
+
+func acknowledgedLSN(
+	acknowledgement pendingAcknowledgement,
+) pgtypes.LSN {
+
+	if acknowledgement.processedLSN != nil {
+		return *acknowledgement.processedLSN
+	}
+	xld := acknowledgement.xld
+	return pgtypes.LSN(xld.WALStart + pglogrepl.LSN(len(xld.WALData)))
+}
@@ -0,0 +1,62 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventemitting
+
+import (
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_AcknowledgementGate_Holds_Back_Open_Windows(
+	t *testing.T,
+) {
+
+	replicationContext := &ackRecordingReplicationContext{}
+	lowWatermark, open := pgtypes.LSN(150), true
+	gate := newAcknowledgementGate(replicationContext, func() (pgtypes.LSN, bool) {
+		return lowWatermark, open
+	})
+
+	// Positions below the low watermark pass the gate
+	assert.NoError(t, gate.AcknowledgeProcessed(walXLogData(100), nil))
+	assert.Equal(t, []pgtypes.LSN{100}, replicationContext.acknowledged())
+
+	processedLSN := pgtypes.LSN(300)
+	assert.NoError(t, gate.AcknowledgeProcessed(walXLogData(200), nil))
+	assert.NoError(t, gate.AcknowledgeProcessed(walXLogData(300), &processedLSN))
+	assert.Equal(t, []pgtypes.LSN{100}, replicationContext.acknowledged())
+
+	lowWatermark = 250
+	assert.NoError(t, gate.release())
+	assert.Equal(t, []pgtypes.LSN{100, 200}, replicationContext.acknowledged())
+
+	open = false
+	assert.NoError(t, gate.release())
+	assert.Equal(t, []pgtypes.LSN{100, 200, 300}, replicationContext.acknowledged())
+}
+
+func walXLogData(
+	lsn uint64,
+) pgtypes.XLogData {
+
+	xld := *testXLogData(lsn)
+	xld.WALStart = pglogrepl.LSN(lsn)
+	return xld
+}
@@ -0,0 +1,188 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventemitting
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"sync"
+	"time"
+)
+
+type batchFlushFn func(
+	records []sink.Record,
+) error
+
+// batchScheduleFn runs the given function on the replication goroutine
+type batchScheduleFn func(
+	fn func(),
+) error
+
+type pendingAcknowledgement struct {
+	xld          pgtypes.XLogData
+	processedLSN *pgtypes.LSN
+}
+
+// emissionBatcher collects events and hands them over to the sink as a
+// single batch, either when the transaction ends, the maximum batch size
+// is reached, or the timeout since the first collected event elapsed.
+// Acknowledgements are held back until the batch was emitted successfully.
+// Timed flushes are scheduled on the replication goroutine, since the sink
+// and the replication context aren't safe to be used concurrently.
+type emissionBatcher struct {
+	replicationContext replicationcontext.ReplicationContext
+	flushFn            batchFlushFn
+	scheduleFn         batchScheduleFn
+	maxSize            int
+	timeout            time.Duration
+	logger             *logging.Logger
+
+	mutex            sync.Mutex
+	stopped          bool
+	timer            *time.Timer
+	records          []sink.Record
+	acknowledgements []pendingAcknowledgement
+}
+
+func newEmissionBatcher(
+	replicationContext replicationcontext.ReplicationContext,
+	flushFn batchFlushFn, scheduleFn batchScheduleFn, maxSize int, timeout time.Duration,
+) (*emissionBatcher, error) {
+
+	logger, err := logging.NewLogger("EmissionBatcher")
+	if err != nil {
+		return nil, err
+	}
+
+	return &emissionBatcher{
+		replicationContext: replicationContext,
+		flushFn:            flushFn,
+		scheduleFn:         scheduleFn,
+		maxSize:            maxSize,
+		timeout:            timeout,
+		logger:             logger,
+		records:            make([]sink.Record, 0, maxSize),
+		acknowledgements:   make([]pendingAcknowledgement, 0),
+	}, nil
+}
+
+// add collects the record. If xld is given, the position is acknowledged
+// after the batch containing the record was emitted.
+func (b *emissionBatcher) add(
+	record sink.Record, xld *pgtypes.XLogData,
+) error {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.records = append(b.records, record)
+	if xld != nil {
+		b.acknowledgements = append(b.acknowledgements, pendingAcknowledgement{xld: *xld})
+	}
+
+	if len(b.records) >= b.maxSize {
+		return b.flush0()
+	}
+
+	if b.timer == nil && !b.stopped {
+		b.timer = time.AfterFunc(b.timeout, b.scheduleFlush)
+	}
+	return nil
+}
+
+// acknowledge marks the given position as processed as soon as
+// all previously collected records are emitted
+func (b *emissionBatcher) acknowledge(
+	xld pgtypes.XLogData, processedLSN *pgtypes.LSN,
+) error {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.records) == 0 && len(b.acknowledgements) == 0 {
+		return b.replicationContext.AcknowledgeProcessed(xld, processedLSN)
+	}
+
+	b.acknowledgements = append(b.acknowledgements, pendingAcknowledgement{xld, processedLSN})
+	return nil
+}
+
+func (b *emissionBatcher) flush() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.flush0()
+}
+
+// stop emits the remaining records and disables the timed flush
+func (b *emissionBatcher) stop() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stopped = true
+	return b.flush0()
+}
+
+// scheduleFlush is called by the timer and hands the
+// flush over to the replication goroutine
+func (b *emissionBatcher) scheduleFlush() {
+	if err := b.scheduleFn(b.timedFlush); err != nil {
+		b.logger.Warnf("Failed to schedule timed batch flush: %+v", err)
+	}
+}
+
+func (b *emissionBatcher) timedFlush() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.timer = nil
+	if err := b.flush0(); err != nil {
+		b.logger.Errorf("Failed to emit batch, retrying later: %+v", err)
+		if !b.stopped {
+			b.timer = time.AfterFunc(b.timeout, b.scheduleFlush)
+		}
+	}
+}
+
+func (b *emissionBatcher) flush0() error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	if len(b.records) > 0 {
+		// Failed batches stay pending and are retried with the next flush
+		if err := b.flushFn(b.records); err != nil {
+			return err
+		}
+		b.records = make([]sink.Record, 0, b.maxSize)
+	}
+
+	for i, acknowledgement := range b.acknowledgements {
+		if err := b.replicationContext.AcknowledgeProcessed(
+			acknowledgement.xld, acknowledgement.processedLSN,
+		); err != nil {
+			// The failed acknowledgement is retried with the next flush
+			b.acknowledgements = b.acknowledgements[i:]
+			return err
+		}
+	}
+	b.acknowledgements = b.acknowledgements[:0]
+	return nil
+}
@@ -0,0 +1,163 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventemitting
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_EmissionBatcher_Flush_On_MaxSize(
+	t *testing.T,
+) {
+
+	replicationContext := &ackRecordingReplicationContext{}
+	batches := make([][]sink.Record, 0)
+	batcher, err := newEmissionBatcher(replicationContext, func(records []sink.Record) error {
+		batches = append(batches, records)
+		return nil
+	}, runScheduled, 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, batcher.add(sink.Record{TopicName: "a"}, testXLogData(100)))
+	assert.Empty(t, batches)
+	assert.Empty(t, replicationContext.acknowledged())
+
+	assert.NoError(t, batcher.add(sink.Record{TopicName: "b"}, testXLogData(200)))
+	assert.Len(t, batches, 1)
+	assert.Len(t, batches[0], 2)
+	assert.Equal(t, []pgtypes.LSN{100, 200}, replicationContext.acknowledged())
+}
+
+func Test_EmissionBatcher_Failed_Batch_Stays_Pending(
+	t *testing.T,
+) {
+
+	replicationContext := &ackRecordingReplicationContext{}
+	fail := true
+	batches := make([][]sink.Record, 0)
+	batcher, err := newEmissionBatcher(replicationContext, func(records []sink.Record) error {
+		if fail {
+			return errors.Errorf("sink unavailable")
+		}
+		batches = append(batches, records)
+		return nil
+	}, runScheduled, 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, batcher.add(sink.Record{TopicName: "a"}, testXLogData(100)))
+	assert.NoError(t, batcher.acknowledge(*testXLogData(150), nil))
+	assert.Error(t, batcher.flush())
+	assert.Empty(t, replicationContext.acknowledged())
+
+	fail = false
+	assert.NoError(t, batcher.flush())
+	assert.Len(t, batches, 1)
+	assert.Equal(t, []pgtypes.LSN{100, 150}, replicationContext.acknowledged())
+
+	// Without pending records, acknowledgements pass through directly
+	assert.NoError(t, batcher.acknowledge(*testXLogData(300), nil))
+	assert.Equal(t, []pgtypes.LSN{100, 150, 300}, replicationContext.acknowledged())
+}
+
+func Test_EmissionBatcher_Flush_On_Timeout(
+	t *testing.T,
+) {
+
+	replicationContext := &ackRecordingReplicationContext{}
+	scheduled := make(chan func(), 1)
+	flushed := make([][]sink.Record, 0)
+	batcher, err := newEmissionBatcher(replicationContext, func(records []sink.Record) error {
+		flushed = append(flushed, records)
+		return nil
+	}, func(fn func()) error {
+		scheduled <- fn
+		return nil
+	}, 10, time.Millisecond*10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, batcher.add(sink.Record{TopicName: "a"}, testXLogData(100)))
+
+	// The timer only schedules the flush, it's executed by the replication goroutine
+	select {
+	case fn := <-scheduled:
+		assert.Empty(t, flushed)
+		fn()
+		assert.Len(t, flushed, 1)
+		assert.Len(t, flushed[0], 1)
+	case <-time.After(time.Second):
+		t.Fatal("batch flush wasn't scheduled after timeout")
+	}
+	assert.NoError(t, batcher.stop())
+	assert.Equal(t, []pgtypes.LSN{100}, replicationContext.acknowledged())
+}
+
+func Test_EmissionBatcher_Failed_Acknowledgement_Stays_Pending(
+	t *testing.T,
+) {
+
+	replicationContext := &failingAckReplicationContext{failures: 1}
+	batcher, err := newEmissionBatcher(replicationContext, func(records []sink.Record) error {
+		return nil
+	}, runScheduled, 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, batcher.add(sink.Record{TopicName: "a"}, testXLogData(100)))
+	assert.NoError(t, batcher.add(sink.Record{TopicName: "b"}, testXLogData(200)))
+	assert.Error(t, batcher.flush())
+	assert.Empty(t, replicationContext.acknowledged())
+
+	assert.NoError(t, batcher.flush())
+	assert.Equal(t, []pgtypes.LSN{100, 200}, replicationContext.acknowledged())
+}
+
+func runScheduled(
+	fn func(),
+) error {
+
+	fn()
+	return nil
+}
+
+type failingAckReplicationContext struct {
+	ackRecordingReplicationContext
+	failures int
+}
+
+func (f *failingAckReplicationContext) AcknowledgeProcessed(
+	xld pgtypes.XLogData, processedLSN *pgtypes.LSN,
+) error {
+
+	if f.failures > 0 {
+		f.failures--
+		return errors.Errorf("state storage unavailable")
+	}
+	return f.ackRecordingReplicationContext.AcknowledgeProcessed(xld, processedLSN)
+}
@@ -0,0 +1,240 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventemitting
+
+import (
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/stream"
+	"sync"
+)
+
+// inflightEvent is an asynchronously emitted event, or an acknowledgement
+// marker (without stream), waiting for its completion
+type inflightEvent struct {
+	xld          *pgtypes.XLogData
+	processedLSN *pgtypes.LSN
+	stream       stream.Stream
+	key          schema.Struct
+	value        schema.Struct
+	future       sink.Future
+}
+
+// emissionPipeline keeps track of asynchronously emitted events in the
+// order of their emission. Events are completed in order, which means the
+// processed LSN is only ever advanced to the lowest contiguous position of
+// completed events. If an event fails, no new events are admitted and the
+// failed event, as well as all events emitted after it, are re-emitted
+// synchronously in their original order to retain the per-key ordering at
+// the sink. If the re-emission fails as well, the pipeline is stopped and
+// the processed LSN never advances past the failed event.
+type emissionPipeline struct {
+	replicationContext replicationcontext.ReplicationContext
+	backOff            backoff.BackOff
+	logger             *logging.Logger
+
+	mutex    sync.Mutex
+	closed   bool
+	err      error
+	inflight chan *inflightEvent
+	done     chan struct{}
+}
+
+func newEmissionPipeline(
+	replicationContext replicationcontext.ReplicationContext, maxInflight uint,
+) (*emissionPipeline, error) {
+
+	logger, err := logging.NewLogger("EmissionPipeline")
+	if err != nil {
+		return nil, err
+	}
+
+	return &emissionPipeline{
+		replicationContext: replicationContext,
+		backOff:            backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 8),
+		logger:             logger,
+		inflight:           make(chan *inflightEvent, maxInflight),
+		done:               make(chan struct{}),
+	}, nil
+}
+
+func (p *emissionPipeline) start() {
+	go p.completionLoop()
+}
+
+// stop waits for all inflight events to be completed
+func (p *emissionPipeline) stop() {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.inflight)
+	p.mutex.Unlock()
+
+	<-p.done
+}
+
+// enqueue emits the event, if it isn't completed already, and adds it to
+// the pipeline. If the maximum number of inflight events is reached, the
+// call blocks until the oldest event is completed. After the pipeline
+// failed, the failure is returned for all further events.
+func (p *emissionPipeline) enqueue(
+	event *inflightEvent,
+) error {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	if p.closed {
+		return errors.Errorf("emission pipeline already stopped")
+	}
+	if event.future == nil {
+		event.future = event.stream.EmitAsync(event.key, event.value)
+	}
+	p.inflight <- event
+	return nil
+}
+
+func (p *emissionPipeline) completionLoop() {
+	defer close(p.done)
+
+	for event := range p.inflight {
+		<-event.future.Done()
+
+		if err := event.future.Err(); err != nil {
+			if !p.recover(event, err) {
+				p.logger.Warnf("Emission pipeline stopped with pending events, last processed LSN isn't advanced")
+				return
+			}
+			continue
+		}
+		p.acknowledge(event)
+	}
+}
+
+// recover re-emits the failed event and all events emitted after it in
+// their original order. No new events are admitted while recovering. It
+// returns false if the events couldn't be re-emitted, in which case the
+// pipeline is failed.
+func (p *emissionPipeline) recover(
+	failed *inflightEvent, cause error,
+) bool {
+
+	pending := p.pause()
+	defer p.mutex.Unlock()
+
+	events := append([]*inflightEvent{failed}, pending...)
+	for _, event := range events {
+		<-event.future.Done()
+	}
+
+	// Same as with synchronous emission, rejected events fail the emission.
+	// Events routed to a dead-letter sink are completed successfully instead.
+	if sink.IsNonRetryable(cause) {
+		p.logger.Errorf("Event rejected by the sink: %s", cause)
+		p.err = errors.Wrap(cause, 0)
+		return false
+	}
+
+	p.logger.Warnf("Asynchronous emission failed, re-emitting %d events: %s", len(events), cause)
+	for _, event := range events {
+		if event.stream != nil {
+			if err := p.reemit(event); err != nil {
+				p.logger.Errorf("Emission failed after retries: %s", err)
+				p.err = errors.Wrap(err, 0)
+				return false
+			}
+		}
+		p.acknowledge(event)
+	}
+	return true
+}
+
+// pause stops admitting new events and returns all events enqueued
+// after the currently failed one. The caller has to unlock the mutex
+// to resume admitting events.
+func (p *emissionPipeline) pause() []*inflightEvent {
+	locked := make(chan struct{})
+	go func() {
+		p.mutex.Lock()
+		close(locked)
+	}()
+
+	// Enqueuing may be blocked on a full pipeline, hence inflight events
+	// are collected while waiting for the lock
+	pending := make([]*inflightEvent, 0)
+	inflight := p.inflight
+	for {
+		select {
+		case <-locked:
+			for {
+				select {
+				case event, ok := <-p.inflight:
+					if !ok {
+						return pending
+					}
+					pending = append(pending, event)
+				default:
+					return pending
+				}
+			}
+		case event, ok := <-inflight:
+			if !ok {
+				inflight = nil
+				continue
+			}
+			pending = append(pending, event)
+		}
+	}
+}
+
+// reemit emits the event synchronously, retrying it the same way as
+// synchronously emitted events
+func (p *emissionPipeline) reemit(
+	event *inflightEvent,
+) error {
+
+	operation := func() error {
+		return permanentIfNonRetryable(event.stream.Emit(event.key, event.value))
+	}
+
+	return backoff.Retry(operation, p.backOff)
+}
+
+func (p *emissionPipeline) acknowledge(
+	event *inflightEvent,
+) {
+
+	if event.xld == nil {
+		return
+	}
+
+	if err := p.replicationContext.AcknowledgeProcessed(*event.xld, event.processedLSN); err != nil {
+		p.logger.Errorf("Failed to acknowledge processed LSN: %+v", err)
+	}
+}
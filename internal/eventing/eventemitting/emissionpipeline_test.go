@@ -0,0 +1,230 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventemitting
+
+import (
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/stream"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_EmissionPipeline_Acknowledges_In_Order(
+	t *testing.T,
+) {
+
+	replicationContext := &ackRecordingReplicationContext{}
+	pipeline, err := newEmissionPipeline(replicationContext, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline.start()
+
+	futures := make([]*sink.CompletableFuture, 0)
+	for i := 1; i <= 3; i++ {
+		future := sink.NewCompletableFuture()
+		futures = append(futures, future)
+		assert.NoError(t, pipeline.enqueue(&inflightEvent{
+			xld:    testXLogData(uint64(i * 100)),
+			future: future,
+		}))
+	}
+
+	// Completing out of order must not advance the watermark
+	futures[2].Complete(nil)
+	futures[1].Complete(nil)
+	time.Sleep(time.Millisecond * 50)
+	assert.Empty(t, replicationContext.acknowledged())
+
+	futures[0].Complete(nil)
+	pipeline.stop()
+
+	assert.Equal(t, []pgtypes.LSN{100, 200, 300}, replicationContext.acknowledged())
+}
+
+func Test_EmissionPipeline_Skips_Transactional_Events(
+	t *testing.T,
+) {
+
+	replicationContext := &ackRecordingReplicationContext{}
+	pipeline, err := newEmissionPipeline(replicationContext, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline.start()
+
+	assert.NoError(t, pipeline.enqueue(&inflightEvent{future: sink.CompletedFuture(nil)}))
+	assert.NoError(t, pipeline.enqueue(&inflightEvent{
+		xld:    testXLogData(100),
+		future: sink.CompletedFuture(nil),
+	}))
+	pipeline.stop()
+
+	assert.Equal(t, []pgtypes.LSN{100}, replicationContext.acknowledged())
+	assert.Error(t, pipeline.enqueue(&inflightEvent{future: sink.CompletedFuture(nil)}))
+}
+
+func Test_EmissionPipeline_Reemits_In_Order_After_Failure(
+	t *testing.T,
+) {
+
+	replicationContext := &ackRecordingReplicationContext{}
+	pipeline, err := newEmissionPipeline(replicationContext, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline.start()
+
+	emitted := &emitRecordingStream{}
+	failed := sink.NewCompletableFuture()
+	for i := 1; i <= 3; i++ {
+		future := sink.CompletedFuture(nil)
+		if i == 1 {
+			future = failed
+		}
+		assert.NoError(t, pipeline.enqueue(&inflightEvent{
+			xld:    testXLogData(uint64(i * 100)),
+			stream: emitted,
+			value:  schema.Struct{"id": i},
+			future: future,
+		}))
+	}
+
+	failed.Complete(errors.Errorf("sink unavailable"))
+	pipeline.stop()
+
+	// Later events already succeeded, but are emitted again after the failed one
+	assert.Equal(t, []any{1, 2, 3}, emitted.emittedIds())
+	assert.Equal(t, []pgtypes.LSN{100, 200, 300}, replicationContext.acknowledged())
+}
+
+func Test_EmissionPipeline_Fails_After_Retries(
+	t *testing.T,
+) {
+
+	replicationContext := &ackRecordingReplicationContext{}
+	pipeline, err := newEmissionPipeline(replicationContext, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline.backOff = backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 2)
+	pipeline.start()
+
+	emitted := &emitRecordingStream{err: errors.Errorf("sink unavailable")}
+	assert.NoError(t, pipeline.enqueue(&inflightEvent{
+		xld:    testXLogData(100),
+		stream: emitted,
+		value:  schema.Struct{"id": 1},
+		future: sink.CompletedFuture(errors.Errorf("sink unavailable")),
+	}))
+	pipeline.stop()
+
+	assert.Equal(t, []any{1, 1, 1}, emitted.emittedIds())
+	assert.Empty(t, replicationContext.acknowledged())
+	assert.Error(t, pipeline.err)
+}
+
+func Test_EmissionPipeline_Fails_On_Rejected_Event(
+	t *testing.T,
+) {
+
+	replicationContext := &ackRecordingReplicationContext{}
+	pipeline, err := newEmissionPipeline(replicationContext, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline.start()
+
+	emitted := &emitRecordingStream{}
+	assert.NoError(t, pipeline.enqueue(&inflightEvent{
+		xld:    testXLogData(100),
+		stream: emitted,
+		value:  schema.Struct{"id": 1},
+		future: sink.CompletedFuture(sink.NonRetryable(errors.Errorf("message too large"))),
+	}))
+	pipeline.stop()
+
+	// Rejected events are neither retried nor acknowledged
+	assert.Empty(t, emitted.emittedIds())
+	assert.Empty(t, replicationContext.acknowledged())
+	assert.Error(t, pipeline.err)
+}
+
+func testXLogData(
+	lsn uint64,
+) *pgtypes.XLogData {
+
+	return &pgtypes.XLogData{
+		XLogData: pglogrepl.XLogData{
+			ServerWALEnd: pglogrepl.LSN(lsn),
+		},
+	}
+}
+
+type ackRecordingReplicationContext struct {
+	replicationcontext.ReplicationContext
+	mutex sync.Mutex
+	lsns  []pgtypes.LSN
+}
+
+func (r *ackRecordingReplicationContext) AcknowledgeProcessed(
+	xld pgtypes.XLogData, _ *pgtypes.LSN,
+) error {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.lsns = append(r.lsns, pgtypes.LSN(xld.ServerWALEnd))
+	return nil
+}
+
+func (r *ackRecordingReplicationContext) acknowledged() []pgtypes.LSN {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.lsns
+}
+
+type emitRecordingStream struct {
+	stream.Stream
+	mutex sync.Mutex
+	err   error
+	ids   []any
+}
+
+func (e *emitRecordingStream) Emit(
+	_, envelope schema.Struct,
+) error {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.ids = append(e.ids, envelope["id"])
+	return e.err
+}
+
+func (e *emitRecordingStream) emittedIds() []any {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.ids
+}
@@ -23,7 +23,10 @@ import (
 	"github.com/cenkalti/backoff/v4"
 	"github.com/go-errors/errors"
 	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/aggregating"
 	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/eventfiltering"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/outbox"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/transforming"
 	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
 	"github.com/noctarius/timescaledb-event-streamer/internal/stats"
 	"github.com/noctarius/timescaledb-event-streamer/spi/config"
@@ -31,6 +34,8 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
 	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sidechannel"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
 	"github.com/noctarius/timescaledb-event-streamer/spi/stream"
 	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
 	"github.com/noctarius/timescaledb-event-streamer/spi/task"
@@ -58,15 +63,31 @@ func (ees *eventEmitterStats) reset() {
 	ees.calls.count = 0
 }
 
+type aggregationStats struct {
+	dropped uint64 `metric:"dropped" type:"counter"`
+}
+
 type EventEmitter struct {
-	replicationContext replicationcontext.ReplicationContext
-	filter             eventfiltering.EventFilter
-	typeManager        pgtypes.TypeManager
-	taskManager        task.TaskManager
-	streamManager      stream.Manager
-	statsReporter      *stats.Reporter
-	backOff            backoff.BackOff
-	logger             *logging.Logger
+	replicationContext  replicationcontext.ReplicationContext
+	filter              eventfiltering.EventFilter
+	transforms          transforming.TransformChain
+	outboxRouter        *outbox.Router
+	aggregator          *aggregating.Aggregator
+	acknowledgementGate *acknowledgementGate
+	watermarkClock      *watermarkClock
+	watermarkTicker     *time.Ticker
+	watermarkDone       chan struct{}
+	aggregationReporter *stats.Reporter
+	typeManager         pgtypes.TypeManager
+	taskManager         task.TaskManager
+	streamManager       stream.Manager
+	statsReporter       *stats.Reporter
+	backOff             backoff.BackOff
+	logger              *logging.Logger
+
+	transactionMetadata bool
+	pipeline            *emissionPipeline
+	batcher             *emissionBatcher
 
 	stats *eventEmitterStats
 }
@@ -74,7 +95,8 @@ type EventEmitter struct {
 func NewEventEmitterFromConfig(
 	c *config.Config, replicationContext replicationcontext.ReplicationContext,
 	streamManager stream.Manager, typeManager pgtypes.TypeManager,
-	taskManager task.TaskManager, statsService *stats.Service,
+	taskManager task.TaskManager, statsService *stats.Service, sideChannel sidechannel.SideChannel,
+	nameGenerator schema.NameGenerator,
 ) (*EventEmitter, error) {
 
 	filters, err := eventfiltering.NewEventFilter(c.Sink.Filters)
@@ -82,13 +104,66 @@ func NewEventEmitterFromConfig(
 		return nil, err
 	}
 
-	return NewEventEmitter(replicationContext, streamManager, typeManager, taskManager, statsService, filters)
+	transforms, err := transforming.NewTransformChainFromConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	outboxRouter, err := outbox.NewRouterFromConfig(c, sideChannel, statsService)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregator, err := aggregating.NewAggregatorFromConfig(c, nameGenerator)
+	if err != nil {
+		return nil, err
+	}
+
+	transactionMetadata := config.GetOrDefault(c, config.PropertySinkTransactionMetadata, false)
+
+	eventEmitter, err := NewEventEmitter(
+		replicationContext, streamManager, typeManager, taskManager,
+		statsService, filters, transforms, outboxRouter, aggregator, transactionMetadata,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	asyncEnabled := config.GetOrDefault(c, config.PropertySinkAsyncEnabled, false)
+	batchEnabled := config.GetOrDefault(c, config.PropertySinkBatchEnabled, false)
+	if asyncEnabled && batchEnabled {
+		return nil, errors.Errorf("sink.async.enabled and sink.batch.enabled can't be used together")
+	}
+
+	// Outbox rows may only be deleted after their events are known to be emitted
+	if outboxRouter != nil && outboxRouter.DeleteEnabled() && (asyncEnabled || batchEnabled) {
+		return nil, errors.Errorf(
+			"sink.outbox.delete can't be used together with sink.async.enabled or sink.batch.enabled",
+		)
+	}
+
+	if batchEnabled {
+		maxSize := config.GetOrDefault(c, config.PropertySinkBatchMaxSize, uint(1000))
+		timeout := config.GetOrDefault(c, config.PropertySinkBatchTimeout, 1000)
+		if err := eventEmitter.enableBatchEmission(maxSize, time.Millisecond*time.Duration(timeout)); err != nil {
+			return nil, err
+		}
+	}
+
+	if asyncEnabled {
+		maxInflight := config.GetOrDefault(c, config.PropertySinkAsyncMaxInflight, uint(10000))
+		if err := eventEmitter.enableAsyncEmission(maxInflight); err != nil {
+			return nil, err
+		}
+	}
+	return eventEmitter, nil
 }
 
 func NewEventEmitter(
 	replicationContext replicationcontext.ReplicationContext, streamManager stream.Manager,
 	typeManager pgtypes.TypeManager, taskManager task.TaskManager, statsService *stats.Service,
-	filter eventfiltering.EventFilter,
+	filter eventfiltering.EventFilter, transforms transforming.TransformChain,
+	outboxRouter *outbox.Router, aggregator *aggregating.Aggregator, transactionMetadata bool,
 ) (*EventEmitter, error) {
 
 	logger, err := logging.NewLogger("EventEmitter")
@@ -96,16 +171,34 @@ func NewEventEmitter(
 		return nil, err
 	}
 
+	// Acknowledgements of rows buffered in aggregation windows are held back
+	// until the windows are flushed, all emission modes acknowledge through the gate
+	var gate *acknowledgementGate
+	var clock *watermarkClock
+	if aggregator != nil {
+		gate = newAcknowledgementGate(replicationContext, aggregator.LowWatermark)
+		clock = newWatermarkClock(time.Now)
+		replicationContext = gate
+	}
+
 	return &EventEmitter{
-		replicationContext: replicationContext,
-		typeManager:        typeManager,
-		taskManager:        taskManager,
-		streamManager:      streamManager,
-		filter:             filter,
-		logger:             logger,
-		statsReporter:      statsService.NewReporter("streamer_eventemitter"),
-		backOff:            backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 8),
-		stats:              &eventEmitterStats{},
+		replicationContext:  replicationContext,
+		typeManager:         typeManager,
+		taskManager:         taskManager,
+		streamManager:       streamManager,
+		filter:              filter,
+		transforms:          transforms,
+		outboxRouter:        outboxRouter,
+		aggregator:          aggregator,
+		acknowledgementGate: gate,
+		watermarkClock:      clock,
+		logger:              logger,
+		statsReporter:       statsService.NewReporter("streamer_eventemitter"),
+		aggregationReporter: statsService.NewReporter("streamer_eventemitter_aggregates"),
+		backOff:             backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 8),
+		stats:               &eventEmitterStats{},
+
+		transactionMetadata: transactionMetadata,
 	}, nil
 }
 
@@ -115,10 +208,35 @@ func (ee *EventEmitter) PostConstruct() error {
 }
 
 func (ee *EventEmitter) Start() error {
+	if ee.pipeline != nil {
+		ee.pipeline.start()
+	}
+	if ee.outboxRouter != nil {
+		ee.outboxRouter.Start()
+	}
+	if ee.aggregator != nil {
+		ee.startWatermarkTicker()
+	}
 	return ee.streamManager.Start()
 }
 
 func (ee *EventEmitter) Stop() error {
+	if ee.watermarkTicker != nil {
+		ee.watermarkTicker.Stop()
+		close(ee.watermarkDone)
+	}
+	// Drain inflight events before the sinks are shut down
+	if ee.pipeline != nil {
+		ee.pipeline.stop()
+	}
+	if ee.batcher != nil {
+		if err := ee.batcher.stop(); err != nil {
+			ee.logger.Errorf("Failed to emit the final batch: %+v", err)
+		}
+	}
+	if ee.outboxRouter != nil {
+		ee.outboxRouter.Stop()
+	}
 	return ee.streamManager.Stop()
 }
 
@@ -133,10 +251,124 @@ func (ee *EventEmitter) NewEventHandler() eventhandlers.BaseReplicationEventHand
 	}
 }
 
+// enableAsyncEmission switches the emitter to asynchronous emission,
+// keeping up to maxInflight events pending at the sink at any time.
+func (ee *EventEmitter) enableAsyncEmission(
+	maxInflight uint,
+) error {
+
+	if maxInflight == 0 {
+		return errors.Errorf("sink.async.maxinflight must be greater than 0")
+	}
+
+	pipeline, err := newEmissionPipeline(ee.replicationContext, maxInflight)
+	if err != nil {
+		return err
+	}
+	ee.pipeline = pipeline
+	return nil
+}
+
+// enableBatchEmission switches the emitter to batched emission, collecting
+// events until the transaction ends, maxSize events are collected, or the
+// timeout since the first collected event elapsed.
+func (ee *EventEmitter) enableBatchEmission(
+	maxSize uint, timeout time.Duration,
+) error {
+
+	if maxSize == 0 {
+		return errors.Errorf("sink.batch.maxsize must be greater than 0")
+	}
+	if timeout <= 0 {
+		return errors.Errorf("sink.batch.timeout must be greater than 0")
+	}
+
+	// Timed flushes run as tasks, serialized with the replication events
+	scheduleFn := func(fn func()) error {
+		return ee.taskManager.EnqueueTask(func(_ task.Notificator) {
+			fn()
+		})
+	}
+
+	batcher, err := newEmissionBatcher(ee.replicationContext, ee.publishBatch, scheduleFn, int(maxSize), timeout)
+	if err != nil {
+		return err
+	}
+	ee.batcher = batcher
+	return nil
+}
+
 func (ee *EventEmitter) emit(
 	xld pgtypes.XLogData, stream stream.Stream, key, value schema.Struct,
 ) error {
 
+	if ee.batcher != nil {
+		return ee.batcher.add(stream.Record(key, value), &xld)
+	}
+
+	if ee.pipeline != nil {
+		return ee.emitAsync(&xld, stream, key, value)
+	}
+
+	if err := ee.publish(stream, key, value); err != nil {
+		return err
+	}
+	return ee.replicationContext.AcknowledgeProcessed(xld, nil)
+}
+
+// emitTransactional emits an event which isn't acknowledged on its own
+func (ee *EventEmitter) emitTransactional(
+	stream stream.Stream, key, value schema.Struct,
+) error {
+
+	if ee.batcher != nil {
+		return ee.batcher.add(stream.Record(key, value), nil)
+	}
+
+	if ee.pipeline != nil {
+		return ee.emitAsync(nil, stream, key, value)
+	}
+	return ee.publish(stream, key, value)
+}
+
+// acknowledge marks the given position as processed. With asynchronous
+// or batched emission, the acknowledgement is deferred until all previously
+// emitted events are completed.
+func (ee *EventEmitter) acknowledge(
+	xld pgtypes.XLogData, processedLSN *pgtypes.LSN,
+) error {
+
+	if ee.batcher != nil {
+		return ee.batcher.acknowledge(xld, processedLSN)
+	}
+
+	if ee.pipeline != nil {
+		return ee.pipeline.enqueue(&inflightEvent{
+			xld:          &xld,
+			processedLSN: processedLSN,
+			future:       sink.CompletedFuture(nil),
+		})
+	}
+	return ee.replicationContext.AcknowledgeProcessed(xld, processedLSN)
+}
+
+func (ee *EventEmitter) emitAsync(
+	xld *pgtypes.XLogData, stream stream.Stream, key, value schema.Struct,
+) error {
+
+	ee.logger.Tracef("Publishing event asynchronously: %+v", value)
+	return ee.pipeline.enqueue(&inflightEvent{
+		xld:    xld,
+		stream: stream,
+		key:    key,
+		value:  value,
+	})
+}
+
+func (ee *EventEmitter) publish(
+	stream stream.Stream, key, value schema.Struct,
+) error {
+
 	// Start time
 	start := time.Now()
 	retries := uint(0)
@@ -144,7 +376,7 @@ func (ee *EventEmitter) emit(
 	// Retryable operation
 	operation := func() error {
 		ee.logger.Tracef("Publishing event: %+v", value)
-		return stream.Emit(key, value)
+		return permanentIfNonRetryable(stream.Emit(key, value))
 	}
 
 	// Run with backoff (it'll automatically reset before starting)
@@ -160,12 +392,133 @@ func (ee *EventEmitter) emit(
 	ee.stats.calls.retry = retries
 	ee.statsReporter.Report(ee.stats)
 
-	return ee.replicationContext.AcknowledgeProcessed(xld, nil)
+	return nil
+}
+
+// flushAggregates advances the aggregation watermark and emits all closed
+// windows. Aggregates are published synchronously, so that acknowledgements
+// held back by the windows are only released after the aggregates are emitted.
+func (ee *EventEmitter) flushAggregates(
+	watermark time.Time,
+) error {
+
+	if ee.aggregator == nil {
+		return nil
+	}
+
+	for _, window := range ee.aggregator.Advance(watermark) {
+		selectedStream := ee.streamManager.GetOrCreateAggregateStream(
+			window.TopicName, window.KeySchema, window.ValueSchema,
+		)
+
+		key := schema.Envelope(selectedStream.KeySchema(), window.Key)
+		value := schema.Envelope(selectedStream.PayloadSchema(), window.Value)
+		if err := ee.publish(selectedStream, key, value); err != nil {
+			return err
+		}
+	}
+	ee.aggregator.Flushed()
+
+	return ee.acknowledgementGate.release()
+}
+
+// startWatermarkTicker regularly advances the aggregation watermark while
+// no transactions are replicated, to close the windows of idle databases.
+// The watermark is advanced on the replication loop, like on commits.
+func (ee *EventEmitter) startWatermarkTicker() {
+	ee.watermarkTicker = time.NewTicker(watermarkTickInterval)
+	ee.watermarkDone = make(chan struct{})
+	ticks, done := ee.watermarkTicker.C, ee.watermarkDone
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticks:
+			}
+			if err := ee.taskManager.EnqueueTask(func(_ task.Notificator) {
+				if watermark, idle := ee.watermarkClock.idleWatermark(); idle {
+					if err := ee.flushAggregates(watermark); err != nil {
+						ee.logger.Errorf("Failed to flush closed aggregation windows: %+v", err)
+					}
+				}
+			}); err != nil {
+				ee.logger.Warnf("Failed to schedule advancing the aggregation watermark: %+v", err)
+			}
+		}
+	}()
+}
+
+// droppedLateRow counts a row dropped, since its aggregation window was
+// closed already, i.e. the row arrived later than the allowed lateness
+func (ee *EventEmitter) droppedLateRow(
+	table schema.TableAlike,
+) {
+
+	ee.logger.Warnf(
+		"Dropped late row of %s, its aggregation window is already closed", table.CanonicalName(),
+	)
+	ee.aggregationReporter.Report(&aggregationStats{dropped: 1})
+}
+
+// aggregates returns true if inserts into the table are aggregated, and
+// if the inserted rows are still emitted as events of their own
+func (ee *EventEmitter) aggregates(
+	table schema.TableAlike,
+) (aggregated, rows bool) {
+
+	if ee.aggregator == nil {
+		return false, true
+	}
+	return ee.aggregator.Matches(table)
+}
+
+func (ee *EventEmitter) publishBatch(
+	records []sink.Record,
+) error {
+
+	// Start time
+	start := time.Now()
+	retries := uint(0)
+
+	// Retryable operation, the batch is only acknowledged if all records succeed
+	operation := func() error {
+		ee.logger.Tracef("Publishing batch of %d events", len(records))
+		return permanentIfNonRetryable(ee.streamManager.EmitBatch(records))
+	}
+
+	// Run with backoff (it'll automatically reset before starting)
+	if err := backoff.RetryNotify(operation, ee.backOff, func(_ error, _ time.Duration) {
+		retries++
+	}); err != nil {
+		return err
+	}
+
+	ee.stats.reset()
+	ee.stats.calls.count += uint64(len(records))
+	ee.stats.calls.time = time.Since(start)
+	ee.stats.calls.retry = retries
+	ee.statsReporter.Report(ee.stats)
+
+	return nil
+}
+
+// permanentIfNonRetryable stops retries for errors the sink
+// classified as non-retryable
+func permanentIfNonRetryable(
+	err error,
+) error {
+
+	if sink.IsNonRetryable(err) {
+		return backoff.Permanent(err)
+	}
+	return err
 }
 
 type eventEmitterEventHandler struct {
 	eventEmitter *EventEmitter
 	typeManager  pgtypes.TypeManager
+	transaction  *transactionContext
 }
 
 func (e *eventEmitterEventHandler) OnReadEvent(
@@ -173,6 +526,16 @@ func (e *eventEmitterEventHandler) OnReadEvent(
 	_ *systemcatalog.Chunk, newValues map[string]any,
 ) error {
 
+	// Snapshots of the outbox table aren't routed, only new inserts are
+	if e.isOutboxTable(table) {
+		return nil
+	}
+
+	// Snapshots aren't aggregated, only new inserts are
+	if aggregated, rows := e.eventEmitter.aggregates(table); aggregated && !rows {
+		return nil
+	}
+
 	cnValues, err := e.convertValues(table, newValues)
 	if err != nil {
 		return err
@@ -207,6 +570,23 @@ func (e *eventEmitterEventHandler) OnInsertEvent(
 		return err
 	}
 
+	if e.isOutboxTable(table) {
+		return e.emitOutboxEvent(xld, cnValues)
+	}
+
+	if aggregated, rows := e.eventEmitter.aggregates(table); aggregated {
+		accepted, err := e.eventEmitter.aggregator.Add(table, pgtypes.LSN(xld.WALStart), newValues, cnValues)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			e.eventEmitter.droppedLateRow(table)
+		}
+		if !rows {
+			return e.eventEmitter.acknowledge(xld, nil)
+		}
+	}
+
 	return e.emit(xld, table,
 		func(stream stream.Stream) (schema.Struct, error) {
 			return stream.Key(newValues)
@@ -222,6 +602,11 @@ func (e *eventEmitterEventHandler) OnUpdateEvent(
 	_ *systemcatalog.Chunk, oldValues, newValues map[string]any,
 ) error {
 
+	// Only inserts into the outbox table are routed as outbox events
+	if e.isOutboxTable(table) {
+		return e.eventEmitter.acknowledge(xld, nil)
+	}
+
 	coValues, err := e.convertValues(table, oldValues)
 	if err != nil {
 		return err
@@ -246,6 +631,11 @@ func (e *eventEmitterEventHandler) OnDeleteEvent(
 	_ *systemcatalog.Chunk, oldValues map[string]any, tombstone bool,
 ) error {
 
+	// Only inserts into the outbox table are routed as outbox events
+	if e.isOutboxTable(table) {
+		return e.eventEmitter.acknowledge(xld, nil)
+	}
+
 	coValues, err := e.convertValues(table, oldValues)
 	if err != nil {
 		return err
@@ -265,6 +655,11 @@ func (e *eventEmitterEventHandler) OnTruncateEvent(
 	xld pgtypes.XLogData, table schema.TableAlike,
 ) error {
 
+	// Only inserts into the outbox table are routed as outbox events
+	if e.isOutboxTable(table) {
+		return e.eventEmitter.acknowledge(xld, nil)
+	}
+
 	return e.emit(xld, table,
 		func(stream stream.Stream) (schema.Struct, error) {
 			return nil, nil
@@ -322,8 +717,15 @@ func (e *eventEmitterEventHandler) OnRelationEvent(
 }
 
 func (e *eventEmitterEventHandler) OnBeginEvent(
-	_ pgtypes.XLogData, _ *pgtypes.BeginMessage,
+	_ pgtypes.XLogData, msg *pgtypes.BeginMessage,
 ) error {
+
+	if e.eventEmitter.transactionMetadata {
+		e.transaction = newTransactionContext(msg.Xid, msg.FinalLSN, msg.CommitTime)
+	}
+	if e.eventEmitter.watermarkClock != nil {
+		e.eventEmitter.watermarkClock.begin()
+	}
 	return nil
 }
 
@@ -349,11 +751,43 @@ func (e *eventEmitterEventHandler) OnTransactionFinishedEvent(
 	xld pgtypes.XLogData, msg *pgtypes.CommitMessage,
 ) error {
 
+	if e.transaction != nil {
+		transaction := e.transaction
+		e.transaction = nil
+
+		// Transactions without any emitted event don't generate transaction metadata events
+		if transaction.begun {
+			if err := e.emitTransactionEvent(transaction.endEvent()); err != nil {
+				return err
+			}
+		}
+	}
+
+	// All outbox events of the transaction are emitted
+	if e.eventEmitter.outboxRouter != nil {
+		e.eventEmitter.outboxRouter.Commit()
+	}
+
 	e.eventEmitter.logger.Debugf(
 		"Transaction xid=%d (LSN: %s) marked as processed", xld.Xid, msg.TransactionEndLSN,
 	)
 	transactionEndLSN := pgtypes.LSN(msg.TransactionEndLSN)
-	return e.eventEmitter.replicationContext.AcknowledgeProcessed(xld, &transactionEndLSN)
+	if err := e.eventEmitter.acknowledge(xld, &transactionEndLSN); err != nil {
+		return err
+	}
+
+	// Batches are emitted at the end of the transaction at latest
+	if e.eventEmitter.batcher != nil {
+		if err := e.eventEmitter.batcher.flush(); err != nil {
+			return err
+		}
+	}
+
+	// The commit time is the watermark closing aggregation windows
+	if e.eventEmitter.watermarkClock == nil {
+		return nil
+	}
+	return e.eventEmitter.flushAggregates(e.eventEmitter.watermarkClock.commit(msg.CommitTime))
 }
 
 func (e *eventEmitterEventHandler) emit(
@@ -399,12 +833,46 @@ func (e *eventEmitterEventHandler) emit0(
 
 	// If unsuccessful we'll discard the event and not send it to the sink
 	if !success {
-		return e.eventEmitter.replicationContext.AcknowledgeProcessed(xld, nil)
+		return e.eventEmitter.acknowledge(xld, nil)
+	}
+
+	if !snapshot && e.transaction != nil && e.transaction.xid == xld.Xid {
+		// The BEGIN event is emitted lazily with the first event of the transaction
+		if !e.transaction.begun {
+			if err := e.emitTransactionEvent(e.transaction.beginEvent()); err != nil {
+				return err
+			}
+		}
+		payloadStruct[schema.FieldNameTransaction] = e.transaction.nextTransactionBlock(hypertable)
+	}
+
+	key, value, err = e.eventEmitter.transforms.Apply(hypertable, key, value)
+	if err != nil {
+		return err
 	}
 
 	return e.eventEmitter.emit(xld, selectedStream, key, value)
 }
 
+func (e *eventEmitterEventHandler) emitTransactionEvent(
+	event schema.Struct,
+) error {
+
+	selectedStream := e.eventEmitter.streamManager.GetOrCreateTransactionStream()
+
+	keyStruct, err := selectedStream.Key(event)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	key := schema.Envelope(selectedStream.KeySchema(), keyStruct)
+	value := schema.Envelope(selectedStream.PayloadSchema(), event)
+
+	// Transaction metadata events aren't acknowledged, the transaction
+	// is acknowledged as a whole when it is marked as processed
+	return e.eventEmitter.emitTransactional(selectedStream, key, value)
+}
+
 func (e *eventEmitterEventHandler) emitMessageEvent(
 	xld pgtypes.XLogData, msg *pgtypes.LogicalReplicationMessage, payloadFactory payloadFactoryFn,
 ) error {
@@ -446,6 +914,38 @@ func (e *eventEmitterEventHandler) emitMessageEvent(
 	return e.eventEmitter.emit(xld, selectedStream, key, value)
 }
 
+// emitOutboxEvent routes a row inserted into the outbox table to the
+// topic of its aggregate type. Filters and transforms aren't applied,
+// the payload is passed through as written by the application.
+func (e *eventEmitterEventHandler) emitOutboxEvent(
+	xld pgtypes.XLogData, values map[string]any,
+) error {
+
+	outboxRouter := e.eventEmitter.outboxRouter
+
+	event, err := outboxRouter.Route(values)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	selectedStream := e.eventEmitter.streamManager.GetOrCreateOutboxStream(event.TopicName)
+	if err := e.eventEmitter.emit(xld, selectedStream, event.Key, event.Value); err != nil {
+		return err
+	}
+
+	// The row is deleted in the background, together with
+	// the other outbox rows of the transaction once it finished
+	outboxRouter.Emitted(event)
+	return nil
+}
+
+func (e *eventEmitterEventHandler) isOutboxTable(
+	table schema.TableAlike,
+) bool {
+
+	return e.eventEmitter.outboxRouter != nil && e.eventEmitter.outboxRouter.Matches(table)
+}
+
 func (e *eventEmitterEventHandler) timescaleEventKey(
 	hypertable *systemcatalog.Hypertable,
 ) (schema.Struct, error) {
@@ -0,0 +1,82 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventemitting
+
+import (
+	"fmt"
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"time"
+)
+
+// transactionContext keeps track of the events emitted as part
+// of the currently replicated transaction to generate the
+// transaction metadata events and transaction blocks
+type transactionContext struct {
+	id               string
+	xid              uint32
+	lsn              pglogrepl.LSN
+	commitTime       time.Time
+	begun            bool
+	totalOrder       uint64
+	dataCollections  []string
+	collectionOrders map[string]uint64
+}
+
+func newTransactionContext(
+	xid uint32, lsn pglogrepl.LSN, commitTime time.Time,
+) *transactionContext {
+
+	return &transactionContext{
+		id:               schema.TransactionId(xid, lsn),
+		xid:              xid,
+		lsn:              lsn,
+		commitTime:       commitTime,
+		collectionOrders: make(map[string]uint64),
+	}
+}
+
+func (t *transactionContext) beginEvent() schema.Struct {
+	t.begun = true
+	return schema.BeginTransactionEvent(t.id, t.xid, t.lsn, t.commitTime)
+}
+
+func (t *transactionContext) endEvent() schema.Struct {
+	dataCollections := make([]schema.Struct, 0, len(t.dataCollections))
+	for _, dataCollection := range t.dataCollections {
+		dataCollections = append(
+			dataCollections,
+			schema.TransactionDataCollection(dataCollection, t.collectionOrders[dataCollection]),
+		)
+	}
+	return schema.EndTransactionEvent(t.id, t.xid, t.lsn, t.commitTime, t.totalOrder, dataCollections)
+}
+
+func (t *transactionContext) nextTransactionBlock(
+	table schema.TableAlike,
+) schema.Struct {
+
+	dataCollection := fmt.Sprintf("%s.%s", table.SchemaName(), table.TableName())
+	if _, present := t.collectionOrders[dataCollection]; !present {
+		t.dataCollections = append(t.dataCollections, dataCollection)
+	}
+
+	t.totalOrder++
+	t.collectionOrders[dataCollection]++
+	return schema.TransactionBlock(t.id, t.totalOrder, t.collectionOrders[dataCollection])
+}
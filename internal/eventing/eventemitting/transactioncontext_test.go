@@ -0,0 +1,90 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventemitting
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_TransactionContext_Orders(
+	t *testing.T,
+) {
+
+	commitTime := time.Now()
+	transaction := newTransactionContext(571, 53195832, commitTime)
+
+	begin := transaction.beginEvent()
+	assert.Equal(t, string(schema.TX_BEGIN), begin[schema.FieldNameStatus])
+	assert.Equal(t, "571:53195832", begin[schema.FieldNameId])
+	assert.True(t, transaction.begun)
+
+	metrics := testTable{schemaName: "public", tableName: "metrics"}
+	events := testTable{schemaName: "public", tableName: "events"}
+
+	block := transaction.nextTransactionBlock(metrics)
+	assert.Equal(t, uint64(1), block[schema.FieldNameTotalOrder])
+	assert.Equal(t, uint64(1), block[schema.FieldNameDataCollectionOrder])
+
+	block = transaction.nextTransactionBlock(events)
+	assert.Equal(t, uint64(2), block[schema.FieldNameTotalOrder])
+	assert.Equal(t, uint64(1), block[schema.FieldNameDataCollectionOrder])
+
+	block = transaction.nextTransactionBlock(metrics)
+	assert.Equal(t, uint64(3), block[schema.FieldNameTotalOrder])
+	assert.Equal(t, uint64(2), block[schema.FieldNameDataCollectionOrder])
+
+	end := transaction.endEvent()
+	assert.Equal(t, string(schema.TX_END), end[schema.FieldNameStatus])
+	assert.Equal(t, uint64(3), end[schema.FieldNameEventCount])
+	assert.Equal(t, []schema.Struct{
+		schema.TransactionDataCollection("public.metrics", 2),
+		schema.TransactionDataCollection("public.events", 1),
+	}, end[schema.FieldNameDataCollections])
+}
+
+type testTable struct {
+	schemaName string
+	tableName  string
+}
+
+func (t testTable) SchemaName() string {
+	return t.schemaName
+}
+
+func (t testTable) TableName() string {
+	return t.tableName
+}
+
+func (t testTable) CanonicalName() string {
+	return ""
+}
+
+func (t testTable) SchemaBuilder() schema.Builder {
+	return nil
+}
+
+func (t testTable) TableColumns() []schema.ColumnAlike {
+	return nil
+}
+
+func (t testTable) KeyIndexColumns() []schema.ColumnAlike {
+	return nil
+}
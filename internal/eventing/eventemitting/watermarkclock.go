@@ -0,0 +1,87 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventemitting
+
+import (
+	"sync"
+	"time"
+)
+
+// watermarkTickInterval is the interval in which the aggregation
+// watermark is advanced while no transactions are replicated
+const watermarkTickInterval = time.Second
+
+// watermarkClock tracks the aggregation watermark. The watermark is the
+// commit time of the last replicated transaction. While the database is
+// idle no commits arrive, hence the watermark is moved forward by the
+// wall-clock time passed since the last commit was received, so that
+// windows are closed (and held acknowledgements released) anyway.
+// While a transaction is replicated, the watermark isn't advanced,
+// since its rows may still belong into the open windows.
+type watermarkClock struct {
+	now func() time.Time
+
+	mutex         sync.Mutex
+	commitTime    time.Time
+	receivedAt    time.Time
+	inTransaction bool
+}
+
+func newWatermarkClock(
+	now func() time.Time,
+) *watermarkClock {
+
+	return &watermarkClock{
+		now: now,
+	}
+}
+
+// begin marks a transaction as being replicated
+func (c *watermarkClock) begin() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.inTransaction = true
+}
+
+// commit records the commit time of a finished transaction
+// and returns it as the new watermark
+func (c *watermarkClock) commit(
+	commitTime time.Time,
+) time.Time {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.inTransaction = false
+	c.commitTime = commitTime
+	c.receivedAt = c.now()
+	return commitTime
+}
+
+// idleWatermark returns the watermark extrapolated from the last
+// commit, or false if a transaction is being replicated or no
+// transaction was replicated yet
+func (c *watermarkClock) idleWatermark() (time.Time, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.inTransaction || c.receivedAt.IsZero() {
+		return time.Time{}, false
+	}
+	return c.commitTime.Add(c.now().Sub(c.receivedAt)), true
+}
@@ -0,0 +1,61 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventemitting
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_WatermarkClock_Idle_Watermark(
+	t *testing.T,
+) {
+
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := newWatermarkClock(func() time.Time {
+		return now
+	})
+
+	// Nothing to extrapolate from before the first commit
+	_, idle := clock.idleWatermark()
+	assert.False(t, idle)
+
+	// The commit time is the watermark, independent of the wall-clock time
+	commitTime := now.Add(-time.Minute)
+	clock.begin()
+	assert.Equal(t, commitTime, clock.commit(commitTime))
+
+	now = now.Add(time.Second * 10)
+	watermark, idle := clock.idleWatermark()
+	assert.True(t, idle)
+	assert.Equal(t, commitTime.Add(time.Second*10), watermark)
+
+	// While a transaction is replicated, the watermark isn't advanced
+	clock.begin()
+	now = now.Add(time.Second * 10)
+	_, idle = clock.idleWatermark()
+	assert.False(t, idle)
+
+	nextCommitTime := commitTime.Add(time.Second * 15)
+	assert.Equal(t, nextCommitTime, clock.commit(nextCommitTime))
+	now = now.Add(time.Second * 5)
+	watermark, idle = clock.idleWatermark()
+	assert.True(t, idle)
+	assert.Equal(t, nextCommitTime.Add(time.Second*5), watermark)
+}
@@ -0,0 +1,222 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package expressions
+
+import (
+	"fmt"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"math"
+	"reflect"
+)
+
+// Environment is the environment expressions are compiled against and
+// evaluated with. Since expressions are type checked against it, unknown
+// variables are reported when the expression is compiled.
+type Environment struct {
+	Key         schema.Struct `expr:"key"`
+	KeySchema   schema.Struct `expr:"keySchema"`
+	Value       schema.Struct `expr:"value"`
+	ValueSchema schema.Struct `expr:"valueSchema"`
+	Topic       string        `expr:"topic"`
+}
+
+// NewEnvironment creates the environment for the given
+// event, key and value are the envelopes of the event
+func NewEnvironment(
+	topicName string, key, value schema.Struct,
+) *Environment {
+
+	keyPayload, _ := key[schema.FieldNamePayload].(schema.Struct)
+	keySchema, _ := key[schema.FieldNameSchema].(schema.Struct)
+	valuePayload, _ := value[schema.FieldNamePayload].(schema.Struct)
+	valueSchema, _ := value[schema.FieldNameSchema].(schema.Struct)
+
+	return &Environment{
+		Key:         keyPayload,
+		KeySchema:   keySchema,
+		Value:       valuePayload,
+		ValueSchema: valueSchema,
+		Topic:       topicName,
+	}
+}
+
+// CompileError is returned if an expression can't be compiled
+type CompileError struct {
+	Expression string
+	Err        error
+}
+
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("failed to compile expression «%s»: %s", e.Expression, e.Err)
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
+
+// EvaluationError is returned if the evaluation of an expression
+// failed or the result doesn't match the expected type
+type EvaluationError struct {
+	Expression string
+	Err        error
+}
+
+func (e *EvaluationError) Error() string {
+	return fmt.Sprintf("failed to evaluate expression «%s»: %s", e.Expression, e.Err)
+}
+
+func (e *EvaluationError) Unwrap() error {
+	return e.Err
+}
+
+// Program is a compiled expression. Programs are safe
+// to be evaluated concurrently.
+type Program struct {
+	expression string
+	program    *vm.Program
+}
+
+func Compile(
+	expression string, options ...expr.Option,
+) (*Program, error) {
+
+	program, err := expr.Compile(expression, append([]expr.Option{expr.Env(Environment{})}, options...)...)
+	if err != nil {
+		return nil, &CompileError{Expression: expression, Err: err}
+	}
+
+	return &Program{
+		expression: expression,
+		program:    program,
+	}, nil
+}
+
+func (p *Program) Expression() string {
+	return p.expression
+}
+
+func (p *Program) Run(
+	env *Environment,
+) (any, error) {
+
+	result, err := expr.Run(p.program, env)
+	if err != nil {
+		return nil, &EvaluationError{Expression: p.expression, Err: err}
+	}
+	return result, nil
+}
+
+// CompileTyped compiles an expression which result is converted into the
+// representation of the given schema type. Supported types are int64,
+// float64, boolean, and string.
+func CompileTyped(
+	expression string, schemaType schema.Type,
+) (*TypedProgram, error) {
+
+	switch schemaType {
+	case schema.INT64, schema.FLOAT64, schema.BOOLEAN, schema.STRING:
+	default:
+		return nil, &CompileError{
+			Expression: expression,
+			Err:        errors.Errorf("unsupported result type: %s", schemaType),
+		}
+	}
+
+	program, err := Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedProgram{
+		Program:    program,
+		schemaType: schemaType,
+	}, nil
+}
+
+// TypedProgram is a compiled expression with a result type
+type TypedProgram struct {
+	*Program
+	schemaType schema.Type
+}
+
+func (tp *TypedProgram) SchemaType() schema.Type {
+	return tp.schemaType
+}
+
+// Run evaluates the expression and converts the result into the
+// representation of the schema type. Nil results are returned as nil,
+// any other result is converted to its text representation for string.
+func (tp *TypedProgram) Run(
+	env *Environment,
+) (any, error) {
+
+	result, err := tp.Program.Run(env)
+	if err != nil || result == nil {
+		return nil, err
+	}
+
+	converted, ok := convert(result, tp.schemaType)
+	if !ok {
+		return nil, &EvaluationError{
+			Expression: tp.expression,
+			Err:        errors.Errorf("result %v (%T) isn't convertible to %s", result, result, tp.schemaType),
+		}
+	}
+	return converted, nil
+}
+
+func convert(
+	value any, schemaType schema.Type,
+) (any, bool) {
+
+	switch schemaType {
+	case schema.STRING:
+		if v, ok := value.(string); ok {
+			return v, true
+		}
+		return fmt.Sprint(value), true
+	case schema.BOOLEAN:
+		v, ok := value.(bool)
+		return v, ok
+	}
+
+	v := reflect.ValueOf(value)
+	switch {
+	case v.CanInt():
+		if schemaType == schema.FLOAT64 {
+			return float64(v.Int()), true
+		}
+		return v.Int(), true
+	case v.CanUint():
+		if schemaType == schema.FLOAT64 {
+			return float64(v.Uint()), true
+		}
+		return int64(v.Uint()), true
+	case v.CanFloat():
+		if schemaType == schema.FLOAT64 {
+			return v.Float(), true
+		}
+		// Only integral floats are converted to int64
+		if f := v.Float(); f == math.Trunc(f) {
+			return int64(f), true
+		}
+	}
+	return nil, false
+}
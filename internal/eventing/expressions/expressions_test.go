@@ -0,0 +1,90 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package expressions
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Compile_Errors(
+	t *testing.T,
+) {
+
+	_, err := Compile("vaule.after.temperature * 1.8")
+	var compileError *CompileError
+	assert.True(t, errors.As(err, &compileError))
+	assert.Equal(t, "vaule.after.temperature * 1.8", compileError.Expression)
+	assert.ErrorContains(t, err, "unknown name vaule")
+
+	_, err = CompileTyped("value.after.temperature", schema.ARRAY)
+	assert.True(t, errors.As(err, &compileError))
+	assert.ErrorContains(t, err, "unsupported result type: array")
+}
+
+func Test_TypedProgram_Run(
+	t *testing.T,
+) {
+
+	env := NewEnvironment("test.public.metrics",
+		schema.Envelope(nil, schema.Struct{"id": 1}),
+		schema.Envelope(nil, schema.Struct{
+			schema.FieldNameAfter: schema.Struct{"temperature": 20, "tenant_id": 42, "name": "foo"},
+		}),
+	)
+
+	testCases := []struct {
+		expression string
+		schemaType schema.Type
+		expected   any
+	}{
+		{"value.after.temperature * 1.8 + 32", schema.FLOAT64, 68.0},
+		{"value.after.temperature * 2", schema.INT64, int64(40)},
+		{"value.after.temperature * 2.0", schema.INT64, int64(40)},
+		{"value.after.temperature > 10", schema.BOOLEAN, true},
+		{"value.after.tenant_id", schema.STRING, "42"},
+		{"topic + '.' + value.after.name", schema.STRING, "test.public.metrics.foo"},
+		{"key.id", schema.INT64, int64(1)},
+		{"value.after.unknown", schema.INT64, nil},
+		{"value.before?.name", schema.STRING, nil},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.expression, func(t *testing.T) {
+			program, err := CompileTyped(testCase.expression, testCase.schemaType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := program.Run(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testCase.expected, result)
+		})
+	}
+
+	program, err := CompileTyped("value.after.temperature / 3", schema.INT64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = program.Run(env)
+	var evaluationError *EvaluationError
+	assert.True(t, errors.As(err, &evaluationError))
+	assert.ErrorContains(t, err, "(float64) isn't convertible to int64")
+}
@@ -54,3 +54,10 @@ func (d *debeziumNamingStrategy) MessageTopicName(
 
 	return fmt.Sprintf("%s.message", topicPrefix)
 }
+
+func (d *debeziumNamingStrategy) TransactionTopicName(
+	topicPrefix string,
+) string {
+
+	return fmt.Sprintf("%s.transaction", topicPrefix)
+}
@@ -43,3 +43,14 @@ func TestDebeziumNamingStrategy_SchemaTopicName(
 	topicName := strategy.SchemaTopicName(topicPrefix, "schema", "hypertable")
 	assert.Equal(t, "foobar.schema.hypertable", topicName)
 }
+
+func TestDebeziumNamingStrategy_TransactionTopicName(
+	t *testing.T,
+) {
+
+	topicPrefix := "foobar"
+
+	strategy := debeziumNamingStrategy{}
+	topicName := strategy.TransactionTopicName(topicPrefix)
+	assert.Equal(t, "foobar.transaction", topicName)
+}
@@ -0,0 +1,179 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outbox
+
+import (
+	"github.com/cenkalti/backoff/v4"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/stats"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sidechannel"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"sync"
+)
+
+const (
+	// maxDeleteBatchSize is the maximum number of rows deleted
+	// by a single statement, far below the parameter limit
+	maxDeleteBatchSize = 1000
+
+	// maxQueuedDeleteBatches is the number of transactions queued
+	// for deletion before the replication loop is held back
+	maxQueuedDeleteBatches = 64
+)
+
+type deleterStats struct {
+	deleted uint64 `metric:"deleted" type:"counter"`
+	failed  uint64 `metric:"failed" type:"counter"`
+}
+
+func (ds *deleterStats) reset() {
+	ds.deleted = 0
+	ds.failed = 0
+}
+
+// deleter removes emitted outbox rows in the background. The ids of
+// the rows emitted by a transaction are deleted together, with a single
+// statement per batch, so that the replication loop never waits on the
+// database. Batches which still fail after retrying are logged and counted
+// as failed, their rows are left behind in the outbox table.
+type deleter struct {
+	sideChannel   sidechannel.SideChannel
+	entity        systemcatalog.SystemEntity
+	idColumn      string
+	backOff       backoff.BackOff
+	logger        *logging.Logger
+	statsReporter *stats.Reporter
+	stats         deleterStats
+
+	batches chan []any
+	mutex   sync.Mutex
+	started bool
+	stopped bool
+	done    chan struct{}
+}
+
+func newDeleter(
+	sideChannel sidechannel.SideChannel, entity systemcatalog.SystemEntity,
+	idColumn string, statsService *stats.Service,
+) (*deleter, error) {
+
+	logger, err := logging.NewLogger("OutboxDeleter")
+	if err != nil {
+		return nil, err
+	}
+
+	return &deleter{
+		sideChannel:   sideChannel,
+		entity:        entity,
+		idColumn:      idColumn,
+		backOff:       backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 8),
+		logger:        logger,
+		statsReporter: statsService.NewReporter("streamer_outbox"),
+		batches:       make(chan []any, maxQueuedDeleteBatches),
+		done:          make(chan struct{}),
+	}, nil
+}
+
+func (d *deleter) start() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.started {
+		return
+	}
+	d.started = true
+	go d.deleteLoop()
+}
+
+// stop deletes all queued batches before it returns
+func (d *deleter) stop() {
+	d.mutex.Lock()
+	if d.stopped {
+		d.mutex.Unlock()
+		return
+	}
+	d.stopped = true
+	started := d.started
+	close(d.batches)
+	d.mutex.Unlock()
+
+	if started {
+		<-d.done
+	}
+}
+
+// enqueue hands the ids of a transaction's emitted outbox rows to the
+// background worker. It only blocks if the worker falls behind by more
+// than maxQueuedDeleteBatches transactions.
+func (d *deleter) enqueue(
+	ids []any,
+) {
+
+	d.mutex.Lock()
+	stopped := d.stopped
+	d.mutex.Unlock()
+
+	if stopped {
+		d.logger.Warnf("Outbox deleter is stopped, %d emitted rows are left behind", len(ids))
+		d.report(0, uint64(len(ids)))
+		return
+	}
+	d.batches <- ids
+}
+
+func (d *deleter) deleteLoop() {
+	defer close(d.done)
+	for ids := range d.batches {
+		for len(ids) > 0 {
+			size := min(len(ids), maxDeleteBatchSize)
+			d.delete(ids[:size])
+			ids = ids[size:]
+		}
+	}
+}
+
+func (d *deleter) delete(
+	ids []any,
+) {
+
+	var deleted int64
+	err := backoff.Retry(func() (err error) {
+		deleted, err = d.sideChannel.DeleteRows(d.entity, d.idColumn, ids)
+		return err
+	}, d.backOff)
+
+	if err != nil {
+		d.logger.Errorf("Failed to delete %d emitted outbox rows: %+v", len(ids), err)
+		d.report(0, uint64(len(ids)))
+		return
+	}
+	d.report(uint64(deleted), 0)
+}
+
+func (d *deleter) report(
+	deleted, failed uint64,
+) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.stats.reset()
+	d.stats.deleted = deleted
+	d.stats.failed = failed
+	d.statsReporter.Report(&d.stats)
+}
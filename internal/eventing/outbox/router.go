@@ -0,0 +1,276 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/stats"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sidechannel"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"strings"
+)
+
+const (
+	defaultTopicPrefix         = "outbox."
+	defaultIdColumn            = "id"
+	defaultAggregateTypeColumn = "aggregatetype"
+	defaultAggregateIdColumn   = "aggregateid"
+	defaultTypeColumn          = "type"
+	defaultPayloadColumn       = "payload"
+)
+
+// Event is an outbox event, routed from a row inserted into
+// the outbox table.
+type Event struct {
+	TopicName string
+	Key       schema.Struct
+	Value     schema.Struct
+	rowId     any
+}
+
+// Router turns inserts into the configured outbox table into outbox
+// events. The aggregate type selects the topic, the aggregate id is
+// used as the event key, and the payload is passed through as is.
+type Router struct {
+	entity systemcatalog.SystemEntity
+
+	topicPrefix string
+	deleter     *deleter
+	emittedIds  []any
+
+	idColumn            string
+	aggregateTypeColumn string
+	aggregateIdColumn   string
+	typeColumn          string
+	payloadColumn       string
+}
+
+// NewRouterFromConfig creates the outbox router from the sink.outbox.*
+// configuration. It returns nil if no outbox table is configured.
+func NewRouterFromConfig(
+	c *config.Config, sideChannel sidechannel.SideChannel, statsService *stats.Service,
+) (*Router, error) {
+
+	table := config.GetOrDefault(c, config.PropertySinkOutboxTable, "")
+	if table == "" {
+		return nil, nil
+	}
+
+	schemaName, tableName, err := ParseTableName(table)
+	if err != nil {
+		return nil, err
+	}
+
+	entity := systemcatalog.NewSystemEntity(schemaName, tableName)
+	idColumn := config.GetOrDefault(c, config.PropertySinkOutboxColumnsId, defaultIdColumn)
+
+	var d *deleter
+	if config.GetOrDefault(c, config.PropertySinkOutboxDelete, false) {
+		if d, err = newDeleter(sideChannel, entity, idColumn, statsService); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Router{
+		entity: entity,
+
+		topicPrefix: config.GetOrDefault(c, config.PropertySinkOutboxTopicPrefix, defaultTopicPrefix),
+		deleter:     d,
+
+		idColumn: idColumn,
+		aggregateTypeColumn: config.GetOrDefault(
+			c, config.PropertySinkOutboxColumnsAggregateType, defaultAggregateTypeColumn,
+		),
+		aggregateIdColumn: config.GetOrDefault(
+			c, config.PropertySinkOutboxColumnsAggregateId, defaultAggregateIdColumn,
+		),
+		typeColumn: config.GetOrDefault(
+			c, config.PropertySinkOutboxColumnsType, defaultTypeColumn,
+		),
+		payloadColumn: config.GetOrDefault(
+			c, config.PropertySinkOutboxColumnsPayload, defaultPayloadColumn,
+		),
+	}, nil
+}
+
+// ParseTableName splits the configured outbox table into schema and
+// table name. Tables without a schema are expected in the public schema.
+func ParseTableName(
+	table string,
+) (schemaName, tableName string, err error) {
+
+	tokens := strings.Split(table, ".")
+	switch len(tokens) {
+	case 1:
+		schemaName, tableName = "public", tokens[0]
+	case 2:
+		schemaName, tableName = tokens[0], tokens[1]
+	default:
+		return "", "", errors.Errorf("illegal outbox table '%s', expected schema.table", table)
+	}
+
+	if schemaName == "" || tableName == "" {
+		return "", "", errors.Errorf("illegal outbox table '%s', expected schema.table", table)
+	}
+	return schemaName, tableName, nil
+}
+
+// DeleteEnabled returns true if outbox rows are deleted after
+// their events were emitted.
+func (r *Router) DeleteEnabled() bool {
+	return r.deleter != nil
+}
+
+// Start starts the background deletion of emitted outbox rows
+func (r *Router) Start() {
+	if r.deleter != nil {
+		r.deleter.start()
+	}
+}
+
+// Stop deletes the outbox rows of all committed transactions
+// and stops the background deletion
+func (r *Router) Stop() {
+	if r.deleter != nil {
+		r.deleter.stop()
+	}
+}
+
+// Matches returns true if the given table is the outbox table.
+func (r *Router) Matches(
+	table schema.TableAlike,
+) bool {
+
+	return table.SchemaName() == r.entity.SchemaName() && table.TableName() == r.entity.TableName()
+}
+
+// Route creates the outbox event for the given (converted) values of
+// a row inserted into the outbox table.
+func (r *Router) Route(
+	values map[string]any,
+) (*Event, error) {
+
+	aggregateType, err := r.requiredValue(values, r.aggregateTypeColumn)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregateId, err := r.requiredValue(values, r.aggregateIdColumn)
+	if err != nil {
+		return nil, err
+	}
+
+	eventType, err := r.requiredValue(values, r.typeColumn)
+	if err != nil {
+		return nil, err
+	}
+
+	var id *string
+	rowId := values[r.idColumn]
+	if rowId != nil {
+		v := fmt.Sprint(rowId)
+		id = &v
+	}
+
+	payload, err := passthroughPayload(values[r.payloadColumn])
+	if err != nil {
+		return nil, err
+	}
+
+	keySchema := schema.OutboxKeySchema()
+	valueSchema := schema.OutboxValueSchema()
+	return &Event{
+		TopicName: r.topicPrefix + aggregateType,
+		Key:       schema.Envelope(keySchema, schema.OutboxKey(aggregateId)),
+		Value:     schema.Envelope(valueSchema, schema.OutboxEvent(id, eventType, payload)),
+		rowId:     rowId,
+	}, nil
+}
+
+// Emitted marks the outbox row of the given event for deletion, after
+// the event was emitted. Rows are deleted when their transaction is
+// committed, see Commit.
+func (r *Router) Emitted(
+	event *Event,
+) {
+
+	if r.deleter == nil {
+		return
+	}
+
+	if event.rowId == nil {
+		r.deleter.logger.Errorf(
+			"Outbox row can't be deleted, column '%s' is not set", r.idColumn,
+		)
+		r.deleter.report(0, 1)
+		return
+	}
+	r.emittedIds = append(r.emittedIds, event.rowId)
+}
+
+// Commit hands the outbox rows emitted by the finished transaction
+// over to the background deletion.
+func (r *Router) Commit() {
+	if r.deleter == nil || len(r.emittedIds) == 0 {
+		return
+	}
+
+	ids := r.emittedIds
+	r.emittedIds = nil
+	r.deleter.enqueue(ids)
+}
+
+func (r *Router) requiredValue(
+	values map[string]any, column string,
+) (string, error) {
+
+	value := values[column]
+	if value == nil {
+		return "", errors.Errorf("outbox column '%s' is not set", column)
+	}
+	if v, ok := value.([]byte); ok {
+		return string(v), nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+func passthroughPayload(
+	payload any,
+) (*string, error) {
+
+	switch v := payload.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return &v, nil
+	case []byte:
+		s := string(v)
+		return &s, nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		s := string(data)
+		return &s, nil
+	}
+}
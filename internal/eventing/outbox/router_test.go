@@ -0,0 +1,296 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outbox
+
+import (
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/stats"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sidechannel"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_Outbox_Router_Not_Configured(
+	t *testing.T,
+) {
+
+	router, err := NewRouterFromConfig(&config.Config{}, nil, stats.NewStatsService(&config.Config{}))
+	assert.NoError(t, err)
+	assert.Nil(t, router)
+}
+
+func Test_Outbox_Router_Matches(
+	t *testing.T,
+) {
+
+	router := makeRouter(t, config.SinkOutboxConfig{Table: "orders.outbox"})
+
+	assert.True(t, router.Matches(systemcatalog.NewPgTable(1, "orders", "outbox", pgtypes.DEFAULT)))
+	assert.False(t, router.Matches(systemcatalog.NewPgTable(2, "public", "outbox", pgtypes.DEFAULT)))
+	assert.False(t, router.Matches(systemcatalog.NewPgTable(3, "orders", "orders", pgtypes.DEFAULT)))
+}
+
+func Test_Outbox_Router_Route(
+	t *testing.T,
+) {
+
+	router := makeRouter(t, config.SinkOutboxConfig{Table: "outbox"})
+
+	event, err := router.Route(map[string]any{
+		"id":            "2b5f4f0e-6c3c-4bd1-9dd4-8a6c2c0f1a44",
+		"aggregatetype": "Order",
+		"aggregateid":   int64(42),
+		"type":          "OrderCreated",
+		"payload":       `{"total":10}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "outbox.Order", event.TopicName)
+	assert.Equal(t, schema.OutboxKeySchema(), event.Key[schema.FieldNameSchema])
+	assert.Equal(t, schema.Struct{schema.FieldNameAggregateId: "42"}, event.Key[schema.FieldNamePayload])
+
+	payload := event.Value[schema.FieldNamePayload].(schema.Struct)
+	assert.Equal(t, "2b5f4f0e-6c3c-4bd1-9dd4-8a6c2c0f1a44", *payload[schema.FieldNameId].(*string))
+	assert.Equal(t, "OrderCreated", payload[schema.FieldNameType])
+	assert.Equal(t, `{"total":10}`, *payload[schema.FieldNamePayload].(*string))
+}
+
+func Test_Outbox_Router_Route_Custom_Columns(
+	t *testing.T,
+) {
+
+	router := makeRouter(t, config.SinkOutboxConfig{
+		Table: "public.events",
+		Columns: config.SinkOutboxColumnsConfig{
+			AggregateType: "aggregate_type",
+			AggregateId:   "aggregate_id",
+			Type:          "event_type",
+			Payload:       "event_payload",
+		},
+		TopicPrefix: "events.",
+	})
+
+	event, err := router.Route(map[string]any{
+		"aggregate_type": "Customer",
+		"aggregate_id":   []byte("c-1"),
+		"event_type":     "CustomerUpdated",
+		"event_payload":  map[string]any{"name": "foo"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "events.Customer", event.TopicName)
+	assert.Equal(t, schema.Struct{schema.FieldNameAggregateId: "c-1"}, event.Key[schema.FieldNamePayload])
+
+	payload := event.Value[schema.FieldNamePayload].(schema.Struct)
+	assert.Nil(t, payload[schema.FieldNameId])
+	assert.Equal(t, `{"name":"foo"}`, *payload[schema.FieldNamePayload].(*string))
+}
+
+func Test_Outbox_Router_Route_Missing_Aggregate_Type(
+	t *testing.T,
+) {
+
+	router := makeRouter(t, config.SinkOutboxConfig{Table: "outbox"})
+
+	_, err := router.Route(map[string]any{
+		"aggregateid": "1",
+		"type":        "OrderCreated",
+	})
+	assert.ErrorContains(t, err, "aggregatetype")
+}
+
+func Test_Outbox_Parse_Table_Name(
+	t *testing.T,
+) {
+
+	schemaName, tableName, err := ParseTableName("outbox")
+	assert.NoError(t, err)
+	assert.Equal(t, "public", schemaName)
+	assert.Equal(t, "outbox", tableName)
+
+	schemaName, tableName, err = ParseTableName("orders.outbox")
+	assert.NoError(t, err)
+	assert.Equal(t, "orders", schemaName)
+	assert.Equal(t, "outbox", tableName)
+
+	_, _, err = ParseTableName("a.b.c")
+	assert.Error(t, err)
+
+	_, _, err = ParseTableName(".outbox")
+	assert.Error(t, err)
+}
+
+func Test_Outbox_Router_Delete_Per_Transaction(
+	t *testing.T,
+) {
+
+	sideChannel := &deletingSideChannel{}
+	router := makeRouterWithSideChannel(t, config.SinkOutboxConfig{Table: "outbox", Delete: lo.ToPtr(true)}, sideChannel)
+	assert.True(t, router.DeleteEnabled())
+	router.Start()
+
+	for _, id := range []string{"1", "2"} {
+		event, err := router.Route(outboxValues(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		router.Emitted(event)
+	}
+
+	// Rows without id can't be deleted, they're counted as failed
+	event, err := router.Route(outboxValues(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.Emitted(event)
+
+	// Nothing is deleted before the transaction finished
+	assert.Empty(t, sideChannel.batches())
+
+	router.Commit()
+	event, err = router.Route(outboxValues("3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.Emitted(event)
+	router.Commit()
+
+	// Transactions without outbox events don't delete anything
+	router.Commit()
+
+	router.Stop()
+	assert.Equal(t, [][]any{{"1", "2"}, {"3"}}, sideChannel.batches())
+}
+
+func Test_Outbox_Router_Delete_Failure(
+	t *testing.T,
+) {
+
+	sideChannel := &deletingSideChannel{err: errors.Errorf("connection refused")}
+	router := makeRouterWithSideChannel(t, config.SinkOutboxConfig{Table: "outbox", Delete: lo.ToPtr(true)}, sideChannel)
+	router.deleter.backOff = &backoffStub{}
+	router.Start()
+
+	event, err := router.Route(outboxValues("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.Emitted(event)
+	router.Commit()
+	router.Stop()
+
+	// Failed deletes are retried, but never block the router
+	assert.Equal(t, 3, sideChannel.attempts)
+	assert.Equal(t, uint64(1), router.deleter.stats.failed)
+}
+
+func outboxValues(
+	id string,
+) map[string]any {
+
+	values := map[string]any{
+		"aggregatetype": "Order",
+		"aggregateid":   "42",
+		"type":          "OrderCreated",
+	}
+	if id != "" {
+		values["id"] = id
+	}
+	return values
+}
+
+type deletingSideChannel struct {
+	sidechannel.SideChannel
+	mutex    sync.Mutex
+	err      error
+	attempts int
+	deleted  [][]any
+}
+
+func (d *deletingSideChannel) DeleteRows(
+	_ systemcatalog.SystemEntity, _ string, values []any,
+) (int64, error) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.attempts++
+	if d.err != nil {
+		return 0, d.err
+	}
+	d.deleted = append(d.deleted, values)
+	return int64(len(values)), nil
+}
+
+func (d *deletingSideChannel) batches() [][]any {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.deleted
+}
+
+// backoffStub retries twice without waiting
+type backoffStub struct {
+	retries int
+}
+
+func (b *backoffStub) NextBackOff() time.Duration {
+	if b.retries == 2 {
+		return backoff.Stop
+	}
+	b.retries++
+	return 0
+}
+
+func (b *backoffStub) Reset() {
+	b.retries = 0
+}
+
+func makeRouter(
+	t *testing.T, outboxConfig config.SinkOutboxConfig,
+) *Router {
+
+	return makeRouterWithSideChannel(t, outboxConfig, nil)
+}
+
+func makeRouterWithSideChannel(
+	t *testing.T, outboxConfig config.SinkOutboxConfig, sideChannel sidechannel.SideChannel,
+) *Router {
+
+	c := &config.Config{
+		Sink: config.SinkConfig{
+			Outbox: outboxConfig,
+		},
+	}
+	router, err := NewRouterFromConfig(c, sideChannel, stats.NewStatsService(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
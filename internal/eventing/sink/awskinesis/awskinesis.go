@@ -19,6 +19,7 @@ package awskinesis
 
 import (
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/kinesis"
@@ -29,9 +30,14 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
 	"log"
+	"sync"
 	"time"
 )
 
+// maxPutRecordsEntries is the maximum number of records
+// accepted by a single PutRecords call
+const maxPutRecordsEntries = 500
+
 func init() {
 	sinkimpl.RegisterSink(config.AwsKinesis, newAwsKinesisSink)
 }
@@ -39,7 +45,21 @@ func init() {
 type awsKinesisSink struct {
 	streamName *string
 	awsKinesis *kinesis.Kinesis
-	encoder    *encoding.JsonEncoder
+	encoder    encoding.Encoder
+	records    chan *pendingRecord
+	done       chan struct{}
+
+	mutex   sync.Mutex
+	started bool
+	stopped bool
+}
+
+// pendingRecord is an asynchronously emitted record waiting to be put.
+// Records are put by a single worker to keep the emission order, all
+// records pending at the time are put with a single PutRecords call.
+type pendingRecord struct {
+	entry  *kinesis.PutRecordsRequestEntry
+	future *sink.CompletableFuture
 }
 
 func newAwsKinesisSink(
@@ -51,6 +71,11 @@ func newAwsKinesisSink(
 		return nil, errors.Errorf("AWS Kinesis sink needs the stream name to be configured")
 	}
 
+	encoder, err := encoding.NewEncoderWithConfig(c, false)
+	if err != nil {
+		return nil, err
+	}
+
 	shardCount := config.GetOrDefault[*int64](c, config.PropertyKinesisStreamShardCount, nil)
 	streamMode := config.GetOrDefault[*string](c, config.PropertyKinesisStreamMode, nil)
 	streamCreate := config.GetOrDefault(c, config.PropertyKinesisStreamCreate, true)
@@ -117,15 +142,46 @@ func newAwsKinesisSink(
 	return &awsKinesisSink{
 		streamName: streamName,
 		awsKinesis: awsKinesis,
-		encoder:    encoding.NewJsonEncoderWithConfig(c),
+		encoder:    encoder,
+		records:    make(chan *pendingRecord, 1024),
+		done:       make(chan struct{}),
 	}, nil
 }
 
 func (a *awsKinesisSink) Start() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.started || a.stopped {
+		return nil
+	}
+	a.started = true
+
+	go a.putLoop()
 	return nil
 }
 
 func (a *awsKinesisSink) Stop() error {
+	a.mutex.Lock()
+	if a.stopped {
+		a.mutex.Unlock()
+		return nil
+	}
+	a.stopped = true
+	close(a.records)
+	started := a.started
+	a.mutex.Unlock()
+
+	// Without the worker running, records emitted
+	// before the sink was started are never put
+	if !started {
+		for record := range a.records {
+			record.future.Complete(errors.Errorf("AWS Kinesis sink stopped before it was started"))
+		}
+		return nil
+	}
+
+	<-a.done
 	return nil
 }
 
@@ -133,7 +189,7 @@ func (a *awsKinesisSink) Emit(
 	_ sink.Context, _ time.Time, topicName string, _, envelope schema.Struct,
 ) error {
 
-	envelopeData, err := a.encoder.Marshal(envelope)
+	encoded, err := a.encoder.Encode(topicName, nil, envelope)
 	if err != nil {
 		return err
 	}
@@ -141,11 +197,154 @@ func (a *awsKinesisSink) Emit(
 	_, err = a.awsKinesis.PutRecord(&kinesis.PutRecordInput{
 		StreamName:   a.streamName,
 		PartitionKey: aws.String(topicName),
-		Data:         envelopeData,
+		Data:         encoded.Value,
 	})
+	return classifyError(err)
+}
+
+func (a *awsKinesisSink) EmitAsync(
+	_ sink.Context, _ time.Time, topicName string, _, envelope schema.Struct,
+) sink.Future {
+
+	encoded, err := a.encoder.Encode(topicName, nil, envelope)
 	if err != nil {
-		return err
+		return sink.CompletedFuture(err)
 	}
 
-	return nil
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.stopped {
+		return sink.CompletedFuture(errors.Errorf("AWS Kinesis sink already stopped"))
+	}
+
+	future := sink.NewCompletableFuture()
+	a.records <- &pendingRecord{
+		entry: &kinesis.PutRecordsRequestEntry{
+			PartitionKey: aws.String(topicName),
+			Data:         encoded.Value,
+		},
+		future: future,
+	}
+	return future
+}
+
+// putLoop puts asynchronously emitted records until the sink is stopped.
+// The loop waits for the next record and collects all further pending
+// records, up to the PutRecords limit, to put them at once.
+func (a *awsKinesisSink) putLoop() {
+	defer close(a.done)
+
+	for record := range a.records {
+		batch := []*pendingRecord{record}
+	collect:
+		for len(batch) < maxPutRecordsEntries {
+			select {
+			case next, ok := <-a.records:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, next)
+			default:
+				break collect
+			}
+		}
+		a.putPending(batch)
+	}
+}
+
+func (a *awsKinesisSink) putPending(
+	batch []*pendingRecord,
+) {
+
+	entries := make([]*kinesis.PutRecordsRequestEntry, 0, len(batch))
+	for _, record := range batch {
+		entries = append(entries, record.entry)
+	}
+
+	output, err := a.awsKinesis.PutRecords(&kinesis.PutRecordsInput{
+		StreamName: a.streamName,
+		Records:    entries,
+	})
+	if err != nil {
+		err = classifyError(err)
+		for _, record := range batch {
+			record.future.Complete(err)
+		}
+		return
+	}
+
+	// Results are returned in the order of the request entries
+	for i, record := range batch {
+		var recordErr error
+		if i < len(output.Records) && output.Records[i].ErrorCode != nil {
+			recordErr = errors.Errorf(
+				"AWS Kinesis failed to put record: %s (%s)",
+				aws.StringValue(output.Records[i].ErrorMessage), aws.StringValue(output.Records[i].ErrorCode),
+			)
+		}
+		record.future.Complete(recordErr)
+	}
+}
+
+func (a *awsKinesisSink) EmitBatch(
+	_ sink.Context, records []sink.Record,
+) error {
+
+	entries := make([]*kinesis.PutRecordsRequestEntry, 0, len(records))
+	for _, record := range records {
+		encoded, err := a.encoder.Encode(record.TopicName, nil, record.Envelope)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &kinesis.PutRecordsRequestEntry{
+			PartitionKey: aws.String(record.TopicName),
+			Data:         encoded.Value,
+		})
+	}
+
+	// Records are put in chunks, failed records are reported by their
+	// index, since the records of other chunks may be put already
+	errs := make(map[int]error)
+	for offset := 0; offset < len(entries); offset += maxPutRecordsEntries {
+		chunk := entries[offset:min(len(entries), offset+maxPutRecordsEntries)]
+
+		output, err := a.awsKinesis.PutRecords(&kinesis.PutRecordsInput{
+			StreamName: a.streamName,
+			Records:    chunk,
+		})
+		if err != nil {
+			// Remaining chunks aren't put, to keep the order of the records
+			err = classifyError(err)
+			for index := offset; index < len(entries); index++ {
+				errs[index] = err
+			}
+			break
+		}
+		for index, result := range output.Records {
+			if result.ErrorCode != nil {
+				errs[offset+index] = errors.Errorf(
+					"AWS Kinesis failed to put record: %s (%s)",
+					aws.StringValue(result.ErrorCode), aws.StringValue(result.ErrorMessage),
+				)
+			}
+		}
+	}
+	return sink.NewBatchError(errs)
+}
+
+// classifyError marks requests rejected by validation (i.e. records
+// exceeding the maximum size) as non-retryable
+func classifyError(
+	err error,
+) error {
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case kinesis.ErrCodeInvalidArgumentException, "ValidationException":
+			return sink.NonRetryable(err)
+		}
+	}
+	return err
 }
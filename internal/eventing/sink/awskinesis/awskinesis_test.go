@@ -19,9 +19,12 @@ package awskinesis
 
 import (
 	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func IGNORE_Test_AWS_Kinesis_Config_Loading(
@@ -66,3 +69,28 @@ func IGNORE_Test_AWS_Kinesis_Config_Loading(
 	assert.Equal(t, "aws_secret_access_key", credentials.SecretAccessKey)
 	assert.Equal(t, "aws_session_token", credentials.SessionToken)
 }
+
+func Test_AWS_Kinesis_Stop_Guards(
+	t *testing.T,
+) {
+
+	awsSink := &awsKinesisSink{
+		encoder: encoding.NewJsonEncoder(false),
+		records: make(chan *pendingRecord, 10),
+		done:    make(chan struct{}),
+	}
+
+	// Records emitted before the sink was started are failed on stop
+	pending := awsSink.EmitAsync(nil, time.Now(), "topic", nil, schema.Struct{})
+
+	// Stopping without being started, or twice, must neither block nor panic
+	assert.NoError(t, awsSink.Stop())
+	assert.NoError(t, awsSink.Stop())
+
+	<-pending.Done()
+	assert.Error(t, pending.Err())
+
+	future := awsSink.EmitAsync(nil, time.Now(), "topic", nil, schema.Struct{})
+	<-future.Done()
+	assert.Error(t, future.Err())
+}
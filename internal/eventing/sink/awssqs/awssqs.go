@@ -21,6 +21,7 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
@@ -30,9 +31,14 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"strconv"
 	"time"
 )
 
+// maxSendMessageBatchEntries is the maximum number of messages
+// accepted by a single SendMessageBatch call
+const maxSendMessageBatchEntries = 10
+
 func init() {
 	sinkimpl.RegisterSink(config.AwsSQS, newAwsSqsSink)
 }
@@ -40,7 +46,7 @@ func init() {
 type awsSqsSink struct {
 	queueUrl *string
 	awsSqs   *sqs.SQS
-	encoder  *encoding.JsonEncoder
+	encoder  encoding.Encoder
 }
 
 func newAwsSqsSink(
@@ -52,6 +58,11 @@ func newAwsSqsSink(
 		return nil, errors.Errorf("AWS SQS sink needs the queue url to be configured")
 	}
 
+	encoder, err := encoding.NewEncoderWithConfig(c, false)
+	if err != nil {
+		return nil, err
+	}
+
 	awsRegion := config.GetOrDefault[*string](c, config.PropertySqsAwsRegion, nil)
 	endpoint := config.GetOrDefault(c, config.PropertySqsAwsEndpoint, "")
 	accessKeyId := config.GetOrDefault[*string](c, config.PropertySqsAwsAccessKeyId, nil)
@@ -77,7 +88,7 @@ func newAwsSqsSink(
 	return &awsSqsSink{
 		queueUrl: queueUrl,
 		awsSqs:   sqs.New(awsSession),
-		encoder:  encoding.NewJsonEncoderWithConfig(c),
+		encoder:  encoder,
 	}, nil
 }
 
@@ -93,33 +104,123 @@ func (a *awsSqsSink) Emit(
 	_ sink.Context, _ time.Time, topicName string, _, envelope schema.Struct,
 ) error {
 
-	envelopeData, err := a.encoder.Marshal(envelope)
+	encoded, err := a.encoder.Encode(topicName, nil, envelope)
 	if err != nil {
 		return err
 	}
 
-	payload := envelope[schema.FieldNamePayload].(schema.Struct)
-	source := payload[schema.FieldNameSource].(schema.Struct)
-	lsn := source[schema.FieldNameLSN].(string)
+	_, err = a.awsSqs.SendMessage(&sqs.SendMessageInput{
+		DelaySeconds:           aws.Int64(0),
+		MessageBody:            aws.String(string(encoded.Value)),
+		MessageGroupId:         aws.String(topicName),
+		MessageDeduplicationId: aws.String(messageDeduplicationId(envelope, encoded.Value)),
+		QueueUrl:               a.queueUrl,
+	})
+	return classifyError(err)
+}
+
+func (a *awsSqsSink) EmitBatch(
+	_ sink.Context, records []sink.Record,
+) error {
+
+	entries := make([]*sqs.SendMessageBatchRequestEntry, 0, len(records))
+	for _, record := range records {
+		encoded, err := a.encoder.Encode(record.TopicName, nil, record.Envelope)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &sqs.SendMessageBatchRequestEntry{
+			// Ids only need to be unique inside a single batch request
+			Id:                     aws.String(strconv.Itoa(len(entries) % maxSendMessageBatchEntries)),
+			DelaySeconds:           aws.Int64(0),
+			MessageBody:            aws.String(string(encoded.Value)),
+			MessageGroupId:         aws.String(record.TopicName),
+			MessageDeduplicationId: aws.String(messageDeduplicationId(record.Envelope, encoded.Value)),
+		})
+	}
+
+	// Messages are sent in chunks, failed messages are reported by their
+	// index, since the messages of other chunks may be sent already
+	errs := make(map[int]error)
+	for offset := 0; offset < len(entries); offset += maxSendMessageBatchEntries {
+		chunk := entries[offset:min(len(entries), offset+maxSendMessageBatchEntries)]
+
+		output, err := a.awsSqs.SendMessageBatch(&sqs.SendMessageBatchInput{
+			Entries:  chunk,
+			QueueUrl: a.queueUrl,
+		})
+		if err != nil {
+			// Remaining chunks aren't sent, to keep the order of the messages
+			err = classifyError(err)
+			for index := offset; index < len(entries); index++ {
+				errs[index] = err
+			}
+			break
+		}
+		for _, failed := range output.Failed {
+			// Entry ids are the indices of the messages inside the chunk
+			index, err := strconv.Atoi(aws.StringValue(failed.Id))
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			err = errors.Errorf("AWS SQS failed to send message: %s", aws.StringValue(failed.Message))
+			if aws.BoolValue(failed.SenderFault) {
+				err = sink.NonRetryable(err)
+			}
+			errs[offset+index] = err
+		}
+	}
+	return sink.NewBatchError(errs)
+}
+
+func messageDeduplicationId(
+	envelope schema.Struct, envelopeData []byte,
+) string {
+
+	// Transaction metadata events don't have a source block, but
+	// carry the LSN and transaction id at the top level of the payload
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	source, ok := payload[schema.FieldNameSource].(schema.Struct)
+	if !ok {
+		source = payload
+	}
+	lsn, _ := source[schema.FieldNameLSN].(string)
 	txId, present := source[schema.FieldNameTxId]
 
+	// The source block carries the transaction id as pointer, it's nil
+	// for events which aren't emitted as part of a transaction
+	if v, ok := txId.(*uint32); ok {
+		if v != nil {
+			txId = *v
+		} else {
+			present = false
+		}
+	}
+
 	var msgDeduplicationIdContent string
 	if present {
-		msgDeduplicationIdContent = fmt.Sprintf("%s-%d-%s", lsn, *(txId.(*uint32)), envelopeData)
+		msgDeduplicationIdContent = fmt.Sprintf("%s-%v-%s", lsn, txId, envelopeData)
 	} else {
 		msgDeduplicationIdContent = fmt.Sprintf("%s-%s", lsn, envelopeData)
 	}
 
 	hash := sha256.New()
 	hash.Write([]byte(msgDeduplicationIdContent))
-	msgDeduplicationId := fmt.Sprintf("%X", hash.Sum(nil))
+	return fmt.Sprintf("%X", hash.Sum(nil))
+}
 
-	_, err = a.awsSqs.SendMessage(&sqs.SendMessageInput{
-		DelaySeconds:           aws.Int64(0),
-		MessageBody:            aws.String(string(envelopeData)),
-		MessageGroupId:         aws.String(topicName),
-		MessageDeduplicationId: aws.String(msgDeduplicationId),
-		QueueUrl:               a.queueUrl,
-	})
+// classifyError marks requests rejected by validation (i.e. messages
+// exceeding the maximum size) as non-retryable
+func classifyError(
+	err error,
+) error {
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case sqs.ErrCodeInvalidMessageContents, "InvalidParameterValue", sqs.ErrCodeBatchRequestTooLong:
+			return sink.NonRetryable(err)
+		}
+	}
 	return err
 }
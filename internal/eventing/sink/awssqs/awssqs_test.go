@@ -18,10 +18,13 @@
 package awssqs
 
 import (
+	"github.com/jackc/pglogrepl"
 	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func Test_AWS_SQS_Config_Loading(
@@ -63,3 +66,40 @@ func Test_AWS_SQS_Config_Loading(
 	assert.Equal(t, "aws_secret_access_key", credentials.SecretAccessKey)
 	assert.Equal(t, "aws_session_token", credentials.SessionToken)
 }
+
+func Test_AWS_SQS_Message_Deduplication_Id_Transaction_Event(
+	t *testing.T,
+) {
+
+	begin := schema.Envelope(
+		schema.TransactionValueSchema(),
+		schema.BeginTransactionEvent("100:1000", 100, pglogrepl.LSN(1000), time.Now()),
+	)
+	end := schema.Envelope(
+		schema.TransactionValueSchema(),
+		schema.EndTransactionEvent("100:2000", 100, pglogrepl.LSN(2000), time.Now(), 0, nil),
+	)
+
+	beginId := messageDeduplicationId(begin, []byte("{}"))
+	endId := messageDeduplicationId(end, []byte("{}"))
+	assert.NotEmpty(t, beginId)
+	assert.NotEqual(t, beginId, endId)
+}
+
+func Test_AWS_SQS_Message_Deduplication_Id_Change_Event(
+	t *testing.T,
+) {
+
+	source := func(lsn pglogrepl.LSN) schema.Struct {
+		return schema.Envelope(schema.Struct{}, schema.Struct{
+			schema.FieldNameSource: schema.Source(
+				lsn, time.Now(), false, "tsdb", "public", "metrics", lo.ToPtr(uint32(100)),
+			),
+		})
+	}
+
+	id1 := messageDeduplicationId(source(1000), []byte("{}"))
+	id2 := messageDeduplicationId(source(2000), []byte("{}"))
+	assert.NotEmpty(t, id1)
+	assert.NotEqual(t, id1, id2)
+}
@@ -0,0 +1,174 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadletter
+
+import (
+	"fmt"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/samber/lo"
+	"time"
+)
+
+// deadLetterSink wraps a sink and routes events, which fail with a
+// non-retryable error, to the dead-letter sink. The wrapped events carry
+// the error details, the original topic, and the LSN of the event.
+type deadLetterSink struct {
+	sink           sink.Sink
+	deadLetterSink sink.Sink
+	topicName      string
+	logger         *logging.Logger
+}
+
+// NewDeadLetterSinkFromConfig wraps the given sink with a dead-letter
+// sink if configured, otherwise the sink is returned as is
+func NewDeadLetterSinkFromConfig(
+	c *config.Config, s sink.Sink,
+) (sink.Sink, error) {
+
+	sinkType := config.GetOrDefault(c, config.PropertySinkDeadLetterType, config.SinkType(""))
+	if sinkType == "" {
+		return s, nil
+	}
+
+	deadLetterSink, err := sinkimpl.NewSink(sinkType, c)
+	if err != nil {
+		return nil, err
+	}
+
+	topicName := config.GetOrDefault(c, config.PropertySinkDeadLetterTopic, "")
+	if topicName == "" {
+		topicName = fmt.Sprintf("%s.deadletter", c.Topic.Prefix)
+	}
+
+	return newDeadLetterSink(s, deadLetterSink, topicName)
+}
+
+func newDeadLetterSink(
+	s, deadLetter sink.Sink, topicName string,
+) (*deadLetterSink, error) {
+
+	logger, err := logging.NewLogger("DeadLetterSink")
+	if err != nil {
+		return nil, err
+	}
+
+	return &deadLetterSink{
+		sink:           s,
+		deadLetterSink: deadLetter,
+		topicName:      topicName,
+		logger:         logger,
+	}, nil
+}
+
+func (d *deadLetterSink) Start() error {
+	if err := d.deadLetterSink.Start(); err != nil {
+		return err
+	}
+	return d.sink.Start()
+}
+
+func (d *deadLetterSink) Stop() error {
+	if err := d.sink.Stop(); err != nil {
+		return err
+	}
+	return d.deadLetterSink.Stop()
+}
+
+func (d *deadLetterSink) Emit(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	err := d.sink.Emit(context, timestamp, topicName, key, envelope)
+	return d.handleError(context, timestamp, topicName, key, envelope, err)
+}
+
+func (d *deadLetterSink) EmitAsync(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) sink.Future {
+
+	asyncSink, ok := d.sink.(sink.AsyncSink)
+	if !ok {
+		return sink.CompletedFuture(d.Emit(context, timestamp, topicName, key, envelope))
+	}
+
+	future := asyncSink.EmitAsync(context, timestamp, topicName, key, envelope)
+	result := sink.NewCompletableFuture()
+	go func() {
+		<-future.Done()
+		result.Complete(d.handleError(context, timestamp, topicName, key, envelope, future.Err()))
+	}()
+	return result
+}
+
+func (d *deadLetterSink) EmitBatch(
+	context sink.Context, records []sink.Record,
+) error {
+
+	if batchSink, ok := d.sink.(sink.BatchSink); ok {
+		err := batchSink.EmitBatch(context, records)
+		if err == nil || !sink.IsNonRetryable(err) {
+			return err
+		}
+
+		// Only the failed records of a partially emitted batch are emitted
+		// again, one by one, to route the rejected ones to the dead-letter sink.
+		// Otherwise, the batch failed as a whole and all records are.
+		if batchErr, ok := sink.AsBatchError(err); ok {
+			records = lo.Filter(records, func(_ sink.Record, index int) bool {
+				_, failed := batchErr.Errors[index]
+				return failed
+			})
+		}
+		d.logger.Warnf("Batch rejected, emitting %d events one by one: %s", len(records), err)
+	}
+
+	for _, record := range records {
+		if err := d.Emit(
+			context, record.Timestamp, record.TopicName, record.Key, record.Envelope,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *deadLetterSink) handleError(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct, err error,
+) error {
+
+	if err == nil || !sink.IsNonRetryable(err) {
+		return err
+	}
+
+	lsn := schema.EnvelopeLSN(envelope)
+	d.logger.Warnf("Event for topic '%s' rejected, routing it to dead-letter topic '%s': %s", topicName, d.topicName, err)
+
+	event := schema.DeadLetterEvent(topicName, lsn, err, timestamp, envelope)
+	dlErr := d.deadLetterSink.Emit(context, timestamp, d.topicName, key, event)
+	if dlErr == nil || !sink.IsNonRetryable(dlErr) {
+		return dlErr
+	}
+
+	// The original envelope can't be encoded either, fall back to its string representation
+	event = schema.DeadLetterEvent(topicName, lsn, err, timestamp, fmt.Sprintf("%+v", envelope))
+	return d.deadLetterSink.Emit(context, timestamp, d.topicName, key, event)
+}
@@ -0,0 +1,182 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadletter
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type emittedEvent struct {
+	topicName string
+	envelope  schema.Struct
+}
+
+func Test_DeadLetterSink_Routes_NonRetryable_Errors(
+	t *testing.T,
+) {
+
+	target := sink.SinkFunc(
+		func(_ sink.Context, _ time.Time, topicName string, _, _ schema.Struct) error {
+			if topicName == "rejected" {
+				return sink.NonRetryable(errors.Errorf("message too large"))
+			}
+			if topicName == "unavailable" {
+				return errors.Errorf("broker unavailable")
+			}
+			return nil
+		},
+	)
+
+	deadLetters := make([]emittedEvent, 0)
+	deadLetter := sink.SinkFunc(
+		func(_ sink.Context, _ time.Time, topicName string, _, envelope schema.Struct) error {
+			deadLetters = append(deadLetters, emittedEvent{topicName, envelope})
+			return nil
+		},
+	)
+
+	deadLetterSink, err := newDeadLetterSink(target, deadLetter, "test.deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := schema.Struct{
+		schema.FieldNamePayload: schema.Struct{
+			schema.FieldNameSource: schema.Struct{
+				schema.FieldNameLSN: "0/32BB438",
+			},
+		},
+	}
+
+	assert.NoError(t, deadLetterSink.Emit(nil, time.Now(), "accepted", nil, envelope))
+	assert.Empty(t, deadLetters)
+
+	assert.NoError(t, deadLetterSink.Emit(nil, time.Now(), "rejected", nil, envelope))
+	assert.Len(t, deadLetters, 1)
+	assert.Equal(t, "test.deadletter", deadLetters[0].topicName)
+	assert.Equal(t, "rejected", deadLetters[0].envelope[schema.FieldNameTopic])
+	assert.Equal(t, "0/32BB438", deadLetters[0].envelope[schema.FieldNameLSN])
+	assert.Equal(t, "message too large", deadLetters[0].envelope[schema.FieldNameError])
+	assert.Equal(t, envelope, deadLetters[0].envelope[schema.FieldNameEnvelope])
+
+	// Retryable errors are passed through to be retried by the emitter
+	assert.Error(t, deadLetterSink.Emit(nil, time.Now(), "unavailable", nil, envelope))
+	assert.Len(t, deadLetters, 1)
+}
+
+func Test_DeadLetterSink_Falls_Back_To_String_Envelope(
+	t *testing.T,
+) {
+
+	encodingError := sink.NonRetryable(errors.Errorf("unsupported value"))
+	target := sink.SinkFunc(
+		func(_ sink.Context, _ time.Time, _ string, _, _ schema.Struct) error {
+			return encodingError
+		},
+	)
+
+	deadLetters := make([]emittedEvent, 0)
+	deadLetter := sink.SinkFunc(
+		func(_ sink.Context, _ time.Time, topicName string, _, envelope schema.Struct) error {
+			if _, ok := envelope[schema.FieldNameEnvelope].(schema.Struct); ok {
+				return encodingError
+			}
+			deadLetters = append(deadLetters, emittedEvent{topicName, envelope})
+			return nil
+		},
+	)
+
+	deadLetterSink, err := newDeadLetterSink(target, deadLetter, "test.deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := schema.Struct{"value": 1}
+	assert.NoError(t, deadLetterSink.Emit(nil, time.Now(), "events", nil, envelope))
+	assert.Len(t, deadLetters, 1)
+	assert.Equal(t, "map[value:1]", deadLetters[0].envelope[schema.FieldNameEnvelope])
+	assert.Nil(t, deadLetters[0].envelope[schema.FieldNameLSN])
+}
+
+func Test_DeadLetterSink_Batch_Emits_Only_Failed_Records_Again(
+	t *testing.T,
+) {
+
+	target := &partialBatchSink{}
+
+	deadLetters := make([]emittedEvent, 0)
+	deadLetter := sink.SinkFunc(
+		func(_ sink.Context, _ time.Time, topicName string, _, envelope schema.Struct) error {
+			deadLetters = append(deadLetters, emittedEvent{topicName, envelope})
+			return nil
+		},
+	)
+
+	deadLetterSink, err := newDeadLetterSink(target, deadLetter, "test.deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = deadLetterSink.EmitBatch(nil, []sink.Record{
+		{TopicName: "first"},
+		{TopicName: "rejected"},
+		{TopicName: "second"},
+	})
+	assert.NoError(t, err)
+
+	// Records emitted by the batch aren't emitted again
+	assert.Equal(t, []string{"first", "second"}, target.emitted)
+	assert.Len(t, deadLetters, 1)
+	assert.Equal(t, "rejected", deadLetters[0].envelope[schema.FieldNameTopic])
+}
+
+// partialBatchSink emits all records of a batch, but the ones for the
+// rejected topic, which are reported as failed by a batch error
+type partialBatchSink struct {
+	sink.SinkFunc
+	emitted []string
+}
+
+func (p *partialBatchSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, _, _ schema.Struct,
+) error {
+
+	if topicName == "rejected" {
+		return sink.NonRetryable(errors.Errorf("message too large"))
+	}
+	p.emitted = append(p.emitted, topicName)
+	return nil
+}
+
+func (p *partialBatchSink) EmitBatch(
+	context sink.Context, records []sink.Record,
+) error {
+
+	errs := make(map[int]error)
+	for index, record := range records {
+		if err := p.Emit(context, record.Timestamp, record.TopicName, record.Key, record.Envelope); err != nil {
+			errs[index] = err
+		}
+	}
+	return sink.NewBatchError(errs)
+}
@@ -0,0 +1,227 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package file
+
+import (
+	"compress/gzip"
+	"github.com/go-errors/errors"
+	"github.com/klauspost/compress/zstd"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var fileExtensions = map[config.FileCompressionType]string{
+	config.GzipFileCompression: ".gz",
+	config.ZstdFileCompression: ".zst",
+}
+
+// compressor compresses rotated files in the background, to
+// not block the emission of events while compressing. Files are
+// compressed into a temporary file first, which is renamed after
+// completion, the original file is removed afterwards.
+type compressor struct {
+	compression config.FileCompressionType
+	logger      *logging.Logger
+	wg          sync.WaitGroup
+
+	mutex   sync.Mutex
+	stopped bool
+	// pending holds the directories requested to be compressed. All
+	// rotated files of a directory are compressed at once, hence a
+	// directory is only requested once until its compression started.
+	pending map[string]bool
+	wakeup  chan struct{}
+}
+
+func newCompressor(
+	compression config.FileCompressionType,
+) (*compressor, error) {
+
+	logger, err := logging.NewLogger("FileSink")
+	if err != nil {
+		return nil, err
+	}
+
+	return &compressor{
+		compression: compression,
+		logger:      logger,
+		pending:     make(map[string]bool),
+		wakeup:      make(chan struct{}, 1),
+	}, nil
+}
+
+func (c *compressor) start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for {
+			// Pending directories are compressed one more time after stopping
+			_, running := <-c.wakeup
+			for _, directory := range c.takePending() {
+				if err := c.compressDirectory(directory); err != nil {
+					c.logger.Errorf("Failed to compress rotated files in '%s': %+v", directory, err)
+				}
+			}
+			if !running {
+				return
+			}
+		}
+	}()
+}
+
+// stop waits for all requested compressions to be finished
+func (c *compressor) stop() {
+	c.mutex.Lock()
+	if c.stopped {
+		c.mutex.Unlock()
+		return
+	}
+	c.stopped = true
+	close(c.wakeup)
+	c.mutex.Unlock()
+
+	c.wg.Wait()
+}
+
+// compress requests the compression of all rotated files in the
+// directory. It never blocks, requests after stopping are ignored.
+func (c *compressor) compress(
+	directory string,
+) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stopped || c.pending[directory] {
+		return
+	}
+	c.pending[directory] = true
+
+	select {
+	case c.wakeup <- struct{}{}:
+	default:
+		// Already woken up, but the pending directories weren't taken yet
+	}
+}
+
+func (c *compressor) takePending() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	directories := make([]string, 0, len(c.pending))
+	for directory := range c.pending {
+		directories = append(directories, directory)
+	}
+	c.pending = make(map[string]bool)
+	return directories
+}
+
+func (c *compressor) compressDirectory(
+	directory string,
+) error {
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	for _, entry := range entries {
+		if !isRotatedFile(entry) {
+			continue
+		}
+		if err := c.compressFile(filepath.Join(directory, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compressor) compressFile(
+	path string,
+) error {
+
+	source, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer source.Close()
+
+	targetPath := path + fileExtensions[c.compression]
+	temporaryPath := targetPath + ".tmp"
+	target, err := os.OpenFile(temporaryPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer target.Close()
+
+	writer, err := c.newWriter(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, source); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if err := writer.Close(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if err := target.Sync(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	if err := os.Rename(temporaryPath, targetPath); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if err := os.Remove(path); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return syncDirectory(filepath.Dir(path))
+}
+
+func (c *compressor) newWriter(
+	target io.Writer,
+) (io.WriteCloser, error) {
+
+	switch c.compression {
+	case config.GzipFileCompression:
+		return gzip.NewWriter(target), nil
+	case config.ZstdFileCompression:
+		writer, err := zstd.NewWriter(target)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		return writer, nil
+	}
+	return nil, errors.Errorf("file Compression '%s' doesn't exist", c.compression)
+}
+
+// isRotatedFile returns true if the entry is a rotated and
+// uncompressed file, but not the active file of the directory
+func isRotatedFile(
+	entry os.DirEntry,
+) bool {
+
+	name := entry.Name()
+	return entry.Type().IsRegular() &&
+		name != activeFileName &&
+		strings.HasPrefix(name, rotatedFilePrefix) &&
+		strings.HasSuffix(name, rotatedFileSuffix)
+}
@@ -0,0 +1,320 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package file
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/gookit/slog/rotatefile"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/samber/lo"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The active file is rolled over into files named
+// events.<timestamp>.ndjson inside the same directory
+const (
+	activeFileName    = "events.ndjson"
+	rotatedFilePrefix = "events."
+	rotatedFileSuffix = ".ndjson"
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.File, newFileSink)
+}
+
+type fileSink struct {
+	path       string
+	maxSize    uint64
+	rotateTime rotatefile.RotateTime
+	encoder    encoding.Encoder
+	compressor *compressor
+	writers    map[string]*topicWriter
+	mutex      sync.Mutex
+}
+
+// topicWriter writes the events of a single topic into the active file
+// of the topic directory. The identity of the active file is used to
+// detect rollovers of the rotating writer.
+type topicWriter struct {
+	directory  string
+	writer     *rotatefile.Writer
+	activeFile os.FileInfo
+}
+
+func newFileSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	path := config.GetOrDefault(c, config.PropertyFilePath, "")
+	if path == "" {
+		return nil, errors.Errorf("file Path must be configured")
+	}
+
+	// Binary encodings can't be written as newline-delimited records
+	encodingType := config.GetOrDefault(c, config.PropertySinkEncodingType, config.JsonEncoding)
+	if encodingType != config.JsonEncoding && encodingType != config.CloudEventsEncoding {
+		return nil, errors.Errorf("file sink doesn't support the encoding type '%s'", encodingType)
+	}
+
+	maxSize, err := logging.ParseMaxSize(
+		lo.ToPtr(config.GetOrDefault(c, config.PropertyFileMaxSize, "100MB")),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var rotateTime rotatefile.RotateTime
+	if maxDuration := config.GetOrDefault(c, config.PropertyFileMaxDuration, 0); maxDuration > 0 {
+		rotateTime = logging.RotateTime(maxDuration)
+	}
+
+	compression := config.FileCompressionType(
+		config.GetOrDefault(c, config.PropertyFileCompression, string(config.NoneFileCompression)),
+	)
+
+	var fileCompressor *compressor
+	switch compression {
+	case config.GzipFileCompression, config.ZstdFileCompression:
+		if fileCompressor, err = newCompressor(compression); err != nil {
+			return nil, err
+		}
+	case config.NoneFileCompression:
+	default:
+		return nil, errors.Errorf("file Compression '%s' doesn't exist", compression)
+	}
+
+	encoder, err := encoding.NewEncoderWithConfig(c, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileSink{
+		path:       path,
+		maxSize:    maxSize,
+		rotateTime: rotateTime,
+		encoder:    encoder,
+		compressor: fileCompressor,
+		writers:    make(map[string]*topicWriter),
+	}, nil
+}
+
+func (f *fileSink) Start() error {
+	if f.compressor != nil {
+		f.compressor.start()
+	}
+	return nil
+}
+
+func (f *fileSink) Stop() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var err error
+	for _, writer := range f.writers {
+		if e := writer.writer.Close(); e != nil && err == nil {
+			err = errors.Wrap(e, 0)
+		}
+	}
+	f.writers = make(map[string]*topicWriter)
+
+	if f.compressor != nil {
+		f.compressor.stop()
+	}
+	return err
+}
+
+func (f *fileSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	writer, err := f.write(topicName, key, envelope)
+	if err != nil || writer == nil {
+		return err
+	}
+	return f.sync(writer)
+}
+
+func (f *fileSink) EmitBatch(
+	_ sink.Context, records []sink.Record,
+) error {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// Files are synced once per topic, after all records are written
+	// Records after a failed one aren't written, to keep their order
+	writers := make([]*topicWriter, 0)
+	errs := make(map[int]error)
+	for index, record := range records {
+		writer, err := f.write(record.TopicName, record.Key, record.Envelope)
+		if err != nil {
+			for ; index < len(records); index++ {
+				errs[index] = err
+			}
+			break
+		}
+		if writer != nil && !lo.Contains(writers, writer) {
+			writers = append(writers, writer)
+		}
+	}
+
+	for _, writer := range writers {
+		if err := f.sync(writer); err != nil {
+			return err
+		}
+	}
+	return sink.NewBatchError(errs)
+}
+
+// write appends the encoded envelope as a single line to the active
+// file of the topic. Envelopes without payload (e.g. tombstones) are
+// skipped, and no writer is returned.
+func (f *fileSink) write(
+	topicName string, key, envelope schema.Struct,
+) (*topicWriter, error) {
+
+	encoded, err := f.encoder.Encode(topicName, key, envelope)
+	if err != nil {
+		return nil, err
+	}
+	if encoded.Value == nil {
+		return nil, nil
+	}
+
+	writer, err := f.topicWriter(topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single write per line prevents lines from being split by a rollover
+	line := make([]byte, 0, len(encoded.Value)+1)
+	line = append(line, encoded.Value...)
+	line = append(line, '\n')
+	if _, err := writer.writer.Write(line); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return writer, nil
+}
+
+// sync flushes the active file of the topic to disk, before the
+// event is acknowledged. If the file was rolled over in the meantime,
+// the directory is synced as well and the rotated files are handed
+// to the compressor.
+func (f *fileSink) sync(
+	writer *topicWriter,
+) error {
+
+	if err := writer.writer.Sync(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	activeFile, err := os.Stat(filepath.Join(writer.directory, activeFileName))
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if os.SameFile(writer.activeFile, activeFile) {
+		return nil
+	}
+	writer.activeFile = activeFile
+
+	if err := syncDirectory(writer.directory); err != nil {
+		return err
+	}
+	if f.compressor != nil {
+		f.compressor.compress(writer.directory)
+	}
+	return nil
+}
+
+// topicWriter returns the cached writer of the topic, or opens
+// a new one. Writers are kept until the sink is stopped.
+func (f *fileSink) topicWriter(
+	topicName string,
+) (*topicWriter, error) {
+
+	if writer, present := f.writers[topicName]; present {
+		return writer, nil
+	}
+
+	// Topic names are used as directory names, and must not
+	// point to a location outside the configured path
+	if !filepath.IsLocal(topicName) {
+		return nil, sink.NonRetryable(
+			errors.Errorf("topic name '%s' isn't a valid directory name", topicName),
+		)
+	}
+
+	directory := filepath.Join(f.path, topicName)
+	if err := os.MkdirAll(directory, 0777); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	writer, err := rotatefile.NewWriter(rotatefile.EmptyConfigWith(func(c *rotatefile.Config) {
+		c.Filepath = filepath.Join(directory, activeFileName)
+		c.MaxSize = f.maxSize
+		c.RotateTime = f.rotateTime
+	}))
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	activeFile, err := os.Stat(filepath.Join(directory, activeFileName))
+	if err != nil {
+		writer.Close()
+		return nil, errors.Wrap(err, 0)
+	}
+
+	topicWriter := &topicWriter{
+		directory:  directory,
+		writer:     writer,
+		activeFile: activeFile,
+	}
+	f.writers[topicName] = topicWriter
+
+	// Compress files rotated before a restart
+	if f.compressor != nil {
+		f.compressor.compress(directory)
+	}
+	return topicWriter, nil
+}
+
+func syncDirectory(
+	directory string,
+) error {
+
+	dir, err := os.Open(directory)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer dir.Close()
+
+	if err := dir.Sync(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_File_Sink_Writes_Ndjson(
+	t *testing.T,
+) {
+
+	path := t.TempDir()
+	fileSink := newTestFileSink(t, config.FileConfig{Path: path})
+
+	assert.NoError(t, fileSink.Emit(nil, time.Now(), "test.public.metrics", nil, testEnvelope(1)))
+	assert.NoError(t, fileSink.EmitBatch(nil, []sink.Record{
+		{Timestamp: time.Now(), TopicName: "test.public.metrics", Envelope: testEnvelope(2)},
+		{Timestamp: time.Now(), TopicName: "test.public.metrics", Envelope: nil},
+		{Timestamp: time.Now(), TopicName: "test.public.other", Envelope: testEnvelope(3)},
+	}))
+	assert.NoError(t, fileSink.Stop())
+
+	values := readValues(t, filepath.Join(path, "test.public.metrics", activeFileName))
+	assert.Equal(t, []int{1, 2}, values)
+
+	values = readValues(t, filepath.Join(path, "test.public.other", activeFileName))
+	assert.Equal(t, []int{3}, values)
+}
+
+func Test_File_Sink_Rotates_And_Compresses(
+	t *testing.T,
+) {
+
+	path := t.TempDir()
+	fileSink := newTestFileSink(t, config.FileConfig{
+		Path:        path,
+		MaxSize:     lo.ToPtr("1B"),
+		Compression: config.GzipFileCompression,
+	})
+
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, fileSink.Emit(nil, time.Now(), "test.public.metrics", nil, testEnvelope(i)))
+	}
+	assert.NoError(t, fileSink.Stop())
+
+	entries, err := os.ReadDir(filepath.Join(path, "test.public.metrics"))
+	assert.NoError(t, err)
+
+	values := make([]int, 0)
+	for _, entry := range entries {
+		if entry.Name() == activeFileName {
+			assert.Empty(t, readValues(t, filepath.Join(path, "test.public.metrics", entry.Name())))
+			continue
+		}
+		assert.True(t, strings.HasSuffix(entry.Name(), rotatedFileSuffix+".gz"), entry.Name())
+		values = append(values, readValues(t, filepath.Join(path, "test.public.metrics", entry.Name()))...)
+	}
+	assert.ElementsMatch(t, []int{1, 2, 3}, values)
+}
+
+func Test_File_Sink_Compression_Requests_Do_Not_Block(
+	t *testing.T,
+) {
+
+	fileCompressor, err := newCompressor(config.GzipFileCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests are collected per directory before the compressor runs
+	path := t.TempDir()
+	for i := 0; i < 1000; i++ {
+		fileCompressor.compress(path)
+	}
+	assert.Len(t, fileCompressor.pending, 1)
+
+	fileCompressor.start()
+	fileCompressor.stop()
+	assert.Empty(t, fileCompressor.pending)
+}
+
+func Test_File_Sink_Emit_After_Stop_Does_Not_Panic(
+	t *testing.T,
+) {
+
+	fileSink := newTestFileSink(t, config.FileConfig{
+		Path:        t.TempDir(),
+		MaxSize:     lo.ToPtr("1B"),
+		Compression: config.GzipFileCompression,
+	})
+	assert.NoError(t, fileSink.Stop())
+
+	assert.NotPanics(t, func() {
+		assert.NoError(t, fileSink.Emit(nil, time.Now(), "test.public.metrics", nil, testEnvelope(1)))
+		assert.NoError(t, fileSink.Emit(nil, time.Now(), "test.public.metrics", nil, testEnvelope(2)))
+	})
+	assert.NoError(t, fileSink.Stop())
+}
+
+func Test_File_Sink_Rejects_Invalid_Topic_Name(
+	t *testing.T,
+) {
+
+	fileSink := newTestFileSink(t, config.FileConfig{Path: t.TempDir()})
+	defer fileSink.Stop()
+
+	err := fileSink.Emit(nil, time.Now(), "../outside", nil, testEnvelope(1))
+	assert.Error(t, err)
+	assert.True(t, sink.IsNonRetryable(err))
+}
+
+func Test_File_Sink_Rejects_Binary_Encoding(
+	t *testing.T,
+) {
+
+	_, err := newFileSink(&config.Config{
+		Sink: config.SinkConfig{
+			Type:     config.File,
+			Encoding: config.SinkEncodingConfig{Type: config.AvroEncoding},
+			File:     config.FileConfig{Path: t.TempDir()},
+		},
+	})
+	assert.Error(t, err)
+}
+
+func newTestFileSink(
+	t *testing.T, fileConfig config.FileConfig,
+) *fileSink {
+
+	s, err := newFileSink(&config.Config{
+		Sink: config.SinkConfig{
+			Type: config.File,
+			File: fileConfig,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return s.(*fileSink)
+}
+
+func testEnvelope(
+	value int,
+) schema.Struct {
+
+	return schema.Struct{
+		schema.FieldNamePayload: schema.Struct{
+			schema.FieldNameOperation: "c",
+			schema.FieldNameAfter: schema.Struct{
+				"val": value,
+			},
+		},
+	}
+}
+
+func readValues(
+	t *testing.T, path string,
+) []int {
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var scanner *bufio.Scanner
+	if strings.HasSuffix(path, ".gz") {
+		reader, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner = bufio.NewScanner(reader)
+	} else {
+		scanner = bufio.NewScanner(file)
+	}
+
+	values := make([]int, 0)
+	for scanner.Scan() {
+		envelope := make(map[string]any)
+		if err := json.Unmarshal(scanner.Bytes(), &envelope); err != nil {
+			t.Fatal(err)
+		}
+		payload := envelope[schema.FieldNamePayload].(map[string]any)
+		after := payload[schema.FieldNameAfter].(map[string]any)
+		values = append(values, int(after["val"].(float64)))
+	}
+	return values
+}
@@ -32,6 +32,13 @@ import (
 	"time"
 )
 
+// batchContentTypes maps the content types of JSON based
+// encodings to the content type of JSON arrays of those
+var batchContentTypes = map[string]string{
+	"application/json":             "application/json",
+	"application/cloudevents+json": "application/cloudevents-batch+json",
+}
+
 func init() {
 	sinkimpl.RegisterSink(config.Http, newHttpSink)
 }
@@ -45,7 +52,7 @@ func basicAuth(
 
 type httpSink struct {
 	client  *http.Client
-	encoder *encoding.JsonEncoder
+	encoder encoding.Encoder
 	address *string
 	headers *http.Header
 }
@@ -68,8 +75,13 @@ func newHttpSink(
 		}
 	}
 
+	encoder, err := encoding.NewEncoderWithConfig(c, true)
+	if err != nil {
+		return nil, err
+	}
+
 	headers := make(http.Header)
-	headers.Add("Content-Type", "application/json")
+	headers.Add("Content-Type", encoder.ContentType())
 
 	authenticationType := config.GetOrDefault(c, config.PropertyHttpAuthenticationType, "none")
 	switch config.HttpAuthenticationType(authenticationType) {
@@ -100,7 +112,7 @@ func newHttpSink(
 
 	return &httpSink{
 		client:  &http.Client{Transport: transport},
-		encoder: encoding.NewJsonEncoderWithConfig(c),
+		encoder: encoder,
 		address: &address,
 		headers: &headers,
 	}, nil
@@ -118,22 +130,79 @@ func (h *httpSink) Stop() error {
 func (h *httpSink) Emit(
 	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
 ) error {
-	payload, err := h.encoder.Marshal(envelope)
+	encoded, err := h.encoder.Encode(topicName, nil, envelope)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", *h.address, bytes.NewBuffer(payload))
+	return h.post(bytes.NewBuffer(encoded.Value), "", encoded.Headers)
+}
+
+func (h *httpSink) post(
+	payload *bytes.Buffer, contentType string, headers map[string]string,
+) error {
+
+	req, err := http.NewRequest("POST", *h.address, payload)
 	if err != nil {
 		return err
 	}
 
-	req.Header = *h.headers
+	req.Header = h.headers.Clone()
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
 	resp, err := h.client.Do(req)
 	if err != nil {
 		return err
 	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("http: non-2xx response status code: %d", resp.StatusCode)
+		err := fmt.Errorf("http: non-2xx response status code: %d", resp.StatusCode)
+		// Client errors are permanent, except timeouts and rate limiting
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+
+			return sink.NonRetryable(err)
+		}
+		return err
 	}
 	return err
 }
+
+// EmitBatch posts all envelopes of the batch as a single JSON array,
+// if supported by the encoding. Otherwise, envelopes are posted one
+// by one.
+func (h *httpSink) EmitBatch(
+	context sink.Context, records []sink.Record,
+) error {
+
+	batchContentType, ok := batchContentTypes[h.encoder.ContentType()]
+	if !ok {
+		return sink.EmitEach(h, context, records)
+	}
+
+	encodedRecords := make([]*encoding.Encoded, 0, len(records))
+	for _, record := range records {
+		encoded, err := h.encoder.Encode(record.TopicName, nil, record.Envelope)
+		if err != nil {
+			return err
+		}
+		// Binary mode attributes can't be transported per batch element
+		if len(encoded.Headers) > 0 {
+			return sink.EmitEach(h, context, records)
+		}
+		encodedRecords = append(encodedRecords, encoded)
+	}
+
+	payload := bytes.NewBufferString("[")
+	for i, encoded := range encodedRecords {
+		if i > 0 {
+			payload.WriteString(",")
+		}
+		payload.Write(encoded.Value)
+	}
+	payload.WriteString("]")
+
+	return h.post(payload, batchContentType, nil)
+}
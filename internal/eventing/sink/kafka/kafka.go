@@ -19,22 +19,39 @@ package kafka
 
 import (
 	"crypto/tls"
+	"fmt"
 	"github.com/IBM/sarama"
+	"github.com/go-errors/errors"
 	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
 	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
 	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
+// nonRetryableErrors are rejections which are returned
+// again if the message is sent again
+var nonRetryableErrors = []error{
+	sarama.ErrInvalidMessage,
+	sarama.ErrInvalidMessageSize,
+	sarama.ErrMessageSizeTooLarge,
+	sarama.ErrInvalidTopic,
+	sarama.ErrMessageSetSizeTooLarge,
+	sarama.ErrInvalidRecord,
+}
+
 func init() {
 	sinkimpl.RegisterSink(config.Kafka, newKafkaSink)
 }
 
 type kafkaSink struct {
-	producer sarama.SyncProducer
-	encoder  *encoding.JsonEncoder
+	producer sarama.AsyncProducer
+	encoder  encoding.Encoder
+	wg       sync.WaitGroup
 }
 
 func newKafkaSink(
@@ -75,47 +92,173 @@ func newKafkaSink(
 		}
 	}
 
-	producer, err := sarama.NewSyncProducer(
+	encoder, err := encoding.NewEncoderWithConfig(c, true)
+	if err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewAsyncProducer(
 		config.GetOrDefault(c, config.PropertyKafkaBrokers, []string{"localhost:9092"}), kafkaConfig,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	return &kafkaSink{
+	k := &kafkaSink{
 		producer: producer,
-		encoder:  encoding.NewJsonEncoderWithConfig(c),
-	}, nil
+		encoder:  encoder,
+	}
+
+	// Without descriptor directory, protobuf descriptors are published to the schema topic
+	if protobufEncoder, ok := encoder.(*encoding.ProtobufEncoder); ok && !protobufEncoder.HasDescriptorPublisher() {
+		protobufEncoder.SetDescriptorPublisher(k.publishDescriptor(
+			config.GetOrDefault(
+				c, config.PropertySinkEncodingProtobufSchemaTopic, fmt.Sprintf("%s.schemas", c.Topic.Prefix),
+			),
+		))
+	}
+
+	return k, nil
 }
 
 func (k *kafkaSink) Start() error {
+	k.wg.Add(2)
+	go func() {
+		defer k.wg.Done()
+		for msg := range k.producer.Successes() {
+			msg.Metadata.(*sink.CompletableFuture).Complete(nil)
+		}
+	}()
+	go func() {
+		defer k.wg.Done()
+		for err := range k.producer.Errors() {
+			err.Msg.Metadata.(*sink.CompletableFuture).Complete(classifyError(err.Err))
+		}
+	}()
 	return nil
 }
 
 func (k *kafkaSink) Stop() error {
-	return k.producer.Close()
+	err := k.producer.Close()
+	k.wg.Wait()
+	return err
 }
 
 func (k *kafkaSink) Emit(
-	_ sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
 ) error {
 
-	keyData, err := k.encoder.Marshal(key)
-	if err != nil {
-		return err
-	}
-	envelopeData, err := k.encoder.Marshal(envelope)
+	future := k.EmitAsync(context, timestamp, topicName, key, envelope)
+	<-future.Done()
+	return future.Err()
+}
+
+func (k *kafkaSink) EmitAsync(
+	_ sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) sink.Future {
+
+	encoded, err := k.encoder.Encode(topicName, key, envelope)
 	if err != nil {
-		return err
+		return sink.CompletedFuture(err)
 	}
 
-	msg := &sarama.ProducerMessage{
+	future := sink.NewCompletableFuture()
+	message := &sarama.ProducerMessage{
 		Topic:     topicName,
-		Key:       sarama.ByteEncoder(keyData),
-		Value:     sarama.ByteEncoder(envelopeData),
+		Key:       sarama.ByteEncoder(encoded.Key),
+		Headers:   recordHeaders(encoded.Headers),
 		Timestamp: timestamp,
+		Metadata:  future,
+	}
+	// Envelopes without payload are sent without value
+	if encoded.Value != nil {
+		message.Value = sarama.ByteEncoder(encoded.Value)
+	}
+	k.producer.Input() <- message
+	return future
+}
+
+func (k *kafkaSink) EmitBatch(
+	context sink.Context, records []sink.Record,
+) error {
+
+	futures := make([]sink.Future, 0, len(records))
+	for _, record := range records {
+		futures = append(futures, k.EmitAsync(
+			context, record.Timestamp, record.TopicName, record.Key, record.Envelope,
+		))
+	}
+
+	return sink.AwaitBatch(futures)
+}
+
+// publishDescriptor creates a DescriptorPublisher which sends the
+// descriptor sets to the schema topic, keyed by message name and
+// fingerprint to keep all schema versions on compacted topics
+func (k *kafkaSink) publishDescriptor(
+	schemaTopic string,
+) encoding.DescriptorPublisher {
+
+	return func(descriptor *encoding.ProtobufDescriptor) error {
+		future := sink.NewCompletableFuture()
+		k.producer.Input() <- &sarama.ProducerMessage{
+			Topic: schemaTopic,
+			Key:   sarama.StringEncoder(fmt.Sprintf("%s-%s", descriptor.MessageName, descriptor.Fingerprint)),
+			Value: sarama.ByteEncoder(descriptor.DescriptorSet),
+			Headers: []sarama.RecordHeader{
+				{Key: []byte(encoding.ProtobufMessageHeader), Value: []byte(descriptor.MessageName)},
+				{Key: []byte(encoding.ProtobufFingerprintHeader), Value: []byte(descriptor.Fingerprint)},
+			},
+			Metadata: future,
+		}
+		<-future.Done()
+		return future.Err()
+	}
+}
+
+// recordHeaders converts the encoder headers, CloudEvents
+// attributes use the ce_ prefix with the Kafka binding
+func recordHeaders(
+	headers map[string]string,
+) []sarama.RecordHeader {
+
+	if len(headers) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	recordHeaders := make([]sarama.RecordHeader, 0, len(headers))
+	for _, name := range names {
+		key := name
+		if strings.HasPrefix(key, "ce-") {
+			key = "ce_" + strings.TrimPrefix(key, "ce-")
+		}
+		recordHeaders = append(recordHeaders, sarama.RecordHeader{
+			Key:   []byte(key),
+			Value: []byte(headers[name]),
+		})
 	}
+	return recordHeaders
+}
+
+func classifyError(
+	err error,
+) error {
 
-	_, _, err = k.producer.SendMessage(msg)
+	// Client side validation, i.e. messages exceeding Producer.MaxMessageBytes
+	var configurationError sarama.ConfigurationError
+	if errors.As(err, &configurationError) {
+		return sink.NonRetryable(err)
+	}
+	for _, nonRetryableError := range nonRetryableErrors {
+		if errors.Is(err, nonRetryableError) {
+			return sink.NonRetryable(err)
+		}
+	}
 	return err
 }
@@ -0,0 +1,200 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.Mqtt, newMqttSink)
+}
+
+// message is a single MQTT publication, user properties
+// are only transmitted with MQTT 5
+type message struct {
+	topic          string
+	payload        []byte
+	contentType    string
+	userProperties [][2]string
+}
+
+// publisher abstracts the MQTT clients of the different protocol
+// versions. Both reconnect automatically if the connection is lost.
+type publisher interface {
+	connect(ctx context.Context) error
+	disconnect() error
+	publish(ctx context.Context, msg message) error
+}
+
+type publisherOptions struct {
+	serverUrl *url.URL
+	clientId  string
+	username  string
+	password  string
+	qos       byte
+	retain    bool
+	tlsConfig *tls.Config
+}
+
+type mqttSink struct {
+	publisher publisher
+	encoder   encoding.Encoder
+	timeout   time.Duration
+}
+
+func newMqttSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	serverUrl, err := url.Parse(config.GetOrDefault(c, config.PropertyMqttUrl, "mqtt://localhost:1883"))
+	if err != nil {
+		return nil, err
+	}
+
+	qos := config.GetOrDefault(c, config.PropertyMqttQoS, 1)
+	if qos < 0 || qos > 2 {
+		return nil, fmt.Errorf("mqtt QoS level '%d' doesn't exist", qos)
+	}
+
+	options := publisherOptions{
+		serverUrl: serverUrl,
+		clientId:  config.GetOrDefault(c, config.PropertyMqttClientId, "timescaledb-event-streamer"),
+		username:  config.GetOrDefault(c, config.PropertyMqttUsername, ""),
+		password:  config.GetOrDefault(c, config.PropertyMqttPassword, ""),
+		qos:       byte(qos),
+		retain:    config.GetOrDefault(c, config.PropertyMqttRetain, false),
+	}
+
+	switch serverUrl.Scheme {
+	case "mqtts", "ssl", "tls", "wss":
+		options.tlsConfig = &tls.Config{
+			InsecureSkipVerify: config.GetOrDefault(
+				c, config.PropertyMqttTlsSkipVerify, false,
+			),
+			ClientAuth: config.GetOrDefault(
+				c, config.PropertyMqttTlsClientAuth, tls.NoClientCert,
+			),
+		}
+	}
+
+	encoder, err := encoding.NewEncoderWithConfig(c, true)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Second * time.Duration(config.GetOrDefault(c, config.PropertyMqttTimeout, 30))
+
+	var p publisher
+	version := config.GetOrDefault(c, config.PropertyMqttVersion, string(config.MqttV5))
+	switch config.MqttProtocolVersion(version) {
+	case config.MqttV311:
+		p = newMqtt311Publisher(options, timeout)
+	case config.MqttV5:
+		p = newMqtt5Publisher(options, timeout)
+	default:
+		return nil, fmt.Errorf("mqtt protocol version '%s' doesn't exist", version)
+	}
+
+	return &mqttSink{
+		publisher: p,
+		encoder:   encoder,
+		timeout:   timeout,
+	}, nil
+}
+
+func (m *mqttSink) Start() error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	return m.publisher.connect(ctx)
+}
+
+func (m *mqttSink) Stop() error {
+	return m.publisher.disconnect()
+}
+
+func (m *mqttSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	encoded, err := m.encoder.Encode(topicName, key, envelope)
+	if err != nil {
+		return err
+	}
+
+	userProperties := [][2]string{{"key", string(encoded.Key)}}
+	if op := operation(envelope); op != "" {
+		userProperties = append(userProperties, [2]string{"op", op})
+	}
+
+	names := make([]string, 0, len(encoded.Headers))
+	for name := range encoded.Headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		userProperties = append(userProperties, [2]string{name, encoded.Headers[name]})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	// Envelopes without payload are sent with an empty payload,
+	// which clears the retained message of the topic, if any
+	return m.publisher.publish(ctx, message{
+		topic:          mqttTopicName(topicName),
+		payload:        encoded.Value,
+		contentType:    m.encoder.ContentType(),
+		userProperties: userProperties,
+	})
+}
+
+// mqttTopicName maps the topic name to the MQTT topic hierarchy,
+// which uses slashes instead of dots as level separators
+func mqttTopicName(
+	topicName string,
+) string {
+
+	return strings.ReplaceAll(topicName, ".", "/")
+}
+
+// operation returns the operation type of the envelope,
+// or an empty string if the envelope was unwrapped
+func operation(
+	envelope schema.Struct,
+) string {
+
+	payload, ok := envelope[schema.FieldNamePayload].(schema.Struct)
+	if !ok {
+		return ""
+	}
+	op, _ := payload[schema.FieldNameOperation].(string)
+	return op
+}
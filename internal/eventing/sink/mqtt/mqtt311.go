@@ -0,0 +1,92 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"time"
+)
+
+type mqtt311Publisher struct {
+	client  mqtt.Client
+	qos     byte
+	retain  bool
+	timeout time.Duration
+}
+
+func newMqtt311Publisher(
+	options publisherOptions, timeout time.Duration,
+) *mqtt311Publisher {
+
+	clientOptions := mqtt.NewClientOptions().
+		AddBroker(options.serverUrl.String()).
+		SetClientID(options.clientId).
+		SetUsername(options.username).
+		SetPassword(options.password).
+		SetProtocolVersion(4).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOrderMatters(true).
+		SetConnectTimeout(timeout).
+		SetWriteTimeout(timeout)
+
+	if options.tlsConfig != nil {
+		clientOptions.SetTLSConfig(options.tlsConfig)
+	}
+
+	return &mqtt311Publisher{
+		client:  mqtt.NewClient(clientOptions),
+		qos:     options.qos,
+		retain:  options.retain,
+		timeout: timeout,
+	}
+}
+
+func (p *mqtt311Publisher) connect(
+	ctx context.Context,
+) error {
+
+	return await(ctx, p.client.Connect())
+}
+
+func (p *mqtt311Publisher) disconnect() error {
+	p.client.Disconnect(uint(p.timeout.Milliseconds()))
+	return nil
+}
+
+func (p *mqtt311Publisher) publish(
+	ctx context.Context, msg message,
+) error {
+
+	return await(ctx, p.client.Publish(msg.topic, p.qos, p.retain, msg.payload))
+}
+
+func await(
+	ctx context.Context, token mqtt.Token,
+) error {
+
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return fmt.Errorf("mqtt operation didn't complete: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"net/url"
+	"time"
+)
+
+// nonRetryableReasonCodes are PUBACK reason codes
+// which are returned again if the message is sent again
+var nonRetryableReasonCodes = []byte{
+	0x90, // Topic Name invalid
+	0x95, // Packet too large
+	0x99, // Payload format invalid
+}
+
+type mqtt5Publisher struct {
+	clientConfig autopaho.ClientConfig
+	connection   *autopaho.ConnectionManager
+	cancel       context.CancelFunc
+	qos          byte
+	retain       bool
+	timeout      time.Duration
+}
+
+func newMqtt5Publisher(
+	options publisherOptions, timeout time.Duration,
+) *mqtt5Publisher {
+
+	clientConfig := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{options.serverUrl},
+		TlsCfg:                        options.tlsConfig,
+		KeepAlive:                     30,
+		CleanStartOnInitialConnection: true,
+		ConnectTimeout:                timeout,
+		ConnectUsername:               options.username,
+		ConnectPassword:               []byte(options.password),
+		ClientConfig: paho.ClientConfig{
+			ClientID: options.clientId,
+		},
+	}
+
+	return &mqtt5Publisher{
+		clientConfig: clientConfig,
+		qos:          options.qos,
+		retain:       options.retain,
+		timeout:      timeout,
+	}
+}
+
+func (p *mqtt5Publisher) connect(
+	ctx context.Context,
+) error {
+
+	// The connection manager keeps reconnecting until it's cancelled
+	connectionCtx, cancel := context.WithCancel(context.Background())
+	connection, err := autopaho.NewConnection(connectionCtx, p.clientConfig)
+	if err != nil {
+		cancel()
+		return err
+	}
+	p.connection = connection
+	p.cancel = cancel
+
+	return connection.AwaitConnection(ctx)
+}
+
+func (p *mqtt5Publisher) disconnect() error {
+	if p.connection == nil {
+		return nil
+	}
+	defer p.cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	return p.connection.Disconnect(ctx)
+}
+
+func (p *mqtt5Publisher) publish(
+	ctx context.Context, msg message,
+) error {
+
+	userProperties := make(paho.UserProperties, 0, len(msg.userProperties))
+	for _, property := range msg.userProperties {
+		userProperties.Add(property[0], property[1])
+	}
+
+	response, err := p.connection.Publish(ctx, &paho.Publish{
+		QoS:     p.qos,
+		Retain:  p.retain,
+		Topic:   msg.topic,
+		Payload: msg.payload,
+		Properties: &paho.PublishProperties{
+			ContentType: msg.contentType,
+			User:        userProperties,
+		},
+	})
+	if err != nil && response != nil {
+		for _, reasonCode := range nonRetryableReasonCodes {
+			if response.ReasonCode == reasonCode {
+				return sink.NonRetryable(err)
+			}
+		}
+	}
+	return err
+}
@@ -20,6 +20,7 @@ package nats
 import (
 	"context"
 	"fmt"
+	"github.com/go-errors/errors"
 	"github.com/nats-io/nats.go"
 	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
 	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
@@ -36,7 +37,7 @@ func init() {
 type natsSink struct {
 	client           *nats.Conn
 	jetStreamContext nats.JetStreamContext
-	encoder          *encoding.JsonEncoder
+	encoder          encoding.Encoder
 	timeout          time.Duration
 }
 
@@ -97,6 +98,11 @@ func connectJetStreamContext(
 		nats.MaxReconnects(-1),
 	)
 
+	encoder, err := encoding.NewEncoderWithConfig(c, true)
+	if err != nil {
+		return nil, err
+	}
+
 	client, err := nats.Connect(address, options...)
 	if err != nil {
 		return nil, err
@@ -115,7 +121,7 @@ func connectJetStreamContext(
 	return &natsSink{
 		client:           client,
 		jetStreamContext: jetStreamContext,
-		encoder:          encoding.NewJsonEncoderWithConfig(c),
+		encoder:          encoder,
 		timeout:          timeout,
 	}, nil
 }
@@ -133,28 +139,74 @@ func (n *natsSink) Emit(
 	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
 ) error {
 
-	keyData, err := n.encoder.Marshal(key)
+	msg, err := n.message(topicName, key, envelope)
 	if err != nil {
 		return err
 	}
-	envelopeData, err := n.encoder.Marshal(envelope)
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+	defer cancel()
+
+	_, err = n.jetStreamContext.PublishMsg(msg, nats.Context(ctx))
+	return classifyError(err)
+}
+
+func (n *natsSink) EmitAsync(
+	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
+) sink.Future {
+
+	msg, err := n.message(topicName, key, envelope)
+	if err != nil {
+		return sink.CompletedFuture(err)
+	}
+
+	pubAckFuture, err := n.jetStreamContext.PublishMsgAsync(msg)
 	if err != nil {
-		return err
+		return sink.CompletedFuture(classifyError(err))
+	}
+
+	future := sink.NewCompletableFuture()
+	go func() {
+		select {
+		case <-pubAckFuture.Ok():
+			future.Complete(nil)
+		case err := <-pubAckFuture.Err():
+			future.Complete(classifyError(err))
+		case <-time.After(n.timeout):
+			future.Complete(nats.ErrTimeout)
+		}
+	}()
+	return future
+}
+
+func (n *natsSink) message(
+	topicName string, key, envelope schema.Struct,
+) (*nats.Msg, error) {
+
+	encoded, err := n.encoder.Encode(topicName, key, envelope)
+	if err != nil {
+		return nil, err
 	}
 
 	header := nats.Header{}
-	header.Add("key", string(keyData))
+	header.Add("key", string(encoded.Key))
+	for name, value := range encoded.Headers {
+		header.Add(name, value)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
-	defer cancel()
+	return &nats.Msg{
+		Subject: topicName,
+		Header:  header,
+		Data:    encoded.Value,
+	}, nil
+}
 
-	_, err = n.jetStreamContext.PublishMsg(
-		&nats.Msg{
-			Subject: topicName,
-			Header:  header,
-			Data:    envelopeData,
-		},
-		nats.Context(ctx),
-	)
+func classifyError(
+	err error,
+) error {
+
+	if errors.Is(err, nats.ErrMaxPayload) || errors.Is(err, nats.ErrBadSubject) {
+		return sink.NonRetryable(err)
+	}
 	return err
 }
@@ -0,0 +1,233 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package pubsub
+
+import (
+	"cloud.google.com/go/pubsub"
+	"context"
+	"github.com/go-errors/errors"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"google.golang.org/api/option"
+	"google.golang.org/api/support/bundler"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+// nonRetryableCodes are rejections which are returned
+// again if the message is sent again
+var nonRetryableCodes = []codes.Code{
+	codes.InvalidArgument,
+	codes.NotFound,
+}
+
+func init() {
+	sinkimpl.RegisterSink(config.PubSub, newPubSubSink)
+}
+
+type pubSubSink struct {
+	client          *pubsub.Client
+	encoder         encoding.Encoder
+	publishSettings pubsub.PublishSettings
+	topics          map[string]*pubsub.Topic
+	mutex           sync.Mutex
+}
+
+func newPubSubSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	projectId := config.GetOrDefault(c, config.PropertyPubSubProjectId, "")
+	if projectId == "" {
+		return nil, errors.Errorf("pubsub ProjectId must be configured")
+	}
+
+	options := make([]option.ClientOption, 0)
+	if endpoint := config.GetOrDefault(c, config.PropertyPubSubEndpoint, ""); endpoint != "" {
+		// Endpoint overrides are meant for the Pub/Sub emulator,
+		// which supports neither authentication nor TLS
+		options = append(options,
+			option.WithEndpoint(endpoint),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		)
+	} else if credentialsFile := config.GetOrDefault(
+		c, config.PropertyPubSubCredentialsFile, "",
+	); credentialsFile != "" {
+		options = append(options, option.WithCredentialsFile(credentialsFile))
+	}
+
+	publishSettings := pubsub.DefaultPublishSettings
+	publishSettings.CountThreshold = config.GetOrDefault(
+		c, config.PropertyPubSubBatchCount, pubsub.DefaultPublishSettings.CountThreshold,
+	)
+	publishSettings.ByteThreshold = config.GetOrDefault(
+		c, config.PropertyPubSubBatchBytes, pubsub.DefaultPublishSettings.ByteThreshold,
+	)
+	publishSettings.DelayThreshold = time.Millisecond * time.Duration(config.GetOrDefault(
+		c, config.PropertyPubSubBatchDelay, int(pubsub.DefaultPublishSettings.DelayThreshold.Milliseconds()),
+	))
+	publishSettings.Timeout = time.Second * time.Duration(config.GetOrDefault(
+		c, config.PropertyPubSubTimeout, int(pubsub.DefaultPublishSettings.Timeout.Seconds()),
+	))
+
+	encoder, err := encoding.NewEncoderWithConfig(c, true)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := pubsub.NewClient(context.Background(), projectId, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pubSubSink{
+		client:          client,
+		encoder:         encoder,
+		publishSettings: publishSettings,
+		topics:          make(map[string]*pubsub.Topic),
+	}, nil
+}
+
+func (p *pubSubSink) Start() error {
+	return nil
+}
+
+func (p *pubSubSink) Stop() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Stop flushes all outstanding messages
+	for _, topic := range p.topics {
+		topic.Stop()
+	}
+	p.topics = make(map[string]*pubsub.Topic)
+	return p.client.Close()
+}
+
+func (p *pubSubSink) Emit(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	future := p.EmitAsync(context, timestamp, topicName, key, envelope)
+	<-future.Done()
+	return future.Err()
+}
+
+func (p *pubSubSink) EmitAsync(
+	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
+) sink.Future {
+
+	encoded, err := p.encoder.Encode(topicName, key, envelope)
+	if err != nil {
+		return sink.CompletedFuture(err)
+	}
+
+	attributes := make(map[string]string, len(encoded.Headers)+1)
+	for name, value := range encoded.Headers {
+		attributes[name] = value
+	}
+
+	// Pub/Sub rejects messages without data and attributes,
+	// therefore tombstones are marked by an attribute
+	if encoded.Value == nil {
+		attributes["tombstone"] = "true"
+	}
+
+	// Messages of the same ordering key are delivered in order,
+	// the encoded primary key keeps the order of events per row
+	orderingKey := string(encoded.Key)
+	topic := p.topic(topicName)
+	result := topic.Publish(context.Background(), &pubsub.Message{
+		Data:        encoded.Value,
+		Attributes:  attributes,
+		OrderingKey: orderingKey,
+	})
+
+	future := sink.NewCompletableFuture()
+	go func() {
+		_, err := result.Get(context.Background())
+		if err != nil && orderingKey != "" {
+			// Publishing of the ordering key is paused after a
+			// failure, the retried messages need to be accepted
+			topic.ResumePublish(orderingKey)
+		}
+		future.Complete(classifyError(err))
+	}()
+	return future
+}
+
+func (p *pubSubSink) EmitBatch(
+	context sink.Context, records []sink.Record,
+) error {
+
+	futures := make([]sink.Future, 0, len(records))
+	for _, record := range records {
+		futures = append(futures, p.EmitAsync(
+			context, record.Timestamp, record.TopicName, record.Key, record.Envelope,
+		))
+	}
+
+	return sink.AwaitBatch(futures)
+}
+
+// topic returns the cached topic handle, or creates a new one.
+// Topic handles batch their messages and are kept until the
+// sink is stopped.
+func (p *pubSubSink) topic(
+	topicName string,
+) *pubsub.Topic {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if topic, present := p.topics[topicName]; present {
+		return topic
+	}
+
+	topic := p.client.Topic(topicName)
+	topic.PublishSettings = p.publishSettings
+	topic.EnableMessageOrdering = true
+	p.topics[topicName] = topic
+	return topic
+}
+
+func classifyError(
+	err error,
+) error {
+
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, bundler.ErrOversizedItem) {
+		return sink.NonRetryable(err)
+	}
+	code := status.Code(err)
+	for _, nonRetryableCode := range nonRetryableCodes {
+		if code == nonRetryableCode {
+			return sink.NonRetryable(err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,241 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pulsar
+
+import (
+	"context"
+	"fmt"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/go-errors/errors"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"strings"
+	"sync"
+	"time"
+)
+
+// nonRetryableErrors are rejections which are returned
+// again if the message is sent again
+var nonRetryableErrors = []error{
+	pulsar.ErrMessageTooLarge,
+	pulsar.ErrInvalidMessage,
+	pulsar.ErrSchema,
+}
+
+func init() {
+	sinkimpl.RegisterSink(config.Pulsar, newPulsarSink)
+}
+
+type pulsarSink struct {
+	client      pulsar.Client
+	encoder     encoding.Encoder
+	topicPrefix string
+	timeout     time.Duration
+	producers   map[string]pulsar.Producer
+	mutex       sync.Mutex
+}
+
+func newPulsarSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	timeout := time.Second * time.Duration(config.GetOrDefault(c, config.PropertyPulsarTimeout, 30))
+
+	clientOptions := pulsar.ClientOptions{
+		URL:               config.GetOrDefault(c, config.PropertyPulsarUrl, "pulsar://localhost:6650"),
+		ConnectionTimeout: timeout,
+		OperationTimeout:  timeout,
+		TLSTrustCertsFilePath: config.GetOrDefault(
+			c, config.PropertyPulsarTlsTrustCertsFile, "",
+		),
+		TLSAllowInsecureConnection: config.GetOrDefault(
+			c, config.PropertyPulsarTlsSkipVerify, false,
+		),
+		TLSValidateHostname: config.GetOrDefault(
+			c, config.PropertyPulsarTlsValidateHostname, false,
+		),
+	}
+
+	authenticationType := config.GetOrDefault(c, config.PropertyPulsarAuthenticationType, "none")
+	switch config.PulsarAuthenticationType(authenticationType) {
+	case config.PulsarTokenAuthentication:
+		if tokenFile := config.GetOrDefault(c, config.PropertyPulsarAuthenticationTokenFile, ""); tokenFile != "" {
+			clientOptions.Authentication = pulsar.NewAuthenticationTokenFromFile(tokenFile)
+		} else {
+			clientOptions.Authentication = pulsar.NewAuthenticationToken(
+				config.GetOrDefault(c, config.PropertyPulsarAuthenticationToken, ""),
+			)
+		}
+	case config.PulsarTlsAuthentication:
+		clientOptions.Authentication = pulsar.NewAuthenticationTLS(
+			config.GetOrDefault(c, config.PropertyPulsarAuthenticationCertificate, ""),
+			config.GetOrDefault(c, config.PropertyPulsarAuthenticationKey, ""),
+		)
+	case config.PulsarNoneAuthentication:
+	default:
+		return nil, fmt.Errorf("pulsar AuthenticationType '%s' doesn't exist", authenticationType)
+	}
+
+	encoder, err := encoding.NewEncoderWithConfig(c, true)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := pulsar.NewClient(clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pulsarSink{
+		client:  client,
+		encoder: encoder,
+		topicPrefix: fmt.Sprintf("persistent://%s/%s/",
+			config.GetOrDefault(c, config.PropertyPulsarTenant, "public"),
+			config.GetOrDefault(c, config.PropertyPulsarNamespace, "default"),
+		),
+		timeout:   timeout,
+		producers: make(map[string]pulsar.Producer),
+	}, nil
+}
+
+func (p *pulsarSink) Start() error {
+	return nil
+}
+
+func (p *pulsarSink) Stop() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, producer := range p.producers {
+		producer.Close()
+	}
+	p.producers = make(map[string]pulsar.Producer)
+	p.client.Close()
+	return nil
+}
+
+func (p *pulsarSink) Emit(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	future := p.EmitAsync(context, timestamp, topicName, key, envelope)
+	<-future.Done()
+	return future.Err()
+}
+
+func (p *pulsarSink) EmitAsync(
+	_ sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) sink.Future {
+
+	encoded, err := p.encoder.Encode(topicName, key, envelope)
+	if err != nil {
+		return sink.CompletedFuture(err)
+	}
+
+	producer, err := p.producer(topicName)
+	if err != nil {
+		return sink.CompletedFuture(err)
+	}
+
+	// Messages are routed to the partitions by key, envelopes
+	// without payload are sent as tombstones without value
+	message := &pulsar.ProducerMessage{
+		Key:        string(encoded.Key),
+		Payload:    encoded.Value,
+		Properties: encoded.Headers,
+		EventTime:  timestamp,
+	}
+
+	future := sink.NewCompletableFuture()
+	producer.SendAsync(
+		context.Background(), message,
+		func(_ pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+			future.Complete(classifyError(err))
+		},
+	)
+	return future
+}
+
+func (p *pulsarSink) EmitBatch(
+	context sink.Context, records []sink.Record,
+) error {
+
+	futures := make([]sink.Future, 0, len(records))
+	for _, record := range records {
+		futures = append(futures, p.EmitAsync(
+			context, record.Timestamp, record.TopicName, record.Key, record.Envelope,
+		))
+	}
+
+	return sink.AwaitBatch(futures)
+}
+
+// producer returns the cached producer of the topic, or creates
+// a new one. Producers are kept until the sink is stopped.
+func (p *pulsarSink) producer(
+	topicName string,
+) (pulsar.Producer, error) {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if producer, present := p.producers[topicName]; present {
+		return producer, nil
+	}
+
+	producer, err := p.client.CreateProducer(pulsar.ProducerOptions{
+		Topic:       p.pulsarTopicName(topicName),
+		SendTimeout: p.timeout,
+		// Batches are built per key to keep the order
+		// of events for Key_Shared subscriptions
+		BatcherBuilderType: pulsar.KeyBasedBatchBuilder,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.producers[topicName] = producer
+	return producer, nil
+}
+
+// pulsarTopicName creates the fully qualified topic name inside the
+// configured tenant and namespace, unless the topic name generated
+// by the naming strategy is fully qualified already
+func (p *pulsarSink) pulsarTopicName(
+	topicName string,
+) string {
+
+	if strings.HasPrefix(topicName, "persistent://") || strings.HasPrefix(topicName, "non-persistent://") {
+		return topicName
+	}
+	return p.topicPrefix + topicName
+}
+
+func classifyError(
+	err error,
+) error {
+
+	for _, nonRetryableError := range nonRetryableErrors {
+		if errors.Is(err, nonRetryableError) {
+			return sink.NonRetryable(err)
+		}
+	}
+	return err
+}
@@ -25,16 +25,25 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"strings"
 	"time"
 )
 
+// nonRetryableErrors are the prefixes of error replies which
+// are returned again if the command is sent again
+var nonRetryableErrors = []string{
+	"WRONGTYPE",
+	"ERR string exceeds maximum allowed size",
+	"ERR Protocol error: invalid bulk length",
+}
+
 func init() {
 	sinkimpl.RegisterSink(config.Redis, newRedisSink)
 }
 
 type redisSink struct {
 	client  *redis.Client
-	encoder *encoding.JsonEncoder
+	encoder encoding.Encoder
 }
 
 func newRedisSink(
@@ -94,9 +103,14 @@ func newRedisSink(
 		}
 	}
 
+	encoder, err := encoding.NewEncoderWithConfig(c, false)
+	if err != nil {
+		return nil, err
+	}
+
 	return &redisSink{
 		client:  redis.NewClient(options),
-		encoder: encoding.NewJsonEncoderWithConfig(c),
+		encoder: encoder,
 	}, nil
 }
 
@@ -112,20 +126,31 @@ func (r *redisSink) Emit(
 	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
 ) error {
 
-	keyData, err := r.encoder.Marshal(key)
-	if err != nil {
-		return err
-	}
-	envelopeData, err := r.encoder.Marshal(envelope)
+	encoded, err := r.encoder.Encode(topicName, key, envelope)
 	if err != nil {
 		return err
 	}
 
-	return r.client.XAdd(&redis.XAddArgs{
+	return classifyError(r.client.XAdd(&redis.XAddArgs{
 		Stream: topicName,
 		Values: map[string]any{
-			"key":      string(keyData),
-			"envelope": string(envelopeData),
+			"key":      string(encoded.Key),
+			"envelope": string(encoded.Value),
 		},
-	}).Err()
+	}).Err())
+}
+
+func classifyError(
+	err error,
+) error {
+
+	if err == nil {
+		return nil
+	}
+	for _, nonRetryableError := range nonRetryableErrors {
+		if strings.HasPrefix(err.Error(), nonRetryableError) {
+			return sink.NonRetryable(err)
+		}
+	}
+	return err
 }
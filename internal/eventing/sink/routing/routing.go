@@ -0,0 +1,477 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package routing
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/eventfiltering"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/unwrap"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// target is a named sink with its routing rules. Nil filters accept all events.
+type target struct {
+	name        string
+	sink        sink.Sink
+	tableFilter *tablefiltering.TableFilter
+	eventFilter eventfiltering.EventFilter
+}
+
+// routingSink dispatches events to all targets with matching routing
+// rules. An event is only accepted once all matching targets accepted it.
+// If an event failed on some targets, the targets which accepted it are
+// skipped when the event is emitted again, to not duplicate it on retry.
+type routingSink struct {
+	targets []*target
+
+	mutex sync.Mutex
+	// accepted holds the names of the targets which accepted an event,
+	// by the event's id, for events which failed on other targets
+	accepted map[string]map[string]bool
+}
+
+// NewRoutingSinkFromConfig creates the sinks configured in sink.sinks,
+// and a routing sink to dispatch events to them
+func NewRoutingSinkFromConfig(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	names := make([]string, 0, len(c.Sink.Sinks))
+	for name := range c.Sink.Sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	targets := make([]*target, 0, len(names))
+	for _, name := range names {
+		namedSinkConfig := c.Sink.Sinks[name]
+
+		derivedConfig := deriveConfig(c, namedSinkConfig)
+		s, err := sinkimpl.NewSink(namedSinkConfig.Type, derivedConfig)
+		if err == nil {
+			s, err = unwrap.NewUnwrappingSinkFromConfig(derivedConfig, s)
+		}
+		if err != nil {
+			return nil, errors.WrapPrefix(err, fmt.Sprintf("sink '%s'", name), 0)
+		}
+
+		var tableFilter *tablefiltering.TableFilter
+		if namedSinkConfig.Tables != nil {
+			// Only explicitly included tables are routed, if includes are defined
+			tableFilter, err = tablefiltering.NewTableFilter(
+				namedSinkConfig.Tables.Excludes, namedSinkConfig.Tables.Includes,
+				len(namedSinkConfig.Tables.Includes) == 0,
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var eventFilter eventfiltering.EventFilter
+		if namedSinkConfig.Condition != "" {
+			eventFilter, err = eventfiltering.NewEventFilter(map[string]config.EventFilterConfig{
+				name: {Condition: namedSinkConfig.Condition},
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		targets = append(targets, &target{
+			name:        name,
+			sink:        s,
+			tableFilter: tableFilter,
+			eventFilter: eventFilter,
+		})
+	}
+
+	return newRoutingSink(targets), nil
+}
+
+func newRoutingSink(
+	targets []*target,
+) *routingSink {
+
+	return &routingSink{
+		targets:  targets,
+		accepted: make(map[string]map[string]bool),
+	}
+}
+
+func (r *routingSink) Start() error {
+	for _, t := range r.targets {
+		if err := t.sink.Start(); err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("sink '%s'", t.name), 0)
+		}
+	}
+	return nil
+}
+
+func (r *routingSink) Stop() error {
+	var err error
+	for _, t := range r.targets {
+		if e := t.sink.Stop(); e != nil && err == nil {
+			err = errors.WrapPrefix(e, fmt.Sprintf("sink '%s'", t.name), 0)
+		}
+	}
+	return err
+}
+
+func (r *routingSink) Emit(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	id, accepted := r.pending(topicName, key, envelope)
+	for _, t := range r.targets {
+		if accepted[t.name] {
+			continue
+		}
+
+		matches, err := t.matches(key, envelope)
+		if err != nil {
+			return err
+		}
+		if !matches {
+			continue
+		}
+
+		if err := t.sink.Emit(context, timestamp, topicName, key, envelope); err != nil {
+			// Events rejected permanently aren't emitted again
+			if !sink.IsNonRetryable(err) {
+				r.remember(id, topicName, key, envelope, accepted)
+			}
+			return errors.WrapPrefix(err, fmt.Sprintf("sink '%s'", t.name), 0)
+		}
+		accepted = markAccepted(accepted, t.name)
+	}
+	return nil
+}
+
+func (r *routingSink) EmitAsync(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) sink.Future {
+
+	id, accepted := r.pending(topicName, key, envelope)
+	names := make([]string, 0, len(r.targets))
+	futures := make([]sink.Future, 0, len(r.targets))
+	for _, t := range r.targets {
+		if accepted[t.name] {
+			continue
+		}
+
+		matches, err := t.matches(key, envelope)
+		if err != nil {
+			return sink.CompletedFuture(err)
+		}
+		if !matches {
+			continue
+		}
+
+		names = append(names, t.name)
+		if asyncSink, ok := t.sink.(sink.AsyncSink); ok {
+			futures = append(futures, asyncSink.EmitAsync(context, timestamp, topicName, key, envelope))
+		} else {
+			futures = append(futures, sink.CompletedFuture(t.sink.Emit(context, timestamp, topicName, key, envelope)))
+		}
+	}
+
+	switch {
+	case len(futures) == 0:
+		return sink.CompletedFuture(nil)
+	case len(futures) == 1 && len(accepted) == 0:
+		return futures[0]
+	}
+
+	// The event is only completed after all targets completed it
+	future := sink.NewCompletableFuture()
+	go func() {
+		var err error
+		for i, f := range futures {
+			<-f.Done()
+			if e := f.Err(); e != nil {
+				if err == nil {
+					err = errors.WrapPrefix(e, fmt.Sprintf("sink '%s'", names[i]), 0)
+				}
+				continue
+			}
+			accepted = markAccepted(accepted, names[i])
+		}
+		if err != nil && !sink.IsNonRetryable(err) {
+			r.remember(id, topicName, key, envelope, accepted)
+		}
+		future.Complete(err)
+	}()
+	return future
+}
+
+// EmitBatch emits the matching records to all targets, even if some
+// targets fail. Records which failed on any target are reported with
+// a batch error, by their index in the original batch.
+func (r *routingSink) EmitBatch(
+	context sink.Context, records []sink.Record,
+) error {
+
+	ids, accepted := r.pendingBatch(records)
+	errs := make(map[int]error)
+	for _, t := range r.targets {
+		matching := make([]sink.Record, 0, len(records))
+		indices := make([]int, 0, len(records))
+		for index, record := range records {
+			if accepted[index][t.name] {
+				continue
+			}
+
+			matches, err := t.matches(record.Key, record.Envelope)
+			if err != nil {
+				return err
+			}
+			if matches {
+				matching = append(matching, record)
+				indices = append(indices, index)
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+
+		failed := failedRecords(t.emitBatch(context, matching), indices)
+		for _, index := range indices {
+			if err, present := failed[index]; present {
+				if _, present := errs[index]; !present {
+					errs[index] = errors.WrapPrefix(err, fmt.Sprintf("sink '%s'", t.name), 0)
+				}
+				continue
+			}
+			accepted[index] = markAccepted(accepted[index], t.name)
+		}
+	}
+
+	// Failed records are remembered even if rejected permanently,
+	// as they're emitted one by one afterward to dead-letter them
+	for index := range errs {
+		record := records[index]
+		r.remember(ids[index], record.TopicName, record.Key, record.Envelope, accepted[index])
+	}
+	return sink.NewBatchError(errs)
+}
+
+// pending returns the id of the event and the targets which accepted
+// it already, if it failed before. The event is forgotten, it needs to
+// be remembered again if it fails again. The id is only calculated if
+// any event is remembered, otherwise an empty id is returned.
+func (r *routingSink) pending(
+	topicName string, key, envelope schema.Struct,
+) (string, map[string]bool) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.accepted) == 0 {
+		return "", nil
+	}
+
+	id := eventId(topicName, key, envelope)
+	accepted := r.accepted[id]
+	delete(r.accepted, id)
+	return id, accepted
+}
+
+// pendingBatch returns the ids of the records and the targets which
+// accepted them already, the same way as pending
+func (r *routingSink) pendingBatch(
+	records []sink.Record,
+) ([]string, []map[string]bool) {
+
+	ids := make([]string, len(records))
+	accepted := make([]map[string]bool, len(records))
+	for index, record := range records {
+		ids[index], accepted[index] = r.pending(record.TopicName, record.Key, record.Envelope)
+	}
+	return ids, accepted
+}
+
+// remember stores the targets which accepted the failed event,
+// to skip them if the event is emitted again
+func (r *routingSink) remember(
+	id, topicName string, key, envelope schema.Struct, accepted map[string]bool,
+) {
+
+	if len(accepted) == 0 {
+		return
+	}
+	if id == "" {
+		id = eventId(topicName, key, envelope)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.accepted[id] = accepted
+}
+
+// eventId identifies an event by its topic, key, and envelope. The
+// envelope contains the event's LSN and the values of its row.
+func eventId(
+	topicName string, key, envelope schema.Struct,
+) string {
+
+	return fmt.Sprintf("%s|%v|%v", topicName, key, envelope)
+}
+
+func markAccepted(
+	accepted map[string]bool, name string,
+) map[string]bool {
+
+	if accepted == nil {
+		accepted = make(map[string]bool)
+	}
+	accepted[name] = true
+	return accepted
+}
+
+// failedRecords returns the errors of the failed records by their index
+// in the original batch. If the target didn't report which records failed,
+// all records are considered failed.
+func failedRecords(
+	err error, indices []int,
+) map[int]error {
+
+	if err == nil {
+		return nil
+	}
+	if batchErr, ok := sink.AsBatchError(sink.RemapBatchError(err, indices)); ok {
+		return batchErr.Errors
+	}
+	failed := make(map[int]error, len(indices))
+	for _, index := range indices {
+		failed[index] = err
+	}
+	return failed
+}
+
+func (t *target) emitBatch(
+	context sink.Context, records []sink.Record,
+) error {
+
+	if batchSink, ok := t.sink.(sink.BatchSink); ok {
+		return batchSink.EmitBatch(context, records)
+	}
+	return sink.EmitEach(t.sink, context, records)
+}
+
+func (t *target) matches(
+	key, envelope schema.Struct,
+) (bool, error) {
+
+	if t.tableFilter != nil {
+		// Events without a table (i.e. logical replication messages)
+		// aren't routed to sinks with a table filter
+		table := sourceTable(envelope)
+		if table == nil || !t.tableFilter.Enabled(table) {
+			return false, nil
+		}
+	}
+
+	if t.eventFilter != nil {
+		return t.eventFilter.Evaluate(nil, key, envelope)
+	}
+	return true, nil
+}
+
+type sourceEntity struct {
+	schemaName string
+	tableName  string
+}
+
+func (s *sourceEntity) SchemaName() string {
+	return s.schemaName
+}
+
+func (s *sourceEntity) TableName() string {
+	return s.tableName
+}
+
+func (s *sourceEntity) CanonicalName() string {
+	return fmt.Sprintf("%s.%s", s.schemaName, s.tableName)
+}
+
+// sourceTable returns the table of the event's source block,
+// or nil if the event doesn't originate from a table
+func sourceTable(
+	envelope schema.Struct,
+) *sourceEntity {
+
+	payload, ok := envelope[schema.FieldNamePayload].(schema.Struct)
+	if !ok {
+		return nil
+	}
+	source, ok := payload[schema.FieldNameSource].(schema.Struct)
+	if !ok {
+		return nil
+	}
+	schemaName, _ := source[schema.FieldNameSchema].(string)
+	tableName, _ := source[schema.FieldNameTable].(string)
+	if schemaName == "" || tableName == "" {
+		return nil
+	}
+	return &sourceEntity{
+		schemaName: schemaName,
+		tableName:  tableName,
+	}
+}
+
+// deriveConfig creates a copy of the configuration with the main sink
+// configuration replaced by the named sink's type and specific configs
+func deriveConfig(
+	c *config.Config, namedSinkConfig config.NamedSinkConfig,
+) *config.Config {
+
+	derived := *c
+	derived.Sink.Type = namedSinkConfig.Type
+	override(&derived.Sink.Encoding, namedSinkConfig.Encoding)
+	override(&derived.Sink.Unwrap, namedSinkConfig.Unwrap)
+	override(&derived.Sink.Nats, namedSinkConfig.Nats)
+	override(&derived.Sink.Kafka, namedSinkConfig.Kafka)
+	override(&derived.Sink.Redis, namedSinkConfig.Redis)
+	override(&derived.Sink.AwsKinesis, namedSinkConfig.AwsKinesis)
+	override(&derived.Sink.AwsSqs, namedSinkConfig.AwsSqs)
+	override(&derived.Sink.Http, namedSinkConfig.Http)
+	override(&derived.Sink.Pulsar, namedSinkConfig.Pulsar)
+	override(&derived.Sink.Amqp, namedSinkConfig.Amqp)
+	override(&derived.Sink.Mqtt, namedSinkConfig.Mqtt)
+	override(&derived.Sink.PubSub, namedSinkConfig.PubSub)
+	override(&derived.Sink.File, namedSinkConfig.File)
+	return &derived
+}
+
+func override[T any](
+	target *T, value T,
+) {
+
+	if !reflect.ValueOf(value).IsZero() {
+		*target = value
+	}
+}
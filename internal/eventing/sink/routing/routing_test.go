@@ -0,0 +1,241 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package routing
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/eventfiltering"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_RoutingSink_Dispatches_To_Matching_Sinks(
+	t *testing.T,
+) {
+
+	metrics, metricsSink := collectingSink()
+	audit, auditSink := collectingSink()
+	all, allSink := collectingSink()
+
+	metricsFilter, err := tablefiltering.NewTableFilter([]string{}, []string{"public.metrics"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditFilter, err := tablefiltering.NewTableFilter([]string{}, []string{"audit.*"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deletesOnly, err := eventfiltering.NewEventFilter(map[string]config.EventFilterConfig{
+		"deletes": {Condition: `value.op == "d"`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routingSink := newRoutingSink([]*target{
+		{name: "metrics", sink: metricsSink, tableFilter: metricsFilter},
+		{name: "audit", sink: auditSink, tableFilter: auditFilter},
+		{name: "deletes", sink: allSink, eventFilter: deletesOnly},
+	})
+
+	key := schema.Envelope(schema.Struct{}, schema.Struct{})
+	assert.NoError(t, routingSink.Emit(nil, time.Now(), "t1", key, testEnvelope("public", "metrics", "c")))
+	assert.NoError(t, routingSink.Emit(nil, time.Now(), "t2", key, testEnvelope("audit", "logins", "c")))
+	assert.NoError(t, routingSink.Emit(nil, time.Now(), "t3", key, testEnvelope("audit", "logins", "d")))
+
+	assert.Equal(t, []string{"t1"}, *metrics)
+	assert.Equal(t, []string{"t2", "t3"}, *audit)
+	assert.Equal(t, []string{"t3"}, *all)
+}
+
+func Test_RoutingSink_Fails_If_Any_Sink_Fails(
+	t *testing.T,
+) {
+
+	accepted, acceptingSink := collectingSink()
+	failingSink := sink.SinkFunc(
+		func(_ sink.Context, _ time.Time, _ string, _, _ schema.Struct) error {
+			return sink.NonRetryable(errors.Errorf("rejected"))
+		},
+	)
+
+	routingSink := newRoutingSink([]*target{
+		{name: "accepting", sink: acceptingSink},
+		{name: "failing", sink: failingSink},
+	})
+
+	key := schema.Envelope(schema.Struct{}, schema.Struct{})
+	err := routingSink.Emit(nil, time.Now(), "t1", key, testEnvelope("public", "metrics", "c"))
+	assert.Error(t, err)
+	assert.True(t, sink.IsNonRetryable(err))
+	assert.Equal(t, []string{"t1"}, *accepted)
+
+	future := routingSink.EmitAsync(nil, time.Now(), "t2", key, testEnvelope("public", "metrics", "c"))
+	<-future.Done()
+	assert.Error(t, future.Err())
+}
+
+func Test_RoutingSink_Retry_Skips_Sinks_Which_Accepted_The_Event(
+	t *testing.T,
+) {
+
+	first, firstSink := collectingSink()
+	second, secondSink := collectingSink()
+	flaky, flakySink := failingOnceSink()
+
+	routingSink := newRoutingSink([]*target{
+		{name: "first", sink: firstSink},
+		{name: "flaky", sink: flakySink},
+		{name: "second", sink: secondSink},
+	})
+
+	key := schema.Envelope(schema.Struct{}, schema.Struct{})
+	envelope := testEnvelope("public", "metrics", "c")
+	assert.Error(t, routingSink.Emit(nil, time.Now(), "t1", key, envelope))
+	assert.NoError(t, routingSink.Emit(nil, time.Now(), "t1", key, envelope))
+
+	assert.Equal(t, []string{"t1"}, *first)
+	assert.Equal(t, []string{"t1"}, *flaky)
+	assert.Equal(t, []string{"t1"}, *second)
+	assert.Empty(t, routingSink.accepted)
+}
+
+func Test_RoutingSink_Async_Retry_Skips_Sinks_Which_Accepted_The_Event(
+	t *testing.T,
+) {
+
+	first, firstSink := collectingSink()
+	flaky, flakySink := failingOnceSink()
+
+	routingSink := newRoutingSink([]*target{
+		{name: "first", sink: firstSink},
+		{name: "flaky", sink: flakySink},
+	})
+
+	key := schema.Envelope(schema.Struct{}, schema.Struct{})
+	envelope := testEnvelope("public", "metrics", "c")
+	future := routingSink.EmitAsync(nil, time.Now(), "t1", key, envelope)
+	<-future.Done()
+	assert.Error(t, future.Err())
+
+	future = routingSink.EmitAsync(nil, time.Now(), "t1", key, envelope)
+	<-future.Done()
+	assert.NoError(t, future.Err())
+
+	assert.Equal(t, []string{"t1"}, *first)
+	assert.Equal(t, []string{"t1"}, *flaky)
+}
+
+func Test_RoutingSink_Batch_Retry_Skips_Sinks_Which_Accepted_The_Records(
+	t *testing.T,
+) {
+
+	first, firstSink := collectingSink()
+	second, secondSink := collectingSink()
+	flaky, flakySink := failingOnceSink()
+
+	routingSink := newRoutingSink([]*target{
+		{name: "first", sink: firstSink},
+		{name: "flaky", sink: flakySink},
+		{name: "second", sink: secondSink},
+	})
+
+	key := schema.Envelope(schema.Struct{}, schema.Struct{})
+	records := []sink.Record{
+		{TopicName: "t1", Key: key, Envelope: testEnvelope("public", "metrics", "c")},
+		{TopicName: "t2", Key: key, Envelope: testEnvelope("public", "metrics", "u")},
+	}
+
+	err := routingSink.EmitBatch(nil, records)
+	batchErr, ok := sink.AsBatchError(err)
+	assert.True(t, ok)
+	assert.Len(t, batchErr.Errors, 2)
+	assert.NoError(t, routingSink.EmitBatch(nil, records))
+
+	assert.Equal(t, []string{"t1", "t2"}, *first)
+	assert.Equal(t, []string{"t1", "t2"}, *flaky)
+	assert.Equal(t, []string{"t1", "t2"}, *second)
+	assert.Empty(t, routingSink.accepted)
+}
+
+func Test_DeriveConfig_Overrides_Sink_Specific_Config(
+	t *testing.T,
+) {
+
+	c := &config.Config{
+		Sink: config.SinkConfig{
+			Type:  config.Kafka,
+			Kafka: config.KafkaConfig{Brokers: []string{"main:9092"}},
+			Http:  config.HttpConfig{Url: "http://main"},
+		},
+	}
+
+	derived := deriveConfig(c, config.NamedSinkConfig{
+		Type:  config.Kafka,
+		Kafka: config.KafkaConfig{Brokers: []string{"audit:9092"}},
+	})
+
+	assert.Equal(t, []string{"audit:9092"}, derived.Sink.Kafka.Brokers)
+	assert.Equal(t, "http://main", derived.Sink.Http.Url)
+	assert.Equal(t, []string{"main:9092"}, c.Sink.Kafka.Brokers)
+}
+
+func collectingSink() (*[]string, sink.Sink) {
+	topics := make([]string, 0)
+	return &topics, sink.SinkFunc(
+		func(_ sink.Context, _ time.Time, topicName string, _, _ schema.Struct) error {
+			topics = append(topics, topicName)
+			return nil
+		},
+	)
+}
+
+// failingOnceSink fails the first emission
+// and collects the topics of all further ones
+func failingOnceSink() (*[]string, sink.Sink) {
+	failed := false
+	topics := make([]string, 0)
+	return &topics, sink.SinkFunc(
+		func(_ sink.Context, _ time.Time, topicName string, _, _ schema.Struct) error {
+			if !failed {
+				failed = true
+				return errors.Errorf("temporarily unavailable")
+			}
+			topics = append(topics, topicName)
+			return nil
+		},
+	)
+}
+
+func testEnvelope(
+	schemaName, tableName, op string,
+) schema.Struct {
+
+	return schema.Envelope(schema.Struct{}, schema.Struct{
+		schema.FieldNameOperation: op,
+		schema.FieldNameSource: schema.Struct{
+			schema.FieldNameSchema: schemaName,
+			schema.FieldNameTable:  tableName,
+		},
+	})
+}
@@ -68,3 +68,23 @@ func (sm *sinkManager) Emit(
 
 	return sm.sink.Emit(sm.sinkContext, timestamp, topicName, key, envelope)
 }
+
+func (sm *sinkManager) EmitAsync(
+	timestamp time.Time, topicName string, key, envelope schema.Struct,
+) sink.Future {
+
+	if asyncSink, ok := sm.sink.(sink.AsyncSink); ok {
+		return asyncSink.EmitAsync(sm.sinkContext, timestamp, topicName, key, envelope)
+	}
+	return sink.CompletedFuture(sm.sink.Emit(sm.sinkContext, timestamp, topicName, key, envelope))
+}
+
+func (sm *sinkManager) EmitBatch(
+	records []sink.Record,
+) error {
+
+	if batchSink, ok := sm.sink.(sink.BatchSink); ok {
+		return batchSink.EmitBatch(sm.sinkContext, records)
+	}
+	return sink.EmitEach(sm.sink, sm.sinkContext, records)
+}
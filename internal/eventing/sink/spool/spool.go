@@ -0,0 +1,437 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spool
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/moby/sys/atomicwriter"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	segmentFileSuffix = ".seg"
+	offsetFileName    = "spool.offset"
+	entryHeaderSize   = 8
+)
+
+var errSpoolFull = errors.Errorf("spool reached its maximum size")
+
+// spool is a segmented append log of encoded entries. Entries are
+// appended to the tail segment, and read and committed from the head
+// segment. Fully committed segments are deleted.
+type spool struct {
+	directory   string
+	segmentSize int64
+	maxSize     int64
+
+	mutex       sync.Mutex
+	segments    []uint64
+	nextSegment uint64
+	writer      *os.File
+	writeOffset int64
+	reader      *os.File
+	readSegment uint64
+	readOffset  int64
+	size        int64
+	entries     uint64
+}
+
+func openSpool(
+	directory string, segmentSize, maxSize int64,
+) (*spool, error) {
+
+	if err := os.MkdirAll(directory, 0777); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	s := &spool{
+		directory:   directory,
+		segmentSize: segmentSize,
+		maxSize:     maxSize,
+	}
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// append writes the entry to the tail segment and syncs it to disk
+func (s *spool) append(
+	data []byte,
+) error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entrySize := int64(entryHeaderSize + len(data))
+	if s.size+entrySize > s.maxSize {
+		return errSpoolFull
+	}
+
+	if s.writer == nil || s.writeOffset+entrySize > s.segmentSize {
+		if err := s.rollSegment(); err != nil {
+			return err
+		}
+	}
+
+	entry := make([]byte, 0, entrySize)
+	entry = binary.BigEndian.AppendUint32(entry, uint32(len(data)))
+	entry = binary.BigEndian.AppendUint32(entry, crc32.ChecksumIEEE(data))
+	entry = append(entry, data...)
+
+	if _, err := s.writer.Write(entry); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if err := s.writer.Sync(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	s.writeOffset += entrySize
+	s.size += entrySize
+	s.entries++
+	return nil
+}
+
+// peek returns the oldest uncommitted entry, or nil if the spool is empty
+func (s *spool) peek() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for s.entries > 0 {
+		if s.reader == nil {
+			reader, err := os.Open(s.segmentPath(s.readSegment))
+			if err != nil {
+				return nil, errors.Wrap(err, 0)
+			}
+			s.reader = reader
+		}
+
+		data, err := readEntry(s.reader, s.readOffset)
+		if err == io.EOF {
+			// Head segment is fully read, continue with the next one
+			if err := s.dropHeadSegment(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return data, err
+	}
+	return nil, nil
+}
+
+// commit marks the entry returned by the last peek as delivered
+func (s *spool) commit(
+	data []byte,
+) error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.readOffset += int64(entryHeaderSize + len(data))
+	s.entries--
+
+	// Fully drained spools are truncated to reclaim the disk space
+	if s.entries == 0 {
+		return s.reset()
+	}
+
+	// The offset is persisted without sync, entries may be
+	// delivered again after a crash (at-least-once)
+	return s.storeOffset()
+}
+
+func (s *spool) isEmpty() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.entries == 0
+}
+
+func (s *spool) stats() (entries uint64, size int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.entries, s.size
+}
+
+func (s *spool) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	if s.writer != nil {
+		if err := s.writer.Close(); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		s.writer = nil
+	}
+	return nil
+}
+
+func (s *spool) rollSegment() error {
+	if s.writer != nil {
+		if err := s.writer.Close(); err != nil {
+			return errors.Wrap(err, 0)
+		}
+	}
+
+	segmentId := s.nextSegment
+	s.nextSegment++
+
+	writer, err := os.OpenFile(s.segmentPath(segmentId), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	if len(s.segments) == 0 {
+		s.readSegment = segmentId
+		s.readOffset = 0
+	}
+	s.segments = append(s.segments, segmentId)
+	s.writer = writer
+	s.writeOffset = 0
+	return nil
+}
+
+// reset removes all segments, the next appended entry starts a new segment
+func (s *spool) reset() error {
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	if s.writer != nil {
+		if err := s.writer.Close(); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		s.writer = nil
+	}
+
+	for _, segmentId := range s.segments {
+		if err := os.Remove(s.segmentPath(segmentId)); err != nil {
+			return errors.Wrap(err, 0)
+		}
+	}
+
+	s.segments = nil
+	s.size = 0
+	s.readSegment = s.nextSegment
+	s.readOffset = 0
+	return s.storeOffset()
+}
+
+func (s *spool) dropHeadSegment() error {
+	// The tail segment is still written to and can't be dropped
+	if len(s.segments) <= 1 {
+		return errors.Errorf("spool head segment %d is corrupted", s.readSegment)
+	}
+
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+
+	path := s.segmentPath(s.readSegment)
+	if fi, err := os.Stat(path); err == nil {
+		s.size -= fi.Size()
+	}
+	if err := os.Remove(path); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	s.segments = s.segments[1:]
+	s.readSegment = s.segments[0]
+	s.readOffset = 0
+	return s.storeOffset()
+}
+
+// recover restores the state of an existing spool directory. Partially
+// written entries at the end of the tail segment are truncated.
+func (s *spool) recover() error {
+	files, err := os.ReadDir(s.directory)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	segments := make([]uint64, 0)
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, segmentFileSuffix) {
+			continue
+		}
+		segmentId, err := strconv.ParseUint(strings.TrimSuffix(name, segmentFileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segmentId)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i] < segments[j]
+	})
+
+	readSegment, readOffset, err := s.loadOffset()
+	if err != nil {
+		return err
+	}
+
+	// Segment ids are never reused, otherwise new segments could
+	// be mistaken as delivered ones after a restart
+	s.nextSegment = readSegment
+	if len(segments) > 0 && segments[len(segments)-1] >= s.nextSegment {
+		s.nextSegment = segments[len(segments)-1] + 1
+	}
+
+	// Remove segments which were fully delivered before the restart
+	for len(segments) > 0 && segments[0] < readSegment {
+		if err := os.Remove(s.segmentPath(segments[0])); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		segments = segments[1:]
+	}
+	if len(segments) == 0 {
+		return nil
+	}
+	if segments[0] != readSegment {
+		readOffset = 0
+	}
+
+	s.segments = segments
+	s.readSegment = segments[0]
+	s.readOffset = readOffset
+
+	for i, segmentId := range segments {
+		offset := int64(0)
+		if i == 0 {
+			offset = readOffset
+		}
+		entries, validSize, err := s.scanSegment(segmentId, offset)
+		if err != nil {
+			return err
+		}
+		s.entries += entries
+		s.size += validSize
+
+		if i == len(segments)-1 {
+			writer, err := os.OpenFile(s.segmentPath(segmentId), os.O_WRONLY, 0666)
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			if err := writer.Truncate(validSize); err != nil {
+				writer.Close()
+				return errors.Wrap(err, 0)
+			}
+			if _, err := writer.Seek(validSize, io.SeekStart); err != nil {
+				writer.Close()
+				return errors.Wrap(err, 0)
+			}
+			s.writer = writer
+			s.writeOffset = validSize
+		}
+	}
+	return nil
+}
+
+func (s *spool) scanSegment(
+	segmentId uint64, offset int64,
+) (entries uint64, validSize int64, err error) {
+
+	file, err := os.Open(s.segmentPath(segmentId))
+	if err != nil {
+		return 0, 0, errors.Wrap(err, 0)
+	}
+	defer file.Close()
+
+	validSize = offset
+	for {
+		data, err := readEntry(file, validSize)
+		if err != nil {
+			// Everything after the last valid entry is discarded
+			return entries, validSize, nil
+		}
+		entries++
+		validSize += int64(entryHeaderSize + len(data))
+	}
+}
+
+func (s *spool) storeOffset() error {
+	writer, err := atomicwriter.New(filepath.Join(s.directory, offsetFileName), 0666)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer writer.Close()
+
+	data := make([]byte, 0, 16)
+	data = binary.BigEndian.AppendUint64(data, s.readSegment)
+	data = binary.BigEndian.AppendUint64(data, uint64(s.readOffset))
+	_, err = writer.Write(data)
+	return err
+}
+
+func (s *spool) loadOffset() (uint64, int64, error) {
+	data, err := os.ReadFile(filepath.Join(s.directory, offsetFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, errors.Wrap(err, 0)
+	}
+	if len(data) != 16 {
+		return 0, 0, errors.Errorf("spool offset file is corrupted")
+	}
+	return binary.BigEndian.Uint64(data), int64(binary.BigEndian.Uint64(data[8:])), nil
+}
+
+func (s *spool) segmentPath(
+	segmentId uint64,
+) string {
+
+	return filepath.Join(s.directory, fmt.Sprintf("%020d%s", segmentId, segmentFileSuffix))
+}
+
+// readEntry reads the entry at the given offset. It returns io.EOF
+// if no complete and valid entry exists at the offset.
+func readEntry(
+	file *os.File, offset int64,
+) ([]byte, error) {
+
+	header := make([]byte, entryHeaderSize)
+	if _, err := file.ReadAt(header, offset); err != nil {
+		return nil, io.EOF
+	}
+
+	length := binary.BigEndian.Uint32(header)
+	checksum := binary.BigEndian.Uint32(header[4:])
+
+	data := make([]byte, length)
+	if _, err := file.ReadAt(data, offset+entryHeaderSize); err != nil {
+		return nil, io.EOF
+	}
+	if crc32.ChecksumIEEE(data) != checksum {
+		return nil, io.EOF
+	}
+	return data, nil
+}
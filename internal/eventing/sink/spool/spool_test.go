@@ -0,0 +1,289 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spool
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/stats"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_Spool_Append_And_Drain_In_Order(
+	t *testing.T,
+) {
+
+	s, err := openSpool(t.TempDir(), 64, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, s.append([]byte(fmt.Sprintf("entry-%d", i))))
+	}
+
+	for i := 0; i < 10; i++ {
+		data, err := s.peek()
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("entry-%d", i), string(data))
+		assert.NoError(t, s.commit(data))
+	}
+
+	data, err := s.peek()
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+	assert.True(t, s.isEmpty())
+}
+
+func Test_Spool_Recovers_After_Restart(
+	t *testing.T,
+) {
+
+	directory := t.TempDir()
+	s, err := openSpool(directory, 64, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, s.append([]byte(fmt.Sprintf("entry-%d", i))))
+	}
+	for i := 0; i < 4; i++ {
+		data, err := s.peek()
+		assert.NoError(t, err)
+		assert.NoError(t, s.commit(data))
+	}
+	assert.NoError(t, s.close())
+
+	// Simulate a partially written entry at the end of the tail segment
+	segments, err := filepath.Glob(filepath.Join(directory, "*"+segmentFileSuffix))
+	assert.NoError(t, err)
+	file, err := os.OpenFile(segments[len(segments)-1], os.O_APPEND|os.O_WRONLY, 0666)
+	assert.NoError(t, err)
+	_, err = file.Write([]byte{0, 0, 0, 42, 1})
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	s, err = openSpool(directory, 64, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	entries, _ := s.stats()
+	assert.Equal(t, uint64(6), entries)
+
+	assert.NoError(t, s.append([]byte("entry-10")))
+	for i := 4; i <= 10; i++ {
+		data, err := s.peek()
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("entry-%d", i), string(data))
+		assert.NoError(t, s.commit(data))
+	}
+	assert.True(t, s.isEmpty())
+}
+
+func Test_Spool_Rejects_When_Full(
+	t *testing.T,
+) {
+
+	s, err := openSpool(t.TempDir(), 32, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	assert.NoError(t, s.append([]byte("0123456789")))
+	assert.ErrorIs(t, s.append([]byte("0123456789abcdef")), errSpoolFull)
+}
+
+func Test_SpoolingSink_Spools_While_Sink_Unavailable(
+	t *testing.T,
+) {
+
+	s, err := openSpool(t.TempDir(), 1024, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mutex := sync.Mutex{}
+	available := false
+	topics := make([]string, 0)
+	target := sink.SinkFunc(
+		func(_ sink.Context, _ time.Time, topicName string, _, _ schema.Struct) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if !available {
+				return errors.Errorf("sink unavailable")
+			}
+			topics = append(topics, topicName)
+			return nil
+		},
+	)
+
+	spoolingSink, err := newSpoolingSink(target, s, time.Millisecond*10, stats.NewStatsService(&config.Config{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, spoolingSink.Start())
+
+	envelope := schema.Struct{"payload": schema.Struct{"value": 1}}
+	assert.NoError(t, spoolingSink.Emit(nil, time.Now(), "first", nil, envelope))
+	assert.NoError(t, spoolingSink.Emit(nil, time.Now(), "second", nil, envelope))
+	assert.False(t, s.isEmpty())
+
+	mutex.Lock()
+	available = true
+	mutex.Unlock()
+
+	// New events are spooled behind the pending ones to keep the order
+	assert.NoError(t, spoolingSink.Emit(nil, time.Now(), "third", nil, envelope))
+
+	assert.Eventually(t, s.isEmpty, time.Second, time.Millisecond*10)
+	assert.NoError(t, spoolingSink.Emit(nil, time.Now(), "fourth", nil, envelope))
+	assert.NoError(t, spoolingSink.Stop())
+
+	assert.Equal(t, []string{"first", "second", "third", "fourth"}, topics)
+}
+
+func Test_SpoolingSink_Replays_Original_Types(
+	t *testing.T,
+) {
+
+	s, err := openSpool(t.TempDir(), 1024, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txId := uint32(100)
+	timestamp := time.UnixMilli(1700000000000).UTC()
+	envelope := schema.Struct{
+		"payload": schema.Struct{
+			"bytes":     []byte{0x00, 0xff},
+			"int16":     int16(-3),
+			"uint64":    uint64(1<<63 + 1),
+			"float32":   float32(1.5),
+			"txId":      &txId,
+			"noTxId":    (*uint32)(nil),
+			"time":      timestamp,
+			"int32s":    []int32{1, 2},
+			"structs":   []schema.Struct{{"count": uint64(1)}},
+			"list":      []any{"a", int64(1)},
+			"nothing":   nil,
+			"transform": schema.Struct{"nested": true},
+		},
+	}
+
+	replayed := make(chan schema.Struct, 1)
+	target := sink.SinkFunc(
+		func(_ sink.Context, _ time.Time, _ string, _, envelope schema.Struct) error {
+			replayed <- envelope
+			return nil
+		},
+	)
+
+	spoolingSink, err := newSpoolingSink(target, s, time.Millisecond*10, stats.NewStatsService(&config.Config{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Appended without emission, to replay the event from the spool
+	assert.NoError(t, spoolingSink.append(time.Now(), "topic", nil, envelope))
+	assert.NoError(t, spoolingSink.Start())
+	defer spoolingSink.Stop()
+
+	select {
+	case actual := <-replayed:
+		assert.Equal(t, envelope, actual)
+	case <-time.After(time.Second):
+		t.Fatal("spooled event wasn't replayed")
+	}
+}
+
+func Test_SpoolingSink_Drops_Rejected_Spooled_Events(
+	t *testing.T,
+) {
+
+	s, err := openSpool(t.TempDir(), 1024, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mutex := sync.Mutex{}
+	topics := make([]string, 0)
+	target := sink.SinkFunc(
+		func(_ sink.Context, _ time.Time, topicName string, _, _ schema.Struct) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if topicName == "rejected" {
+				return sink.NonRetryable(errors.Errorf("message too large"))
+			}
+			topics = append(topics, topicName)
+			return nil
+		},
+	)
+
+	spoolingSink, err := newSpoolingSink(target, s, time.Millisecond*10, stats.NewStatsService(&config.Config{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rejected events aren't spooled in the first place
+	assert.Error(t, spoolingSink.Emit(nil, time.Now(), "rejected", nil, schema.Struct{}))
+	assert.True(t, s.isEmpty())
+
+	assert.NoError(t, spoolingSink.append(time.Now(), "rejected", nil, schema.Struct{}))
+	assert.NoError(t, spoolingSink.append(time.Now(), "accepted", nil, schema.Struct{}))
+	assert.NoError(t, spoolingSink.Start())
+
+	assert.Eventually(t, s.isEmpty, time.Second, time.Millisecond*10)
+	assert.NoError(t, spoolingSink.Stop())
+
+	assert.Equal(t, []string{"accepted"}, topics)
+	assert.Equal(t, uint64(1), spoolingSink.stats.rejected)
+}
+
+func Test_SpoolingSink_Rejects_Async_Emission(
+	t *testing.T,
+) {
+
+	c := &config.Config{
+		Sink: config.SinkConfig{
+			Spool: config.SinkSpoolConfig{
+				Enabled: lo.ToPtr(true),
+				Path:    t.TempDir(),
+			},
+			Async: config.SinkAsyncConfig{
+				Enabled: lo.ToPtr(true),
+			},
+		},
+	}
+
+	_, err := NewSpoolingSinkFromConfig(c, sink.SinkFunc(nil), stats.NewStatsService(c))
+	assert.Error(t, err)
+}
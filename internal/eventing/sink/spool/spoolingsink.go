@@ -0,0 +1,357 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spool
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/stats"
+	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"sync"
+	"time"
+)
+
+const megabyte = 1024 * 1024
+
+type spoolStats struct {
+	spooled  uint64 `metric:"spooled" type:"counter"`
+	drained  uint64 `metric:"drained" type:"counter"`
+	rejected uint64 `metric:"rejected" type:"counter"`
+	entries  uint64 `metric:"entries" type:"gauge"`
+	size     int64  `metric:"size" type:"gauge"`
+}
+
+type spooledEntry struct {
+	Timestamp time.Time   `json:"timestamp"`
+	TopicName string      `json:"topic"`
+	Key       *typedValue `json:"key"`
+	Envelope  *typedValue `json:"envelope"`
+}
+
+// spoolingSink wraps a sink and spools events to disk while the sink
+// is unavailable. Spooled events are drained in order as soon as the
+// sink recovers; new events are spooled until the spool is empty to
+// keep the emission order. Events are considered processed as soon as
+// they are durably spooled. Events rejected by the sink aren't spooled,
+// since they'd never succeed.
+type spoolingSink struct {
+	sink          sink.Sink
+	spool         *spool
+	retryInterval time.Duration
+	logger        *logging.Logger
+	statsReporter *stats.Reporter
+
+	mutex          sync.Mutex
+	context        sink.Context
+	stats          spoolStats
+	wakeup         chan struct{}
+	shutdownWaiter *waiting.ShutdownAwaiter
+}
+
+// NewSpoolingSinkFromConfig wraps the given sink with a spool if
+// the spool is enabled, otherwise the sink is returned as is
+func NewSpoolingSinkFromConfig(
+	c *config.Config, s sink.Sink, statsService *stats.Service,
+) (sink.Sink, error) {
+
+	if !config.GetOrDefault(c, config.PropertySinkSpoolEnabled, false) {
+		return s, nil
+	}
+
+	// Asynchronously emitted events can't be spooled in order,
+	// since later events may already be emitted when one fails
+	if config.GetOrDefault(c, config.PropertySinkAsyncEnabled, false) {
+		return nil, errors.Errorf("sink.spool.enabled can't be used together with sink.async.enabled")
+	}
+
+	path := config.GetOrDefault(c, config.PropertySinkSpoolPath, "")
+	if path == "" {
+		return nil, errors.Errorf("Sink spool needs a path to be configured")
+	}
+
+	segmentSize := config.GetOrDefault(c, config.PropertySinkSpoolSegmentSize, uint(64))
+	maxSize := config.GetOrDefault(c, config.PropertySinkSpoolMaxSize, uint(1024))
+	if segmentSize == 0 || maxSize < segmentSize {
+		return nil, errors.Errorf("Sink spool maxsize must be greater or equal to segmentsize")
+	}
+
+	spool, err := openSpool(path, int64(segmentSize)*megabyte, int64(maxSize)*megabyte)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSpoolingSink(s, spool, time.Second*5, statsService)
+}
+
+func newSpoolingSink(
+	s sink.Sink, spool *spool, retryInterval time.Duration, statsService *stats.Service,
+) (*spoolingSink, error) {
+
+	logger, err := logging.NewLogger("SpoolingSink")
+	if err != nil {
+		return nil, err
+	}
+
+	return &spoolingSink{
+		sink:           s,
+		spool:          spool,
+		retryInterval:  retryInterval,
+		logger:         logger,
+		statsReporter:  statsService.NewReporter("streamer_sink_spool"),
+		wakeup:         make(chan struct{}, 1),
+		shutdownWaiter: waiting.NewShutdownAwaiter(),
+	}, nil
+}
+
+func (s *spoolingSink) Start() error {
+	if err := s.sink.Start(); err != nil {
+		return err
+	}
+	if !s.spool.isEmpty() {
+		entries, _ := s.spool.stats()
+		s.logger.Infof("Found %d spooled events, draining them to the sink", entries)
+	}
+	go s.drain()
+	return nil
+}
+
+func (s *spoolingSink) Stop() error {
+	s.shutdownWaiter.SignalShutdown()
+	if err := s.shutdownWaiter.AwaitDone(); err != nil {
+		s.logger.Warnln("Failed to shutdown spool drainer in time")
+	}
+	if err := s.spool.close(); err != nil {
+		return err
+	}
+	return s.sink.Stop()
+}
+
+func (s *spoolingSink) Emit(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.context = context
+
+	// Events are only emitted directly if nothing is waiting in the spool
+	if s.spool.isEmpty() {
+		err := s.sink.Emit(context, timestamp, topicName, key, envelope)
+		if err == nil || sink.IsNonRetryable(err) {
+			return err
+		}
+		s.logger.Warnf("Sink unavailable, spooling events until it recovers: %s", err)
+	}
+
+	if err := s.append(timestamp, topicName, key, envelope); err != nil {
+		return err
+	}
+	s.signalDrain()
+	return nil
+}
+
+func (s *spoolingSink) EmitBatch(
+	context sink.Context, records []sink.Record,
+) error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.context = context
+
+	// Batches are only emitted directly if nothing is waiting in the spool
+	if s.spool.isEmpty() {
+		err := s.emitBatch(context, records)
+		if err == nil || sink.IsNonRetryable(err) {
+			return err
+		}
+		s.logger.Warnf("Sink unavailable, spooling events until it recovers: %s", err)
+	}
+
+	// Records of a partially emitted batch are spooled again, which
+	// may lead to duplicates, but never to lost events
+	for _, record := range records {
+		if err := s.append(record.Timestamp, record.TopicName, record.Key, record.Envelope); err != nil {
+			return err
+		}
+	}
+	s.signalDrain()
+	return nil
+}
+
+func (s *spoolingSink) emitBatch(
+	context sink.Context, records []sink.Record,
+) error {
+
+	if batchSink, ok := s.sink.(sink.BatchSink); ok {
+		return batchSink.EmitBatch(context, records)
+	}
+	for _, record := range records {
+		if err := s.sink.Emit(
+			context, record.Timestamp, record.TopicName, record.Key, record.Envelope,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *spoolingSink) append(
+	timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	typedKey, err := newTypedValue(key)
+	if err != nil {
+		return err
+	}
+	typedEnvelope, err := newTypedValue(envelope)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(spooledEntry{
+		Timestamp: timestamp,
+		TopicName: topicName,
+		Key:       typedKey,
+		Envelope:  typedEnvelope,
+	})
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	if err := s.spool.append(data); err != nil {
+		return err
+	}
+
+	s.stats.spooled++
+	s.reportStats()
+	return nil
+}
+
+func (s *spoolingSink) signalDrain() {
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (s *spoolingSink) drain() {
+	for {
+		data, err := s.spool.peek()
+		if err != nil {
+			s.logger.Errorf("Failed to read spooled event: %+v", err)
+			if !s.await(nil, time.After(s.retryInterval)) {
+				return
+			}
+			continue
+		}
+
+		if data == nil {
+			if !s.await(s.wakeup, nil) {
+				return
+			}
+			continue
+		}
+
+		rejected := false
+		if err := s.emitSpooled(data); err != nil {
+			// Spooled events are already acknowledged, rejected events can't be
+			// reported back and would block the spool forever if retried
+			if !sink.IsNonRetryable(err) {
+				s.logger.Debugf("Sink still unavailable: %s", err)
+				if !s.await(nil, time.After(s.retryInterval)) {
+					return
+				}
+				continue
+			}
+			s.logger.Errorf("Spooled event rejected by the sink, dropping it: %s", err)
+			rejected = true
+		}
+
+		if err := s.spool.commit(data); err != nil {
+			s.logger.Errorf("Failed to commit spooled event: %+v", err)
+		}
+
+		s.mutex.Lock()
+		if rejected {
+			s.stats.rejected++
+		} else {
+			s.stats.drained++
+		}
+		s.reportStats()
+		s.mutex.Unlock()
+
+		if s.spool.isEmpty() {
+			s.logger.Infoln("Spool drained, sink recovered")
+		}
+	}
+}
+
+func (s *spoolingSink) emitSpooled(
+	data []byte,
+) error {
+
+	entry := spooledEntry{}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return sink.NonRetryable(errors.Wrap(err, 0))
+	}
+
+	key, err := entry.Key.value()
+	if err != nil {
+		return sink.NonRetryable(err)
+	}
+	envelope, err := entry.Envelope.value()
+	if err != nil {
+		return sink.NonRetryable(err)
+	}
+
+	s.mutex.Lock()
+	context := s.context
+	s.mutex.Unlock()
+
+	keyStruct, _ := key.(schema.Struct)
+	envelopeStruct, _ := envelope.(schema.Struct)
+	return s.sink.Emit(context, entry.Timestamp, entry.TopicName, keyStruct, envelopeStruct)
+}
+
+// await blocks until a new event is spooled or the timeout fires,
+// nil channels are ignored. It returns false on shutdown.
+func (s *spoolingSink) await(
+	wakeup <-chan struct{}, timeout <-chan time.Time,
+) bool {
+
+	select {
+	case <-s.shutdownWaiter.AwaitShutdownChan():
+		s.shutdownWaiter.SignalDone()
+		return false
+	case <-wakeup:
+		return true
+	case <-timeout:
+		return true
+	}
+}
+
+func (s *spoolingSink) reportStats() {
+	s.stats.entries, s.stats.size = s.spool.stats()
+	s.statsReporter.Report(&s.stats)
+}
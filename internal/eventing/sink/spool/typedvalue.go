@@ -0,0 +1,201 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spool
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"reflect"
+	"time"
+)
+
+const (
+	typeNil     = "nil"
+	typeStruct  = "struct"
+	typeList    = "list"
+	typeStructs = "structs"
+)
+
+// scalarTypes are the value types, as well as pointers and slices of
+// them, which are spooled as plain JSON and restored to their exact type
+var scalarTypes = make(map[string]reflect.Type)
+
+func init() {
+	for _, value := range []any{
+		false, "", int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0), time.Time{},
+	} {
+		valueType := reflect.TypeOf(value)
+		for _, t := range []reflect.Type{valueType, reflect.PointerTo(valueType), reflect.SliceOf(valueType)} {
+			scalarTypes[t.String()] = t
+		}
+	}
+}
+
+// typedValue is the spooled representation of an event value. JSON on its
+// own loses the Go type of the value (i.e. byte slices become base64 strings
+// and all numbers become float64), hence the type is stored alongside the
+// value, to replay spooled events exactly like directly emitted events.
+type typedValue struct {
+	Type  string          `json:"t"`
+	Value json.RawMessage `json:"v,omitempty"`
+}
+
+func newTypedValue(
+	value any,
+) (*typedValue, error) {
+
+	switch v := value.(type) {
+	case nil:
+		return &typedValue{Type: typeNil}, nil
+	case schema.Struct:
+		return newTypedStruct(v)
+	case []any:
+		return newTypedList(typeList, v)
+	case []schema.Struct:
+		elements := make([]any, len(v))
+		for i, element := range v {
+			elements[i] = element
+		}
+		return newTypedList(typeStructs, elements)
+	}
+
+	typeName := reflect.TypeOf(value).String()
+	if _, ok := scalarTypes[typeName]; !ok {
+		return nil, errors.Errorf("value of type %T can't be spooled", value)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return &typedValue{Type: typeName, Value: data}, nil
+}
+
+func newTypedStruct(
+	values schema.Struct,
+) (*typedValue, error) {
+
+	if values == nil {
+		return &typedValue{Type: typeNil}, nil
+	}
+
+	typedValues := make(map[string]*typedValue, len(values))
+	for key, value := range values {
+		typed, err := newTypedValue(value)
+		if err != nil {
+			return nil, err
+		}
+		typedValues[key] = typed
+	}
+
+	data, err := json.Marshal(typedValues)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return &typedValue{Type: typeStruct, Value: data}, nil
+}
+
+func newTypedList(
+	typeName string, values []any,
+) (*typedValue, error) {
+
+	typedValues := make([]*typedValue, len(values))
+	for i, value := range values {
+		typed, err := newTypedValue(value)
+		if err != nil {
+			return nil, err
+		}
+		typedValues[i] = typed
+	}
+
+	data, err := json.Marshal(typedValues)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return &typedValue{Type: typeName, Value: data}, nil
+}
+
+// value restores the original value with its original type
+func (tv *typedValue) value() (any, error) {
+	switch tv.Type {
+	case typeNil:
+		return nil, nil
+	case typeStruct:
+		return tv.structValue()
+	case typeList:
+		return tv.listValue()
+	case typeStructs:
+		values, err := tv.listValue()
+		if err != nil {
+			return nil, err
+		}
+		structs := make([]schema.Struct, len(values))
+		for i, value := range values {
+			structs[i], _ = value.(schema.Struct)
+		}
+		return structs, nil
+	}
+
+	valueType, ok := scalarTypes[tv.Type]
+	if !ok {
+		return nil, errors.Errorf("spooled value of unknown type %s", tv.Type)
+	}
+
+	value := reflect.New(valueType)
+	if err := json.Unmarshal(tv.Value, value.Interface()); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return value.Elem().Interface(), nil
+}
+
+func (tv *typedValue) structValue() (schema.Struct, error) {
+	typedValues := make(map[string]*typedValue)
+	if err := json.Unmarshal(tv.Value, &typedValues); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	values := make(schema.Struct, len(typedValues))
+	for key, typed := range typedValues {
+		value, err := typed.value()
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+func (tv *typedValue) listValue() ([]any, error) {
+	typedValues := make([]*typedValue, 0)
+	if err := json.Unmarshal(tv.Value, &typedValues); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	values := make([]any, len(typedValues))
+	for i, typed := range typedValues {
+		value, err := typed.value()
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
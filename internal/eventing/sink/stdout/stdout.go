@@ -36,18 +36,27 @@ func newStdoutSink(
 	c *spiconfig.Config,
 ) (sink.Sink, error) {
 
-	encoder := encoding.NewJsonEncoderWithConfig(c)
+	encoder, err := encoding.NewEncoderWithConfig(c, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Plain JSON output omits the embedded schema for readability
+	_, stripSchema := encoder.(*encoding.JsonEncoder)
+
 	return sink.SinkFunc(
 		func(
-			_ sink.Context, _ time.Time, _ string, _, envelope schema.Struct,
+			_ sink.Context, _ time.Time, topicName string, _, envelope schema.Struct,
 		) error {
 
-			delete(envelope, "schema")
-			data, err := encoder.Marshal(envelope)
+			if stripSchema {
+				delete(envelope, "schema")
+			}
+			encoded, err := encoder.Encode(topicName, nil, envelope)
 			if err != nil {
 				return err
 			}
-			_, err = fmt.Fprintf(os.Stdout, "%s\n", string(data))
+			_, err = fmt.Fprintf(os.Stdout, "%s\n", string(encoded.Value))
 			return err
 		},
 	), nil
@@ -0,0 +1,174 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package topicrouting
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/expressions"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"time"
+)
+
+const RoutingKeySchemaName = "com.timescale.RoutingKey"
+
+const fieldNameKey = "key"
+
+var routingKeySchema = schema.NewSchemaBuilder(schema.STRUCT).
+	SchemaName(RoutingKeySchemaName).
+	Required().
+	Field(fieldNameKey, 0, schema.String().Required()).
+	Build()
+
+// topicRoutingSink wraps a sink and computes the topic name and key of
+// events from expressions. Expressions evaluating to nil (or an empty
+// topic name) keep the original topic name or key.
+type topicRoutingSink struct {
+	sink  sink.Sink
+	topic *expressions.TypedProgram
+	key   *expressions.TypedProgram
+}
+
+// NewTopicRoutingSinkFromConfig wraps the given sink with a topic routing
+// sink if any expression is configured, otherwise the sink is returned as is
+func NewTopicRoutingSinkFromConfig(
+	c *config.Config, s sink.Sink,
+) (sink.Sink, error) {
+
+	topicExpression := config.GetOrDefault(c, config.PropertyTopicExpression, "")
+	keyExpression := config.GetOrDefault(c, config.PropertyTopicKeyExpression, "")
+	if topicExpression == "" && keyExpression == "" {
+		return s, nil
+	}
+
+	return newTopicRoutingSink(s, topicExpression, keyExpression)
+}
+
+func newTopicRoutingSink(
+	s sink.Sink, topicExpression, keyExpression string,
+) (*topicRoutingSink, error) {
+
+	routingSink := &topicRoutingSink{
+		sink: s,
+	}
+
+	if topicExpression != "" {
+		program, err := expressions.CompileTyped(topicExpression, schema.STRING)
+		if err != nil {
+			return nil, err
+		}
+		routingSink.topic = program
+	}
+
+	if keyExpression != "" {
+		program, err := expressions.CompileTyped(keyExpression, schema.STRING)
+		if err != nil {
+			return nil, err
+		}
+		routingSink.key = program
+	}
+	return routingSink, nil
+}
+
+func (t *topicRoutingSink) Start() error {
+	return t.sink.Start()
+}
+
+func (t *topicRoutingSink) Stop() error {
+	return t.sink.Stop()
+}
+
+func (t *topicRoutingSink) Emit(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	topicName, key, err := t.route(topicName, key, envelope)
+	if err != nil {
+		return err
+	}
+	return t.sink.Emit(context, timestamp, topicName, key, envelope)
+}
+
+func (t *topicRoutingSink) EmitAsync(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) sink.Future {
+
+	topicName, key, err := t.route(topicName, key, envelope)
+	if err != nil {
+		return sink.CompletedFuture(err)
+	}
+
+	if asyncSink, ok := t.sink.(sink.AsyncSink); ok {
+		return asyncSink.EmitAsync(context, timestamp, topicName, key, envelope)
+	}
+	return sink.CompletedFuture(t.sink.Emit(context, timestamp, topicName, key, envelope))
+}
+
+func (t *topicRoutingSink) EmitBatch(
+	context sink.Context, records []sink.Record,
+) error {
+
+	routed := make([]sink.Record, 0, len(records))
+	for _, record := range records {
+		topicName, key, err := t.route(record.TopicName, record.Key, record.Envelope)
+		if err != nil {
+			return err
+		}
+		routed = append(routed, sink.Record{
+			Timestamp: record.Timestamp,
+			TopicName: topicName,
+			Key:       key,
+			Envelope:  record.Envelope,
+		})
+	}
+
+	if batchSink, ok := t.sink.(sink.BatchSink); ok {
+		return batchSink.EmitBatch(context, routed)
+	}
+
+	return sink.EmitEach(t.sink, context, routed)
+}
+
+// route evaluates the expressions against the event. Evaluation errors
+// won't go away when retried and are returned as non-retryable.
+func (t *topicRoutingSink) route(
+	topicName string, key, envelope schema.Struct,
+) (string, schema.Struct, error) {
+
+	env := expressions.NewEnvironment(topicName, key, envelope)
+
+	if t.topic != nil {
+		result, err := t.topic.Run(env)
+		if err != nil {
+			return "", nil, sink.NonRetryable(err)
+		}
+		if routedTopicName, ok := result.(string); ok && routedTopicName != "" {
+			topicName = routedTopicName
+		}
+	}
+
+	if t.key != nil {
+		result, err := t.key.Run(env)
+		if err != nil {
+			return "", nil, sink.NonRetryable(err)
+		}
+		if result != nil {
+			key = schema.Envelope(routingKeySchema, schema.Struct{fieldNameKey: result})
+		}
+	}
+	return topicName, key, nil
+}
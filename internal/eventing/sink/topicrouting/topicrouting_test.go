@@ -0,0 +1,92 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package topicrouting
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type emittedEvent struct {
+	topicName string
+	key       schema.Struct
+}
+
+func Test_TopicRoutingSink_Routes_By_Expression(
+	t *testing.T,
+) {
+
+	emitted := make([]emittedEvent, 0)
+	target := sink.SinkFunc(
+		func(_ sink.Context, _ time.Time, topicName string, key, _ schema.Struct) error {
+			emitted = append(emitted, emittedEvent{topicName, key})
+			return nil
+		},
+	)
+
+	routingSink, err := newTopicRoutingSink(
+		target, "value.after?.tenant_id != nil ? topic + '.' + string(value.after.tenant_id) : nil",
+		"value.after?.tenant_id",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	originalKey := schema.Envelope(nil, schema.Struct{"id": 1})
+	tenantEvent := schema.Envelope(nil, schema.Struct{
+		schema.FieldNameAfter: schema.Struct{"id": 1, "tenant_id": 42},
+	})
+	deleteEvent := schema.Envelope(nil, schema.Struct{
+		schema.FieldNameBefore: schema.Struct{"id": 1, "tenant_id": 42},
+	})
+
+	assert.NoError(t, routingSink.Emit(nil, time.Now(), "test.public.metrics", originalKey, tenantEvent))
+	assert.NoError(t, routingSink.EmitBatch(nil, []sink.Record{
+		{TopicName: "test.public.metrics", Key: originalKey, Envelope: deleteEvent},
+	}))
+
+	assert.Equal(t, []emittedEvent{
+		{"test.public.metrics.42", schema.Envelope(routingKeySchema, schema.Struct{"key": "42"})},
+		{"test.public.metrics", originalKey},
+	}, emitted)
+}
+
+func Test_TopicRoutingSink_Evaluation_Errors_Are_NonRetryable(
+	t *testing.T,
+) {
+
+	target := sink.SinkFunc(
+		func(_ sink.Context, _ time.Time, _ string, _, _ schema.Struct) error {
+			return nil
+		},
+	)
+
+	routingSink, err := newTopicRoutingSink(target, "value.after.tenant_id", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = routingSink.Emit(nil, time.Now(), "test", nil, schema.Envelope(nil, schema.Struct{}))
+	assert.Error(t, err)
+	assert.True(t, sink.IsNonRetryable(err))
+
+	_, err = newTopicRoutingSink(target, "topic +", "")
+	assert.ErrorContains(t, err, "failed to compile expression «topic +»")
+}
@@ -0,0 +1,349 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package unwrap
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"strings"
+	"time"
+)
+
+const sourceFieldPrefix = "source."
+
+// addedField is a source or envelope field which is appended
+// to the unwrapped row as a prefixed column
+type addedField struct {
+	columnName string
+	fieldName  string
+	source     bool
+	schema     schema.Struct
+}
+
+// unwrappingSink wraps a sink and replaces the Debezium-style change event
+// envelopes of create, update, read, and delete events with the flattened
+// row state. Deletes are either emitted as tombstones (nil value), as the
+// before row carrying a deleted flag, or dropped. Other events are passed
+// through as is.
+type unwrappingSink struct {
+	sink            sink.Sink
+	deletes         config.UnwrapDeleteMode
+	deletedField    string
+	fields          []addedField
+	dropKeySchema   bool
+	dropValueSchema bool
+	schemas         *schema.InstanceCache[schema.Struct]
+}
+
+// NewUnwrappingSinkFromConfig wraps the given sink with an unwrapping
+// sink if enabled, otherwise the sink is returned as is
+func NewUnwrappingSinkFromConfig(
+	c *config.Config, s sink.Sink,
+) (sink.Sink, error) {
+
+	if !config.GetOrDefault(c, config.PropertySinkUnwrapEnabled, false) {
+		return s, nil
+	}
+
+	deletes := config.GetOrDefault(c, config.PropertySinkUnwrapDeletes, config.TombstoneDeletes)
+	fields := config.GetOrDefault(c, config.PropertySinkUnwrapFields, []string{})
+	prefix := config.GetOrDefault(c, config.PropertySinkUnwrapPrefix, "__")
+	dropKeySchema := config.GetOrDefault(c, config.PropertySinkUnwrapDropKeySchema, false)
+	dropValueSchema := config.GetOrDefault(c, config.PropertySinkUnwrapDropValueSchema, false)
+
+	if dropKeySchema || dropValueSchema {
+		// Schema based encoders require the inline schema to generate their own
+		encodingType := config.GetOrDefault(c, config.PropertySinkEncodingType, config.JsonEncoding)
+		if encodingType != config.JsonEncoding {
+			return nil, errors.Errorf(
+				"dropping the inline schema requires the '%s' encoding, found '%s'",
+				config.JsonEncoding, encodingType,
+			)
+		}
+	}
+
+	return newUnwrappingSink(s, deletes, fields, prefix, dropKeySchema, dropValueSchema)
+}
+
+func newUnwrappingSink(
+	s sink.Sink, deletes config.UnwrapDeleteMode, fields []string,
+	prefix string, dropKeySchema, dropValueSchema bool,
+) (*unwrappingSink, error) {
+
+	switch deletes {
+	case config.TombstoneDeletes, config.FlagDeletes, config.DropDeletes:
+	default:
+		return nil, errors.Errorf("illegal unwrap delete mode: %s", deletes)
+	}
+
+	addedFields, err := resolveAddedFields(fields, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &unwrappingSink{
+		sink:            s,
+		deletes:         deletes,
+		deletedField:    fmt.Sprintf("%sdeleted", prefix),
+		fields:          addedFields,
+		dropKeySchema:   dropKeySchema,
+		dropValueSchema: dropValueSchema,
+		schemas:         schema.NewInstanceCache[schema.Struct](schema.DefaultInstanceCacheSize),
+	}, nil
+}
+
+func (u *unwrappingSink) Start() error {
+	return u.sink.Start()
+}
+
+func (u *unwrappingSink) Stop() error {
+	return u.sink.Stop()
+}
+
+func (u *unwrappingSink) Emit(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	key, envelope, skip := u.unwrap(key, envelope)
+	if skip {
+		return nil
+	}
+	return u.sink.Emit(context, timestamp, topicName, key, envelope)
+}
+
+func (u *unwrappingSink) EmitAsync(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) sink.Future {
+
+	key, envelope, skip := u.unwrap(key, envelope)
+	if skip {
+		return sink.CompletedFuture(nil)
+	}
+
+	if asyncSink, ok := u.sink.(sink.AsyncSink); ok {
+		return asyncSink.EmitAsync(context, timestamp, topicName, key, envelope)
+	}
+	return sink.CompletedFuture(u.sink.Emit(context, timestamp, topicName, key, envelope))
+}
+
+func (u *unwrappingSink) EmitBatch(
+	context sink.Context, records []sink.Record,
+) error {
+
+	unwrapped := make([]sink.Record, 0, len(records))
+	indices := make([]int, 0, len(records))
+	for index, record := range records {
+		key, envelope, skip := u.unwrap(record.Key, record.Envelope)
+		if skip {
+			continue
+		}
+		unwrapped = append(unwrapped, sink.Record{
+			Timestamp: record.Timestamp,
+			TopicName: record.TopicName,
+			Key:       key,
+			Envelope:  envelope,
+		})
+		indices = append(indices, index)
+	}
+
+	if len(unwrapped) == 0 {
+		return nil
+	}
+
+	var err error
+	if batchSink, ok := u.sink.(sink.BatchSink); ok {
+		err = batchSink.EmitBatch(context, unwrapped)
+	} else {
+		err = sink.EmitEach(u.sink, context, unwrapped)
+	}
+
+	// Failed records are reported by their index in the original batch
+	return sink.RemapBatchError(err, indices)
+}
+
+// unwrap transforms the key and envelope of an event. The returned skip
+// flag is true if the event must not be emitted at all.
+func (u *unwrappingSink) unwrap(
+	key, envelope schema.Struct,
+) (schema.Struct, schema.Struct, bool) {
+
+	if u.dropKeySchema && key != nil {
+		key, _ = key[schema.FieldNamePayload].(schema.Struct)
+	}
+
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	if payload == nil {
+		return key, u.dropSchema(envelope), false
+	}
+
+	var row schema.Struct
+	deleted := false
+	switch op, _ := payload[schema.FieldNameOperation].(string); schema.Operation(op) {
+	case schema.OP_CREATE, schema.OP_UPDATE, schema.OP_READ:
+		row, _ = payload[schema.FieldNameAfter].(schema.Struct)
+
+	case schema.OP_DELETE:
+		// The tombstone follow-up event of a delete carries an explicit nil after state
+		if _, tombstone := payload[schema.FieldNameAfter]; tombstone {
+			// In tombstone mode the delete event itself was already emitted as tombstone
+			return key, nil, u.deletes == config.TombstoneDeletes
+		}
+
+		switch u.deletes {
+		case config.DropDeletes:
+			return key, nil, true
+		case config.TombstoneDeletes:
+			return key, nil, false
+		}
+		row, _ = payload[schema.FieldNameBefore].(schema.Struct)
+		deleted = true
+
+	default:
+		return key, u.dropSchema(envelope), false
+	}
+
+	value := make(schema.Struct, len(row)+len(u.fields)+1)
+	for column, columnValue := range row {
+		value[column] = columnValue
+	}
+	if u.deletes == config.FlagDeletes {
+		value[u.deletedField] = deleted
+	}
+
+	source, _ := payload[schema.FieldNameSource].(schema.Struct)
+	for _, field := range u.fields {
+		if field.source {
+			value[field.columnName] = source[field.fieldName]
+		} else {
+			value[field.columnName] = payload[field.fieldName]
+		}
+	}
+
+	if u.dropValueSchema {
+		return key, value, false
+	}
+
+	envelopeSchema, _ := envelope[schema.FieldNameSchema].(schema.Struct)
+	return key, schema.Envelope(u.unwrappedSchema(envelopeSchema), value), false
+}
+
+func (u *unwrappingSink) dropSchema(
+	envelope schema.Struct,
+) schema.Struct {
+
+	if !u.dropValueSchema || envelope == nil {
+		return envelope
+	}
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	return payload
+}
+
+// unwrappedSchema returns the schema of the unwrapped row, which is
+// derived once per envelope schema instance
+func (u *unwrappingSink) unwrappedSchema(
+	envelopeSchema schema.Struct,
+) schema.Struct {
+
+	if envelopeSchema == nil {
+		return nil
+	}
+
+	unwrapped, _ := u.schemas.GetOrCreate("", envelopeSchema, u.deriveUnwrappedSchema)
+	return unwrapped
+}
+
+// deriveUnwrappedSchema derives the schema of the unwrapped
+// row from the after field of the envelope schema
+func (u *unwrappingSink) deriveUnwrappedSchema(
+	envelopeSchema schema.Struct,
+) (schema.Struct, error) {
+
+	unwrapped := schema.Struct{
+		schema.FieldNameType: schema.STRUCT,
+	}
+	fields := make([]schema.Struct, 0)
+
+	envelopeFields, _ := envelopeSchema[schema.FieldNameFields].([]schema.Struct)
+	for _, envelopeField := range envelopeFields {
+		if envelopeField[schema.FieldNameField] != schema.FieldNameAfter {
+			continue
+		}
+		for property, value := range envelopeField {
+			switch property {
+			case schema.FieldNameField, schema.FieldNameIndex, schema.FieldNameFields:
+			default:
+				unwrapped[property] = value
+			}
+		}
+		if rowFields, ok := envelopeField[schema.FieldNameFields].([]schema.Struct); ok {
+			fields = append(fields, rowFields...)
+		}
+	}
+
+	if u.deletes == config.FlagDeletes {
+		fields = append(fields, schema.Boolean().FieldName(u.deletedField).Build())
+	}
+	for _, field := range u.fields {
+		fields = append(fields, field.schema)
+	}
+	unwrapped[schema.FieldNameFields] = fields
+	return unwrapped, nil
+}
+
+// resolveAddedFields resolves the configured field names. Fields of the
+// source block can be referenced by name or with the "source." prefix,
+// while op, ts_ms, and tsdb_op refer to the event itself unless prefixed.
+func resolveAddedFields(
+	fields []string, prefix string,
+) ([]addedField, error) {
+
+	eventFields := map[string]schema.Builder{
+		schema.FieldNameOperation:   schema.String(),
+		schema.FieldNameTimestamp:   schema.Int64(),
+		schema.FieldNameTimescaleOp: schema.String(),
+	}
+
+	sourceFields := schema.SourceSchema().Fields()
+
+	addedFields := make([]addedField, 0, len(fields))
+	for _, field := range fields {
+		fieldName := strings.TrimPrefix(field, sourceFieldPrefix)
+		columnName := fmt.Sprintf("%s%s", prefix, strings.ReplaceAll(field, ".", "_"))
+
+		var builder schema.Builder
+		source := false
+		if eventField, ok := eventFields[field]; ok {
+			builder = eventField.Clone()
+		} else if sourceField, ok := sourceFields[fieldName]; ok {
+			builder = sourceField.SchemaBuilder().Clone()
+			source = true
+		} else {
+			return nil, errors.Errorf("unknown unwrap field: %s", field)
+		}
+
+		addedFields = append(addedFields, addedField{
+			columnName: columnName,
+			fieldName:  fieldName,
+			source:     source,
+			schema:     builder.FieldName(columnName).Index(-1).Optional().DefaultValue(nil).Build(),
+		})
+	}
+	return addedFields, nil
+}
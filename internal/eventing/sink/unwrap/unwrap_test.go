@@ -0,0 +1,235 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package unwrap
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type emittedEvent struct {
+	key      schema.Struct
+	envelope schema.Struct
+}
+
+func Test_UnwrappingSink_Unwraps_Row_State(
+	t *testing.T,
+) {
+
+	target, emitted := collectingSink()
+	unwrappingSink, err := newUnwrappingSink(
+		target, config.TombstoneDeletes, []string{"lsn", "table", "op", "source.ts_ms"}, "__", false, false,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelopeSchema := testEnvelopeSchema()
+	envelope := schema.Envelope(envelopeSchema, schema.CreateEvent(
+		schema.Struct{"id": 1, "name": "foo"}, testSource(),
+	))
+
+	assert.NoError(t, unwrappingSink.Emit(nil, time.Now(), "test", testKey(), envelope))
+	assert.NoError(t, unwrappingSink.Emit(nil, time.Now(), "test", testKey(), envelope))
+	assert.Len(t, *emitted, 2)
+
+	payload := (*emitted)[0].envelope[schema.FieldNamePayload].(schema.Struct)
+	assert.Equal(t, schema.Struct{
+		"id":             1,
+		"name":           "foo",
+		"__lsn":          "0/16B3748",
+		"__table":        "metrics",
+		"__op":           "c",
+		"__source_ts_ms": int64(1700000000000),
+	}, payload)
+
+	// The original envelope must not be modified
+	assert.NotContains(t, envelope[schema.FieldNamePayload].(schema.Struct)[schema.FieldNameAfter], "__lsn")
+
+	unwrappedSchema := (*emitted)[0].envelope[schema.FieldNameSchema].(schema.Struct)
+	assert.Equal(t, "test.Value", unwrappedSchema[schema.FieldNameName])
+	assert.NotContains(t, unwrappedSchema, schema.FieldNameField)
+
+	fieldNames := make([]string, 0)
+	for _, field := range unwrappedSchema[schema.FieldNameFields].([]schema.Struct) {
+		fieldNames = append(fieldNames, field[schema.FieldNameField].(string))
+	}
+	assert.Equal(t, []string{"id", "name", "__lsn", "__table", "__op", "__source_ts_ms"}, fieldNames)
+
+	// Unwrapped schemas are derived once per envelope schema instance
+	assert.Equal(t,
+		reflect.ValueOf(unwrappedSchema).Pointer(),
+		reflect.ValueOf((*emitted)[1].envelope[schema.FieldNameSchema]).Pointer(),
+	)
+}
+
+func Test_UnwrappingSink_Delete_Modes(
+	t *testing.T,
+) {
+
+	before := schema.Struct{"id": 1, "name": "foo"}
+	deleteEvent := schema.Envelope(testEnvelopeSchema(), schema.DeleteEvent(before, testSource(), false))
+	tombstoneEvent := schema.Envelope(testEnvelopeSchema(), schema.DeleteEvent(before, testSource(), true))
+
+	testCases := []struct {
+		deletes  config.UnwrapDeleteMode
+		expected []schema.Struct
+	}{
+		{config.TombstoneDeletes, []schema.Struct{nil}},
+		{config.FlagDeletes, []schema.Struct{{"id": 1, "name": "foo", "__deleted": true}, nil}},
+		{config.DropDeletes, []schema.Struct{nil}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(string(testCase.deletes), func(t *testing.T) {
+			target, emitted := collectingSink()
+			unwrappingSink, err := newUnwrappingSink(target, testCase.deletes, nil, "__", false, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.NoError(t, unwrappingSink.Emit(nil, time.Now(), "test", testKey(), deleteEvent))
+			assert.NoError(t, unwrappingSink.Emit(nil, time.Now(), "test", testKey(), tombstoneEvent))
+
+			envelopes := make([]schema.Struct, 0)
+			for _, event := range *emitted {
+				assert.Equal(t, testKey(), event.key)
+				envelopes = append(envelopes, event.envelope)
+			}
+			assert.Equal(t, testCase.expected, envelopes)
+		})
+	}
+}
+
+func Test_UnwrappingSink_Flags_Non_Deleted_Rows(
+	t *testing.T,
+) {
+
+	target, emitted := collectingSink()
+	unwrappingSink, err := newUnwrappingSink(target, config.FlagDeletes, nil, "_", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := schema.Envelope(testEnvelopeSchema(), schema.UpdateEvent(
+		nil, schema.Struct{"id": 1, "name": "bar"}, testSource(),
+	))
+	assert.NoError(t, unwrappingSink.Emit(nil, time.Now(), "test", nil, envelope))
+	assert.Len(t, *emitted, 1)
+	assert.Equal(t,
+		schema.Struct{"id": 1, "name": "bar", "_deleted": false},
+		(*emitted)[0].envelope[schema.FieldNamePayload],
+	)
+}
+
+func Test_UnwrappingSink_Drops_Schemas(
+	t *testing.T,
+) {
+
+	target, emitted := collectingSink()
+	unwrappingSink, err := newUnwrappingSink(target, config.TombstoneDeletes, nil, "__", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []sink.Record{
+		{
+			TopicName: "test",
+			Key:       testKey(),
+			Envelope: schema.Envelope(testEnvelopeSchema(), schema.ReadEvent(
+				schema.Struct{"id": 1, "name": "foo"}, testSource(),
+			)),
+		},
+		{
+			TopicName: "test.transaction",
+			Key:       schema.Envelope(schema.TransactionKeySchema(), schema.TransactionKey("42")),
+			Envelope:  schema.Envelope(schema.Struct{}, schema.Struct{schema.FieldNameStatus: "BEGIN"}),
+		},
+	}
+
+	assert.NoError(t, unwrappingSink.EmitBatch(nil, records))
+	assert.Equal(t, []emittedEvent{
+		{
+			key:      schema.Struct{"id": 1},
+			envelope: schema.Struct{"id": 1, "name": "foo"},
+		},
+		{
+			key:      schema.TransactionKey("42"),
+			envelope: schema.Struct{schema.FieldNameStatus: "BEGIN"},
+		},
+	}, *emitted)
+}
+
+func Test_UnwrappingSink_Rejects_Unknown_Fields(
+	t *testing.T,
+) {
+
+	_, err := newUnwrappingSink(nil, config.TombstoneDeletes, []string{"source.foo"}, "__", false, false)
+	assert.ErrorContains(t, err, "unknown unwrap field: source.foo")
+
+	_, err = newUnwrappingSink(nil, config.UnwrapDeleteMode("rewrite"), nil, "__", false, false)
+	assert.ErrorContains(t, err, "illegal unwrap delete mode: rewrite")
+}
+
+func collectingSink() (sink.Sink, *[]emittedEvent) {
+	emitted := make([]emittedEvent, 0)
+	return sink.SinkFunc(
+		func(_ sink.Context, _ time.Time, _ string, key, envelope schema.Struct) error {
+			emitted = append(emitted, emittedEvent{key, envelope})
+			return nil
+		},
+	), &emitted
+}
+
+func testEnvelopeSchema() schema.Struct {
+	rowSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("test.Value").
+		Field("id", 0, schema.Int32().Required()).
+		Field("name", 1, schema.String())
+
+	return schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("test.Envelope").
+		Required().
+		Field(schema.FieldNameBefore, -1, rowSchema.Clone()).
+		Field(schema.FieldNameAfter, -1, rowSchema.Clone().Required()).
+		Field(schema.FieldNameSource, -1, schema.SourceSchema()).
+		Field(schema.FieldNameOperation, -1, schema.String().Required()).
+		Field(schema.FieldNameTimestamp, -1, schema.Int64()).
+		Build()
+}
+
+func testKey() schema.Struct {
+	return schema.Envelope(
+		schema.NewSchemaBuilder(schema.STRUCT).
+			SchemaName("test.Key").
+			Field("id", 0, schema.Int32().Required()).
+			Build(),
+		schema.Struct{"id": 1},
+	)
+}
+
+func testSource() schema.Struct {
+	xid := uint32(42)
+	return schema.Source(
+		23803720, time.UnixMilli(1700000000000), false, "tsdb", "public", "metrics", &xid,
+	)
+}
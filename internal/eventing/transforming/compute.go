@@ -0,0 +1,151 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transforming
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/expressions"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/transform"
+)
+
+func init() {
+	RegisterTransform(config.ComputeTransform, newComputeTransform)
+}
+
+type computedField struct {
+	field   string
+	program *expressions.TypedProgram
+}
+
+// computeTransform adds fields computed by expressions to the after row.
+// Fields are computed in order of their definition, hence expressions can
+// refer to previously computed fields. Events without after row (i.e.
+// deletes) aren't modified.
+type computeTransform struct {
+	fields  []computedField
+	schemas *schemaCache
+}
+
+func newComputeTransform(
+	c config.TransformConfig,
+) (transform.Transform, error) {
+
+	if len(c.Computed) == 0 {
+		return nil, errors.Errorf("compute transform requires computed fields")
+	}
+
+	fields := make([]computedField, 0, len(c.Computed))
+	for _, computed := range c.Computed {
+		if computed.Field == "" {
+			return nil, errors.Errorf("computed field requires a field name")
+		}
+
+		schemaType := schema.Type(computed.Type)
+		if schemaType == "" {
+			schemaType = schema.STRING
+		}
+
+		program, err := expressions.CompileTyped(computed.Expression, schemaType)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, fmt.Sprintf("computed field '%s'", computed.Field), 0)
+		}
+
+		fields = append(fields, computedField{
+			field:   computed.Field,
+			program: program,
+		})
+	}
+
+	return &computeTransform{
+		fields:  fields,
+		schemas: newSchemaCache(),
+	}, nil
+}
+
+func (c *computeTransform) Transform(
+	key, value schema.Struct,
+) (schema.Struct, schema.Struct, error) {
+
+	payload, _ := value[schema.FieldNamePayload].(schema.Struct)
+	row, _ := payload[schema.FieldNameAfter].(schema.Struct)
+	if row == nil {
+		return key, value, nil
+	}
+
+	env := expressions.NewEnvironment("", key, value)
+	for _, field := range c.fields {
+		result, err := field.program.Run(env)
+		if err != nil {
+			return nil, nil, err
+		}
+		row[field.field] = result
+	}
+
+	valueSchema, _ := value[schema.FieldNameSchema].(schema.Struct)
+	derived, err := c.schemas.derive(valueSchema, c.envelopeSchema)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, schema.Envelope(derived, payload), nil
+}
+
+func (c *computeTransform) envelopeSchema(
+	envelopeSchema schema.Struct,
+) (schema.Struct, error) {
+
+	derived := cloneStruct(envelopeSchema)
+	fields, _ := envelopeSchema[schema.FieldNameFields].([]schema.Struct)
+	derivedFields := make([]schema.Struct, 0, len(fields))
+	for _, field := range fields {
+		if fieldNameOf(field) == schema.FieldNameAfter {
+			field = c.rowSchema(field)
+		}
+		derivedFields = append(derivedFields, field)
+	}
+	derived[schema.FieldNameFields] = derivedFields
+	return derived, nil
+}
+
+func (c *computeTransform) rowSchema(
+	rowSchema schema.Struct,
+) schema.Struct {
+
+	computed := make(map[string]bool, len(c.fields))
+	for _, field := range c.fields {
+		computed[field.field] = true
+	}
+
+	derived := cloneStruct(rowSchema)
+	fields, _ := rowSchema[schema.FieldNameFields].([]schema.Struct)
+	derivedFields := make([]schema.Struct, 0, len(fields)+len(c.fields))
+	for _, field := range fields {
+		// Computed fields replace existing columns of the same name
+		if !computed[fieldNameOf(field)] {
+			derivedFields = append(derivedFields, field)
+		}
+	}
+	for _, field := range c.fields {
+		derivedFields = append(derivedFields,
+			schema.NewSchemaBuilder(field.program.SchemaType()).FieldName(field.field).Optional().Build(),
+		)
+	}
+	derived[schema.FieldNameFields] = derivedFields
+	return derived
+}
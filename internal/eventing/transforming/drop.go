@@ -0,0 +1,71 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transforming
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/transform"
+	"github.com/samber/lo"
+)
+
+func init() {
+	RegisterTransform(config.DropTransform, newDropTransform)
+}
+
+// dropTransformer removes columns from rows, keys aren't
+// modified to keep the event identity intact
+type dropTransformer struct {
+	fields map[string]bool
+}
+
+func newDropTransform(
+	c config.TransformConfig,
+) (transform.Transform, error) {
+
+	if len(c.Fields) == 0 {
+		return nil, errors.Errorf("drop transform requires fields")
+	}
+
+	fields := lo.SliceToMap(c.Fields, func(field string) (string, bool) {
+		return field, true
+	})
+	return newRowTransform(&dropTransformer{fields: fields}, false), nil
+}
+
+func (d *dropTransformer) transformFields(
+	fields []schema.Struct,
+) []schema.Struct {
+
+	return lo.Filter(fields, func(field schema.Struct, _ int) bool {
+		return !d.fields[fieldNameOf(field)]
+	})
+}
+
+func (d *dropTransformer) transformRow(
+	row schema.Struct,
+) (schema.Struct, error) {
+
+	transformed := make(schema.Struct, len(row))
+	for column, value := range row {
+		if !d.fields[column] {
+			transformed[column] = value
+		}
+	}
+	return transformed, nil
+}
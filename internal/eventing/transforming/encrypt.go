@@ -0,0 +1,230 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transforming
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/encryption"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/samber/lo"
+	"sync"
+)
+
+const (
+	encryptedSchemaName          = "com.timescale.Encrypted"
+	encryptionKeyIdParameter     = "keyId"
+	encryptionAlgorithmParameter = "algorithm"
+)
+
+// NewEncryptionStage creates the stage encrypting the columns selected
+// by the configured column patterns (schema.table.column). It returns
+// an identity chain if no columns are configured.
+func NewEncryptionStage(
+	c *config.Config,
+) (TransformChain, error) {
+
+	columns := config.GetOrDefault(c, config.PropertySinkEncryptionColumns, []string{})
+	if len(columns) == 0 {
+		return identityTransformChain, nil
+	}
+
+	columnFilter, err := tablefiltering.NewColumnFilter([]string{}, columns)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	keyring, err := encryption.NewKeyringFromConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEncryptionStage(columnFilter, keyring), nil
+}
+
+// encryptionStage encrypts the selected columns of keys and value rows
+// with AES-GCM. Since column patterns are table specific, a row transform
+// is created per table. Primary key columns are encrypted deterministically,
+// so that equal keys keep ending up in the same partition of key based sinks.
+type encryptionStage struct {
+	columnFilter *tablefiltering.ColumnFilter
+	keyring      *encryption.Keyring
+	mutex        sync.Mutex
+	transforms   map[string]*rowTransform
+}
+
+func newEncryptionStage(
+	columnFilter *tablefiltering.ColumnFilter, keyring *encryption.Keyring,
+) *encryptionStage {
+
+	return &encryptionStage{
+		columnFilter: columnFilter,
+		keyring:      keyring,
+		transforms:   make(map[string]*rowTransform),
+	}
+}
+
+func (e *encryptionStage) Apply(
+	table schema.TableAlike, key, value schema.Struct,
+) (schema.Struct, schema.Struct, error) {
+
+	if table == nil {
+		return key, value, nil
+	}
+
+	transform, transformer := e.tableTransform(table)
+
+	// Skip tables without selected columns. Checked against the current
+	// columns, since schema changes may add matching columns at any time
+	if !lo.SomeBy(table.TableColumns(), func(column schema.ColumnAlike) bool {
+		return transformer.selected(column.Name())
+	}) {
+		return key, value, nil
+	}
+	return transform.Transform(key, value)
+}
+
+func (e *encryptionStage) tableTransform(
+	table schema.TableAlike,
+) (*rowTransform, *encryptTransformer) {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	canonicalName := table.CanonicalName()
+	if transform, present := e.transforms[canonicalName]; present {
+		return transform, transform.transformer.(*encryptTransformer)
+	}
+
+	transformer := &encryptTransformer{
+		table:        table,
+		columnFilter: e.columnFilter,
+		keyring:      e.keyring,
+		columns:      make(map[string]columnEncryption),
+	}
+	transform := newRowTransform(transformer, true)
+	e.transforms[canonicalName] = transform
+	return transform, transformer
+}
+
+type columnEncryption int
+
+const (
+	columnNotEncrypted columnEncryption = iota
+	columnEncrypted
+	columnEncryptedDeterministic
+)
+
+// encryptTransformer replaces the values of the selected columns by
+// their AES-GCM encrypted JSON representation. The schema.table.column
+// name is used as associated data, binding the ciphertext to its column.
+type encryptTransformer struct {
+	table        schema.TableAlike
+	columnFilter *tablefiltering.ColumnFilter
+	keyring      *encryption.Keyring
+	mutex        sync.Mutex
+	columns      map[string]columnEncryption
+}
+
+func (e *encryptTransformer) selected(
+	column string,
+) bool {
+
+	return e.encryption(column) != columnNotEncrypted
+}
+
+func (e *encryptTransformer) encryption(
+	column string,
+) columnEncryption {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	mode, present := e.columns[column]
+	if !present {
+		mode = columnNotEncrypted
+		if e.columnFilter.Matches(e.table, column) {
+			mode = columnEncrypted
+			if lo.SomeBy(e.table.TableColumns(), func(item schema.ColumnAlike) bool {
+				return item.Name() == column && item.IsPrimaryKey()
+			}) {
+				mode = columnEncryptedDeterministic
+			}
+		}
+		e.columns[column] = mode
+	}
+	return mode
+}
+
+func (e *encryptTransformer) transformFields(
+	fields []schema.Struct,
+) []schema.Struct {
+
+	transformed := make([]schema.Struct, 0, len(fields))
+	for _, field := range fields {
+		if e.selected(fieldNameOf(field)) {
+			field = retypeField(field, schema.BYTES)
+			// Key schema elements carry the field name as name, hence
+			// the encryption properties are added to the wrapped type
+			target := field
+			if isKeySchemaElement(field) {
+				target = field[schema.FieldNameSchema].(schema.Struct)
+			}
+			target[schema.FieldNameName] = encryptedSchemaName
+			target[encryptionKeyIdParameter] = e.keyring.ActiveKeyId()
+			target[encryptionAlgorithmParameter] = encryption.Algorithm
+		}
+		transformed = append(transformed, field)
+	}
+	return transformed
+}
+
+func (e *encryptTransformer) transformRow(
+	row schema.Struct,
+) (schema.Struct, error) {
+
+	transformed := make(schema.Struct, len(row))
+	for column, value := range row {
+		if mode := e.encryption(column); value != nil && mode != columnNotEncrypted {
+			plaintext, err := json.Marshal(value)
+			if err != nil {
+				return nil, errors.Errorf("failed encoding column '%s' for encryption: %s", column, err)
+			}
+			encrypt := e.keyring.Encrypt
+			if mode == columnEncryptedDeterministic {
+				encrypt = e.keyring.EncryptDeterministic
+			}
+			ciphertext, err := encrypt(plaintext, []byte(e.associatedData(column)))
+			if err != nil {
+				return nil, err
+			}
+			value = ciphertext
+		}
+		transformed[column] = value
+	}
+	return transformed, nil
+}
+
+func (e *encryptTransformer) associatedData(
+	column string,
+) string {
+
+	return fmt.Sprintf("%s.%s.%s", e.table.SchemaName(), e.table.TableName(), column)
+}
@@ -0,0 +1,164 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transforming
+
+import (
+	"encoding/json"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/encryption"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Encryption_Stage(
+	t *testing.T,
+) {
+
+	keyring, err := encryption.NewKeyring("k2", map[string][]byte{
+		"k1": []byte("0123456789abcdef"),
+		"k2": []byte("0123456789abcdef0123456789abcdef"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columnFilter, err := tablefiltering.NewColumnFilter([]string{}, []string{`public.metrics."name"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stage := newEncryptionStage(columnFilter, keyring)
+	metrics := makeHypertableWithColumns("public", "metrics", "id", "name", "ts")
+
+	key, value, err := stage.Apply(metrics, testKey(), testValue())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys aren't encrypted
+	assert.Equal(t, schema.Struct{"id": 1}, key[schema.FieldNamePayload])
+
+	ciphertext, ok := after(value)["name"].([]byte)
+	assert.True(t, ok)
+	assert.Equal(t, 1, after(value)["id"])
+
+	// The key id is part of the ciphertext
+	keyId, _, err := encryption.KeyIdOf(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "k2", keyId)
+
+	plaintext, err := keyring.Decrypt(ciphertext, []byte("public.metrics.name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	assert.NoError(t, json.Unmarshal(plaintext, &name))
+	assert.Equal(t, "foo", name)
+
+	// The ciphertext is bound to its column
+	_, err = keyring.Decrypt(ciphertext, []byte("public.metrics.id"))
+	assert.Error(t, err)
+
+	field := rowSchema(value)[schema.FieldNameFields].([]schema.Struct)[1]
+	assert.Equal(t, "name", field[schema.FieldNameField])
+	assert.Equal(t, schema.BYTES, field[schema.FieldNameType])
+	assert.Equal(t, encryptedSchemaName, field[schema.FieldNameName])
+	assert.Equal(t, "k2", field[encryptionKeyIdParameter])
+	assert.Equal(t, encryption.Algorithm, field[encryptionAlgorithmParameter])
+
+	// Tables without selected columns are passed through
+	devices := makeHypertableWithColumns("public", "devices", "id", "name", "ts")
+	_, value, err = stage.Apply(devices, testKey(), testValue())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "foo", after(value)["name"])
+}
+
+func Test_Encryption_Stage_Primary_Key_Columns(
+	t *testing.T,
+) {
+
+	keyring, err := encryption.NewKeyring("k1", map[string][]byte{
+		"k1": []byte("0123456789abcdef"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columnFilter, err := tablefiltering.NewColumnFilter([]string{}, []string{`public.metrics."id"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stage := newEncryptionStage(columnFilter, keyring)
+	metrics := makeHypertable("public", "metrics")
+	metrics.ApplyTableSchema([]systemcatalog.Column{
+		systemcatalog.NewIndexColumn(
+			"id", 25, -1, nil, false, true, nil, nil, true, nil,
+			systemcatalog.ASC, systemcatalog.NULLS_LAST, false, false, nil, nil, nil,
+		),
+		systemcatalog.NewColumn("name", 25, -1, nil, true, nil),
+		systemcatalog.NewColumn("ts", 25, -1, nil, true, nil),
+	})
+
+	key1, value1, err := stage.Apply(metrics, testKey(), testValue())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, value2, err := stage.Apply(metrics, testKey(), testValue())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Primary key columns are encrypted in the key, deterministically
+	keyCiphertext, ok := key1[schema.FieldNamePayload].(schema.Struct)["id"].([]byte)
+	assert.True(t, ok)
+	assert.Equal(t, keyCiphertext, key2[schema.FieldNamePayload].(schema.Struct)["id"])
+	assert.Equal(t, keyCiphertext, after(value1)["id"])
+	assert.Equal(t, keyCiphertext, after(value2)["id"])
+
+	plaintext, err := keyring.Decrypt(keyCiphertext, []byte("public.metrics.id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1", string(plaintext))
+
+	field := key1[schema.FieldNameSchema].(schema.Struct)[schema.FieldNameFields].([]schema.Struct)[0]
+	assert.Equal(t, "id", field[schema.FieldNameName])
+	fieldType := field[schema.FieldNameSchema].(schema.Struct)
+	assert.Equal(t, string(schema.BYTES), fieldType[schema.FieldNameType])
+	assert.Equal(t, encryptedSchemaName, fieldType[schema.FieldNameName])
+	assert.Equal(t, "k1", fieldType[encryptionKeyIdParameter])
+}
+
+func makeHypertableWithColumns(
+	schemaName, tableName string, columnNames ...string,
+) *systemcatalog.Hypertable {
+
+	hypertable := makeHypertable(schemaName, tableName)
+	columns := make([]systemcatalog.Column, 0, len(columnNames))
+	for _, columnName := range columnNames {
+		columns = append(columns, systemcatalog.NewColumn(columnName, 25, -1, nil, true, nil))
+	}
+	hypertable.ApplyTableSchema(columns)
+	return hypertable
+}
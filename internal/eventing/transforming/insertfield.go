@@ -0,0 +1,78 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transforming
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/transform"
+	"github.com/samber/lo"
+	"slices"
+)
+
+func init() {
+	RegisterTransform(config.InsertFieldTransform, newInsertFieldTransform)
+}
+
+// insertFieldTransformer adds static string columns to rows
+type insertFieldTransformer struct {
+	values map[string]string
+	fields []schema.Struct
+}
+
+func newInsertFieldTransform(
+	c config.TransformConfig,
+) (transform.Transform, error) {
+
+	if len(c.Values) == 0 {
+		return nil, errors.Errorf("insertfield transform requires values")
+	}
+
+	names := lo.Keys(c.Values)
+	slices.Sort(names)
+
+	fields := make([]schema.Struct, 0, len(names))
+	for _, name := range names {
+		fields = append(fields, schema.String().FieldName(name).Build())
+	}
+	return newRowTransform(&insertFieldTransformer{values: c.Values, fields: fields}, false), nil
+}
+
+func (i *insertFieldTransformer) transformFields(
+	fields []schema.Struct,
+) []schema.Struct {
+
+	transformed := make([]schema.Struct, 0, len(fields)+len(i.fields))
+	for _, field := range fields {
+		// Inserted fields replace existing columns of the same name
+		if _, present := i.values[fieldNameOf(field)]; !present {
+			transformed = append(transformed, field)
+		}
+	}
+	return append(transformed, i.fields...)
+}
+
+func (i *insertFieldTransformer) transformRow(
+	row schema.Struct,
+) (schema.Struct, error) {
+
+	for name, value := range i.values {
+		row[name] = value
+	}
+	return row, nil
+}
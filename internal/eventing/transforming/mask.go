@@ -0,0 +1,110 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transforming
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/transform"
+	"github.com/samber/lo"
+)
+
+func init() {
+	RegisterTransform(config.MaskTransform, newMaskTransform)
+}
+
+const (
+	maskModeHash   = "hash"
+	maskModeRedact = "redact"
+)
+
+// maskTransformer masks the values of columns in keys and rows. Hashed
+// values are replaced by the hex encoded SHA-256 hash of their string
+// representation, redacted values are replaced by null.
+type maskTransformer struct {
+	fields map[string]bool
+	redact bool
+}
+
+func newMaskTransform(
+	c config.TransformConfig,
+) (transform.Transform, error) {
+
+	if len(c.Fields) == 0 {
+		return nil, errors.Errorf("mask transform requires fields")
+	}
+
+	mode := c.Mode
+	if mode == "" {
+		mode = maskModeHash
+	}
+	if mode != maskModeHash && mode != maskModeRedact {
+		return nil, errors.Errorf("illegal mask mode: %s", mode)
+	}
+
+	fields := lo.SliceToMap(c.Fields, func(field string) (string, bool) {
+		return field, true
+	})
+	return newRowTransform(&maskTransformer{fields: fields, redact: mode == maskModeRedact}, true), nil
+}
+
+func (m *maskTransformer) transformFields(
+	fields []schema.Struct,
+) []schema.Struct {
+
+	transformed := make([]schema.Struct, 0, len(fields))
+	for _, field := range fields {
+		if m.fields[fieldNameOf(field)] {
+			if m.redact {
+				field = optionalField(field)
+			} else {
+				field = retypeField(field, schema.STRING)
+			}
+		}
+		transformed = append(transformed, field)
+	}
+	return transformed
+}
+
+func (m *maskTransformer) transformRow(
+	row schema.Struct,
+) (schema.Struct, error) {
+
+	transformed := make(schema.Struct, len(row))
+	for column, value := range row {
+		if m.fields[column] {
+			value = m.mask(value)
+		}
+		transformed[column] = value
+	}
+	return transformed, nil
+}
+
+func (m *maskTransformer) mask(
+	value any,
+) any {
+
+	if m.redact || value == nil {
+		return nil
+	}
+	hash := sha256.Sum256([]byte(fmt.Sprint(value)))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,71 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transforming
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/transform"
+)
+
+func init() {
+	RegisterTransform(config.RenameTransform, newRenameTransform)
+}
+
+// renameTransformer renames columns of keys and rows
+type renameTransformer struct {
+	renames map[string]string
+}
+
+func newRenameTransform(
+	c config.TransformConfig,
+) (transform.Transform, error) {
+
+	if len(c.Renames) == 0 {
+		return nil, errors.Errorf("rename transform requires renames")
+	}
+	return newRowTransform(&renameTransformer{renames: c.Renames}, true), nil
+}
+
+func (r *renameTransformer) transformFields(
+	fields []schema.Struct,
+) []schema.Struct {
+
+	transformed := make([]schema.Struct, 0, len(fields))
+	for _, field := range fields {
+		if newName, ok := r.renames[fieldNameOf(field)]; ok {
+			field = renameField(field, newName)
+		}
+		transformed = append(transformed, field)
+	}
+	return transformed
+}
+
+func (r *renameTransformer) transformRow(
+	row schema.Struct,
+) (schema.Struct, error) {
+
+	transformed := make(schema.Struct, len(row))
+	for column, value := range row {
+		if newName, ok := r.renames[column]; ok {
+			column = newName
+		}
+		transformed[column] = value
+	}
+	return transformed, nil
+}
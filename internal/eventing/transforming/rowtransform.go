@@ -0,0 +1,239 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transforming
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+)
+
+// rowTransformer transforms the columns of rows and the
+// field schemas describing them
+type rowTransformer interface {
+	transformFields(
+		fields []schema.Struct,
+	) []schema.Struct
+	transformRow(
+		row schema.Struct,
+	) (schema.Struct, error)
+}
+
+// rowTransform applies a rowTransformer to the before and after rows
+// of value envelopes and, if enabled, to the row of key envelopes
+type rowTransform struct {
+	transformer rowTransformer
+	keys        bool
+	schemas     *schemaCache
+}
+
+func newRowTransform(
+	transformer rowTransformer, keys bool,
+) *rowTransform {
+
+	return &rowTransform{
+		transformer: transformer,
+		keys:        keys,
+		schemas:     newSchemaCache(),
+	}
+}
+
+func (r *rowTransform) Transform(
+	key, value schema.Struct,
+) (schema.Struct, schema.Struct, error) {
+
+	if r.keys && key != nil {
+		keySchema, _ := key[schema.FieldNameSchema].(schema.Struct)
+		keyPayload, _ := key[schema.FieldNamePayload].(schema.Struct)
+
+		if keyPayload != nil {
+			row, err := r.transformer.transformRow(keyPayload)
+			if err != nil {
+				return nil, nil, err
+			}
+			keyPayload = row
+		}
+		derived, err := r.schemas.derive(keySchema, r.transformStructSchema)
+		if err != nil {
+			return nil, nil, err
+		}
+		key = schema.Envelope(derived, keyPayload)
+	}
+
+	if value != nil {
+		valueSchema, _ := value[schema.FieldNameSchema].(schema.Struct)
+		valuePayload, _ := value[schema.FieldNamePayload].(schema.Struct)
+
+		if valuePayload != nil {
+			for _, fieldName := range []string{schema.FieldNameBefore, schema.FieldNameAfter} {
+				if row, ok := valuePayload[fieldName].(schema.Struct); ok && row != nil {
+					transformed, err := r.transformer.transformRow(row)
+					if err != nil {
+						return nil, nil, err
+					}
+					valuePayload[fieldName] = transformed
+				}
+			}
+		}
+		derived, err := r.schemas.derive(valueSchema, r.transformEnvelopeSchema)
+		if err != nil {
+			return nil, nil, err
+		}
+		value = schema.Envelope(derived, valuePayload)
+	}
+	return key, value, nil
+}
+
+func (r *rowTransform) transformStructSchema(
+	structSchema schema.Struct,
+) (schema.Struct, error) {
+
+	derived := cloneStruct(structSchema)
+	fields, _ := structSchema[schema.FieldNameFields].([]schema.Struct)
+	derived[schema.FieldNameFields] = r.transformer.transformFields(fields)
+	return derived, nil
+}
+
+func (r *rowTransform) transformEnvelopeSchema(
+	envelopeSchema schema.Struct,
+) (schema.Struct, error) {
+
+	derived := cloneStruct(envelopeSchema)
+	fields, _ := envelopeSchema[schema.FieldNameFields].([]schema.Struct)
+	derivedFields := make([]schema.Struct, 0, len(fields))
+	for _, field := range fields {
+		switch field[schema.FieldNameField] {
+		case schema.FieldNameBefore, schema.FieldNameAfter:
+			field, _ = r.transformStructSchema(field)
+		}
+		derivedFields = append(derivedFields, field)
+	}
+	derived[schema.FieldNameFields] = derivedFields
+	return derived, nil
+}
+
+// schemaCache derives schemas once per instance of the original schema,
+// which keeps derived schemas stable and the schema caches of the encoders
+// working. Failed derivations aren't cached.
+type schemaCache struct {
+	schemas *schema.InstanceCache[schema.Struct]
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{
+		schemas: schema.NewInstanceCache[schema.Struct](schema.DefaultInstanceCacheSize),
+	}
+}
+
+func (sc *schemaCache) derive(
+	original schema.Struct, fn func(original schema.Struct) (schema.Struct, error),
+) (schema.Struct, error) {
+
+	if original == nil {
+		return nil, nil
+	}
+	return sc.schemas.GetOrCreate("", original, fn)
+}
+
+func cloneStruct(
+	s schema.Struct,
+) schema.Struct {
+
+	clone := make(schema.Struct, len(s))
+	for key, value := range s {
+		clone[key] = value
+	}
+	return clone
+}
+
+// isKeySchemaElement returns true if the field schema is a key schema
+// element, which carries the field name as name and wraps the type
+func isKeySchemaElement(
+	field schema.Struct,
+) bool {
+
+	_, wrapped := field[schema.FieldNameSchema].(schema.Struct)
+	_, typed := field[schema.FieldNameType]
+	return wrapped && !typed
+}
+
+func fieldNameOf(
+	field schema.Struct,
+) string {
+
+	fieldName := schema.FieldNameField
+	if isKeySchemaElement(field) {
+		fieldName = schema.FieldNameName
+	}
+	name, _ := field[fieldName].(string)
+	return name
+}
+
+func renameField(
+	field schema.Struct, name string,
+) schema.Struct {
+
+	renamed := cloneStruct(field)
+	if isKeySchemaElement(field) {
+		renamed[schema.FieldNameName] = name
+	} else {
+		renamed[schema.FieldNameField] = name
+	}
+	return renamed
+}
+
+func optionalField(
+	field schema.Struct,
+) schema.Struct {
+
+	optional := cloneStruct(field)
+	if isKeySchemaElement(field) {
+		nested := cloneStruct(field[schema.FieldNameSchema].(schema.Struct))
+		nested[schema.FieldNameOptional] = true
+		optional[schema.FieldNameSchema] = nested
+	} else {
+		optional[schema.FieldNameOptional] = true
+	}
+	return optional
+}
+
+// retypeField creates a copy of the field schema with the given type,
+// dropping the properties which are specific to the original type
+func retypeField(
+	field schema.Struct, schemaType schema.Type,
+) schema.Struct {
+
+	if isKeySchemaElement(field) {
+		retyped := cloneStruct(field)
+		nested := field[schema.FieldNameSchema].(schema.Struct)
+		retyped[schema.FieldNameSchema] = schema.Struct{
+			schema.FieldNameType:     string(schemaType),
+			schema.FieldNameOptional: nested[schema.FieldNameOptional],
+		}
+		return retyped
+	}
+
+	retyped := schema.Struct{
+		schema.FieldNameType: schemaType,
+	}
+	for _, property := range []string{
+		schema.FieldNameField, schema.FieldNameIndex, schema.FieldNameOptional,
+	} {
+		if value, present := field[property]; present {
+			retyped[property] = value
+		}
+	}
+	return retyped
+}
@@ -0,0 +1,143 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transforming
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/transform"
+	"github.com/samber/lo"
+	"time"
+)
+
+func init() {
+	RegisterTransform(config.TimestampConvertTransform, newTimestampConvertTransform)
+}
+
+const (
+	timestampModeUnix   = "unix"
+	timestampModeString = "string"
+)
+
+// timestampLayouts are the text representations of
+// timestamp, timestamptz, and date values
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	time.DateOnly,
+}
+
+// timestampConvertTransformer converts timestamp columns of keys and rows
+// between epoch milliseconds (unix) and their text representation (string)
+type timestampConvertTransformer struct {
+	fields map[string]bool
+	unix   bool
+	format string
+}
+
+func newTimestampConvertTransform(
+	c config.TransformConfig,
+) (transform.Transform, error) {
+
+	if len(c.Fields) == 0 {
+		return nil, errors.Errorf("timestampconvert transform requires fields")
+	}
+	if c.Mode != timestampModeUnix && c.Mode != timestampModeString {
+		return nil, errors.Errorf("illegal timestampconvert mode: %s", c.Mode)
+	}
+
+	format := c.Format
+	if format == "" {
+		format = time.RFC3339Nano
+	}
+
+	fields := lo.SliceToMap(c.Fields, func(field string) (string, bool) {
+		return field, true
+	})
+	return newRowTransform(&timestampConvertTransformer{
+		fields: fields,
+		unix:   c.Mode == timestampModeUnix,
+		format: format,
+	}, true), nil
+}
+
+func (t *timestampConvertTransformer) transformFields(
+	fields []schema.Struct,
+) []schema.Struct {
+
+	schemaType := schema.STRING
+	if t.unix {
+		schemaType = schema.INT64
+	}
+
+	transformed := make([]schema.Struct, 0, len(fields))
+	for _, field := range fields {
+		if t.fields[fieldNameOf(field)] {
+			field = retypeField(field, schemaType)
+		}
+		transformed = append(transformed, field)
+	}
+	return transformed
+}
+
+func (t *timestampConvertTransformer) transformRow(
+	row schema.Struct,
+) (schema.Struct, error) {
+
+	for column := range t.fields {
+		value, present := row[column]
+		if !present || value == nil {
+			continue
+		}
+
+		timestamp, err := t.parse(value)
+		if err != nil {
+			return nil, errors.Errorf("column '%s': %s", column, err)
+		}
+
+		if t.unix {
+			row[column] = timestamp.UnixMilli()
+		} else {
+			row[column] = timestamp.UTC().Format(t.format)
+		}
+	}
+	return row, nil
+}
+
+func (t *timestampConvertTransformer) parse(
+	value any,
+) (time.Time, error) {
+
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case int64:
+		return time.UnixMilli(v), nil
+	case int:
+		return time.UnixMilli(int64(v)), nil
+	case float64:
+		return time.UnixMilli(int64(v)), nil
+	case string:
+		for _, layout := range append([]string{t.format}, timestampLayouts...) {
+			if timestamp, err := time.Parse(layout, v); err == nil {
+				return timestamp, nil
+			}
+		}
+	}
+	return time.Time{}, errors.Errorf("unsupported timestamp value: %v", value)
+}
@@ -0,0 +1,142 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transforming
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/transform"
+)
+
+type TransformChain interface {
+	Apply(
+		table schema.TableAlike, key, value schema.Struct,
+	) (schema.Struct, schema.Struct, error)
+}
+
+type transformChainFunc func(
+	table schema.TableAlike, key, value schema.Struct,
+) (schema.Struct, schema.Struct, error)
+
+func (tcf transformChainFunc) Apply(
+	table schema.TableAlike, key, value schema.Struct,
+) (schema.Struct, schema.Struct, error) {
+
+	return tcf(table, key, value)
+}
+
+var identityTransformChain transformChainFunc = func(
+	_ schema.TableAlike, key, value schema.Struct,
+) (schema.Struct, schema.Struct, error) {
+
+	return key, value, nil
+}
+
+// chainElement is a transform with the tables it is applied
+// to. A nil table filter applies the transform to all tables.
+type chainElement struct {
+	transform   transform.Transform
+	tableFilter *tablefiltering.TableFilter
+}
+
+// NewTransformChainFromConfig creates the encryption stage followed by
+// the chain of configured transforms. Columns are encrypted first,
+// therefore no transform (e.g. computed fields) can leak their values.
+func NewTransformChainFromConfig(
+	c *config.Config,
+) (TransformChain, error) {
+
+	encryptionStage, err := NewEncryptionStage(c)
+	if err != nil {
+		return nil, err
+	}
+
+	transforms, err := NewTransformChain(c.Sink.Transforms)
+	if err != nil {
+		return nil, err
+	}
+
+	return transformChainFunc(
+		func(table schema.TableAlike, key, value schema.Struct) (schema.Struct, schema.Struct, error) {
+			key, value, err := encryptionStage.Apply(table, key, value)
+			if err != nil {
+				return nil, nil, err
+			}
+			return transforms.Apply(table, key, value)
+		},
+	), nil
+}
+
+// NewTransformChain creates the chain of transforms in the order
+// of their definition. Events without a table, such as logical
+// replication messages or transaction metadata, aren't transformed.
+func NewTransformChain(
+	transformDefinitions []config.TransformConfig,
+) (TransformChain, error) {
+
+	if len(transformDefinitions) == 0 {
+		return identityTransformChain, nil
+	}
+
+	elements := make([]chainElement, 0, len(transformDefinitions))
+	for i, def := range transformDefinitions {
+		t, err := NewTransform(def)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, fmt.Sprintf("transform %d", i), 0)
+		}
+
+		var tableFilter *tablefiltering.TableFilter
+		if def.Tables != nil {
+			// Only explicitly included tables are transformed, if includes are defined
+			tableFilter, err = tablefiltering.NewTableFilter(
+				def.Tables.Excludes, def.Tables.Includes, len(def.Tables.Includes) == 0,
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		elements = append(elements, chainElement{
+			transform:   t,
+			tableFilter: tableFilter,
+		})
+	}
+
+	return transformChainFunc(
+		func(table schema.TableAlike, key, value schema.Struct) (schema.Struct, schema.Struct, error) {
+			if table == nil {
+				return key, value, nil
+			}
+
+			for _, element := range elements {
+				if element.tableFilter != nil && !element.tableFilter.Enabled(table) {
+					continue
+				}
+
+				var err error
+				key, value, err = element.transform.Transform(key, value)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			return key, value, nil
+		},
+	), nil
+}
@@ -0,0 +1,63 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transforming
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/transform"
+	"sync"
+)
+
+var transformRegistry = &registry{
+	mutex:     sync.Mutex{},
+	factories: make(map[config.TransformType]transform.Factory),
+}
+
+type registry struct {
+	mutex     sync.Mutex
+	factories map[config.TransformType]transform.Factory
+}
+
+// RegisterTransform registers a config.TransformType to a Factory
+// implementation which creates the Transform when requested
+func RegisterTransform(
+	name config.TransformType, factory transform.Factory,
+) bool {
+
+	transformRegistry.mutex.Lock()
+	defer transformRegistry.mutex.Unlock()
+	if _, present := transformRegistry.factories[name]; !present {
+		transformRegistry.factories[name] = factory
+		return true
+	}
+	return false
+}
+
+// NewTransform instantiates a new instance of the requested
+// Transform when available, otherwise returns an error.
+func NewTransform(
+	c config.TransformConfig,
+) (transform.Transform, error) {
+
+	transformRegistry.mutex.Lock()
+	defer transformRegistry.mutex.Unlock()
+	if p, present := transformRegistry.factories[c.Type]; present {
+		return p(c)
+	}
+	return nil, errors.Errorf("TransformType '%s' doesn't exist", c.Type)
+}
@@ -0,0 +1,352 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transforming
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/expressions"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+func Test_Rename_Transform(
+	t *testing.T,
+) {
+
+	key, value := applyTransform(t, config.TransformConfig{
+		Type:    config.RenameTransform,
+		Renames: map[string]string{"id": "device_id", "name": "label"},
+	})
+
+	assert.Equal(t, schema.Struct{"device_id": 1}, key[schema.FieldNamePayload])
+	assert.Equal(t, []string{"device_id"}, fieldNames(key[schema.FieldNameSchema]))
+
+	assert.Equal(t, schema.Struct{"device_id": 1, "label": "foo", "ts": int64(1700000000000)}, after(value))
+	assert.Equal(t, []string{"device_id", "label", "ts"}, fieldNames(rowSchema(value)))
+}
+
+func Test_Drop_Transform(
+	t *testing.T,
+) {
+
+	key, value := applyTransform(t, config.TransformConfig{
+		Type:   config.DropTransform,
+		Fields: []string{"id", "name"},
+	})
+
+	// Keys aren't modified by drop
+	assert.Equal(t, schema.Struct{"id": 1}, key[schema.FieldNamePayload])
+	assert.Equal(t, schema.Struct{"ts": int64(1700000000000)}, after(value))
+	assert.Equal(t, []string{"ts"}, fieldNames(rowSchema(value)))
+}
+
+func Test_Mask_Transform(
+	t *testing.T,
+) {
+
+	key, value := applyTransform(t, config.TransformConfig{
+		Type:   config.MaskTransform,
+		Fields: []string{"id", "name"},
+	})
+
+	hashedId := "6b86b273ff34fce19d6b804eff5a3f5747ada4eaa22f1d49c01e52ddb7875b4b"
+	assert.Equal(t, schema.Struct{"id": hashedId}, key[schema.FieldNamePayload])
+	keyField := key[schema.FieldNameSchema].(schema.Struct)[schema.FieldNameFields].([]schema.Struct)[0]
+	assert.Equal(t, "string", keyField[schema.FieldNameSchema].(schema.Struct)[schema.FieldNameType])
+
+	assert.Equal(t, hashedId, after(value)["id"])
+	assert.Equal(t, "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", after(value)["name"])
+	assert.Equal(t, schema.STRING, rowSchema(value)[schema.FieldNameFields].([]schema.Struct)[0][schema.FieldNameType])
+
+	_, value = applyTransform(t, config.TransformConfig{
+		Type:   config.MaskTransform,
+		Fields: []string{"name"},
+		Mode:   "redact",
+	})
+	assert.Equal(t, schema.Struct{"id": 1, "name": nil, "ts": int64(1700000000000)}, after(value))
+	assert.Equal(t, true, rowSchema(value)[schema.FieldNameFields].([]schema.Struct)[1][schema.FieldNameOptional])
+}
+
+func Test_InsertField_Transform(
+	t *testing.T,
+) {
+
+	_, value := applyTransform(t, config.TransformConfig{
+		Type:   config.InsertFieldTransform,
+		Values: map[string]string{"region": "eu-west-1"},
+	})
+
+	assert.Equal(t, "eu-west-1", after(value)["region"])
+	assert.Equal(t, []string{"id", "name", "ts", "region"}, fieldNames(rowSchema(value)))
+}
+
+func Test_TimestampConvert_Transform(
+	t *testing.T,
+) {
+
+	_, value := applyTransform(t, config.TransformConfig{
+		Type:   config.TimestampConvertTransform,
+		Fields: []string{"ts"},
+		Mode:   "string",
+	})
+
+	assert.Equal(t, "2023-11-14T22:13:20Z", after(value)["ts"])
+	assert.Equal(t, schema.STRING, rowSchema(value)[schema.FieldNameFields].([]schema.Struct)[2][schema.FieldNameType])
+
+	transform, err := NewTransform(config.TransformConfig{
+		Type:   config.TimestampConvertTransform,
+		Fields: []string{"ts"},
+		Mode:   "unix",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, value, err = transform.Transform(nil, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(1700000000000), after(value)["ts"])
+}
+
+func Test_ValueToKey_Transform(
+	t *testing.T,
+) {
+
+	key, _ := applyTransform(t, config.TransformConfig{
+		Type:   config.ValueToKeyTransform,
+		Fields: []string{"name", "ts"},
+	})
+
+	assert.Equal(t, schema.Struct{"name": "foo", "ts": int64(1700000000000)}, key[schema.FieldNamePayload])
+	keySchema := key[schema.FieldNameSchema].(schema.Struct)
+	assert.Equal(t, "test.Key", keySchema[schema.FieldNameName])
+	assert.Equal(t, []string{"name", "ts"}, fieldNames(keySchema))
+
+	transform, err := NewTransform(config.TransformConfig{
+		Type:   config.ValueToKeyTransform,
+		Fields: []string{"unknown"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = transform.Transform(testKey(), testValue())
+	assert.ErrorContains(t, err, "valuetokey field 'unknown' doesn't exist")
+}
+
+func Test_Compute_Transform(
+	t *testing.T,
+) {
+
+	_, value := applyTransform(t, config.TransformConfig{
+		Type: config.ComputeTransform,
+		Computed: []config.ComputedFieldConfig{
+			{Field: "ts_s", Expression: "value.after.ts / 1000", Type: "int64"},
+			{Field: "label", Expression: "value.after.name + '-' + string(value.after.ts_s)"},
+		},
+	})
+
+	assert.Equal(t, int64(1700000000), after(value)["ts_s"])
+	assert.Equal(t, "foo-1700000000", after(value)["label"])
+	assert.Equal(t, []string{"id", "name", "ts", "ts_s", "label"}, fieldNames(rowSchema(value)))
+	assert.Equal(t, schema.INT64, rowSchema(value)[schema.FieldNameFields].([]schema.Struct)[3][schema.FieldNameType])
+
+	_, err := NewTransform(config.TransformConfig{
+		Type:     config.ComputeTransform,
+		Computed: []config.ComputedFieldConfig{{Field: "broken", Expression: "value.after.ts +"}},
+	})
+	var compileError *expressions.CompileError
+	assert.True(t, errors.As(err, &compileError))
+	assert.ErrorContains(t, err, "computed field 'broken'")
+}
+
+func Test_Transforms_Cache_Derived_Schemas(
+	t *testing.T,
+) {
+
+	transform, err := NewTransform(config.TransformConfig{
+		Type:   config.DropTransform,
+		Fields: []string{"name"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelopeSchema := testEnvelopeSchema()
+	_, first, err := transform.Transform(nil, schema.Envelope(envelopeSchema, testPayload()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := transform.Transform(nil, schema.Envelope(envelopeSchema, testPayload()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t,
+		reflect.ValueOf(first[schema.FieldNameSchema]).Pointer(),
+		reflect.ValueOf(second[schema.FieldNameSchema]).Pointer(),
+	)
+	// The original schema must not be modified
+	assert.Equal(t, []string{"id", "name", "ts"}, fieldNames(rowSchema(schema.Envelope(envelopeSchema, nil))))
+}
+
+func Test_TransformChain_Table_Patterns(
+	t *testing.T,
+) {
+
+	chain, err := NewTransformChain([]config.TransformConfig{
+		{
+			Type:   config.DropTransform,
+			Tables: &config.IncludedTablesConfig{Includes: []string{"public.metrics"}},
+			Fields: []string{"name"},
+		},
+		{
+			Type:    config.RenameTransform,
+			Renames: map[string]string{"ts": "time"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, value, err := chain.Apply(makeHypertable("public", "metrics"), testKey(), testValue())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, schema.Struct{"id": 1, "time": int64(1700000000000)}, after(value))
+
+	_, value, err = chain.Apply(makeHypertable("public", "devices"), testKey(), testValue())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, schema.Struct{"id": 1, "name": "foo", "time": int64(1700000000000)}, after(value))
+
+	// Events without table aren't transformed
+	_, value, err = chain.Apply(nil, testKey(), testValue())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, testPayload()[schema.FieldNameAfter], after(value))
+
+	_, err = NewTransformChain([]config.TransformConfig{{Type: "unknown"}})
+	assert.ErrorContains(t, err, "TransformType 'unknown' doesn't exist")
+}
+
+func applyTransform(
+	t *testing.T, c config.TransformConfig,
+) (schema.Struct, schema.Struct) {
+
+	transform, err := NewTransform(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, value, err := transform.Transform(testKey(), testValue())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, value
+}
+
+func after(
+	value schema.Struct,
+) schema.Struct {
+
+	return value[schema.FieldNamePayload].(schema.Struct)[schema.FieldNameAfter].(schema.Struct)
+}
+
+func rowSchema(
+	value schema.Struct,
+) schema.Struct {
+
+	for _, field := range value[schema.FieldNameSchema].(schema.Struct)[schema.FieldNameFields].([]schema.Struct) {
+		if field[schema.FieldNameField] == schema.FieldNameAfter {
+			return field
+		}
+	}
+	return nil
+}
+
+func fieldNames(
+	schemaDefinition any,
+) []string {
+
+	names := make([]string, 0)
+	for _, field := range schemaDefinition.(schema.Struct)[schema.FieldNameFields].([]schema.Struct) {
+		names = append(names, fieldNameOf(field))
+	}
+	return names
+}
+
+func testKey() schema.Struct {
+	return schema.Envelope(
+		schema.Struct{
+			schema.FieldNameType:     string(schema.STRUCT),
+			schema.FieldNameName:     "test.Key",
+			schema.FieldNameOptional: false,
+			schema.FieldNameFields: []schema.Struct{
+				{
+					schema.FieldNameName:  "id",
+					schema.FieldNameIndex: 0,
+					schema.FieldNameSchema: schema.Struct{
+						schema.FieldNameType:     string(schema.INT32),
+						schema.FieldNameOptional: false,
+					},
+				},
+			},
+		},
+		schema.Struct{"id": 1},
+	)
+}
+
+func testValue() schema.Struct {
+	return schema.Envelope(testEnvelopeSchema(), testPayload())
+}
+
+func testPayload() schema.Struct {
+	return schema.CreateEvent(schema.Struct{"id": 1, "name": "foo", "ts": int64(1700000000000)}, nil)
+}
+
+func testEnvelopeSchema() schema.Struct {
+	rowSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("test.Value").
+		Field("id", 0, schema.Int32().Required()).
+		Field("name", 1, schema.String()).
+		Field("ts", 2, schema.Int64().Required())
+
+	return schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("test.Envelope").
+		Required().
+		Field(schema.FieldNameBefore, -1, rowSchema.Clone()).
+		Field(schema.FieldNameAfter, -1, rowSchema.Clone().Required()).
+		Field(schema.FieldNameOperation, -1, schema.String().Required()).
+		Build()
+}
+
+func makeHypertable(
+	schemaName, tableName string,
+) *systemcatalog.Hypertable {
+
+	return systemcatalog.NewHypertable(
+		1, schemaName, tableName, "test", "test", nil, 0, nil, nil, pgtypes.DEFAULT,
+	)
+}
@@ -0,0 +1,119 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transforming
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/transform"
+)
+
+func init() {
+	RegisterTransform(config.ValueToKeyTransform, newValueToKeyTransform)
+}
+
+// valueToKeyTransform replaces the key with the given columns of the
+// after row, or the before row for deletes. Events without row keep
+// their original key.
+type valueToKeyTransform struct {
+	fields  []string
+	schemas *schemaCache
+}
+
+func newValueToKeyTransform(
+	c config.TransformConfig,
+) (transform.Transform, error) {
+
+	if len(c.Fields) == 0 {
+		return nil, errors.Errorf("valuetokey transform requires fields")
+	}
+
+	return &valueToKeyTransform{
+		fields:  c.Fields,
+		schemas: newSchemaCache(),
+	}, nil
+}
+
+func (v *valueToKeyTransform) Transform(
+	key, value schema.Struct,
+) (schema.Struct, schema.Struct, error) {
+
+	payload, _ := value[schema.FieldNamePayload].(schema.Struct)
+	row, _ := payload[schema.FieldNameAfter].(schema.Struct)
+	if row == nil {
+		row, _ = payload[schema.FieldNameBefore].(schema.Struct)
+	}
+	if row == nil {
+		return key, value, nil
+	}
+
+	keyPayload := make(schema.Struct, len(v.fields))
+	for _, field := range v.fields {
+		keyPayload[field] = row[field]
+	}
+
+	valueSchema, _ := value[schema.FieldNameSchema].(schema.Struct)
+	keySchema, _ := key[schema.FieldNameSchema].(schema.Struct)
+
+	derived, err := v.schemas.derive(valueSchema, func(valueSchema schema.Struct) (schema.Struct, error) {
+		return v.keySchema(valueSchema, keySchema)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return schema.Envelope(derived, keyPayload), value, nil
+}
+
+func (v *valueToKeyTransform) keySchema(
+	valueSchema, keySchema schema.Struct,
+) (schema.Struct, error) {
+
+	rowFields := make(map[string]schema.Struct)
+	envelopeFields, _ := valueSchema[schema.FieldNameFields].([]schema.Struct)
+	for _, envelopeField := range envelopeFields {
+		if fieldNameOf(envelopeField) != schema.FieldNameAfter {
+			continue
+		}
+		fields, _ := envelopeField[schema.FieldNameFields].([]schema.Struct)
+		for _, field := range fields {
+			rowFields[fieldNameOf(field)] = field
+		}
+	}
+
+	fields := make([]schema.Struct, 0, len(v.fields))
+	for index, fieldName := range v.fields {
+		field, present := rowFields[fieldName]
+		if !present {
+			return nil, errors.Errorf("valuetokey field '%s' doesn't exist", fieldName)
+		}
+		field = cloneStruct(field)
+		field[schema.FieldNameIndex] = index
+		fields = append(fields, field)
+	}
+
+	derived := schema.Struct{
+		schema.FieldNameType:     string(schema.STRUCT),
+		schema.FieldNameOptional: false,
+		schema.FieldNameFields:   fields,
+	}
+	if name, ok := keySchema[schema.FieldNameName]; ok {
+		derived[schema.FieldNameName] = name
+	}
+	return derived, nil
+}
@@ -426,8 +426,8 @@ func newFileHandler(
 
 	if fileHandler == nil {
 		if config.MaxDuration != nil {
-			seconds := rotatefile.RotateTime((time.Second * time.Duration(*config.MaxDuration)).Seconds())
-			if h, err := handler.NewTimeRotateFileHandler(config.Path, seconds, configurator); err != nil {
+			rotateTime := RotateTime(*config.MaxDuration)
+			if h, err := handler.NewTimeRotateFileHandler(config.Path, rotateTime, configurator); err != nil {
 				return false, nil, errors.Errorf(
 					"Failed to initialize logfile handler => %s", err.Error(),
 				)
@@ -438,15 +438,9 @@ func newFileHandler(
 	}
 
 	if fileHandler == nil {
-		maxSize := fiveMegabyte
-		if config.MaxSize != nil {
-			bs, err := bytesize.Parse(*config.MaxSize)
-			if err != nil {
-				return false, nil, errors.Errorf(
-					"Failed to parse max size property '%s' => %s", *config.MaxSize, err.Error(),
-				)
-			}
-			maxSize = bs
+		maxSize, err := ParseMaxSize(config.MaxSize)
+		if err != nil {
+			return false, nil, err
 		}
 
 		if h, err := handler.NewSizeRotateFileHandler(config.Path, int(maxSize), configurator); err != nil {
@@ -461,3 +455,31 @@ func newFileHandler(
 	fileHandlers[config.Path] = fileHandler
 	return false, fileHandler, nil
 }
+
+// ParseMaxSize parses the maximum file size of size based file
+// rotation (e.g. 5MB), defaulting to five megabytes if not set
+func ParseMaxSize(
+	maxSize *string,
+) (uint64, error) {
+
+	if maxSize == nil {
+		return uint64(fiveMegabyte), nil
+	}
+
+	bs, err := bytesize.Parse(*maxSize)
+	if err != nil {
+		return 0, errors.Errorf(
+			"Failed to parse max size property '%s' => %s", *maxSize, err.Error(),
+		)
+	}
+	return uint64(bs), nil
+}
+
+// RotateTime converts the maximum file duration in seconds
+// into the interval of time based file rotation
+func RotateTime(
+	maxDuration int,
+) rotatefile.RotateTime {
+
+	return rotatefile.RotateTime((time.Second * time.Duration(maxDuration)).Seconds())
+}
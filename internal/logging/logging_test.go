@@ -90,3 +90,19 @@ func Test_New_File_Handler_Cache(
 	assert.Nil(t, err)
 	assert.True(t, cached)
 }
+
+func Test_Parse_Max_Size(
+	t *testing.T,
+) {
+
+	maxSize, err := ParseMaxSize(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5242880), maxSize)
+
+	maxSize, err = ParseMaxSize(lo.ToPtr("10MB"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10485760), maxSize)
+
+	_, err = ParseMaxSize(lo.ToPtr("ten megabytes"))
+	assert.NotNil(t, err)
+}
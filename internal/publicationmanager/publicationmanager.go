@@ -18,23 +18,38 @@
 package publicationmanager
 
 import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
 	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
 	"github.com/noctarius/timescaledb-event-streamer/spi/publication"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sidechannel"
 	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/noctarius/timescaledb-event-streamer/spi/version"
+	"sync"
 )
 
+type publicationTable struct {
+	filter     *tablefiltering.TableFilter
+	projection sidechannel.TableProjection
+}
+
 type publicationManager struct {
 	sideChannel sidechannel.SideChannel
 
 	publicationName     string
 	publicationCreate   bool
 	publicationAutoDrop bool
+	publicationTables   []publicationTable
+
+	lock        sync.Mutex
+	pgVersion   version.PostgresVersion
+	hypertables map[int32]*systemcatalog.Hypertable
 }
 
 func NewPublicationManager(
 	c *config.Config, sideChannel sidechannel.SideChannel,
-) publication.PublicationManager {
+) (publication.PublicationManager, error) {
 
 	publicationName := config.GetOrDefault(
 		c, config.PropertyPostgresqlPublicationName, "",
@@ -45,6 +60,24 @@ func NewPublicationManager(
 	publicationAutoDrop := config.GetOrDefault(
 		c, config.PropertyPostgresqlPublicationAutoDrop, true,
 	)
+	publicationTableConfigs := config.GetOrDefault(
+		c, config.PropertyPostgresqlPublicationTables, []config.PublicationTableConfig{},
+	)
+
+	publicationTables := make([]publicationTable, 0, len(publicationTableConfigs))
+	for _, tableConfig := range publicationTableConfigs {
+		filter, err := tablefiltering.NewTableFilter([]string{}, []string{tableConfig.Table}, false)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		publicationTables = append(publicationTables, publicationTable{
+			filter: filter,
+			projection: sidechannel.TableProjection{
+				Columns:   tableConfig.Columns,
+				RowFilter: tableConfig.Filter,
+			},
+		})
+	}
 
 	return &publicationManager{
 		sideChannel: sideChannel,
@@ -52,7 +85,10 @@ func NewPublicationManager(
 		publicationName:     publicationName,
 		publicationCreate:   publicationCreate,
 		publicationAutoDrop: publicationAutoDrop,
-	}
+		publicationTables:   publicationTables,
+
+		hypertables: make(map[int32]*systemcatalog.Hypertable),
+	}, nil
 }
 
 func (pm *publicationManager) PublicationName() string {
@@ -80,7 +116,93 @@ func (pm *publicationManager) AttachTablesToPublication(
 	entities ...systemcatalog.SystemEntity,
 ) error {
 
-	return pm.sideChannel.AttachTablesToPublication(pm.PublicationName(), entities...)
+	tables := make([]sidechannel.PublicationTable, 0, len(entities))
+	for _, entity := range entities {
+		projection, err := pm.TableProjection(entity)
+		if err != nil {
+			return err
+		}
+
+		if !projection.IsEmpty() {
+			// Column lists and row filters are only supported from PG15 onwards
+			if err := pm.ensureProjectionSupported(); err != nil {
+				return err
+			}
+			if err := pm.ensureProjectionCoversReplicaIdentity(entity, projection); err != nil {
+				return err
+			}
+		}
+
+		tables = append(tables, sidechannel.PublicationTable{
+			TableProjection: projection,
+			Entity:          entity,
+		})
+	}
+
+	return pm.sideChannel.AttachTablesToPublication(pm.PublicationName(), tables...)
+}
+
+func (pm *publicationManager) UpdatePublishedTables(
+	entities ...systemcatalog.SystemEntity,
+) error {
+
+	if len(entities) == 0 {
+		return nil
+	}
+
+	pgVersion, err := pm.postgresVersion()
+	if err != nil {
+		return err
+	}
+
+	// Without column lists and row filters there's nothing to update,
+	// but configured projections for published tables must still fail
+	if pgVersion < version.PG_15_VERSION {
+		for _, entity := range entities {
+			projection, err := pm.TableProjection(entity)
+			if err != nil {
+				return err
+			}
+			if !projection.IsEmpty() {
+				return pm.ensureProjectionSupported()
+			}
+		}
+		return nil
+	}
+
+	published, err := pm.sideChannel.ReadPublishedTableProjections(pm.PublicationName())
+	if err != nil {
+		return err
+	}
+
+	tables := make([]sidechannel.PublicationTable, 0)
+	for _, entity := range entities {
+		projection, err := pm.TableProjection(entity)
+		if err != nil {
+			return err
+		}
+
+		// Row filters are deparsed by PostgreSQL, hence tables with row filters
+		// are always re-attached and compared after re-attaching them
+		current := published[entity.CanonicalName()]
+		if projection.Equal(current) && projection.RowFilter == "" {
+			continue
+		}
+
+		if !projection.IsEmpty() {
+			if err := pm.ensureProjectionCoversReplicaIdentity(entity, projection); err != nil {
+				return err
+			}
+		}
+
+		tables = append(tables, sidechannel.PublicationTable{
+			TableProjection: projection,
+			Entity:          entity,
+		})
+	}
+
+	_, err = pm.sideChannel.ReplacePublishedTables(pm.PublicationName(), tables...)
+	return err
 }
 
 func (pm *publicationManager) DetachTablesFromPublication(
@@ -105,3 +227,114 @@ func (pm *publicationManager) ExistsPublication() (bool, error) {
 func (pm *publicationManager) DropPublication() error {
 	return pm.sideChannel.DropPublication(pm.PublicationName())
 }
+
+func (pm *publicationManager) TableProjection(
+	entity systemcatalog.SystemEntity,
+) (sidechannel.TableProjection, error) {
+
+	if len(pm.publicationTables) == 0 {
+		return sidechannel.TableProjection{}, nil
+	}
+
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	// Chunks are published with the settings of their hypertable
+	if chunk, ok := entity.(*systemcatalog.Chunk); ok {
+		hypertable, err := pm.resolveHypertable(chunk.HypertableId())
+		if err != nil {
+			return sidechannel.TableProjection{}, err
+		}
+		entity = hypertable
+	}
+
+	for _, table := range pm.publicationTables {
+		if table.filter.Enabled(entity) {
+			return table.projection, nil
+		}
+	}
+	return sidechannel.TableProjection{}, nil
+}
+
+func (pm *publicationManager) resolveHypertable(
+	hypertableId int32,
+) (*systemcatalog.Hypertable, error) {
+
+	if hypertable, present := pm.hypertables[hypertableId]; present {
+		return hypertable, nil
+	}
+
+	// Unknown hypertable, most likely created after the last lookup
+	if err := pm.sideChannel.ReadHypertables(func(hypertable *systemcatalog.Hypertable) error {
+		pm.hypertables[hypertable.Id()] = hypertable
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	if hypertable, present := pm.hypertables[hypertableId]; present {
+		return hypertable, nil
+	}
+	return nil, errors.Errorf("hypertable with id %d doesn't exist", hypertableId)
+}
+
+// ensureProjectionCoversReplicaIdentity fails if the projection would make
+// PostgreSQL reject updates and deletes of the table after it is published
+func (pm *publicationManager) ensureProjectionCoversReplicaIdentity(
+	entity systemcatalog.SystemEntity, projection sidechannel.TableProjection,
+) error {
+
+	replicaIdentity, err := pm.sideChannel.ReadReplicaIdentity(entity.SchemaName(), entity.TableName())
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	// Without replica identity, updates and deletes fail independent of the projection
+	if replicaIdentity == pgtypes.NOTHING {
+		return nil
+	}
+
+	columns, identityColumns, err := pm.sideChannel.ReadReplicaIdentityColumns(
+		entity.SchemaName(), entity.TableName(),
+	)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	if err := projection.ValidateReplicaIdentity(columns, identityColumns); err != nil {
+		return errors.Errorf(
+			"publication projection of %s doesn't cover its replica identity (%s): %s",
+			entity.CanonicalName(), replicaIdentity.Name(), err,
+		)
+	}
+	return nil
+}
+
+func (pm *publicationManager) ensureProjectionSupported() error {
+	pgVersion, err := pm.postgresVersion()
+	if err != nil {
+		return err
+	}
+
+	if pgVersion < version.PG_15_VERSION {
+		return errors.Errorf(
+			"publication column lists and row filters require PostgreSQL 15 or later, found %s",
+			pgVersion.String(),
+		)
+	}
+	return nil
+}
+
+func (pm *publicationManager) postgresVersion() (version.PostgresVersion, error) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	if pm.pgVersion == 0 {
+		pgVersion, err := pm.sideChannel.GetPostgresVersion()
+		if err != nil {
+			return 0, errors.Wrap(err, 0)
+		}
+		pm.pgVersion = pgVersion
+	}
+	return pm.pgVersion, nil
+}
@@ -0,0 +1,138 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package publicationmanager
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sidechannel"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/noctarius/timescaledb-event-streamer/spi/version"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_PublicationManager_Updates_Changed_Projections(
+	t *testing.T,
+) {
+
+	sideChannel := &testSideChannel{
+		pgVersion: version.PG_15_VERSION,
+		published: map[string]sidechannel.TableProjection{
+			`"public"."metrics"`:   {Columns: []string{"ts"}},
+			`"public"."unchanged"`: {Columns: []string{"value", "ts"}},
+			`"public"."leftover"`:  {Columns: []string{"ts"}},
+			`"public"."filtered"`:  {RowFilter: "(value > 0)"},
+			`"public"."plain"`:     {},
+		},
+	}
+
+	publicationManager := newTestPublicationManager(t, sideChannel,
+		config.PublicationTableConfig{Table: "public.metrics", Columns: []string{"ts", "value"}},
+		config.PublicationTableConfig{Table: "public.unchanged", Columns: []string{"ts", "value"}},
+		config.PublicationTableConfig{Table: "public.filtered", Filter: "value > 0"},
+	)
+
+	assert.NoError(t, publicationManager.UpdatePublishedTables(
+		testTable("metrics"), testTable("unchanged"), testTable("leftover"),
+		testTable("filtered"), testTable("plain"),
+	))
+
+	// Tables with row filters are always re-attached, since PostgreSQL
+	// deparses row filters, and compared after re-attaching them
+	assert.Equal(t, []string{
+		`"public"."metrics" ("ts","value")`,
+		`"public"."leftover"`,
+		`"public"."filtered" WHERE (value > 0)`,
+	}, lo.Map(sideChannel.replaced, func(table sidechannel.PublicationTable, _ int) string {
+		return table.AsSqlTableSpec()
+	}))
+}
+
+func Test_PublicationManager_Fails_Projections_Of_Published_Tables_Before_PG15(
+	t *testing.T,
+) {
+
+	sideChannel := &testSideChannel{pgVersion: version.PG_14_VERSION}
+	publicationManager := newTestPublicationManager(t, sideChannel,
+		config.PublicationTableConfig{Table: "public.metrics", Columns: []string{"ts"}},
+	)
+
+	assert.NoError(t, publicationManager.UpdatePublishedTables(testTable("other")))
+	assert.ErrorContains(t,
+		publicationManager.UpdatePublishedTables(testTable("metrics")),
+		"publication column lists and row filters require PostgreSQL 15 or later",
+	)
+	assert.Nil(t, sideChannel.replaced)
+}
+
+type testSideChannel struct {
+	sidechannel.SideChannel
+	pgVersion version.PostgresVersion
+	published map[string]sidechannel.TableProjection
+	replaced  []sidechannel.PublicationTable
+}
+
+func (t *testSideChannel) GetPostgresVersion() (version.PostgresVersion, error) {
+	return t.pgVersion, nil
+}
+
+func (t *testSideChannel) ReadPublishedTableProjections(
+	_ string,
+) (map[string]sidechannel.TableProjection, error) {
+
+	return t.published, nil
+}
+
+func (t *testSideChannel) ReplacePublishedTables(
+	_ string, tables ...sidechannel.PublicationTable,
+) ([]sidechannel.PublicationTable, error) {
+
+	t.replaced = tables
+	return tables, nil
+}
+
+func (t *testSideChannel) ReadReplicaIdentity(
+	_, _ string,
+) (pgtypes.ReplicaIdentity, error) {
+
+	return pgtypes.NOTHING, nil
+}
+
+func newTestPublicationManager(
+	t *testing.T, sideChannel sidechannel.SideChannel, tables ...config.PublicationTableConfig,
+) *publicationManager {
+
+	c := &config.Config{}
+	c.PostgreSQL.Publication.Name = "test"
+	c.PostgreSQL.Publication.Tables = tables
+
+	pm, err := NewPublicationManager(c, sideChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pm.(*publicationManager)
+}
+
+func testTable(
+	tableName string,
+) *systemcatalog.PgTable {
+
+	return systemcatalog.NewPgTable(1, "public", tableName, pgtypes.DEFAULT)
+}
@@ -18,6 +18,8 @@
 package logicalreplicationresolver
 
 import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
 	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
 	"github.com/noctarius/timescaledb-event-streamer/spi/eventhandlers"
 	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
@@ -43,13 +45,30 @@ func NewResolver(
 		config, spiconfig.PropertyPostgresqlTxwindowMaxsize, uint(10000),
 	)
 
+	var compactionFilter *tablefiltering.TableFilter
+	compaction := config.PostgreSQL.Transaction.Compaction
+	if len(compaction.Includes) > 0 {
+		if !enabled || maxSize == 0 {
+			return nil, errors.Errorf("transaction compaction requires the transaction window to be enabled")
+		}
+
+		filter, err := tablefiltering.NewTableFilter(compaction.Excludes, compaction.Includes, false)
+		if err != nil {
+			return nil, err
+		}
+		compactionFilter = filter
+	}
+
 	resolver, err := newLogicalReplicationResolver(config, replicationContext, systemCatalog, typeManager, taskManager)
 	if err != nil {
 		return nil, err
 	}
 
-	if enabled && maxSize > 0 {
-		return newTransactionTracker(timeout, maxSize, replicationContext, systemCatalog, resolver, taskManager)
-	}
-	return resolver, nil
+	// The transaction tracker is always in front of the resolver, since streamed
+	// and prepared transactions need to be collected even without transaction window
+	spillPath := spiconfig.GetOrDefault(config, spiconfig.PropertyPostgresqlTxwindowSpillPath, "")
+	return newTransactionTracker(
+		enabled && maxSize > 0, timeout, maxSize, spillPath, replicationContext,
+		systemCatalog, typeManager, resolver, taskManager, compactionFilter,
+	)
 }
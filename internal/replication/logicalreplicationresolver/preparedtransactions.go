@@ -0,0 +1,208 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logicalreplicationresolver
+
+import (
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/eventhandlers"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
+)
+
+// preparedTransactions collects the changes of prepared transactions
+// (PREPARE TRANSACTION) decoded by PostgreSQL 15+ with two_phase enabled.
+// Depending on the configured mode, the changes are either replayed when
+// the PREPARE is received, or held back until the COMMIT PREPARED arrives.
+// Held back changes of rolled back transactions are discarded. While
+// changes are held back, the processed LSN isn't advanced beyond the
+// start of the prepared transaction, so that PostgreSQL sends it again
+// if the streamer is restarted before the COMMIT PREPARED is received.
+type preparedTransactions struct {
+	replicationContext replicationcontext.ReplicationContext
+	spiller            *transactionSpiller
+	emitOnPrepare      bool
+	active             *preparedTransaction
+	prepared           map[string]*transactionBuffer
+	logger             *logging.Logger
+}
+
+type preparedTransaction struct {
+	xid    uint32
+	gid    string
+	buffer *transactionBuffer
+}
+
+func newPreparedTransactions(
+	replicationContext replicationcontext.ReplicationContext, spiller *transactionSpiller,
+	logger *logging.Logger,
+) *preparedTransactions {
+
+	return &preparedTransactions{
+		replicationContext: replicationContext,
+		spiller:            spiller,
+		emitOnPrepare:      replicationContext.TwoPhaseMode() == config.TwoPhasePrepare,
+		prepared:           make(map[string]*transactionBuffer),
+		logger:             logger,
+	}
+}
+
+// begin starts collecting the changes of a new prepared transaction.
+func (pt *preparedTransactions) begin(
+	xld pgtypes.XLogData, msg *pgtypes.BeginPrepareMessage,
+) {
+
+	if !pt.emitOnPrepare {
+		pt.replicationContext.HoldProcessedLSN(msg.Gid, pgtypes.LSN(xld.WALStart))
+	}
+
+	pt.active = &preparedTransaction{
+		xid:    msg.Xid,
+		gid:    msg.Gid,
+		buffer: pt.spiller.newBuffer(msg.Xid),
+	}
+}
+
+// push collects the message if a prepared transaction is currently being
+// received and returns true, otherwise it returns false and the message
+// needs to be handled by the caller.
+func (pt *preparedTransactions) push(
+	xld pgtypes.XLogData, msg pglogrepl.Message,
+) (bool, error) {
+
+	if pt.active == nil {
+		return false, nil
+	}
+
+	return true, pt.active.buffer.push(&transactionEntry{
+		xld: xld,
+		msg: msg,
+	})
+}
+
+// prepare finishes collecting the changes of the currently received
+// prepared transaction and either replays or holds them.
+func (pt *preparedTransactions) prepare(
+	handler eventhandlers.LogicalReplicationEventHandler,
+	xld pgtypes.XLogData, msg *pgtypes.PrepareMessage,
+) error {
+
+	var buffer *transactionBuffer
+	if pt.active != nil {
+		buffer = pt.active.buffer
+	}
+	pt.active = nil
+
+	return pt.prepareBuffer(handler, xld, msg, buffer)
+}
+
+// streamPrepare replays or holds the changes of a streamed prepared
+// transaction. Streamed prepared transactions don't have a BEGIN PREPARE,
+// hence the processed LSN is held back from the STREAM PREPARE onwards,
+// which is enough for PostgreSQL to send the transaction again.
+func (pt *preparedTransactions) streamPrepare(
+	handler eventhandlers.LogicalReplicationEventHandler,
+	xld pgtypes.XLogData, msg *pgtypes.PrepareMessage, buffer *transactionBuffer,
+) error {
+
+	if !pt.emitOnPrepare {
+		pt.replicationContext.HoldProcessedLSN(msg.Gid, pgtypes.LSN(xld.WALStart))
+	}
+	return pt.prepareBuffer(handler, xld, msg, buffer)
+}
+
+// prepareBuffer either replays the given changes immediately, or holds
+// them until the prepared transaction is committed or rolled back.
+func (pt *preparedTransactions) prepareBuffer(
+	handler eventhandlers.LogicalReplicationEventHandler,
+	xld pgtypes.XLogData, msg *pgtypes.PrepareMessage, buffer *transactionBuffer,
+) error {
+
+	if pt.emitOnPrepare {
+		defer buffer.close()
+		return replayTransaction(
+			handler, xld, buffer, msg.Xid, msg.PrepareLSN, msg.EndPrepareLSN, msg.PrepareTime,
+		)
+	}
+
+	if buffer == nil {
+		buffer = pt.spiller.newBuffer(msg.Xid)
+	}
+	pt.prepared[msg.Gid] = buffer
+	return nil
+}
+
+// commitPrepared replays the held back changes of the committed prepared
+// transaction. If the changes were emitted at prepare time already, there
+// is nothing left to do. Changes which weren't held back, even though
+// they should have been, were emitted at prepare time before the mode was
+// switched and the streamer restarted. PostgreSQL doesn't send the PREPARE
+// again in this case, only the COMMIT PREPARED.
+func (pt *preparedTransactions) commitPrepared(
+	handler eventhandlers.LogicalReplicationEventHandler,
+	xld pgtypes.XLogData, msg *pgtypes.CommitPreparedMessage,
+) error {
+
+	if pt.emitOnPrepare {
+		return nil
+	}
+
+	buffer, present := pt.prepared[msg.Gid]
+	if !present {
+		pt.logger.Warnf(
+			"Prepared transaction gid=%s (xid=%d) committed, but its changes weren't held back, "+
+				"assuming they were emitted at prepare time already", msg.Gid, msg.Xid,
+		)
+
+		// Forward the commit anyway, to acknowledge the processed LSN
+		commitMsg := &pgtypes.CommitMessage{
+			CommitLSN:         msg.CommitLSN,
+			TransactionEndLSN: msg.EndCommitLSN,
+			CommitTime:        msg.CommitTime,
+		}
+		commitMsg.SetType(pglogrepl.MessageTypeCommit)
+		return handler.OnCommitEvent(xld, commitMsg)
+	}
+	delete(pt.prepared, msg.Gid)
+	defer buffer.close()
+
+	if err := replayTransaction(
+		handler, xld, buffer, msg.Xid, msg.CommitLSN, msg.EndCommitLSN, msg.CommitTime,
+	); err != nil {
+		return err
+	}
+
+	pt.replicationContext.ReleaseProcessedLSN(msg.Gid)
+	return nil
+}
+
+// rollbackPrepared discards the held back changes of the rolled back
+// prepared transaction and returns the number of discarded changes.
+func (pt *preparedTransactions) rollbackPrepared(
+	msg *pgtypes.RollbackPreparedMessage,
+) int {
+
+	buffer := pt.prepared[msg.Gid]
+	delete(pt.prepared, msg.Gid)
+	pt.replicationContext.ReleaseProcessedLSN(msg.Gid)
+
+	discarded := buffer.len()
+	buffer.close()
+	return discarded
+}
@@ -0,0 +1,183 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logicalreplicationresolver
+
+import (
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/eventhandlers"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_PreparedTransactions_Hold_Until_Commit(
+	t *testing.T,
+) {
+
+	replicationContext := newHoldRecordingReplicationContext(config.TwoPhaseCommit)
+	pt := newPreparedTransactions(replicationContext, testSpiller(t, 100), testLogger(t))
+	assertPushed(t, false, pt, pgtypes.XLogData{}, &pgtypes.InsertMessage{})
+
+	pt.begin(pgtypes.XLogData{XLogData: pglogrepl.XLogData{WALStart: 1000}}, &pgtypes.BeginPrepareMessage{Xid: 100, Gid: "gid-1"})
+	assert.Equal(t, pgtypes.LSN(1000), replicationContext.holds["gid-1"])
+	assertPushed(t, true, pt, pgtypes.XLogData{Xid: 100}, &pgtypes.InsertMessage{})
+	assertPushed(t, true, pt, pgtypes.XLogData{Xid: 100}, &pgtypes.UpdateMessage{})
+
+	err := pt.prepare(nil, pgtypes.XLogData{Xid: 100}, &pgtypes.PrepareMessage{Xid: 100, Gid: "gid-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pt.prepared["gid-1"].len())
+
+	// Changes after the prepare aren't part of the prepared transaction anymore
+	assertPushed(t, false, pt, pgtypes.XLogData{}, &pgtypes.InsertMessage{})
+
+	// The hold is kept until the prepared transaction is committed
+	assert.Equal(t, pgtypes.LSN(1000), replicationContext.holds["gid-1"])
+}
+
+func Test_PreparedTransactions_Rollback_Discards(
+	t *testing.T,
+) {
+
+	replicationContext := newHoldRecordingReplicationContext(config.TwoPhaseCommit)
+	pt := newPreparedTransactions(replicationContext, testSpiller(t, 100), testLogger(t))
+	pt.begin(pgtypes.XLogData{XLogData: pglogrepl.XLogData{WALStart: 1000}}, &pgtypes.BeginPrepareMessage{Xid: 100, Gid: "gid-1"})
+	assertPushed(t, true, pt, pgtypes.XLogData{Xid: 100}, &pgtypes.InsertMessage{})
+
+	err := pt.prepare(nil, pgtypes.XLogData{Xid: 100}, &pgtypes.PrepareMessage{Xid: 100, Gid: "gid-1"})
+	assert.NoError(t, err)
+
+	discarded := pt.rollbackPrepared(&pgtypes.RollbackPreparedMessage{Xid: 100, Gid: "gid-1"})
+	assert.Equal(t, 1, discarded)
+	assert.Empty(t, pt.prepared)
+	assert.Empty(t, replicationContext.holds)
+}
+
+func Test_PreparedTransactions_Unknown_Gid_Forwards_Commit(
+	t *testing.T,
+) {
+
+	// The transaction was prepared and acknowledged in prepare mode, PostgreSQL
+	// only sends the COMMIT PREPARED after the restart in commit mode
+	pt := newPreparedTransactions(newHoldRecordingReplicationContext(config.TwoPhaseCommit), testSpiller(t, 100), testLogger(t))
+	handler := &commitRecordingHandler{}
+	err := pt.commitPrepared(handler, pgtypes.XLogData{}, &pgtypes.CommitPreparedMessage{
+		Xid:          100,
+		Gid:          "gid-1",
+		CommitLSN:    2000,
+		EndCommitLSN: 2100,
+	})
+	assert.NoError(t, err)
+
+	if assert.Len(t, handler.commits, 1) {
+		assert.Equal(t, pglogrepl.LSN(2000), handler.commits[0].CommitLSN)
+		assert.Equal(t, pglogrepl.LSN(2100), handler.commits[0].TransactionEndLSN)
+	}
+	assert.Equal(t, 0, handler.begins)
+}
+
+func Test_PreparedTransactions_Emit_On_Prepare_Doesnt_Hold(
+	t *testing.T,
+) {
+
+	replicationContext := newHoldRecordingReplicationContext(config.TwoPhasePrepare)
+	pt := newPreparedTransactions(replicationContext, testSpiller(t, 100), testLogger(t))
+	pt.begin(pgtypes.XLogData{XLogData: pglogrepl.XLogData{WALStart: 1000}}, &pgtypes.BeginPrepareMessage{Xid: 100, Gid: "gid-1"})
+	assert.Empty(t, replicationContext.holds)
+
+	err := pt.commitPrepared(nil, pgtypes.XLogData{}, &pgtypes.CommitPreparedMessage{Xid: 100, Gid: "gid-1"})
+	assert.NoError(t, err)
+}
+
+func assertPushed(
+	t *testing.T, expected bool, pt *preparedTransactions, xld pgtypes.XLogData, msg pglogrepl.Message,
+) {
+
+	collected, err := pt.push(xld, msg)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, collected)
+}
+
+func testLogger(
+	t *testing.T,
+) *logging.Logger {
+
+	logger, err := logging.NewLogger("PreparedTransactionsTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logger
+}
+
+type commitRecordingHandler struct {
+	eventhandlers.LogicalReplicationEventHandler
+	begins  int
+	commits []*pgtypes.CommitMessage
+}
+
+func (c *commitRecordingHandler) OnBeginEvent(
+	_ pgtypes.XLogData, _ *pgtypes.BeginMessage,
+) error {
+
+	c.begins++
+	return nil
+}
+
+func (c *commitRecordingHandler) OnCommitEvent(
+	_ pgtypes.XLogData, msg *pgtypes.CommitMessage,
+) error {
+
+	c.commits = append(c.commits, msg)
+	return nil
+}
+
+type holdRecordingReplicationContext struct {
+	replicationcontext.ReplicationContext
+	twoPhaseMode config.TwoPhaseMode
+	holds        map[string]pgtypes.LSN
+}
+
+func newHoldRecordingReplicationContext(
+	twoPhaseMode config.TwoPhaseMode,
+) *holdRecordingReplicationContext {
+
+	return &holdRecordingReplicationContext{
+		twoPhaseMode: twoPhaseMode,
+		holds:        make(map[string]pgtypes.LSN),
+	}
+}
+
+func (h *holdRecordingReplicationContext) TwoPhaseMode() config.TwoPhaseMode {
+	return h.twoPhaseMode
+}
+
+func (h *holdRecordingReplicationContext) HoldProcessedLSN(
+	id string, lsn pgtypes.LSN,
+) {
+
+	h.holds[id] = lsn
+}
+
+func (h *holdRecordingReplicationContext) ReleaseProcessedLSN(
+	id string,
+) {
+
+	delete(h.holds, id)
+}
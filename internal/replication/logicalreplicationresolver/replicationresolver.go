@@ -146,11 +146,6 @@ func newLogicalReplicationResolver(
 	}, nil
 }
 
-func (l *logicalReplicationResolver) PostConstruct() error {
-	l.taskManager.RegisterReplicationEventHandler(l)
-	return nil
-}
-
 func (l *logicalReplicationResolver) OnTableSnapshotStartedEvent(
 	_ string, _ systemcatalog.BaseTable,
 ) error {
@@ -239,7 +234,13 @@ func (l *logicalReplicationResolver) OnBeginEvent(
 
 	l.replicationContext.SetLastBeginLSN(pgtypes.LSN(xld.WALStart))
 	l.replicationContext.SetLastTransactionId(msg.Xid)
-	return nil
+	return l.taskManager.EnqueueTask(func(notificator task.Notificator) {
+		notificator.NotifyRecordReplicationEventHandler(
+			func(handler eventhandlers.RecordReplicationEventHandler) error {
+				return handler.OnBeginEvent(xld, msg)
+			},
+		)
+	})
 }
 
 func (l *logicalReplicationResolver) OnCommitEvent(
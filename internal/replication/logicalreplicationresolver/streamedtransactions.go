@@ -0,0 +1,197 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logicalreplicationresolver
+
+import (
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/spi/eventhandlers"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"time"
+)
+
+// streamedTransactions collects the changes of in-progress transactions
+// streamed by PostgreSQL 14+ (streaming 'on' or 'parallel'). Chunks of
+// different transactions may interleave, therefore changes are collected
+// per top-level transaction id until the Stream Commit or Stream Abort
+// message arrives. Committed transactions are replayed as a regular
+// BEGIN / ... / COMMIT sequence, which keeps events in commit order.
+// Changes beyond the transaction window's maximum size are spilled to disk.
+type streamedTransactions struct {
+	spiller      *transactionSpiller
+	transactions map[uint32]*transactionBuffer
+}
+
+func newStreamedTransactions(
+	spiller *transactionSpiller,
+) *streamedTransactions {
+
+	return &streamedTransactions{
+		spiller:      spiller,
+		transactions: make(map[uint32]*transactionBuffer),
+	}
+}
+
+// push collects the message if the XLogData belongs to a streamed
+// transaction and returns true, otherwise it returns false and the
+// message needs to be handled by the caller.
+func (st *streamedTransactions) push(
+	xld pgtypes.XLogData, msg pglogrepl.Message,
+) (bool, error) {
+
+	if !xld.IsStreamed() {
+		return false, nil
+	}
+
+	buffer, present := st.transactions[xld.Xid]
+	if !present {
+		buffer = st.spiller.newBuffer(xld.Xid)
+		st.transactions[xld.Xid] = buffer
+	}
+
+	return true, buffer.push(&transactionEntry{
+		xld: xld,
+		msg: msg,
+	})
+}
+
+// abort discards the changes of the aborted (sub-)transaction and returns
+// the number of discarded changes. If the top-level transaction was aborted
+// all collected changes are removed.
+func (st *streamedTransactions) abort(
+	msg *pgtypes.StreamAbortMessage,
+) int {
+
+	buffer, present := st.transactions[msg.Xid]
+	if !present {
+		return 0
+	}
+
+	if msg.IsTopLevel() {
+		delete(st.transactions, msg.Xid)
+		discarded := buffer.len()
+		buffer.close()
+		return discarded
+	}
+	return buffer.discard(msg.SubXid)
+}
+
+// take removes and returns the collected changes of the given transaction.
+// The caller is responsible to close the returned buffer.
+func (st *streamedTransactions) take(
+	xid uint32,
+) *transactionBuffer {
+
+	buffer := st.transactions[xid]
+	delete(st.transactions, xid)
+	return buffer
+}
+
+// commit removes the collected changes of the committed transaction and
+// replays them against the given handler, framed by a synthesized BEGIN
+// and COMMIT message.
+func (st *streamedTransactions) commit(
+	handler eventhandlers.LogicalReplicationEventHandler,
+	xld pgtypes.XLogData, msg *pgtypes.StreamCommitMessage,
+) error {
+
+	buffer := st.take(msg.Xid)
+	defer buffer.close()
+
+	return replayTransaction(
+		handler, xld, buffer, msg.Xid, msg.CommitLSN, msg.TransactionEndLSN, msg.CommitTime,
+	)
+}
+
+// replayTransaction replays the given changes as a regular transaction
+// against the handler, framed by a synthesized BEGIN and COMMIT message.
+func replayTransaction(
+	handler eventhandlers.LogicalReplicationEventHandler, xld pgtypes.XLogData,
+	buffer *transactionBuffer, xid uint32, commitLSN, transactionEndLSN pglogrepl.LSN,
+	commitTime time.Time,
+) error {
+
+	beginMsg := &pgtypes.BeginMessage{
+		FinalLSN:   commitLSN,
+		CommitTime: commitTime,
+		Xid:        xid,
+	}
+	beginMsg.SetType(pglogrepl.MessageTypeBegin)
+	if err := handler.OnBeginEvent(xld, beginMsg); err != nil {
+		return err
+	}
+
+	if err := buffer.forEach(func(entry *transactionEntry) error {
+		// The change isn't streamed anymore, it's part of a committed transaction now
+		entry.xld.StreamXid = nil
+		return dispatchTransactionEntry(handler, entry)
+	}); err != nil {
+		return err
+	}
+
+	commitMsg := &pgtypes.CommitMessage{
+		CommitLSN:         commitLSN,
+		TransactionEndLSN: transactionEndLSN,
+		CommitTime:        commitTime,
+	}
+	commitMsg.SetType(pglogrepl.MessageTypeCommit)
+	return handler.OnCommitEvent(xld, commitMsg)
+}
+
+// transactionEntryHandler is the subset of the logical replication
+// callbacks collected transaction entries are dispatched to
+type transactionEntryHandler interface {
+	OnBeginEvent(
+		xld pgtypes.XLogData, msg *pgtypes.BeginMessage,
+	) error
+	OnInsertEvent(
+		xld pgtypes.XLogData, msg *pgtypes.InsertMessage,
+	) error
+	OnUpdateEvent(
+		xld pgtypes.XLogData, msg *pgtypes.UpdateMessage,
+	) error
+	OnDeleteEvent(
+		xld pgtypes.XLogData, msg *pgtypes.DeleteMessage,
+	) error
+	OnTruncateEvent(
+		xld pgtypes.XLogData, msg *pgtypes.TruncateMessage,
+	) error
+	OnMessageEvent(
+		xld pgtypes.XLogData, msg *pgtypes.LogicalReplicationMessage,
+	) error
+}
+
+func dispatchTransactionEntry(
+	handler transactionEntryHandler, entry *transactionEntry,
+) error {
+
+	switch msg := entry.msg.(type) {
+	case *pgtypes.BeginMessage:
+		return handler.OnBeginEvent(entry.xld, msg)
+	case *pgtypes.InsertMessage:
+		return handler.OnInsertEvent(entry.xld, msg)
+	case *pgtypes.UpdateMessage:
+		return handler.OnUpdateEvent(entry.xld, msg)
+	case *pgtypes.DeleteMessage:
+		return handler.OnDeleteEvent(entry.xld, msg)
+	case *pgtypes.TruncateMessage:
+		return handler.OnTruncateEvent(entry.xld, msg)
+	case *pgtypes.LogicalReplicationMessage:
+		return handler.OnMessageEvent(entry.xld, msg)
+	}
+	return nil
+}
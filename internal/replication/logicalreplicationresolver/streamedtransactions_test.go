@@ -0,0 +1,159 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logicalreplicationresolver
+
+import (
+	"encoding/binary"
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/internal/containers"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_StreamedTransactions_Push_Not_Streamed(
+	t *testing.T,
+) {
+
+	st := newStreamedTransactions(testSpiller(t, 100))
+	collected, err := st.push(pgtypes.XLogData{Xid: 100}, &pgtypes.InsertMessage{})
+	assert.NoError(t, err)
+	assert.False(t, collected)
+	assert.Empty(t, st.transactions)
+}
+
+func Test_StreamedTransactions_Abort_SubTransaction(
+	t *testing.T,
+) {
+
+	st := newStreamedTransactions(testSpiller(t, 100))
+	pushStreamed(t, st, streamedXLogData(100, 100), &pgtypes.InsertMessage{})
+	pushStreamed(t, st, streamedXLogData(100, 101), &pgtypes.InsertMessage{})
+	pushStreamed(t, st, streamedXLogData(100, 101), &pgtypes.UpdateMessage{})
+	pushStreamed(t, st, streamedXLogData(200, 200), &pgtypes.DeleteMessage{})
+
+	discarded := st.abort(&pgtypes.StreamAbortMessage{Xid: 100, SubXid: 101})
+	assert.Equal(t, 2, discarded)
+	assert.Equal(t, 1, st.transactions[100].len())
+	assert.Equal(t, 1, st.transactions[200].len())
+}
+
+func Test_StreamedTransactions_Abort_TopLevel(
+	t *testing.T,
+) {
+
+	st := newStreamedTransactions(testSpiller(t, 100))
+	pushStreamed(t, st, streamedXLogData(100, 100), &pgtypes.InsertMessage{})
+	pushStreamed(t, st, streamedXLogData(100, 101), &pgtypes.InsertMessage{})
+
+	discarded := st.abort(&pgtypes.StreamAbortMessage{Xid: 100, SubXid: 100})
+	assert.Equal(t, 2, discarded)
+	assert.NotContains(t, st.transactions, uint32(100))
+}
+
+func Test_StreamedTransactions_Spill_Beyond_MaxSize(
+	t *testing.T,
+) {
+
+	spiller := testSpiller(t, 2)
+	st := newStreamedTransactions(spiller)
+
+	prefixes := []string{"a", "b", "c", "d", "e"}
+	subXids := []uint32{100, 101, 100, 101, 100}
+	for i, prefix := range prefixes {
+		xld := streamedXLogData(100, subXids[i])
+		xld.WALStart = pglogrepl.LSN(i * 100)
+		xld.WALData = streamedMessageWALData(subXids[i], prefix)
+
+		msg, _, err := pgtypes.ParseStreamedXlogData(xld.WALData)
+		assert.NoError(t, err)
+		pushStreamed(t, st, xld, msg)
+	}
+
+	buffer := st.transactions[100]
+	assert.Len(t, buffer.entries, 2)
+	assert.NotNil(t, buffer.spill)
+	assert.Equal(t, 5, buffer.len())
+
+	// Spilled changes of aborted sub-transactions are skipped
+	discarded := st.abort(&pgtypes.StreamAbortMessage{Xid: 100, SubXid: 101})
+	assert.Equal(t, 2, discarded)
+
+	buffer = st.take(100)
+	spillFile := buffer.spill.file.Name()
+
+	replayed := make([]string, 0)
+	lsns := make([]pglogrepl.LSN, 0)
+	assert.NoError(t, buffer.forEach(func(entry *transactionEntry) error {
+		replayed = append(replayed, entry.msg.(*pgtypes.LogicalReplicationMessage).Prefix)
+		lsns = append(lsns, entry.xld.WALStart)
+		assert.Equal(t, uint32(100), entry.xld.Xid)
+		return nil
+	}))
+	assert.Equal(t, []string{"a", "c", "e"}, replayed)
+	assert.Equal(t, []pglogrepl.LSN{0, 200, 400}, lsns)
+
+	buffer.close()
+	assert.NoFileExists(t, spillFile)
+}
+
+func pushStreamed(
+	t *testing.T, st *streamedTransactions, xld pgtypes.XLogData, msg pglogrepl.Message,
+) {
+
+	collected, err := st.push(xld, msg)
+	assert.NoError(t, err)
+	assert.True(t, collected)
+}
+
+func testSpiller(
+	t *testing.T, maxSize uint,
+) *transactionSpiller {
+
+	spiller, err := newTransactionSpiller(
+		maxSize, t.TempDir(), containers.NewRelationCache[*pgtypes.RelationMessage](), nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spiller
+}
+
+func streamedMessageWALData(
+	xid uint32, prefix string,
+) []byte {
+
+	data := []byte{byte(pgtypes.MessageTypeLogicalDecodingMessage)}
+	data = binary.BigEndian.AppendUint32(data, xid)
+	data = append(data, 1)
+	data = binary.BigEndian.AppendUint64(data, 0)
+	data = append(data, prefix...)
+	data = append(data, 0)
+	data = binary.BigEndian.AppendUint32(data, 0)
+	return data
+}
+
+func streamedXLogData(
+	xid, subXid uint32,
+) pgtypes.XLogData {
+
+	return pgtypes.XLogData{
+		Xid:       xid,
+		StreamXid: &subXid,
+	}
+}
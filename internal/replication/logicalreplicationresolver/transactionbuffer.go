@@ -0,0 +1,440 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logicalreplicationresolver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/internal/containers"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"io"
+	"os"
+	"time"
+)
+
+// spillRecordHeaderSize is the size of the fixed header of a spilled change:
+// WALStart, ServerWALEnd, ServerTime, LastBegin, LastCommit (8 bytes each),
+// StreamXid, relation version and WALData length (4 bytes each), and the
+// streamed flag (1 byte)
+const spillRecordHeaderSize = 5*8 + 3*4 + 1
+
+// noRelation marks spilled changes which aren't bound to a relation
+const noRelation = int32(-1)
+
+// transactionSpiller creates the buffers for changes of streamed and
+// prepared transactions. Buffers keep up to maxSize changes in memory,
+// further changes are spilled to disk as raw WAL data and decoded again
+// when the transaction is replayed.
+type transactionSpiller struct {
+	maxSize     uint
+	path        string
+	relations   *containers.RelationCache[*pgtypes.RelationMessage]
+	typeManager pgtypes.TypeManager
+	logger      *logging.Logger
+}
+
+func newTransactionSpiller(
+	maxSize uint, path string, relations *containers.RelationCache[*pgtypes.RelationMessage],
+	typeManager pgtypes.TypeManager,
+) (*transactionSpiller, error) {
+
+	logger, err := logging.NewLogger("TransactionSpiller")
+	if err != nil {
+		return nil, err
+	}
+
+	if path == "" {
+		path = os.TempDir()
+	}
+
+	return &transactionSpiller{
+		maxSize:     maxSize,
+		path:        path,
+		relations:   relations,
+		typeManager: typeManager,
+		logger:      logger,
+	}, nil
+}
+
+func (ts *transactionSpiller) newBuffer(
+	xid uint32,
+) *transactionBuffer {
+
+	return &transactionBuffer{
+		spiller: ts,
+		xid:     xid,
+		entries: make([]*transactionEntry, 0),
+	}
+}
+
+// decode parses spilled WAL data and decodes the tuples with the
+// relation which was active when the change was received
+func (ts *transactionSpiller) decode(
+	data []byte, xid uint32, streamed bool, relation *pgtypes.RelationMessage,
+) (msg pglogrepl.Message, err error) {
+
+	if streamed {
+		msg, _, err = pgtypes.ParseStreamedXlogData(data)
+	} else {
+		msg, err = pgtypes.ParseXlogData(data, &xid)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch m := msg.(type) {
+	case *pglogrepl.InsertMessage:
+		if relation == nil {
+			return nil, errors.Errorf("unknown relation ID %d of spilled change", m.RelationID)
+		}
+		newValues, err := ts.typeManager.DecodeTuples(relation, m.Tuple)
+		if err != nil {
+			return nil, err
+		}
+		m.Tuple = nil
+		return &pgtypes.InsertMessage{InsertMessage: m, NewValues: newValues}, nil
+	case *pglogrepl.UpdateMessage:
+		if relation == nil {
+			return nil, errors.Errorf("unknown relation ID %d of spilled change", m.RelationID)
+		}
+		oldValues, err := ts.typeManager.DecodeTuples(relation, m.OldTuple)
+		if err != nil {
+			return nil, err
+		}
+		newValues, err := ts.typeManager.DecodeTuples(relation, m.NewTuple)
+		if err != nil {
+			return nil, err
+		}
+		m.OldTuple = nil
+		m.NewTuple = nil
+		return &pgtypes.UpdateMessage{UpdateMessage: m, OldValues: oldValues, NewValues: newValues}, nil
+	case *pglogrepl.DeleteMessage:
+		if relation == nil {
+			return nil, errors.Errorf("unknown relation ID %d of spilled change", m.RelationID)
+		}
+		oldValues, err := ts.typeManager.DecodeTuples(relation, m.OldTuple)
+		if err != nil {
+			return nil, err
+		}
+		m.OldTuple = nil
+		return &pgtypes.DeleteMessage{DeleteMessage: m, OldValues: oldValues}, nil
+	case *pglogrepl.TruncateMessage:
+		truncateMsg := pgtypes.TruncateMessage(*m)
+		return &truncateMsg, nil
+	}
+	return msg, nil
+}
+
+// transactionBuffer collects the changes of a single transaction. Up to
+// maxSize changes are kept in memory, further changes are spilled to a
+// temporary file, which is removed when the buffer is closed.
+type transactionBuffer struct {
+	spiller *transactionSpiller
+	xid     uint32
+	entries []*transactionEntry
+	spill   *transactionSpill
+}
+
+func (b *transactionBuffer) push(
+	entry *transactionEntry,
+) error {
+
+	if b.spill == nil && uint(len(b.entries)) < b.spiller.maxSize {
+		b.entries = append(b.entries, entry)
+		return nil
+	}
+
+	if b.spill == nil {
+		spill, err := newTransactionSpill(b.spiller.path, b.xid, entry.xld.DatabaseName)
+		if err != nil {
+			return err
+		}
+		b.spill = spill
+		b.spiller.logger.Infof(
+			"Transaction xid=%d exceeds %d changes, spilling further changes to %s",
+			b.xid, b.spiller.maxSize, spill.file.Name(),
+		)
+	}
+
+	var relation *pgtypes.RelationMessage
+	if relationId, ok := relationIdOf(entry.msg); ok {
+		relation, _ = b.spiller.relations.Get(relationId)
+	}
+	return b.spill.write(entry, relation)
+}
+
+// discard removes the changes of the given sub-transaction and
+// returns the number of discarded changes
+func (b *transactionBuffer) discard(
+	subXid uint32,
+) int {
+
+	remaining := make([]*transactionEntry, 0, len(b.entries))
+	for _, entry := range b.entries {
+		if entry.xld.StreamXid == nil || *entry.xld.StreamXid != subXid {
+			remaining = append(remaining, entry)
+		}
+	}
+	discarded := len(b.entries) - len(remaining)
+	b.entries = remaining
+
+	if b.spill != nil {
+		discarded += b.spill.discard(subXid)
+	}
+	return discarded
+}
+
+func (b *transactionBuffer) len() int {
+	if b == nil {
+		return 0
+	}
+	length := len(b.entries)
+	if b.spill != nil {
+		length += b.spill.length
+	}
+	return length
+}
+
+// forEach calls fn for all collected changes in the order they were
+// received, spilled changes are read back and decoded on the fly
+func (b *transactionBuffer) forEach(
+	fn func(entry *transactionEntry) error,
+) error {
+
+	if b == nil {
+		return nil
+	}
+
+	for _, entry := range b.entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	if b.spill != nil {
+		return b.spill.forEach(b.spiller.decode, fn)
+	}
+	return nil
+}
+
+// close releases the collected changes and removes the spill file
+func (b *transactionBuffer) close() {
+	if b == nil {
+		return
+	}
+
+	b.entries = nil
+	if b.spill != nil {
+		if err := b.spill.close(); err != nil {
+			b.spiller.logger.Warnf("Failed to remove spill file of transaction xid=%d: %+v", b.xid, err)
+		}
+		b.spill = nil
+	}
+}
+
+type spillDecoderFn func(
+	data []byte, xid uint32, streamed bool, relation *pgtypes.RelationMessage,
+) (pglogrepl.Message, error)
+
+// transactionSpill is the temporary file of spilled changes of a single
+// transaction. Relations are kept in memory once per version, changes
+// refer to the relation version which was active when they were received.
+type transactionSpill struct {
+	file             *os.File
+	writer           *bufio.Writer
+	xid              uint32
+	databaseName     string
+	length           int
+	relations        []*pgtypes.RelationMessage
+	relationVersions map[uint32]int32
+	subXids          map[uint32]int
+	aborted          map[uint32]bool
+}
+
+func newTransactionSpill(
+	path string, xid uint32, databaseName string,
+) (*transactionSpill, error) {
+
+	file, err := os.CreateTemp(path, fmt.Sprintf("transaction-%d-*.spill", xid))
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	return &transactionSpill{
+		file:             file,
+		writer:           bufio.NewWriter(file),
+		xid:              xid,
+		databaseName:     databaseName,
+		relations:        make([]*pgtypes.RelationMessage, 0),
+		relationVersions: make(map[uint32]int32),
+		subXids:          make(map[uint32]int),
+		aborted:          make(map[uint32]bool),
+	}, nil
+}
+
+func (s *transactionSpill) write(
+	entry *transactionEntry, relation *pgtypes.RelationMessage,
+) error {
+
+	relationVersion := noRelation
+	if relation != nil {
+		version, present := s.relationVersions[relation.RelationID]
+		if !present || s.relations[version] != relation {
+			version = int32(len(s.relations))
+			s.relations = append(s.relations, relation)
+			s.relationVersions[relation.RelationID] = version
+		}
+		relationVersion = version
+	}
+
+	var streamXid uint32
+	var streamed byte
+	if entry.xld.StreamXid != nil {
+		streamXid = *entry.xld.StreamXid
+		streamed = 1
+	}
+
+	xld := entry.xld
+	header := make([]byte, spillRecordHeaderSize)
+	binary.BigEndian.PutUint64(header[0:], uint64(xld.WALStart))
+	binary.BigEndian.PutUint64(header[8:], uint64(xld.ServerWALEnd))
+	binary.BigEndian.PutUint64(header[16:], uint64(xld.ServerTime.UnixNano()))
+	binary.BigEndian.PutUint64(header[24:], uint64(xld.LastBegin))
+	binary.BigEndian.PutUint64(header[32:], uint64(xld.LastCommit))
+	binary.BigEndian.PutUint32(header[40:], streamXid)
+	binary.BigEndian.PutUint32(header[44:], uint32(relationVersion))
+	binary.BigEndian.PutUint32(header[48:], uint32(len(xld.WALData)))
+	header[52] = streamed
+
+	if _, err := s.writer.Write(header); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if _, err := s.writer.Write(xld.WALData); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	s.length++
+	s.subXids[streamXid]++
+	return nil
+}
+
+// discard marks the changes of the sub-transaction as aborted, they
+// are skipped when the spilled changes are read back
+func (s *transactionSpill) discard(
+	subXid uint32,
+) int {
+
+	if s.aborted[subXid] {
+		return 0
+	}
+
+	discarded := s.subXids[subXid]
+	s.aborted[subXid] = true
+	s.length -= discarded
+	return discarded
+}
+
+func (s *transactionSpill) forEach(
+	decoder spillDecoderFn, fn func(entry *transactionEntry) error,
+) error {
+
+	if err := s.writer.Flush(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	reader := bufio.NewReader(s.file)
+	header := make([]byte, spillRecordHeaderSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.Wrap(err, 0)
+		}
+
+		data := make([]byte, binary.BigEndian.Uint32(header[48:]))
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return errors.Wrap(err, 0)
+		}
+
+		streamed := header[52] == 1
+		streamXid := binary.BigEndian.Uint32(header[40:])
+		if streamed && s.aborted[streamXid] {
+			continue
+		}
+
+		var relation *pgtypes.RelationMessage
+		if relationVersion := int32(binary.BigEndian.Uint32(header[44:])); relationVersion != noRelation {
+			relation = s.relations[relationVersion]
+		}
+
+		msg, err := decoder(data, s.xid, streamed, relation)
+		if err != nil {
+			return err
+		}
+
+		xld := pgtypes.XLogData{
+			XLogData: pglogrepl.XLogData{
+				WALStart:     pglogrepl.LSN(binary.BigEndian.Uint64(header[0:])),
+				ServerWALEnd: pglogrepl.LSN(binary.BigEndian.Uint64(header[8:])),
+				ServerTime:   time.Unix(0, int64(binary.BigEndian.Uint64(header[16:]))),
+				WALData:      data,
+			},
+			DatabaseName: s.databaseName,
+			LastBegin:    pgtypes.LSN(binary.BigEndian.Uint64(header[24:])),
+			LastCommit:   pgtypes.LSN(binary.BigEndian.Uint64(header[32:])),
+			Xid:          s.xid,
+		}
+		if streamed {
+			xld.StreamXid = &streamXid
+		}
+
+		if err := fn(&transactionEntry{xld: xld, msg: msg}); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *transactionSpill) close() error {
+	if err := s.file.Close(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return os.Remove(s.file.Name())
+}
+
+func relationIdOf(
+	msg pglogrepl.Message,
+) (uint32, bool) {
+
+	switch m := msg.(type) {
+	case *pgtypes.InsertMessage:
+		return m.RelationID, true
+	case *pgtypes.UpdateMessage:
+		return m.RelationID, true
+	case *pgtypes.DeleteMessage:
+		return m.RelationID, true
+	}
+	return 0, false
+}
@@ -0,0 +1,313 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logicalreplicationresolver
+
+import (
+	"fmt"
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/internal/containers"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"strings"
+)
+
+type tableResolverFn func(
+	relationId uint32,
+) (systemcatalog.BaseTable, bool)
+
+// transactionCompactor compacts the changes of a transaction, keeping only
+// the latest version per primary key of the selected tables. The versions
+// of a row are merged into a single create, update, or delete, emitted at
+// the position of the latest version. Rows inserted and deleted in the
+// same transaction are dropped altogether.
+type transactionCompactor struct {
+	tableFilter  *tablefiltering.TableFilter
+	resolveTable tableResolverFn
+}
+
+func newTransactionCompactor(
+	tableFilter *tablefiltering.TableFilter, resolveTable tableResolverFn,
+) *transactionCompactor {
+
+	return &transactionCompactor{
+		tableFilter:  tableFilter,
+		resolveTable: resolveTable,
+	}
+}
+
+// newCatalogTableResolver resolves relations to PostgreSQL tables, or to
+// the hypertable of a chunk, so that versions of a row moved between
+// chunks are compacted together
+func newCatalogTableResolver(
+	systemCatalog systemcatalog.SystemCatalog, relations *containers.RelationCache[*pgtypes.RelationMessage],
+) tableResolverFn {
+
+	return func(relationId uint32) (systemcatalog.BaseTable, bool) {
+		relation, present := relations.Get(relationId)
+		if !present || systemcatalog.IsHypertableEvent(relation) || systemcatalog.IsChunkEvent(relation) {
+			return nil, false
+		}
+
+		if systemcatalog.IsVanillaTable(relation) {
+			return systemCatalog.FindVanillaTableById(relationId)
+		}
+
+		chunk, present := systemCatalog.FindChunkByName(relation.Namespace, relation.RelationName)
+		if !present {
+			return nil, false
+		}
+		return systemCatalog.FindHypertableById(chunk.HypertableId())
+	}
+}
+
+type compactedRow struct {
+	first     *transactionEntry
+	last      *transactionEntry
+	lastIndex int
+	versions  int
+}
+
+type compactedTable struct {
+	keyColumns []string
+	disabled   bool
+}
+
+func (c *transactionCompactor) compact(
+	entries []*transactionEntry,
+) []*transactionEntry {
+
+	tables := make(map[uint32]*compactedTable)
+	tablesByName := make(map[string]*compactedTable)
+	rows := make(map[string]*compactedRow)
+	rowKeys := make([]string, len(entries))
+
+	for i, entry := range entries {
+		relationId, keyValues, oldKeyValues, compactable := rowValues(entry)
+		if !compactable {
+			continue
+		}
+
+		table, present := tables[relationId]
+		if !present {
+			table = c.compactedTable(relationId, tablesByName)
+			tables[relationId] = table
+		}
+		if table == nil {
+			continue
+		}
+
+		key, complete := rowKey(table.keyColumns, keyValues)
+		if !complete {
+			continue
+		}
+
+		// Rows changing their primary key can't be tracked reliably, hence the
+		// table isn't compacted in this transaction
+		if oldKeyValues != nil {
+			if oldKey, _ := rowKey(table.keyColumns, oldKeyValues); oldKey != key {
+				table.disabled = true
+				continue
+			}
+		}
+
+		rowKeys[i] = key
+		row, present := rows[key]
+		if !present {
+			row = &compactedRow{first: entry}
+			rows[key] = row
+		}
+		row.last = entry
+		row.lastIndex = i
+		row.versions++
+	}
+
+	compacted := make([]*transactionEntry, 0, len(entries))
+	for i, entry := range entries {
+		key := rowKeys[i]
+		if key == "" {
+			compacted = append(compacted, entry)
+			continue
+		}
+
+		relationId, _, _, _ := rowValues(entry)
+		if tables[relationId].disabled {
+			compacted = append(compacted, entry)
+			continue
+		}
+
+		row := rows[key]
+		if row.versions == 1 {
+			compacted = append(compacted, entry)
+			continue
+		}
+
+		if i == row.lastIndex {
+			if merged := mergeVersions(row.first, row.last); merged != nil {
+				compacted = append(compacted, merged)
+			}
+		}
+	}
+	return compacted
+}
+
+func (c *transactionCompactor) compactedTable(
+	relationId uint32, tablesByName map[string]*compactedTable,
+) *compactedTable {
+
+	table, present := c.resolveTable(relationId)
+	if !present || !c.tableFilter.Enabled(table) {
+		return nil
+	}
+
+	// Chunks are resolved to their hypertable, hence all chunks
+	// of a hypertable share the same state
+	if compacted, present := tablesByName[table.CanonicalName()]; present {
+		return compacted
+	}
+
+	keyColumns := make([]string, 0)
+	for _, column := range table.TableColumns() {
+		if column.IsPrimaryKey() {
+			keyColumns = append(keyColumns, column.Name())
+		}
+	}
+
+	// Without primary key, versions of a row can't be identified
+	if len(keyColumns) == 0 {
+		tablesByName[table.CanonicalName()] = nil
+		return nil
+	}
+
+	// The row key needs to be unique across the relations
+	// of a hypertable, hence the table name is part of it
+	keyColumns = append([]string{table.CanonicalName()}, keyColumns...)
+	compacted := &compactedTable{keyColumns: keyColumns}
+	tablesByName[table.CanonicalName()] = compacted
+	return compacted
+}
+
+// mergeVersions merges the first and last version of a row into a single
+// change, or nil if the row neither existed before nor after the transaction
+func mergeVersions(
+	first, last *transactionEntry,
+) *transactionEntry {
+
+	_, insertedFirst := first.msg.(*pgtypes.InsertMessage)
+	_, deletedLast := last.msg.(*pgtypes.DeleteMessage)
+	existedBefore := !insertedFirst
+	existsAfter := !deletedLast
+
+	relationId, _, _, _ := rowValues(last)
+	oldValues := previousValues(first, last)
+
+	var msg pglogrepl.Message
+	switch {
+	case !existedBefore && !existsAfter:
+		return nil
+
+	case !existedBefore:
+		msg = &pgtypes.InsertMessage{
+			InsertMessage: &pglogrepl.InsertMessage{RelationID: relationId},
+			NewValues:     newValues(last),
+		}
+
+	case existsAfter:
+		msg = &pgtypes.UpdateMessage{
+			UpdateMessage: &pglogrepl.UpdateMessage{RelationID: relationId},
+			OldValues:     oldValues,
+			NewValues:     newValues(last),
+		}
+
+	default:
+		msg = &pgtypes.DeleteMessage{
+			DeleteMessage: &pglogrepl.DeleteMessage{RelationID: relationId},
+			OldValues:     oldValues,
+		}
+	}
+
+	return &transactionEntry{
+		xld: last.xld,
+		msg: msg,
+	}
+}
+
+// previousValues returns the values of the row before the transaction, as far as
+// known, which depends on the replica identity of the table
+func previousValues(
+	first, last *transactionEntry,
+) map[string]any {
+
+	switch msg := first.msg.(type) {
+	case *pgtypes.UpdateMessage:
+		if msg.OldValues != nil {
+			return msg.OldValues
+		}
+	case *pgtypes.DeleteMessage:
+		return msg.OldValues
+	}
+
+	if msg, ok := last.msg.(*pgtypes.DeleteMessage); ok {
+		return msg.OldValues
+	}
+	return nil
+}
+
+func newValues(
+	entry *transactionEntry,
+) map[string]any {
+
+	switch msg := entry.msg.(type) {
+	case *pgtypes.InsertMessage:
+		return msg.NewValues
+	case *pgtypes.UpdateMessage:
+		return msg.NewValues
+	}
+	return nil
+}
+
+func rowValues(
+	entry *transactionEntry,
+) (relationId uint32, keyValues, oldKeyValues map[string]any, compactable bool) {
+
+	switch msg := entry.msg.(type) {
+	case *pgtypes.InsertMessage:
+		return msg.RelationID, msg.NewValues, nil, true
+	case *pgtypes.UpdateMessage:
+		return msg.RelationID, msg.NewValues, msg.OldValues, true
+	case *pgtypes.DeleteMessage:
+		return msg.RelationID, msg.OldValues, nil, true
+	}
+	return 0, nil, nil, false
+}
+
+func rowKey(
+	keyColumns []string, values map[string]any,
+) (string, bool) {
+
+	key := make([]string, len(keyColumns))
+	key[0] = keyColumns[0]
+	for i, column := range keyColumns[1:] {
+		value, present := values[column]
+		if !present {
+			return "", false
+		}
+		key[i+1] = fmt.Sprintf("%v", value)
+	}
+	return strings.Join(key, "\x00"), true
+}
@@ -0,0 +1,221 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logicalreplicationresolver
+
+import (
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_TransactionCompactor_Updates(
+	t *testing.T,
+) {
+
+	compactor := newTestTransactionCompactor(t)
+	compacted := compactor.compact([]*transactionEntry{
+		compactionEntry(1, updateMessage(1, row(1, "a"), row(1, "b"))),
+		compactionEntry(2, updateMessage(1, row(1, "b"), row(1, "c"))),
+		compactionEntry(3, updateMessage(1, row(1, "c"), row(1, "d"))),
+	})
+
+	assert.Len(t, compacted, 1)
+	assert.Equal(t, pglogrepl.LSN(3), compacted[0].xld.ServerWALEnd)
+	update := compacted[0].msg.(*pgtypes.UpdateMessage)
+	assert.Equal(t, uint32(1), update.RelationID)
+	assert.Equal(t, row(1, "a"), update.OldValues)
+	assert.Equal(t, row(1, "d"), update.NewValues)
+}
+
+func Test_TransactionCompactor_Insert_And_Updates(
+	t *testing.T,
+) {
+
+	compactor := newTestTransactionCompactor(t)
+	compacted := compactor.compact([]*transactionEntry{
+		compactionEntry(1, insertMessage(1, row(1, "a"))),
+		compactionEntry(2, updateMessage(1, nil, row(1, "b"))),
+	})
+
+	assert.Len(t, compacted, 1)
+	insert := compacted[0].msg.(*pgtypes.InsertMessage)
+	assert.Equal(t, row(1, "b"), insert.NewValues)
+}
+
+func Test_TransactionCompactor_Updates_And_Delete(
+	t *testing.T,
+) {
+
+	compactor := newTestTransactionCompactor(t)
+	compacted := compactor.compact([]*transactionEntry{
+		compactionEntry(1, updateMessage(1, row(1, "a"), row(1, "b"))),
+		compactionEntry(2, deleteMessage(1, row(1, "b"))),
+	})
+
+	assert.Len(t, compacted, 1)
+	deleted := compacted[0].msg.(*pgtypes.DeleteMessage)
+	assert.Equal(t, row(1, "a"), deleted.OldValues)
+}
+
+func Test_TransactionCompactor_Insert_And_Delete(
+	t *testing.T,
+) {
+
+	compactor := newTestTransactionCompactor(t)
+	compacted := compactor.compact([]*transactionEntry{
+		compactionEntry(1, insertMessage(1, row(1, "a"))),
+		compactionEntry(2, updateMessage(1, nil, row(1, "b"))),
+		compactionEntry(3, deleteMessage(1, row(1, nil))),
+	})
+
+	assert.Empty(t, compacted)
+}
+
+func Test_TransactionCompactor_Keeps_Order(
+	t *testing.T,
+) {
+
+	compactor := newTestTransactionCompactor(t)
+	message := &pgtypes.LogicalReplicationMessage{}
+	compacted := compactor.compact([]*transactionEntry{
+		compactionEntry(1, updateMessage(1, nil, row(1, "a"))),
+		compactionEntry(2, insertMessage(1, row(2, "a"))),
+		compactionEntry(3, updateMessage(1, nil, row(1, "b"))),
+		compactionEntry(4, message),
+		compactionEntry(5, insertMessage(2, row(1, "a"))),
+		compactionEntry(6, updateMessage(2, nil, row(1, "b"))),
+	})
+
+	assert.Len(t, compacted, 5)
+	assert.Equal(t, pglogrepl.LSN(2), compacted[0].xld.ServerWALEnd)
+	assert.Equal(t, pglogrepl.LSN(3), compacted[1].xld.ServerWALEnd)
+	assert.Equal(t, row(1, "b"), compacted[1].msg.(*pgtypes.UpdateMessage).NewValues)
+	assert.Same(t, message, compacted[2].msg)
+	assert.Equal(t, pglogrepl.LSN(5), compacted[3].xld.ServerWALEnd)
+	assert.Equal(t, pglogrepl.LSN(6), compacted[4].xld.ServerWALEnd)
+}
+
+func Test_TransactionCompactor_Primary_Key_Change(
+	t *testing.T,
+) {
+
+	compactor := newTestTransactionCompactor(t)
+	compacted := compactor.compact([]*transactionEntry{
+		compactionEntry(1, updateMessage(1, row(1, "a"), row(1, "b"))),
+		compactionEntry(2, updateMessage(1, row(1, "b"), row(2, "b"))),
+		compactionEntry(3, updateMessage(1, row(2, "b"), row(2, "c"))),
+	})
+
+	assert.Len(t, compacted, 3)
+}
+
+func newTestTransactionCompactor(
+	t *testing.T,
+) *transactionCompactor {
+
+	compacted := systemcatalog.NewPgTable(1, "public", "compacted", pgtypes.DEFAULT)
+	compacted.ApplyTableSchema([]systemcatalog.Column{
+		systemcatalog.NewIndexColumn(
+			"id", 23, -1, nil, false, true, nil, nil, false, nil,
+			systemcatalog.ASC, systemcatalog.NULLS_LAST, false, false, nil, nil, nil,
+		),
+		systemcatalog.NewColumn("value", 25, -1, nil, true, nil),
+	})
+
+	other := systemcatalog.NewPgTable(2, "public", "other", pgtypes.DEFAULT)
+	other.ApplyTableSchema([]systemcatalog.Column{
+		systemcatalog.NewIndexColumn(
+			"id", 23, -1, nil, false, true, nil, nil, false, nil,
+			systemcatalog.ASC, systemcatalog.NULLS_LAST, false, false, nil, nil, nil,
+		),
+		systemcatalog.NewColumn("value", 25, -1, nil, true, nil),
+	})
+
+	tableFilter, err := tablefiltering.NewTableFilter([]string{}, []string{"public.compacted"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newTransactionCompactor(tableFilter, func(relationId uint32) (systemcatalog.BaseTable, bool) {
+		switch relationId {
+		case 1:
+			return compacted, true
+		case 2:
+			return other, true
+		}
+		return nil, false
+	})
+}
+
+func compactionEntry(
+	lsn pglogrepl.LSN, msg pglogrepl.Message,
+) *transactionEntry {
+
+	return &transactionEntry{
+		xld: pgtypes.XLogData{
+			XLogData: pglogrepl.XLogData{
+				ServerWALEnd: lsn,
+			},
+		},
+		msg: msg,
+	}
+}
+
+func insertMessage(
+	relationId uint32, newValues map[string]any,
+) *pgtypes.InsertMessage {
+
+	return &pgtypes.InsertMessage{
+		InsertMessage: &pglogrepl.InsertMessage{RelationID: relationId},
+		NewValues:     newValues,
+	}
+}
+
+func updateMessage(
+	relationId uint32, oldValues, newValues map[string]any,
+) *pgtypes.UpdateMessage {
+
+	return &pgtypes.UpdateMessage{
+		UpdateMessage: &pglogrepl.UpdateMessage{RelationID: relationId},
+		OldValues:     oldValues,
+		NewValues:     newValues,
+	}
+}
+
+func deleteMessage(
+	relationId uint32, oldValues map[string]any,
+) *pgtypes.DeleteMessage {
+
+	return &pgtypes.DeleteMessage{
+		DeleteMessage: &pglogrepl.DeleteMessage{RelationID: relationId},
+		OldValues:     oldValues,
+	}
+}
+
+func row(
+	id int32, value any,
+) map[string]any {
+
+	return map[string]any{
+		"id":    id,
+		"value": value,
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/jackc/pglogrepl"
 	"github.com/noctarius/timescaledb-event-streamer/internal/containers"
 	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
 	"github.com/noctarius/timescaledb-event-streamer/spi/eventhandlers"
 	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
 	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
@@ -35,20 +36,29 @@ const (
 )
 
 type transactionTracker struct {
+	windowEnabled                bool
 	timeout                      time.Duration
 	relations                    *containers.RelationCache[*pgtypes.RelationMessage]
 	resolver                     *logicalReplicationResolver
 	taskManager                  task.TaskManager
 	systemCatalog                systemcatalog.SystemCatalog
 	activeTransaction            *transaction
+	streamedTransactions         *streamedTransactions
+	preparedTransactions         *preparedTransactions
+	compactor                    *transactionCompactor
 	logger                       *logging.Logger
 	supportsDecompressionMarkers bool
 }
 
+// newTransactionTracker creates the transaction tracker in front of the
+// resolver. Streamed and prepared transactions are always collected by
+// the tracker, if the transaction window is disabled all other changes
+// are passed on to the resolver as they are received.
 func newTransactionTracker(
-	timeout time.Duration, maxSize uint, replicationContext replicationcontext.ReplicationContext,
-	systemCatalog systemcatalog.SystemCatalog, resolver *logicalReplicationResolver,
-	taskManager task.TaskManager,
+	windowEnabled bool, timeout time.Duration, maxSize uint, spillPath string,
+	replicationContext replicationcontext.ReplicationContext, systemCatalog systemcatalog.SystemCatalog,
+	typeManager pgtypes.TypeManager, resolver *logicalReplicationResolver,
+	taskManager task.TaskManager, compactionFilter *tablefiltering.TableFilter,
 ) (eventhandlers.LogicalReplicationEventHandler, error) {
 
 	logger, err := logging.NewLogger("TransactionTracker")
@@ -56,18 +66,34 @@ func newTransactionTracker(
 		return nil, err
 	}
 
+	relations := containers.NewRelationCache[*pgtypes.RelationMessage]()
+	spiller, err := newTransactionSpiller(maxSize, spillPath, relations, typeManager)
+	if err != nil {
+		return nil, err
+	}
+
 	tt := &transactionTracker{
+		windowEnabled:                windowEnabled,
 		timeout:                      timeout,
 		systemCatalog:                systemCatalog,
 		taskManager:                  taskManager,
-		relations:                    containers.NewRelationCache[*pgtypes.RelationMessage](),
+		relations:                    relations,
+		streamedTransactions:         newStreamedTransactions(spiller),
+		preparedTransactions:         newPreparedTransactions(replicationContext, spiller, logger),
 		logger:                       logger,
 		resolver:                     resolver,
 		supportsDecompressionMarkers: replicationContext.IsDecompressionMarkingEnabled(),
 	}
 
+	if compactionFilter != nil {
+		tt.compactor = newTransactionCompactor(
+			compactionFilter, newCatalogTableResolver(systemCatalog, tt.relations),
+		)
+	}
+
 	tt.activeTransaction = &transaction{
 		transactionTracker: tt,
+		maxSize:            maxSize,
 		queue:              containers.NewQueue[*transactionEntry](int(maxSize + 1)),
 	}
 
@@ -129,11 +155,12 @@ func (tt *transactionTracker) OnBeginEvent(
 	xld pgtypes.XLogData, msg *pgtypes.BeginMessage,
 ) error {
 
-	tt.startTransaction(msg.Xid, msg.CommitTime, pgtypes.LSN(msg.FinalLSN))
-	if tt.supportsDecompressionMarkers {
+	if !tt.windowEnabled {
 		return tt.resolver.OnBeginEvent(xld, msg)
 	}
-	return nil
+
+	tt.startTransaction(msg.Xid, msg.CommitTime, pgtypes.LSN(msg.FinalLSN))
+	return tt.resolver.OnBeginEvent(xld, msg)
 }
 
 func (tt *transactionTracker) OnCommitEvent(
@@ -150,6 +177,13 @@ func (tt *transactionTracker) OnCommitEvent(
 	tt.activeTransaction.active = false
 
 	if tt.supportsDecompressionMarkers {
+		// With decompression markers, transactions are only collected
+		// to compact their changes, which need to be emitted now
+		if tt.compactor != nil {
+			if err := tt.activeTransaction.drain(); err != nil {
+				return err
+			}
+		}
 		return tt.resolver.OnCommitEvent(xld, msg)
 	}
 
@@ -167,7 +201,7 @@ func (tt *transactionTracker) OnCommitEvent(
 
 		// If there isn't a decompression event in the same transaction where done here
 		if tt.activeTransaction.decompressionUpdate == nil {
-			return nil
+			return tt.resolver.OnCommitEvent(xld, msg)
 		}
 	}
 
@@ -178,7 +212,10 @@ func (tt *transactionTracker) OnCommitEvent(
 			if err := tt.resolver.onChunkDecompressionEvent(xld, chunk); err != nil {
 				return err
 			}
-			return tt.resolver.onChunkUpdateEvent(xld, message.msg.(*pgtypes.UpdateMessage))
+			if err := tt.resolver.onChunkUpdateEvent(xld, message.msg.(*pgtypes.UpdateMessage)); err != nil {
+				return err
+			}
+			return tt.resolver.OnCommitEvent(xld, msg)
 		}
 	}
 
@@ -192,6 +229,18 @@ func (tt *transactionTracker) OnInsertEvent(
 	xld pgtypes.XLogData, msg *pgtypes.InsertMessage,
 ) error {
 
+	// Changes of in-progress and prepared transactions are collected until
+	// the transaction is committed (or prepared, depending on the configuration)
+	if collected, err := tt.collectTransactionEntry(xld, msg); err != nil {
+		return err
+	} else if collected {
+		return nil
+	}
+
+	if !tt.windowEnabled {
+		return tt.resolver.OnInsertEvent(xld, msg)
+	}
+
 	relation, present := tt.relations.Get(msg.RelationID)
 	if present {
 		// If no insert events are going to be generated, and we don't need to update the catalog,
@@ -217,7 +266,7 @@ func (tt *transactionTracker) OnInsertEvent(
 			return nil
 		}
 
-		if !tt.supportsDecompressionMarkers {
+		if tt.collectsTransaction() {
 			handled, err := tt.activeTransaction.pushTransactionEntry(&transactionEntry{
 				xld: xld,
 				msg: msg,
@@ -237,7 +286,15 @@ func (tt *transactionTracker) OnUpdateEvent(
 	xld pgtypes.XLogData, msg *pgtypes.UpdateMessage,
 ) error {
 
-	if tt.supportsDecompressionMarkers {
+	// Changes of in-progress and prepared transactions are collected until
+	// the transaction is committed (or prepared, depending on the configuration)
+	if collected, err := tt.collectTransactionEntry(xld, msg); err != nil {
+		return err
+	} else if collected {
+		return nil
+	}
+
+	if !tt.windowEnabled || !tt.collectsTransaction() {
 		return tt.resolver.OnUpdateEvent(xld, msg)
 	}
 
@@ -247,7 +304,7 @@ func (tt *transactionTracker) OnUpdateEvent(
 	}
 
 	if relation, present := tt.relations.Get(msg.RelationID); present {
-		if systemcatalog.IsChunkEvent(relation) {
+		if !tt.supportsDecompressionMarkers && systemcatalog.IsChunkEvent(relation) {
 			chunkId := msg.NewValues["id"].(int32)
 			if chunk, present := tt.systemCatalog.FindChunkById(chunkId); present {
 				oldChunkStatus := chunk.Status()
@@ -301,7 +358,15 @@ func (tt *transactionTracker) OnDeleteEvent(
 	xld pgtypes.XLogData, msg *pgtypes.DeleteMessage,
 ) error {
 
-	if tt.supportsDecompressionMarkers {
+	// Changes of in-progress and prepared transactions are collected until
+	// the transaction is committed (or prepared, depending on the configuration)
+	if collected, err := tt.collectTransactionEntry(xld, msg); err != nil {
+		return err
+	} else if collected {
+		return nil
+	}
+
+	if !tt.windowEnabled || !tt.collectsTransaction() {
 		return tt.resolver.OnDeleteEvent(xld, msg)
 	}
 
@@ -336,6 +401,18 @@ func (tt *transactionTracker) OnTruncateEvent(
 	xld pgtypes.XLogData, msg *pgtypes.TruncateMessage,
 ) error {
 
+	// Changes of in-progress and prepared transactions are collected until
+	// the transaction is committed (or prepared, depending on the configuration)
+	if collected, err := tt.collectTransactionEntry(xld, msg); err != nil {
+		return err
+	} else if collected {
+		return nil
+	}
+
+	if !tt.windowEnabled {
+		return tt.resolver.OnTruncateEvent(xld, msg)
+	}
+
 	// Since internal catalog tables shouldn't EVER be truncated, we ignore this case
 	// and only collect the truncate event if we expect the event to be generated in
 	// the later step. If no event is going to be created we discard it right here
@@ -344,7 +421,7 @@ func (tt *transactionTracker) OnTruncateEvent(
 		return nil
 	}
 
-	if !tt.supportsDecompressionMarkers && tt.activeTransaction.active {
+	if tt.collectsTransaction() && tt.activeTransaction.active {
 		handled, err := tt.activeTransaction.pushTransactionEntry(&transactionEntry{
 			xld: xld,
 			msg: msg,
@@ -377,6 +454,18 @@ func (tt *transactionTracker) OnMessageEvent(
 	xld pgtypes.XLogData, msg *pgtypes.LogicalReplicationMessage,
 ) error {
 
+	// Changes of in-progress and prepared transactions are collected until
+	// the transaction is committed (or prepared, depending on the configuration)
+	if collected, err := tt.collectTransactionEntry(xld, msg); err != nil {
+		return err
+	} else if collected {
+		return nil
+	}
+
+	if !tt.windowEnabled {
+		return tt.resolver.OnMessageEvent(xld, msg)
+	}
+
 	// If the message is transactional we need to store it into the currently collected
 	// transaction, otherwise we can run it straight away.
 	if msg.IsTransactional() {
@@ -397,7 +486,7 @@ func (tt *transactionTracker) OnMessageEvent(
 			return nil
 		}
 
-		if !tt.supportsDecompressionMarkers {
+		if tt.collectsTransaction() {
 			if tt.activeTransaction.active {
 				handled, err := tt.activeTransaction.pushTransactionEntry(&transactionEntry{
 					xld: xld,
@@ -415,6 +504,108 @@ func (tt *transactionTracker) OnMessageEvent(
 	return tt.resolver.OnMessageEvent(xld, msg)
 }
 
+func (tt *transactionTracker) OnStreamStartEvent(
+	_ pgtypes.XLogData, msg *pgtypes.StreamStartMessage,
+) error {
+
+	tt.logger.Verbosef("Streamed transaction xid=%d started receiving changes", msg.Xid)
+	return nil
+}
+
+func (tt *transactionTracker) OnStreamStopEvent(
+	_ pgtypes.XLogData, _ *pgtypes.StreamStopMessage,
+) error {
+
+	return nil
+}
+
+func (tt *transactionTracker) OnStreamCommitEvent(
+	xld pgtypes.XLogData, msg *pgtypes.StreamCommitMessage,
+) error {
+
+	// Replaying the collected changes through the transaction tracker itself,
+	// makes sure that streamed transactions are handled exactly the same way
+	// as non-streamed ones (including compression and decompression handling)
+	return tt.streamedTransactions.commit(tt, xld, msg)
+}
+
+func (tt *transactionTracker) OnStreamAbortEvent(
+	_ pgtypes.XLogData, msg *pgtypes.StreamAbortMessage,
+) error {
+
+	discarded := tt.streamedTransactions.abort(msg)
+	tt.logger.Verbosef(
+		"Streamed transaction xid=%d (subXid=%d) aborted, discarded %d changes", msg.Xid, msg.SubXid, discarded,
+	)
+	return nil
+}
+
+func (tt *transactionTracker) OnStreamPrepareEvent(
+	xld pgtypes.XLogData, msg *pgtypes.StreamPrepareMessage,
+) error {
+
+	buffer := tt.streamedTransactions.take(msg.Xid)
+	return tt.preparedTransactions.streamPrepare(tt, xld, &msg.PrepareMessage, buffer)
+}
+
+func (tt *transactionTracker) OnBeginPrepareEvent(
+	xld pgtypes.XLogData, msg *pgtypes.BeginPrepareMessage,
+) error {
+
+	tt.preparedTransactions.begin(xld, msg)
+	return nil
+}
+
+func (tt *transactionTracker) OnPrepareEvent(
+	xld pgtypes.XLogData, msg *pgtypes.PrepareMessage,
+) error {
+
+	return tt.preparedTransactions.prepare(tt, xld, msg)
+}
+
+func (tt *transactionTracker) OnCommitPreparedEvent(
+	xld pgtypes.XLogData, msg *pgtypes.CommitPreparedMessage,
+) error {
+
+	return tt.preparedTransactions.commitPrepared(tt, xld, msg)
+}
+
+func (tt *transactionTracker) OnRollbackPreparedEvent(
+	_ pgtypes.XLogData, msg *pgtypes.RollbackPreparedMessage,
+) error {
+
+	if tt.preparedTransactions.emitOnPrepare {
+		tt.logger.Warnf(
+			"Prepared transaction gid=%s (xid=%d) rolled back after its changes were already emitted",
+			msg.Gid, msg.Xid,
+		)
+		return nil
+	}
+
+	discarded := tt.preparedTransactions.rollbackPrepared(msg)
+	tt.logger.Verbosef(
+		"Prepared transaction gid=%s (xid=%d) rolled back, discarded %d changes", msg.Gid, msg.Xid, discarded,
+	)
+	return nil
+}
+
+// collectsTransaction returns true if the changes of the active transaction
+// are collected until commit, either to detect compressions and decompressions
+// of chunks, or to compact the changes per row
+func (tt *transactionTracker) collectsTransaction() bool {
+	return !tt.supportsDecompressionMarkers || tt.compactor != nil
+}
+
+func (tt *transactionTracker) collectTransactionEntry(
+	xld pgtypes.XLogData, msg pglogrepl.Message,
+) (bool, error) {
+
+	if collected, err := tt.streamedTransactions.push(xld, msg); err != nil || collected {
+		return collected, err
+	}
+	return tt.preparedTransactions.push(xld, msg)
+}
+
 func (tt *transactionTracker) startTransaction(
 	xid uint32, commitTime time.Time, finalLSN pgtypes.LSN,
 ) {
@@ -475,6 +666,18 @@ func (t *transaction) pushTransactionEntry(
 	}
 
 	if t.timedOut || t.overflowed {
+		// Compaction is bounded by the transaction window, all changes
+		// after this point are passed on as they are received
+		if t.transactionTracker.compactor != nil {
+			reason := "exceeded the transaction window timeout"
+			if t.overflowed {
+				reason = "exceeded the transaction window maxsize"
+			}
+			t.transactionTracker.logger.Warnf(
+				"Transaction xid=%d %s after %d changes, only these changes are compacted",
+				t.xid, reason, t.queueLength,
+			)
+		}
 		return true, t.drain()
 	}
 
@@ -482,37 +685,32 @@ func (t *transaction) pushTransactionEntry(
 }
 
 func (t *transaction) drain() error {
+	if compactor := t.transactionTracker.compactor; compactor != nil {
+		entries := make([]*transactionEntry, 0, t.queueLength)
+		for {
+			entry := t.queue.Pop()
+			if entry == nil {
+				break
+			}
+			entries = append(entries, entry)
+		}
+
+		for _, entry := range compactor.compact(entries) {
+			if err := dispatchTransactionEntry(t.transactionTracker.resolver, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	for {
 		entry := t.queue.Pop()
 		if entry == nil {
 			break
 		}
 
-		switch msg := entry.msg.(type) {
-		case *pgtypes.BeginMessage:
-			if err := t.transactionTracker.resolver.OnBeginEvent(entry.xld, msg); err != nil {
-				return err
-			}
-		case *pgtypes.InsertMessage:
-			if err := t.transactionTracker.resolver.OnInsertEvent(entry.xld, msg); err != nil {
-				return err
-			}
-		case *pgtypes.UpdateMessage:
-			if err := t.transactionTracker.resolver.OnUpdateEvent(entry.xld, msg); err != nil {
-				return err
-			}
-		case *pgtypes.DeleteMessage:
-			if err := t.transactionTracker.resolver.OnDeleteEvent(entry.xld, msg); err != nil {
-				return err
-			}
-		case *pgtypes.TruncateMessage:
-			if err := t.transactionTracker.resolver.OnTruncateEvent(entry.xld, msg); err != nil {
-				return err
-			}
-		case *pgtypes.LogicalReplicationMessage:
-			if err := t.transactionTracker.resolver.OnMessageEvent(entry.xld, msg); err != nil {
-				return err
-			}
+		if err := dispatchTransactionEntry(t.transactionTracker.resolver, entry); err != nil {
+			return err
 		}
 	}
 	return nil
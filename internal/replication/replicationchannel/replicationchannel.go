@@ -115,12 +115,39 @@ func (rc *ReplicationChannel) StartReplicationChannel(
 		fmt.Sprintf("publication_names '%s'", rc.publicationManager.PublicationName()),
 	}
 	if rc.replicationContext.IsPG14GE() {
+		// Streaming of in-progress transactions requires protocol version 2,
+		// two-phase commits (PG15+) require protocol version 3, and parallel
+		// streaming (PG16+) requires protocol version 4
+		protocolVersion := 2
+		streamingMode := rc.replicationContext.TransactionStreamingMode()
+		twoPhaseMode := rc.replicationContext.TwoPhaseMode()
+		if twoPhaseMode != config.TwoPhaseOff {
+			protocolVersion = 3
+		}
+		if streamingMode == config.StreamingParallel {
+			protocolVersion = 4
+		}
+
 		pluginArguments = append(
 			pluginArguments,
-			"proto_version '2'",
+			fmt.Sprintf("proto_version '%d'", protocolVersion),
 			"messages 'true'",
 			"binary 'true'",
 		)
+
+		if streamingMode != config.StreamingOff {
+			pluginArguments = append(
+				pluginArguments,
+				fmt.Sprintf("streaming '%s'", streamingMode),
+			)
+		}
+
+		if twoPhaseMode != config.TwoPhaseOff {
+			pluginArguments = append(
+				pluginArguments,
+				"two_phase 'true'",
+			)
+		}
 	} else {
 		pluginArguments = append(
 			pluginArguments,
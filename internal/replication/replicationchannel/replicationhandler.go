@@ -18,6 +18,7 @@
 package replicationchannel
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/go-errors/errors"
 	"github.com/jackc/pglogrepl"
@@ -73,6 +74,8 @@ type replicationHandler struct {
 	statsReporter      *stats.Reporter
 	loopDead           atomic.Bool
 	lastTransactionId  *uint32
+	activeStreamXid    *uint32
+	activePrepare      bool
 	logger             *logging.Logger
 
 	stats           *replicationChannelStats
@@ -193,9 +196,14 @@ func (rh *replicationHandler) startReplicationHandler(
 				Xid:          xid,
 			}
 
-			// Skip all entries that were already replicated before the streamer was shut down
+			// Skip all entries that were already replicated before the streamer was shut down.
+			// Stream start and stop messages are never skipped, since they define how the
+			// following messages need to be parsed.
 			msgType := pglogrepl.MessageType(xld.WALData[0])
-			if msgType != pglogrepl.MessageTypeRelation && restartLSN > pgtypes.LSN(xld.WALStart) {
+			if msgType != pglogrepl.MessageTypeRelation &&
+				msgType != pglogrepl.MessageTypeStreamStart &&
+				msgType != pglogrepl.MessageTypeStreamStop &&
+				restartLSN > pgtypes.LSN(xld.WALStart) {
 				rh.logger.Debugf("Skipped message, LSN lower than restartLSN: %s < %s", xld.WALStart, restartLSN)
 				rh.stats.reset()
 				rh.stats.calls.total++
@@ -218,7 +226,29 @@ func (rh *replicationHandler) handleXLogData(
 	xld pgtypes.XLogData,
 ) error {
 
-	msg, err := pgtypes.ParseXlogData(xld.WALData, rh.lastTransactionId)
+	var msg pglogrepl.Message
+	var err error
+
+	// Messages between a stream start and stop message belong to an in-progress
+	// transaction and carry the (sub-)transaction id as an additional field
+	if rh.activeStreamXid != nil {
+		var streamXid uint32
+		msg, streamXid, err = pgtypes.ParseStreamedXlogData(xld.WALData)
+		if streamXid != 0 {
+			xld.Xid = *rh.activeStreamXid
+			xld.StreamXid = &streamXid
+			// Changes of streamed transactions may be spilled to disk as raw WAL
+			// data, which needs to outlive the receive buffer of the connection
+			xld.WALData = bytes.Clone(xld.WALData)
+		}
+	} else {
+		// Same as with streamed transactions, changes of held back prepared
+		// transactions may be spilled to disk
+		if rh.activePrepare {
+			xld.WALData = bytes.Clone(xld.WALData)
+		}
+		msg, err = pgtypes.ParseXlogData(xld.WALData, rh.lastTransactionId)
+	}
 	if err != nil {
 		return fmt.Errorf("parsing logical replication message: %s", err)
 	}
@@ -289,6 +319,114 @@ func (rh *replicationHandler) handleReplicationEvents(
 				},
 			)
 		})
+	case *pgtypes.StreamStartMessage:
+		rh.logger.Debugf("EVENT: %s", logicalMsg)
+		xid := logicalMsg.Xid
+		rh.activeStreamXid = &xid
+		xld.Xid = xid
+		return rh.taskManager.EnqueueTask(func(notificator task.Notificator) {
+			notificator.NotifyLogicalReplicationEventHandler(
+				func(handler eventhandlers.LogicalReplicationEventHandler) error {
+					return handler.OnStreamStartEvent(xld, logicalMsg)
+				},
+			)
+		})
+	case *pgtypes.StreamStopMessage:
+		rh.logger.Debugf("EVENT: %s", logicalMsg)
+		rh.activeStreamXid = nil
+		return rh.taskManager.EnqueueTask(func(notificator task.Notificator) {
+			notificator.NotifyLogicalReplicationEventHandler(
+				func(handler eventhandlers.LogicalReplicationEventHandler) error {
+					return handler.OnStreamStopEvent(xld, logicalMsg)
+				},
+			)
+		})
+	case *pgtypes.StreamCommitMessage:
+		rh.logger.Debugf("EVENT: %s", logicalMsg)
+		xld.Xid = logicalMsg.Xid
+		rh.stats.statistics.transactions++
+		return rh.taskManager.EnqueueTask(func(notificator task.Notificator) {
+			notificator.NotifyLogicalReplicationEventHandler(
+				func(handler eventhandlers.LogicalReplicationEventHandler) error {
+					return handler.OnStreamCommitEvent(xld, logicalMsg)
+				},
+			)
+		})
+	case *pgtypes.StreamAbortMessage:
+		rh.logger.Debugf("EVENT: %s", logicalMsg)
+		xld.Xid = logicalMsg.Xid
+		return rh.taskManager.EnqueueTask(func(notificator task.Notificator) {
+			notificator.NotifyLogicalReplicationEventHandler(
+				func(handler eventhandlers.LogicalReplicationEventHandler) error {
+					return handler.OnStreamAbortEvent(xld, logicalMsg)
+				},
+			)
+		})
+	case *pgtypes.StreamPrepareMessage:
+		rh.logger.Debugf("EVENT: %s", logicalMsg)
+		xld.Xid = logicalMsg.Xid
+		return rh.taskManager.EnqueueTask(func(notificator task.Notificator) {
+			notificator.NotifyLogicalReplicationEventHandler(
+				func(handler eventhandlers.LogicalReplicationEventHandler) error {
+					return handler.OnStreamPrepareEvent(xld, logicalMsg)
+				},
+			)
+		})
+	case *pgtypes.BeginPrepareMessage:
+		rh.logger.Debugf("EVENT: %s", logicalMsg)
+		rh.replicationContext.SetLastTransactionId(logicalMsg.Xid)
+		rh.lastTransactionId = &logicalMsg.Xid
+		rh.activePrepare = true
+		xld.Xid = logicalMsg.Xid
+		// Indicates the beginning of a prepared transaction (PREPARE TRANSACTION).
+		// Whether the transaction is committed or rolled back is only known when
+		// the Commit Prepared or Rollback Prepared message is received.
+		rh.transactionSize = 0
+		return rh.taskManager.EnqueueTask(func(notificator task.Notificator) {
+			notificator.NotifyLogicalReplicationEventHandler(
+				func(handler eventhandlers.LogicalReplicationEventHandler) error {
+					return handler.OnBeginPrepareEvent(xld, logicalMsg)
+				},
+			)
+		})
+	case *pgtypes.PrepareMessage:
+		rh.logger.Debugf("EVENT: %s", logicalMsg)
+		rh.lastTransactionId = nil
+		rh.activePrepare = false
+		xld.Xid = logicalMsg.Xid
+
+		if rh.transactionSize > rh.stats.statistics.largestTransaction {
+			rh.stats.statistics.largestTransaction = rh.transactionSize
+		}
+
+		return rh.taskManager.EnqueueTask(func(notificator task.Notificator) {
+			notificator.NotifyLogicalReplicationEventHandler(
+				func(handler eventhandlers.LogicalReplicationEventHandler) error {
+					return handler.OnPrepareEvent(xld, logicalMsg)
+				},
+			)
+		})
+	case *pgtypes.CommitPreparedMessage:
+		rh.logger.Debugf("EVENT: %s", logicalMsg)
+		xld.Xid = logicalMsg.Xid
+		rh.stats.statistics.transactions++
+		return rh.taskManager.EnqueueTask(func(notificator task.Notificator) {
+			notificator.NotifyLogicalReplicationEventHandler(
+				func(handler eventhandlers.LogicalReplicationEventHandler) error {
+					return handler.OnCommitPreparedEvent(xld, logicalMsg)
+				},
+			)
+		})
+	case *pgtypes.RollbackPreparedMessage:
+		rh.logger.Debugf("EVENT: %s", logicalMsg)
+		xld.Xid = logicalMsg.Xid
+		return rh.taskManager.EnqueueTask(func(notificator task.Notificator) {
+			notificator.NotifyLogicalReplicationEventHandler(
+				func(handler eventhandlers.LogicalReplicationEventHandler) error {
+					return handler.OnRollbackPreparedEvent(xld, logicalMsg)
+				},
+			)
+		})
 	case *pglogrepl.InsertMessage:
 		rh.transactionSize++
 		rh.stats.calls.inserts++
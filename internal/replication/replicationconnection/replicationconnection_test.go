@@ -404,6 +404,16 @@ func (t testReplicationContext) LastProcessedLSN() pgtypes.LSN {
 	return 0
 }
 
+func (t testReplicationContext) HoldProcessedLSN(
+	_ string, _ pgtypes.LSN,
+) {
+}
+
+func (t testReplicationContext) ReleaseProcessedLSN(
+	_ string,
+) {
+}
+
 func (t testReplicationContext) SetPositionLSNs(
 	receivedLSN, processedLSN pgtypes.LSN,
 ) {
@@ -413,6 +423,14 @@ func (t testReplicationContext) InitialSnapshotMode() config.InitialSnapshotMode
 	return ""
 }
 
+func (t testReplicationContext) TransactionStreamingMode() config.TransactionStreamingMode {
+	return config.StreamingOff
+}
+
+func (t testReplicationContext) TwoPhaseMode() config.TwoPhaseMode {
+	return config.TwoPhaseOff
+}
+
 func (t testReplicationContext) DatabaseUsername() string {
 	return ""
 }
@@ -461,6 +479,14 @@ func (t testReplicationContext) IsPG14GE() bool {
 	return false
 }
 
+func (t testReplicationContext) IsPG15GE() bool {
+	return false
+}
+
+func (t testReplicationContext) IsPG16GE() bool {
+	return false
+}
+
 func (t testReplicationContext) IsMinimumTimescaleVersion() bool {
 	return false
 }
@@ -42,6 +42,8 @@ type replicationContext struct {
 	stateStorageManager statestorage.Manager
 
 	snapshotInitialMode         spiconfig.InitialSnapshotMode
+	transactionStreamingMode    spiconfig.TransactionStreamingMode
+	twoPhaseMode                spiconfig.TwoPhaseMode
 	replicationSlotName         string
 	replicationSlotCreate       bool
 	replicationSlotAutoDrop     bool
@@ -57,6 +59,7 @@ type replicationContext struct {
 	lastReceivedLSN   pgtypes.LSN
 	lastProcessedLSN  pgtypes.LSN
 	lastTransactionId uint32
+	processedLSNHolds map[string]pgtypes.LSN
 
 	pgVersion   version.PostgresVersion
 	tsdbVersion version.TimescaleVersion
@@ -80,6 +83,14 @@ func NewReplicationContext(
 		config, spiconfig.PropertyPostgresqlReplicationSlotAutoDrop, true,
 	)
 
+	transactionStreamingMode := spiconfig.GetOrDefault(
+		config, spiconfig.PropertyPostgresqlTxStreaming, spiconfig.StreamingOff,
+	)
+
+	twoPhaseMode := spiconfig.GetOrDefault(
+		config, spiconfig.PropertyPostgresqlTxTwoPhase, spiconfig.TwoPhaseOff,
+	)
+
 	logger, err := logging.NewLogger("ReplicationContext")
 	if err != nil {
 		return nil, err
@@ -94,10 +105,13 @@ func NewReplicationContext(
 		sideChannel:         sideChannel,
 		stateStorageManager: stateStorageManager,
 
-		snapshotInitialMode:     snapshotInitialMode,
-		replicationSlotName:     replicationSlotName,
-		replicationSlotCreate:   replicationSlotCreate,
-		replicationSlotAutoDrop: replicationSlotAutoDrop,
+		snapshotInitialMode:      snapshotInitialMode,
+		transactionStreamingMode: transactionStreamingMode,
+		twoPhaseMode:             twoPhaseMode,
+		replicationSlotName:      replicationSlotName,
+		replicationSlotCreate:    replicationSlotCreate,
+		replicationSlotAutoDrop:  replicationSlotAutoDrop,
+		processedLSNHolds:        make(map[string]pgtypes.LSN),
 	}
 
 	pgVersion, err := sideChannel.GetPostgresVersion()
@@ -123,6 +137,23 @@ func NewReplicationContext(
 	replicationContext.systemId = systemId
 	replicationContext.timeline = timeline
 
+	// Streaming of in-progress transactions is only available with PG14+,
+	// parallel streaming requires PG16+. Fall back to the next best option.
+	if transactionStreamingMode == spiconfig.StreamingParallel && !replicationContext.IsPG16GE() {
+		logger.Warnf("Parallel transaction streaming requires PostgreSQL 16+, falling back to 'on'")
+		replicationContext.transactionStreamingMode = spiconfig.StreamingOn
+	}
+	if replicationContext.transactionStreamingMode != spiconfig.StreamingOff && !replicationContext.IsPG14GE() {
+		logger.Warnf("Transaction streaming requires PostgreSQL 14+, falling back to 'off'")
+		replicationContext.transactionStreamingMode = spiconfig.StreamingOff
+	}
+
+	// Decoding of prepared transactions (two_phase) is only available with PG15+
+	if twoPhaseMode != spiconfig.TwoPhaseOff && !replicationContext.IsPG15GE() {
+		logger.Warnf("Two-phase commit decoding requires PostgreSQL 15+, falling back to 'off'")
+		replicationContext.twoPhaseMode = spiconfig.TwoPhaseOff
+	}
+
 	walLevel, err := sideChannel.GetWalLevel()
 	if err != nil {
 		return nil, err
@@ -261,6 +292,14 @@ func (rc *replicationContext) AcknowledgeProcessed(
 		newLastProcessedLSN = *processedLSN
 	}
 
+	// Positions beyond held back prepared transactions aren't acknowledged,
+	// otherwise PostgreSQL wouldn't send them again after a restart
+	for _, hold := range rc.processedLSNHolds {
+		if newLastProcessedLSN > hold {
+			newLastProcessedLSN = hold
+		}
+	}
+
 	if newLastProcessedLSN > rc.lastProcessedLSN {
 		rc.lastProcessedLSN = newLastProcessedLSN
 	}
@@ -280,10 +319,36 @@ func (rc *replicationContext) AcknowledgeProcessed(
 	return rc.stateStorageManager.Set(rc.replicationSlotName, o)
 }
 
+func (rc *replicationContext) HoldProcessedLSN(
+	id string, lsn pgtypes.LSN,
+) {
+
+	rc.lsnMutex.Lock()
+	defer rc.lsnMutex.Unlock()
+	rc.processedLSNHolds[id] = lsn
+}
+
+func (rc *replicationContext) ReleaseProcessedLSN(
+	id string,
+) {
+
+	rc.lsnMutex.Lock()
+	defer rc.lsnMutex.Unlock()
+	delete(rc.processedLSNHolds, id)
+}
+
 func (rc *replicationContext) InitialSnapshotMode() spiconfig.InitialSnapshotMode {
 	return rc.snapshotInitialMode
 }
 
+func (rc *replicationContext) TransactionStreamingMode() spiconfig.TransactionStreamingMode {
+	return rc.transactionStreamingMode
+}
+
+func (rc *replicationContext) TwoPhaseMode() spiconfig.TwoPhaseMode {
+	return rc.twoPhaseMode
+}
+
 func (rc *replicationContext) DatabaseUsername() string {
 	return rc.pgxConfig.User
 }
@@ -332,6 +397,14 @@ func (rc *replicationContext) IsPG14GE() bool {
 	return rc.pgVersion >= version.PG_14_VERSION
 }
 
+func (rc *replicationContext) IsPG15GE() bool {
+	return rc.pgVersion >= version.PG_15_VERSION
+}
+
+func (rc *replicationContext) IsPG16GE() bool {
+	return rc.pgVersion >= version.PG_16_VERSION
+}
+
 func (rc *replicationContext) IsMinimumTimescaleVersion() bool {
 	return rc.tsdbVersion >= version.TSDB_MIN_VERSION
 }
@@ -193,6 +193,14 @@ func (r *Replicator) StartReplication() *cli.ExitError {
 		return erroring.AdaptErrorWithMessage(err, "failed to read published tables", 25)
 	}
 
+	// Already published tables keep their column list and row filter,
+	// unless updated to the configured projection
+	if err := publicationManager.UpdatePublishedTables(
+		resolvePublishedTables(systemCatalog, publishedTables)...,
+	); err != nil {
+		return erroring.AdaptErrorWithMessage(err, "failed to update published tables", 25)
+	}
+
 	// Get initial list of chunks to add to publication
 	initialTables, err := r.collectChunksForPublication(
 		stateStorageManager.EncodedState, systemCatalog.GetAllChunks, publishedTables,
@@ -349,6 +357,25 @@ func (r *Replicator) containerInitializer(
 	return nil
 }
 
+// resolvePublishedTables returns the known chunks and vanilla tables
+// of the published tables, which are required to select their projection
+func resolvePublishedTables(
+	systemCatalog systemcatalog.SystemCatalog, publishedTables []systemcatalog.SystemEntity,
+) []systemcatalog.SystemEntity {
+
+	knownTables := lo.SliceToMap(
+		append(systemCatalog.GetAllChunks(), systemCatalog.GetAllVanillaTables()...),
+		func(entity systemcatalog.SystemEntity) (string, systemcatalog.SystemEntity) {
+			return entity.CanonicalName(), entity
+		},
+	)
+
+	return lo.FilterMap(publishedTables, func(entity systemcatalog.SystemEntity, _ int) (systemcatalog.SystemEntity, bool) {
+		knownTable, present := knownTables[entity.CanonicalName()]
+		return knownTable, present
+	})
+}
+
 func (r *Replicator) collectVanillaTablesForPublication(
 	encodedState func(name string) ([]byte, bool),
 	getAllVanillaTables func() []systemcatalog.SystemEntity,
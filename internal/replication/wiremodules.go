@@ -21,6 +21,11 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/eventemitting"
 	namingstrategyimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/namingstrategy"
 	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/deadletter"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/routing"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/spool"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/topicrouting"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/unwrap"
 	"github.com/noctarius/timescaledb-event-streamer/internal/publicationmanager"
 	"github.com/noctarius/timescaledb-event-streamer/internal/replication/logicalreplicationresolver"
 	"github.com/noctarius/timescaledb-event-streamer/internal/replication/replicationchannel"
@@ -74,9 +79,30 @@ var DynamicModule = wiring.DefineModule(
 			return namingstrategyimpl.NewNamingStrategy(name, c)
 		})
 
-		module.Provide(func(c *config.Config) (sink.Sink, error) {
-			name := config.GetOrDefault(c, config.PropertySink, config.Stdout)
-			return sinkimpl.NewSink(name, c)
+		module.Provide(func(c *config.Config, statsService *stats.Service) (sink.Sink, error) {
+			var s sink.Sink
+			var err error
+			if len(c.Sink.Sinks) > 0 {
+				s, err = routing.NewRoutingSinkFromConfig(c)
+			} else {
+				name := config.GetOrDefault(c, config.PropertySink, config.Stdout)
+				if s, err = sinkimpl.NewSink(name, c); err == nil {
+					s, err = unwrap.NewUnwrappingSinkFromConfig(c, s)
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+			s, err = topicrouting.NewTopicRoutingSinkFromConfig(c, s)
+			if err != nil {
+				return nil, err
+			}
+			// Rejected events are dead-lettered before they'd end up in the spool
+			s, err = deadletter.NewDeadLetterSinkFromConfig(c, s)
+			if err != nil {
+				return nil, err
+			}
+			return spool.NewSpoolingSinkFromConfig(c, s, statsService)
 		})
 	},
 )
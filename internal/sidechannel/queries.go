@@ -80,6 +80,23 @@ SELECT pt.schemaname, pt.tablename
 FROM pg_catalog.pg_publication_tables pt
 WHERE pt.pubname = $1`
 
+// Column lists and row filters are only available from PG15 onwards. Tables without
+// column list have an empty list, tables without row filter have an empty filter.
+const queryReadPublishedTableProjections = `
+SELECT n.nspname, c.relname,
+       ARRAY(
+           SELECT a.attname::text
+           FROM pg_catalog.pg_attribute a
+           WHERE a.attrelid = pr.prrelid AND a.attnum = ANY(pr.prattrs)
+           ORDER BY a.attnum
+       ),
+       coalesce(pg_catalog.pg_get_expr(pr.prqual, pr.prrelid), '')
+FROM pg_catalog.pg_publication_rel pr
+JOIN pg_catalog.pg_publication p ON p.oid = pr.prpubid
+JOIN pg_catalog.pg_class c ON c.oid = pr.prrelid
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+WHERE p.pubname = $1`
+
 const queryCheckTableExistsInPublication = `
 SELECT true
 FROM pg_catalog.pg_publication_tables pt
@@ -191,12 +208,32 @@ FROM pg_catalog.pg_class c
 LEFT JOIN pg_catalog.pg_namespace n ON c.relnamespace = n.oid
 WHERE n.nspname=$1 and c.relname=$2`
 
+const queryReadReplicaIdentityColumns = `
+SELECT a.attname, bool_or(
+    CASE c.relreplident
+        WHEN 'f' THEN true
+        WHEN 'd' THEN coalesce(i.indisprimary, false)
+        WHEN 'i' THEN coalesce(i.indisreplident, false)
+        ELSE false
+    END
+)
+FROM pg_catalog.pg_class c
+LEFT JOIN pg_catalog.pg_namespace n ON c.relnamespace = n.oid
+JOIN pg_catalog.pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+LEFT JOIN pg_catalog.pg_index i ON i.indrelid = c.oid AND a.attnum = ANY(i.indkey) AND (i.indisprimary OR i.indisreplident)
+WHERE n.nspname=$1 and c.relname=$2
+GROUP BY a.attnum, a.attname
+ORDER BY a.attnum`
+
 const queryTemplateSnapshotHighWatermark = `
 SELECT %s
 FROM %s
+WHERE %s
 ORDER BY %s
 LIMIT 1`
 
+const queryTemplateDeleteRows = `DELETE FROM %s WHERE "%s" IN (%s)`
+
 const queryCheckUserTablePrivilege = `SELECT HAS_TABLE_PRIVILEGE($1, $2, $3)`
 
 const queryReadCompositeTypeSchema = `
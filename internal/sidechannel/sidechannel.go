@@ -336,21 +336,27 @@ func (sc *sideChannel) ReadHypertableSchema(
 }
 
 func (sc *sideChannel) AttachTablesToPublication(
-	publicationName string, entities ...systemcatalog.SystemEntity,
+	publicationName string, tables ...sidechannel.PublicationTable,
 ) error {
 
-	if len(entities) == 0 {
+	if len(tables) == 0 {
 		return nil
 	}
 
-	entityTableList := sc.entitiesToTableList(entities)
-	attachingQuery := fmt.Sprintf(queryTemplateAddTableToPublication, publicationName, entityTableList)
+	tableSpecs := make([]string, len(tables))
+	for i, table := range tables {
+		tableSpecs[i] = table.AsSqlTableSpec()
+	}
+
+	attachingQuery := fmt.Sprintf(
+		queryTemplateAddTableToPublication, publicationName, strings.Join(tableSpecs, ","),
+	)
 	return sc.newSession(time.Second*20, func(session *session) error {
 		if _, err := session.exec(attachingQuery); err != nil {
 			return errors.Wrap(err, 0)
 		}
-		for _, entity := range entities {
-			sc.logger.Infof("Updated publication %s to add table %s", publicationName, entity.CanonicalName())
+		for _, tableSpec := range tableSpecs {
+			sc.logger.Infof("Updated publication %s to add table %s", publicationName, tableSpec)
 		}
 		return nil
 	})
@@ -379,15 +385,19 @@ func (sc *sideChannel) DetachTablesFromPublication(
 
 func (sc *sideChannel) SnapshotChunkTable(
 	rowDecoderFactory pgtypes.RowDecoderFactory, chunk *systemcatalog.Chunk,
-	snapshotBatchSize int, cb sidechannel.SnapshotRowCallback,
+	projection sidechannel.TableProjection, snapshotBatchSize int, cb sidechannel.SnapshotRowCallback,
 ) (pgtypes.LSN, error) {
 
 	var currentLSN pgtypes.LSN = 0
 
 	cursorName := lo.RandomString(15, lo.LowerCaseLettersCharset)
 	cursorQuery := fmt.Sprintf(
-		"DECLARE %s SCROLL CURSOR FOR SELECT * FROM %s", cursorName, chunk.CanonicalName(),
+		"DECLARE %s SCROLL CURSOR FOR SELECT %s FROM %s",
+		cursorName, projection.AsSqlColumnList(), chunk.CanonicalName(),
 	)
+	if condition := projection.AsSqlCondition(); condition != "" {
+		cursorQuery = fmt.Sprintf("%s WHERE %s", cursorQuery, condition)
+	}
 
 	callback := func(lsn pgtypes.LSN, values map[string]any) error {
 		if currentLSN == 0 {
@@ -407,7 +417,8 @@ func (sc *sideChannel) SnapshotChunkTable(
 
 func (sc *sideChannel) FetchTableSnapshotBatch(
 	rowDecoderFactory pgtypes.RowDecoderFactory, table systemcatalog.BaseTable,
-	snapshotName string, snapshotBatchSize int, cb sidechannel.SnapshotRowCallback,
+	projection sidechannel.TableProjection, snapshotName string, snapshotBatchSize int,
+	cb sidechannel.SnapshotRowCallback,
 ) error {
 
 	index, present := table.Columns().SnapshotIndex()
@@ -450,10 +461,14 @@ func (sc *sideChannel) FetchTableSnapshotBatch(
 				)
 			}
 
+			if condition := projection.AsSqlCondition(); condition != "" {
+				comparison = fmt.Sprintf("%s AND %s", condition, comparison)
+			}
+
 			cursorName := lo.RandomString(15, lo.LowerCaseLettersCharset)
 			cursorQuery := fmt.Sprintf(
-				`DECLARE %s SCROLL CURSOR FOR SELECT * FROM %s WHERE %s ORDER BY %s LIMIT %d`,
-				cursorName, table.CanonicalName(), comparison,
+				`DECLARE %s SCROLL CURSOR FOR SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT %d`,
+				cursorName, projection.AsSqlColumnList(), table.CanonicalName(), comparison,
 				index.AsSqlOrderBy(false), snapshotBatchSize*10,
 			)
 
@@ -479,7 +494,8 @@ func (sc *sideChannel) FetchTableSnapshotBatch(
 }
 
 func (sc *sideChannel) ReadSnapshotHighWatermark(
-	rowDecoderFactory pgtypes.RowDecoderFactory, table systemcatalog.BaseTable, snapshotName string,
+	rowDecoderFactory pgtypes.RowDecoderFactory, table systemcatalog.BaseTable,
+	projection sidechannel.TableProjection, snapshotName string,
 ) (values map[string]any, err error) {
 
 	index, present := table.Columns().SnapshotIndex()
@@ -489,9 +505,14 @@ func (sc *sideChannel) ReadSnapshotHighWatermark(
 		)
 	}
 
+	condition := "true"
+	if rowFilter := projection.AsSqlCondition(); rowFilter != "" {
+		condition = rowFilter
+	}
+
 	query := fmt.Sprintf(
 		queryTemplateSnapshotHighWatermark, index.AsSqlTuple(),
-		table.CanonicalName(), index.AsSqlOrderBy(true),
+		table.CanonicalName(), condition, index.AsSqlOrderBy(true),
 	)
 	if err := sc.newSession(time.Second*10, func(session *session) error {
 		if _, err := session.exec("BEGIN TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
@@ -522,6 +543,39 @@ func (sc *sideChannel) ReadSnapshotHighWatermark(
 	return
 }
 
+func (sc *sideChannel) DeleteRows(
+	entity systemcatalog.SystemEntity, column string, values []any,
+) (deleted int64, err error) {
+
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	// Every value is bound separately, so that its parameter
+	// type is inferred from the column, like for a single value
+	placeholders := make([]string, len(values))
+	for i := range values {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	deleteQuery := fmt.Sprintf(
+		queryTemplateDeleteRows, entity.CanonicalName(),
+		strings.ReplaceAll(column, "\"", "\"\""), strings.Join(placeholders, ", "),
+	)
+	err = sc.newSession(time.Second*10, func(session *session) error {
+		tag, err := session.exec(deleteQuery, values...)
+		if err != nil {
+			return err
+		}
+		deleted = tag.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		err = errors.Wrap(err, 0)
+	}
+	return
+}
+
 func (sc *sideChannel) ReadReplicaIdentity(
 	schemaName, tableName string,
 ) (pgtypes.ReplicaIdentity, error) {
@@ -542,6 +596,31 @@ func (sc *sideChannel) ReadReplicaIdentity(
 	return replicaIdentity, nil
 }
 
+func (sc *sideChannel) ReadReplicaIdentityColumns(
+	schemaName, tableName string,
+) (columns, identityColumns []string, err error) {
+
+	columns = make([]string, 0)
+	identityColumns = make([]string, 0)
+	if err := sc.newSession(time.Second*10, func(session *session) error {
+		return session.queryFunc(func(row pgx.Row) error {
+			var column string
+			var identity bool
+			if err := row.Scan(&column, &identity); err != nil {
+				return errors.Wrap(err, 0)
+			}
+			columns = append(columns, column)
+			if identity {
+				identityColumns = append(identityColumns, column)
+			}
+			return nil
+		}, queryReadReplicaIdentityColumns, schemaName, tableName)
+	}); err != nil {
+		return nil, nil, err
+	}
+	return columns, identityColumns, nil
+}
+
 func (sc *sideChannel) ReadContinuousAggregate(
 	materializedHypertableId int32,
 ) (viewSchema, viewName string, found bool, err error) {
@@ -582,6 +661,120 @@ func (sc *sideChannel) ReadPublishedTables(
 	return systemEntities, nil
 }
 
+func (sc *sideChannel) ReadPublishedTableProjections(
+	publicationName string,
+) (map[string]sidechannel.TableProjection, error) {
+
+	var projections map[string]sidechannel.TableProjection
+	if err := sc.newSession(time.Second*20, func(session *session) error {
+		var err error
+		projections, err = readPublishedTableProjections(session, publicationName)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return projections, nil
+}
+
+func (sc *sideChannel) ReplacePublishedTables(
+	publicationName string, tables ...sidechannel.PublicationTable,
+) ([]sidechannel.PublicationTable, error) {
+
+	if len(tables) == 0 {
+		return nil, nil
+	}
+
+	tableNames := make([]string, len(tables))
+	tableSpecs := make([]string, len(tables))
+	for i, table := range tables {
+		tableNames[i] = table.Entity.CanonicalName()
+		tableSpecs[i] = table.AsSqlTableSpec()
+	}
+
+	changed := make([]sidechannel.PublicationTable, 0)
+	if err := sc.newSession(time.Second*20, func(session *session) error {
+		if _, err := session.exec("BEGIN"); err != nil {
+			return errors.Wrap(err, 0)
+		}
+
+		committed := false
+		defer func() {
+			if !committed {
+				session.exec("ROLLBACK")
+			}
+		}()
+
+		before, err := readPublishedTableProjections(session, publicationName)
+		if err != nil {
+			return err
+		}
+
+		// Dropping and adding the tables in the same transaction
+		// replaces their column lists and row filters atomically
+		if _, err := session.exec(fmt.Sprintf(
+			queryTemplateDropTableFromPublication, publicationName, strings.Join(tableNames, ","),
+		)); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		if _, err := session.exec(fmt.Sprintf(
+			queryTemplateAddTableToPublication, publicationName, strings.Join(tableSpecs, ","),
+		)); err != nil {
+			return errors.Wrap(err, 0)
+		}
+
+		after, err := readPublishedTableProjections(session, publicationName)
+		if err != nil {
+			return err
+		}
+
+		// Row filters are compared as deparsed by PostgreSQL
+		for i, table := range tables {
+			if !before[tableNames[i]].Equal(after[tableNames[i]]) {
+				changed = append(changed, table)
+			}
+		}
+		if len(changed) == 0 {
+			return nil
+		}
+
+		if _, err := session.exec("COMMIT"); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		committed = true
+
+		for _, table := range changed {
+			sc.logger.Infof("Updated publication %s to replace table %s", publicationName, table.AsSqlTableSpec())
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+func readPublishedTableProjections(
+	session *session, publicationName string,
+) (map[string]sidechannel.TableProjection, error) {
+
+	projections := make(map[string]sidechannel.TableProjection)
+	if err := session.queryFunc(func(row pgx.Row) error {
+		var schemaName, tableName, rowFilter string
+		var columns []string
+		if err := row.Scan(&schemaName, &tableName, &columns, &rowFilter); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		canonicalName := systemcatalog.NewSystemEntity(schemaName, tableName).CanonicalName()
+		projections[canonicalName] = sidechannel.TableProjection{
+			Columns:   columns,
+			RowFilter: rowFilter,
+		}
+		return nil
+	}, queryReadPublishedTableProjections, publicationName); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return projections, nil
+}
+
 func (sc *sideChannel) ReadReplicationSlot(
 	slotName string,
 ) (pluginName, slotType string, restartLsn, confirmedFlushLsn pgtypes.LSN, err error) {
@@ -35,11 +35,16 @@ import (
 	_ "github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
 
 	// Register built-in sinks
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/amqp"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/awskinesis"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/awssqs"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/file"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/http"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/kafka"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/mqtt"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/nats"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/pubsub"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/pulsar"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/redis"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/stdout"
 )
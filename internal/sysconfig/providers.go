@@ -65,7 +65,7 @@ var (
 
 type PublicationManagerProvider = func(
 	*config.Config, sidechannel.SideChannel,
-) publication.PublicationManager
+) (publication.PublicationManager, error)
 
 type TaskManagerProvider = func(
 	*config.Config,
@@ -121,5 +121,6 @@ type SystemCatalogProvider = func(
 
 type EventEmitterProvider = func(
 	*config.Config, replicationcontext.ReplicationContext, stream.Manager,
-	pgtypes.TypeManager, task.TaskManager, *stats.Service,
+	pgtypes.TypeManager, task.TaskManager, *stats.Service, sidechannel.SideChannel,
+	schema.NameGenerator,
 ) (*eventemitting.EventEmitter, error)
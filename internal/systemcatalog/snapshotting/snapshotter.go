@@ -31,6 +31,7 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
 	"github.com/noctarius/timescaledb-event-streamer/spi/task"
 	"github.com/noctarius/timescaledb-event-streamer/spi/watermark"
+	"github.com/samber/lo"
 	"hash/fnv"
 	"time"
 )
@@ -62,8 +63,9 @@ type SnapshotTask struct {
 }
 
 type Snapshotter struct {
-	partitionCount    uint64
-	snapshotBatchSize int
+	partitionCount     uint64
+	snapshotBatchSize  int
+	selectTableColumns bool
 
 	statsReporter       *stats.Reporter
 	taskManager         task.TaskManager
@@ -87,14 +89,18 @@ func NewSnapshotterFromConfig(
 
 	parallelism := config.GetOrDefault(c, config.PropertySnapshotterParallelism, uint8(5))
 	snapshotBatchSize := config.GetOrDefault(c, config.PropertyPostgresqlSnapshotBatchsize, 1000)
+
+	// With a column filter, snapshots only read the selected columns
+	selectTableColumns := len(c.PostgreSQL.Columns.Excludes) > 0 || len(c.PostgreSQL.Columns.Includes) > 0
+
 	return NewSnapshotter(
-		parallelism, snapshotBatchSize, stateStorageManager, sideChannel,
+		parallelism, snapshotBatchSize, selectTableColumns, stateStorageManager, sideChannel,
 		taskManager, publicationManager, typeManager, statsService,
 	)
 }
 
 func NewSnapshotter(
-	partitionCount uint8, snapshotBatchSize int, stateStorageManager statestorage.Manager,
+	partitionCount uint8, snapshotBatchSize int, selectTableColumns bool, stateStorageManager statestorage.Manager,
 	sideChannel sidechannel.SideChannel, taskManager task.TaskManager,
 	publicationManager publication.PublicationManager, typeManager pgtypes.TypeManager,
 	statsService *stats.Service,
@@ -111,8 +117,9 @@ func NewSnapshotter(
 	}
 
 	s := &Snapshotter{
-		partitionCount:    uint64(partitionCount),
-		snapshotBatchSize: snapshotBatchSize,
+		partitionCount:     uint64(partitionCount),
+		snapshotBatchSize:  snapshotBatchSize,
+		selectTableColumns: selectTableColumns,
 
 		stateStorageManager: stateStorageManager,
 		sideChannel:         sideChannel,
@@ -234,8 +241,13 @@ func (s *Snapshotter) snapshotChunk(
 		}
 	}
 
+	projection, err := s.tableProjection(t.Chunk, t.Table)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
 	lsn, err := s.sideChannel.SnapshotChunkTable(
-		s.typeManager.GetOrPlanRowDecoder, t.Chunk, s.snapshotBatchSize,
+		s.typeManager.GetOrPlanRowDecoder, t.Chunk, projection, s.snapshotBatchSize,
 		func(lsn pgtypes.LSN, values map[string]any) error {
 			s.partitionStats[partition].records.total++
 			return s.taskManager.EnqueueTask(func(notificator task.Notificator) {
@@ -296,6 +308,11 @@ func (s *Snapshotter) snapshotBaseTable(
 	t SnapshotTask, partition int,
 ) error {
 
+	projection, err := s.tableProjection(t.Table, t.Table)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
 	// tableSnapshotState
 	if err := s.stateStorageManager.SnapshotContextTransaction(
 		*t.SnapshotName, true,
@@ -305,7 +322,7 @@ func (s *Snapshotter) snapshotBaseTable(
 			// Initialize the watermark or update the high watermark after a restart
 			if created || t.nextSnapshotFetch {
 				highWatermark, err := s.sideChannel.ReadSnapshotHighWatermark(
-					s.typeManager.GetOrPlanRowDecoder, t.Table, *t.SnapshotName,
+					s.typeManager.GetOrPlanRowDecoder, t.Table, projection, *t.SnapshotName,
 				)
 				if err != nil {
 					return errors.Wrap(err, 0)
@@ -321,7 +338,7 @@ func (s *Snapshotter) snapshotBaseTable(
 	}
 
 	// Kick off snapshot fetching
-	if err := s.runSnapshotFetchBatch(t, partition); err != nil {
+	if err := s.runSnapshotFetchBatch(t, projection, partition); err != nil {
 		return errors.Wrap(err, 0)
 	}
 
@@ -352,13 +369,32 @@ func (s *Snapshotter) snapshotBaseTable(
 	)
 }
 
+func (s *Snapshotter) tableProjection(
+	entity systemcatalog.SystemEntity, table systemcatalog.BaseTable,
+) (sidechannel.TableProjection, error) {
+
+	projection, err := s.publicationManager.TableProjection(entity)
+	if err != nil {
+		return sidechannel.TableProjection{}, err
+	}
+
+	// The table's columns are already restricted by the column filter
+	// and the publication's column list, so select exactly those
+	if s.selectTableColumns {
+		projection.Columns = lo.Map(table.Columns(), func(column systemcatalog.Column, _ int) string {
+			return column.Name()
+		})
+	}
+	return projection, nil
+}
+
 func (s *Snapshotter) runSnapshotFetchBatch(
-	t SnapshotTask, partition int,
+	t SnapshotTask, projection sidechannel.TableProjection, partition int,
 ) error {
 
 	iteration := 0
 	return s.sideChannel.FetchTableSnapshotBatch(
-		s.typeManager.GetOrPlanRowDecoder, t.Table, *t.SnapshotName, s.snapshotBatchSize,
+		s.typeManager.GetOrPlanRowDecoder, t.Table, projection, *t.SnapshotName, s.snapshotBatchSize,
 		func(lsn pgtypes.LSN, values map[string]any) error {
 			s.partitionStats[partition].records.total++
 			iteration++
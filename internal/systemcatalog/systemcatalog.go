@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"github.com/go-errors/errors"
 	"github.com/jackc/pgx/v5"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/outbox"
 	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
 	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/snapshotting"
 	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
@@ -60,6 +61,7 @@ type systemCatalog struct {
 	taskManager                 task.TaskManager
 	hypertableReplicationFilter *tablefiltering.TableFilter
 	vanillaReplicationFilter    *tablefiltering.TableFilter
+	columnFilter                *tablefiltering.ColumnFilter
 	snapshotter                 *snapshotting.Snapshotter
 	logger                      *logging.Logger
 	rwLock                      sync.RWMutex
@@ -79,9 +81,29 @@ func NewSystemCatalog(
 		return nil, errors.Wrap(err, 0)
 	}
 
+	// The outbox table is replicated whenever the outbox router is configured
+	vanillaIncludes := config.PostgreSQL.Tables.Includes
+	if config.Sink.Outbox.Table != "" {
+		schemaName, tableName, err := outbox.ParseTableName(config.Sink.Outbox.Table)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		vanillaIncludes = append(
+			slices.Clone(vanillaIncludes), systemcatalog.MakeRelationKey(schemaName, tableName),
+		)
+	}
+
 	// Create the Replication Filter, selecting enabled and blocking disabled PostgreSQL tables for replication
 	vanillaReplicationFilter, err := tablefiltering.NewTableFilter(
-		config.PostgreSQL.Tables.Excludes, config.PostgreSQL.Tables.Includes, false,
+		config.PostgreSQL.Tables.Excludes, vanillaIncludes, false,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	// Create the Column Filter, selecting the columns of tables to be emitted
+	columnFilter, err := tablefiltering.NewColumnFilter(
+		config.PostgreSQL.Columns.Excludes, config.PostgreSQL.Columns.Includes,
 	)
 	if err != nil {
 		return nil, errors.Wrap(err, 0)
@@ -109,6 +131,7 @@ func NewSystemCatalog(
 		stateStorageManager:         stateStorageManager,
 		hypertableReplicationFilter: hypertableReplicationFilter,
 		vanillaReplicationFilter:    vanillaReplicationFilter,
+		columnFilter:                columnFilter,
 		publicationManager:          publicationManager,
 		sideChannel:                 sideChannel,
 		snapshotter:                 snapshotter,
@@ -348,6 +371,36 @@ func (sc *systemCatalog) ApplySchemaUpdate(
 	table systemcatalog.SystemEntity, columns []systemcatalog.Column,
 ) error {
 
+	// Restrict the schema to the columns attached to the publication,
+	// since those are the only ones replicated or read by snapshots
+	projection, err := sc.publicationManager.TableProjection(table)
+	if err != nil {
+		return err
+	}
+	if len(projection.Columns) > 0 {
+		columns = lo.Filter(columns, func(column systemcatalog.Column, _ int) bool {
+			return lo.Contains(projection.Columns, column.Name())
+		})
+	}
+
+	// Remove all columns not selected by the column filter
+	if !sc.columnFilter.IsEmpty() {
+		selectedColumns := make([]systemcatalog.Column, 0, len(columns))
+		for _, column := range columns {
+			if sc.columnFilter.Enabled(table, column.Name()) {
+				selectedColumns = append(selectedColumns, column)
+				continue
+			}
+			if column.IsPrimaryKey() || column.IsReplicaIdent() {
+				return errors.Errorf(
+					"column '%s' of table '%s' is part of the primary key or replica identity and cannot be excluded",
+					column.Name(), table.CanonicalName(),
+				)
+			}
+		}
+		columns = selectedColumns
+	}
+
 	if hypertable, ok := table.(*systemcatalog.Hypertable); ok {
 		if difference := hypertable.ApplyTableSchema(columns); difference != nil {
 			sc.logger.Verbosef("Schema Update: Hypertable %d => %+v", hypertable.Id(), difference)
@@ -0,0 +1,170 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tablefiltering
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"regexp"
+	"strings"
+)
+
+// ColumnFilter selects the columns of a table to be emitted. Its
+// patterns use the same syntax as the TableFilter, extended by a
+// third token for the column name (schema.table.column).
+type ColumnFilter struct {
+	includes []*columnFilter
+	excludes []*columnFilter
+}
+
+func NewColumnFilter(
+	excludes, includes []string,
+) (*ColumnFilter, error) {
+
+	excludeFilters := make([]*columnFilter, 0)
+	for _, exclude := range excludes {
+		f, err := parseColumnFilter(exclude)
+		if err != nil {
+			return nil, err
+		}
+		excludeFilters = append(excludeFilters, f)
+	}
+
+	includeFilters := make([]*columnFilter, 0)
+	for _, include := range includes {
+		f, err := parseColumnFilter(include)
+		if err != nil {
+			return nil, err
+		}
+		includeFilters = append(includeFilters, f)
+	}
+
+	return &ColumnFilter{
+		includes: includeFilters,
+		excludes: excludeFilters,
+	}, nil
+}
+
+// IsEmpty returns true if no include or exclude patterns
+// are defined and all columns are accepted.
+func (cf *ColumnFilter) IsEmpty() bool {
+	return len(cf.includes) == 0 && len(cf.excludes) == 0
+}
+
+// Enabled returns true if the column of the given table is selected.
+// Excludes have priority over includes. Tables without any matching
+// include pattern have all (not excluded) columns selected, while
+// tables with at least one matching include pattern only have the
+// explicitly included columns selected.
+func (cf *ColumnFilter) Enabled(
+	table systemcatalog.SystemEntity, column string,
+) bool {
+
+	// excluded has priority
+	for _, exclude := range cf.excludes {
+		if exclude.matchesTable(table) && exclude.matchesColumn(column) {
+			return false
+		}
+	}
+
+	tableIncluded := false
+	for _, include := range cf.includes {
+		if include.matchesTable(table) {
+			if include.matchesColumn(column) {
+				return true
+			}
+			tableIncluded = true
+		}
+	}
+
+	// if the table has includes, the column must be explicitly included
+	return !tableIncluded
+}
+
+// Matches returns true if the column of the given table is explicitly
+// matched by an include pattern, and not by an exclude pattern.
+func (cf *ColumnFilter) Matches(
+	table systemcatalog.SystemEntity, column string,
+) bool {
+
+	for _, exclude := range cf.excludes {
+		if exclude.matchesTable(table) && exclude.matchesColumn(column) {
+			return false
+		}
+	}
+
+	for _, include := range cf.includes {
+		if include.matchesTable(table) && include.matchesColumn(column) {
+			return true
+		}
+	}
+	return false
+}
+
+type columnFilter struct {
+	tableFilter *filter
+	column      string
+	columnRegex *regexp.Regexp
+}
+
+func parseColumnFilter(
+	filterTerm string,
+) (*columnFilter, error) {
+
+	tokens := strings.Split(filterTerm, ".")
+	if len(tokens) != 3 {
+		return nil, fmt.Errorf("failed parsing column filter term: %s", filterTerm)
+	}
+
+	tableFilter, err := parseFilter(fmt.Sprintf("%s.%s", tokens[0], tokens[1]))
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	column, columnIsRegex, err := parseToken(tokens[2])
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	f := &columnFilter{
+		tableFilter: tableFilter,
+	}
+	if columnIsRegex {
+		f.columnRegex = regexp.MustCompile(fmt.Sprintf("^%s$", column))
+	} else {
+		f.column = column
+	}
+	return f, nil
+}
+
+func (f *columnFilter) matchesTable(
+	table systemcatalog.SystemEntity,
+) bool {
+
+	return f.tableFilter.matches(table)
+}
+
+func (f *columnFilter) matchesColumn(
+	column string,
+) bool {
+
+	if f.columnRegex != nil {
+		return f.columnRegex.Match([]byte(column))
+	}
+	return f.column == column
+}
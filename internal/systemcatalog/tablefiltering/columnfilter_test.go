@@ -0,0 +1,114 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tablefiltering
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Column_Default_Included(
+	t *testing.T,
+) {
+
+	columnFilter, err := NewColumnFilter(emptyList, emptyList)
+	if err != nil {
+		t.Fatalf("error parsing: %+v", err)
+	}
+
+	hypertable := makeHypertable(1, "public", "test")
+	assert.True(t, columnFilter.IsEmpty())
+	assert.True(t, columnFilter.Enabled(hypertable, "ssn"))
+}
+
+func Test_Column_Parse_Error_Too_Few_Tokens(
+	t *testing.T,
+) {
+
+	_, err := NewColumnFilter(asList("public.test"), emptyList)
+	if err == nil {
+		t.FailNow()
+	}
+	assert.ErrorContains(t, err, "failed parsing column filter term: public.test")
+}
+
+func Test_Column_Excluded(
+	t *testing.T,
+) {
+
+	columnFilter, err := NewColumnFilter(asList("public.test.ssn", "*.*.raw_+"), emptyList)
+	if err != nil {
+		t.Fatalf("error parsing: %+v", err)
+	}
+
+	hypertable := makeHypertable(1, "public", "test")
+	other := makeHypertable(2, "public", "other")
+	assert.False(t, columnFilter.IsEmpty())
+	assert.False(t, columnFilter.Enabled(hypertable, "ssn"))
+	assert.False(t, columnFilter.Enabled(hypertable, "raw_payload"))
+	assert.True(t, columnFilter.Enabled(hypertable, "temperature"))
+	assert.True(t, columnFilter.Enabled(other, "ssn"))
+	assert.False(t, columnFilter.Enabled(other, "raw_payload"))
+}
+
+func Test_Column_Included(
+	t *testing.T,
+) {
+
+	columnFilter, err := NewColumnFilter(emptyList, asList("public.test.ts", "public.test.temp*"))
+	if err != nil {
+		t.Fatalf("error parsing: %+v", err)
+	}
+
+	hypertable := makeHypertable(1, "public", "test")
+	other := makeHypertable(2, "public", "other")
+	assert.True(t, columnFilter.Enabled(hypertable, "ts"))
+	assert.True(t, columnFilter.Enabled(hypertable, "temperature"))
+	assert.False(t, columnFilter.Enabled(hypertable, "ssn"))
+	// tables without matching include patterns keep all columns
+	assert.True(t, columnFilter.Enabled(other, "ssn"))
+}
+
+func Test_Column_Excludes_Precedence(
+	t *testing.T,
+) {
+
+	columnFilter, err := NewColumnFilter(asList("public.test.temperature"), asList("public.test.*"))
+	if err != nil {
+		t.Fatalf("error parsing: %+v", err)
+	}
+
+	hypertable := makeHypertable(1, "public", "test")
+	assert.True(t, columnFilter.Enabled(hypertable, "ts"))
+	assert.False(t, columnFilter.Enabled(hypertable, "temperature"))
+}
+
+func Test_Column_Matches(
+	t *testing.T,
+) {
+
+	columnFilter, err := NewColumnFilter(asList("public.other.ssn"), asList("public.*.ssn"))
+	if err != nil {
+		t.Fatalf("error parsing: %+v", err)
+	}
+
+	hypertable := makeHypertable(1, "public", "test")
+	other := makeHypertable(2, "public", "other")
+	assert.True(t, columnFilter.Matches(hypertable, "ssn"))
+	assert.False(t, columnFilter.Matches(hypertable, "ts"))
+	assert.False(t, columnFilter.Matches(other, "ssn"))
+}
@@ -42,6 +42,11 @@ const (
 	AwsKinesis SinkType = "kinesis"
 	AwsSQS     SinkType = "sqs"
 	Http       SinkType = "http"
+	Pulsar     SinkType = "pulsar"
+	Amqp       SinkType = "amqp"
+	Mqtt       SinkType = "mqtt"
+	PubSub     SinkType = "pubsub"
+	File       SinkType = "file"
 )
 
 type NamingStrategyType string
@@ -50,6 +55,59 @@ const (
 	Debezium NamingStrategyType = "debezium"
 )
 
+type EncodingType string
+
+const (
+	JsonEncoding        EncodingType = "json"
+	AvroEncoding        EncodingType = "avro"
+	ProtobufEncoding    EncodingType = "protobuf"
+	CloudEventsEncoding EncodingType = "cloudevents"
+)
+
+type CloudEventsMode string
+
+const (
+	StructuredMode CloudEventsMode = "structured"
+	BinaryMode     CloudEventsMode = "binary"
+)
+
+type UnwrapDeleteMode string
+
+const (
+	TombstoneDeletes UnwrapDeleteMode = "tombstone"
+	FlagDeletes      UnwrapDeleteMode = "flag"
+	DropDeletes      UnwrapDeleteMode = "drop"
+)
+
+type EncryptionKeySource string
+
+const (
+	FileEncryptionKeySource EncryptionKeySource = "file"
+	EnvEncryptionKeySource  EncryptionKeySource = "env"
+)
+
+type TransformType string
+
+const (
+	RenameTransform           TransformType = "rename"
+	DropTransform             TransformType = "drop"
+	MaskTransform             TransformType = "mask"
+	InsertFieldTransform      TransformType = "insertfield"
+	TimestampConvertTransform TransformType = "timestampconvert"
+	ValueToKeyTransform       TransformType = "valuetokey"
+	ComputeTransform          TransformType = "compute"
+)
+
+type AggregateFunction string
+
+const (
+	MinAggregate   AggregateFunction = "min"
+	MaxAggregate   AggregateFunction = "max"
+	AvgAggregate   AggregateFunction = "avg"
+	CountAggregate AggregateFunction = "count"
+	LastAggregate  AggregateFunction = "last"
+)
+
 type NatsAuthorizationType string
 
 const (
@@ -58,6 +116,22 @@ const (
 	Jwt         NatsAuthorizationType = "jwt"
 )
 
+type TransactionStreamingMode string
+
+const (
+	StreamingOff      TransactionStreamingMode = "off"
+	StreamingOn       TransactionStreamingMode = "on"
+	StreamingParallel TransactionStreamingMode = "parallel"
+)
+
+type TwoPhaseMode string
+
+const (
+	TwoPhaseOff     TwoPhaseMode = "off"
+	TwoPhasePrepare TwoPhaseMode = "prepare"
+	TwoPhaseCommit  TwoPhaseMode = "commit"
+)
+
 type InitialSnapshotMode string
 
 const (
@@ -74,6 +148,7 @@ type PostgreSQLConfig struct {
 	Transaction     TransactionConfig      `toml:"transaction" yaml:"transaction"`
 	Snapshot        SnapshotConfig         `toml:"snapshot" yaml:"snapshot"`
 	Tables          IncludedTablesConfig   `toml:"tables" yaml:"tables"`
+	Columns         IncludedColumnsConfig  `toml:"columns" yaml:"columns"`
 	Events          PostgresqlEventsConfig `toml:"events" yaml:"events"`
 }
 
@@ -111,9 +186,19 @@ type SnapshotConfig struct {
 }
 
 type PublicationConfig struct {
-	Name     string `toml:"name" yaml:"name"`
-	Create   *bool  `toml:"create" yaml:"create"`
-	AutoDrop *bool  `toml:"autodrop" yaml:"autoDrop"`
+	Name     string                   `toml:"name" yaml:"name"`
+	Create   *bool                    `toml:"create" yaml:"create"`
+	AutoDrop *bool                    `toml:"autodrop" yaml:"autoDrop"`
+	Tables   []PublicationTableConfig `toml:"tables" yaml:"tables"`
+}
+
+// PublicationTableConfig defines the column list and row filter
+// a (hyper)table is attached to the publication with. Requires
+// PostgreSQL 15 or later.
+type PublicationTableConfig struct {
+	Table   string   `toml:"table" yaml:"table"`
+	Columns []string `toml:"columns" yaml:"columns"`
+	Filter  string   `toml:"filter" yaml:"filter"`
 }
 
 type ReplicationSlotConfig struct {
@@ -123,25 +208,161 @@ type ReplicationSlotConfig struct {
 }
 
 type TransactionConfig struct {
-	Window TransactionWindowConfig `toml:"window" yaml:"window"`
+	Window     TransactionWindowConfig   `toml:"window" yaml:"window"`
+	Streaming  *TransactionStreamingMode `toml:"streaming" yaml:"streaming"`
+	TwoPhase   *TwoPhaseMode             `toml:"twophase" yaml:"twoPhase"`
+	Compaction IncludedTablesConfig      `toml:"compaction" yaml:"compaction"`
 }
 
 type TransactionWindowConfig struct {
+	Enabled   *bool  `toml:"enabled" yaml:"enabled"`
+	Timeout   int    `toml:"timeout" yaml:"timeout"`
+	MaxSize   uint   `toml:"maxsize" yaml:"maxSize"`
+	SpillPath string `toml:"spillpath" yaml:"spillPath"`
+}
+
+type SinkConfig struct {
+	Type        SinkType                     `toml:"type" yaml:"type"`
+	Tombstone   *bool                        `toml:"tombstone" yaml:"tombstone"`
+	Encoding    SinkEncodingConfig           `toml:"encoding" yaml:"encoding"`
+	Transaction SinkTransactionConfig        `toml:"transaction" yaml:"transaction"`
+	Async       SinkAsyncConfig              `toml:"async" yaml:"async"`
+	Batch       SinkBatchConfig              `toml:"batch" yaml:"batch"`
+	Spool       SinkSpoolConfig              `toml:"spool" yaml:"spool"`
+	DeadLetter  SinkDeadLetterConfig         `toml:"deadletter" yaml:"deadLetter"`
+	Unwrap      SinkUnwrapConfig             `toml:"unwrap" yaml:"unwrap"`
+	Sinks       map[string]NamedSinkConfig   `toml:"sinks" yaml:"sinks"`
+	Filters     map[string]EventFilterConfig `toml:"filters" yaml:"filters"`
+	Transforms  []TransformConfig            `toml:"transforms" yaml:"transforms"`
+	Encryption  SinkEncryptionConfig         `toml:"encryption" yaml:"encryption"`
+	Outbox      SinkOutboxConfig             `toml:"outbox" yaml:"outbox"`
+	Aggregates  []AggregateConfig            `toml:"aggregates" yaml:"aggregates"`
+	Nats        NatsConfig                   `toml:"nats" yaml:"nats"`
+	Kafka       KafkaConfig                  `toml:"kafka" yaml:"kafka"`
+	Redis       RedisConfig                  `toml:"redis" yaml:"redis"`
+	AwsKinesis  AwsKinesisConfig             `toml:"kinesis" yaml:"kinesis"`
+	AwsSqs      AwsSqsConfig                 `toml:"sqs" yaml:"sqs"`
+	Http        HttpConfig                   `toml:"http" yaml:"http"`
+	Pulsar      PulsarConfig                 `toml:"pulsar" yaml:"pulsar"`
+	Amqp        AmqpConfig                   `toml:"amqp" yaml:"amqp"`
+	Mqtt        MqttConfig                   `toml:"mqtt" yaml:"mqtt"`
+	PubSub      PubSubConfig                 `toml:"pubsub" yaml:"pubSub"`
+	File        FileConfig                   `toml:"file" yaml:"file"`
+}
+
+type SinkEncodingConfig struct {
+	Type           EncodingType           `toml:"type" yaml:"type"`
+	SchemaRegistry SchemaRegistryConfig   `toml:"schemaregistry" yaml:"schemaRegistry"`
+	Protobuf       ProtobufEncodingConfig `toml:"protobuf" yaml:"protobuf"`
+	CloudEvents    CloudEventsConfig      `toml:"cloudevents" yaml:"cloudEvents"`
+}
+
+type SchemaRegistryConfig struct {
+	Url      string `toml:"url" yaml:"url"`
+	Username string `toml:"username" yaml:"username"`
+	Password string `toml:"password" yaml:"password"`
+}
+
+type ProtobufEncodingConfig struct {
+	SchemaTopic    string `toml:"schematopic" yaml:"schemaTopic"`
+	DescriptorPath string `toml:"descriptorpath" yaml:"descriptorPath"`
+}
+
+type CloudEventsConfig struct {
+	Mode   CloudEventsMode `toml:"mode" yaml:"mode"`
+	Source string          `toml:"source" yaml:"source"`
+}
+
+type SinkTransactionConfig struct {
+	Metadata *bool `toml:"metadata" yaml:"metadata"`
+}
+
+type SinkAsyncConfig struct {
+	Enabled     *bool `toml:"enabled" yaml:"enabled"`
+	MaxInflight uint  `toml:"maxinflight" yaml:"maxInflight"`
+}
+
+type SinkBatchConfig struct {
 	Enabled *bool `toml:"enabled" yaml:"enabled"`
-	Timeout int   `toml:"timeout" yaml:"timeout"`
 	MaxSize uint  `toml:"maxsize" yaml:"maxSize"`
+	Timeout int   `toml:"timeout" yaml:"timeout"`
 }
 
-type SinkConfig struct {
-	Type       SinkType                     `toml:"type" yaml:"type"`
-	Tombstone  *bool                        `toml:"tombstone" yaml:"tombstone"`
-	Filters    map[string]EventFilterConfig `toml:"filters" yaml:"filters"`
-	Nats       NatsConfig                   `toml:"nats" yaml:"nats"`
-	Kafka      KafkaConfig                  `toml:"kafka" yaml:"kafka"`
-	Redis      RedisConfig                  `toml:"redis" yaml:"redis"`
-	AwsKinesis AwsKinesisConfig             `toml:"kinesis" yaml:"kinesis"`
-	AwsSqs     AwsSqsConfig                 `toml:"sqs" yaml:"sqs"`
-	Http       HttpConfig                   `toml:"http" yaml:"http"`
+type SinkSpoolConfig struct {
+	Enabled     *bool  `toml:"enabled" yaml:"enabled"`
+	Path        string `toml:"path" yaml:"path"`
+	MaxSize     uint   `toml:"maxsize" yaml:"maxSize"`
+	SegmentSize uint   `toml:"segmentsize" yaml:"segmentSize"`
+}
+
+type SinkDeadLetterConfig struct {
+	Type  *SinkType `toml:"type" yaml:"type"`
+	Topic string    `toml:"topic" yaml:"topic"`
+}
+
+type SinkEncryptionConfig struct {
+	Columns []string            `toml:"columns" yaml:"columns"`
+	Key     EncryptionKeyConfig `toml:"key" yaml:"key"`
+}
+
+// EncryptionKeyConfig defines where the encryption keys are read
+// from. Keys are identified by their key id, the active key is used
+// to encrypt new values, while other keys are kept available for
+// consumers decrypting values after a key rotation.
+type EncryptionKeyConfig struct {
+	Source EncryptionKeySource `toml:"source" yaml:"source"`
+	File   string              `toml:"file" yaml:"file"`
+	Env    string              `toml:"env" yaml:"env"`
+	Active string              `toml:"active" yaml:"active"`
+}
+
+// SinkOutboxConfig configures the outbox event router. Inserts into
+// the configured outbox table are emitted as outbox events, using the
+// aggregate type to select the topic and the aggregate id as key.
+type SinkOutboxConfig struct {
+	Table       string                  `toml:"table" yaml:"table"`
+	Columns     SinkOutboxColumnsConfig `toml:"columns" yaml:"columns"`
+	TopicPrefix string                  `toml:"topicprefix" yaml:"topicPrefix"`
+	Delete      *bool                   `toml:"delete" yaml:"delete"`
+}
+
+type SinkOutboxColumnsConfig struct {
+	Id            string `toml:"id" yaml:"id"`
+	AggregateType string `toml:"aggregatetype" yaml:"aggregateType"`
+	AggregateId   string `toml:"aggregateid" yaml:"aggregateId"`
+	Type          string `toml:"type" yaml:"type"`
+	Payload       string `toml:"payload" yaml:"payload"`
+}
+
+type SinkUnwrapConfig struct {
+	Enabled         *bool            `toml:"enabled" yaml:"enabled"`
+	Deletes         UnwrapDeleteMode `toml:"deletes" yaml:"deletes"`
+	Fields          []string         `toml:"fields" yaml:"fields"`
+	Prefix          string           `toml:"prefix" yaml:"prefix"`
+	DropKeySchema   *bool            `toml:"dropkeyschema" yaml:"dropKeySchema"`
+	DropValueSchema *bool            `toml:"dropvalueschema" yaml:"dropValueSchema"`
+}
+
+// NamedSinkConfig defines one of multiple sinks events are routed to.
+// Sink specific configurations override the ones of the main sink
+// configuration, if defined.
+type NamedSinkConfig struct {
+	Type       SinkType              `toml:"type" yaml:"type"`
+	Tables     *IncludedTablesConfig `toml:"tables" yaml:"tables"`
+	Condition  string                `toml:"condition" yaml:"condition"`
+	Encoding   SinkEncodingConfig    `toml:"encoding" yaml:"encoding"`
+	Unwrap     SinkUnwrapConfig      `toml:"unwrap" yaml:"unwrap"`
+	Nats       NatsConfig            `toml:"nats" yaml:"nats"`
+	Kafka      KafkaConfig           `toml:"kafka" yaml:"kafka"`
+	Redis      RedisConfig           `toml:"redis" yaml:"redis"`
+	AwsKinesis AwsKinesisConfig      `toml:"kinesis" yaml:"kinesis"`
+	AwsSqs     AwsSqsConfig          `toml:"sqs" yaml:"sqs"`
+	Http       HttpConfig            `toml:"http" yaml:"http"`
+	Pulsar     PulsarConfig          `toml:"pulsar" yaml:"pulsar"`
+	Amqp       AmqpConfig            `toml:"amqp" yaml:"amqp"`
+	Mqtt       MqttConfig            `toml:"mqtt" yaml:"mqtt"`
+	PubSub     PubSubConfig          `toml:"pubsub" yaml:"pubSub"`
+	File       FileConfig            `toml:"file" yaml:"file"`
 }
 
 type EventFilterConfig struct {
@@ -150,9 +371,51 @@ type EventFilterConfig struct {
 	Condition    string                `toml:"condition" yaml:"condition"`
 }
 
+// TransformConfig defines a single transform of the transform chain.
+// Besides the type, the properties used depend on the transform type.
+// Options carries arbitrary properties for transforms registered by
+// plugins.
+type TransformConfig struct {
+	Type    TransformType         `toml:"type" yaml:"type"`
+	Tables  *IncludedTablesConfig `toml:"tables" yaml:"tables"`
+	Fields  []string              `toml:"fields" yaml:"fields"`
+	Renames map[string]string     `toml:"renames" yaml:"renames"`
+	Values  map[string]string     `toml:"values" yaml:"values"`
+	Mode    string                `toml:"mode" yaml:"mode"`
+	Format  string                `toml:"format" yaml:"format"`
+	Options map[string]any        `toml:"options" yaml:"options"`
+
+	Computed []ComputedFieldConfig `toml:"computed" yaml:"computed"`
+}
+
+// ComputedFieldConfig defines a field computed by an expression, the
+// type is the schema type of the result (int64, float64, boolean, or
+// string)
+type ComputedFieldConfig struct {
+	Field      string `toml:"field" yaml:"field"`
+	Expression string `toml:"expression" yaml:"expression"`
+	Type       string `toml:"type" yaml:"type"`
+}
+
+// AggregateConfig defines a time-window aggregation of the inserts
+// into the selected tables. Window and lateness are milliseconds, the
+// time column defaults to the time dimension of the hypertable.
+type AggregateConfig struct {
+	Tables     IncludedTablesConfig `toml:"tables" yaml:"tables"`
+	GroupBy    []string             `toml:"groupby" yaml:"groupBy"`
+	Fields     []string             `toml:"fields" yaml:"fields"`
+	Functions  []AggregateFunction  `toml:"functions" yaml:"functions"`
+	TimeColumn string               `toml:"timecolumn" yaml:"timeColumn"`
+	Window     int                  `toml:"window" yaml:"window"`
+	Lateness   int                  `toml:"lateness" yaml:"lateness"`
+	Rows       *bool                `toml:"rows" yaml:"rows"`
+}
+
 type TopicConfig struct {
 	NamingStrategy TopicNamingStrategyConfig `toml:"namingstrategy" yaml:"namingStrategy"`
 	Prefix         string                    `toml:"prefix" yaml:"prefix"`
+	Expression     string                    `toml:"expression" yaml:"expression"`
+	KeyExpression  string                    `toml:"keyexpression" yaml:"keyExpression"`
 }
 
 type TimescaleDBConfig struct {
@@ -242,6 +505,11 @@ type IncludedTablesConfig struct {
 	Includes []string `toml:"includes" yaml:"includes"`
 }
 
+type IncludedColumnsConfig struct {
+	Excludes []string `toml:"excludes" yaml:"excludes"`
+	Includes []string `toml:"includes" yaml:"includes"`
+}
+
 type TimescaleEventsConfig struct {
 	Read          *bool `toml:"read" yaml:"read"`
 	Insert        *bool `toml:"insert" yaml:"insert"`
@@ -321,6 +589,113 @@ const (
 	HeaderAuthentication HttpAuthenticationType = "header"
 )
 
+// PulsarConfig defines the Pulsar sink. Topics are created inside the
+// tenant and namespace, TLS is enabled using the pulsar+ssl:// scheme.
+type PulsarConfig struct {
+	Url            string                     `toml:"url" yaml:"url"`
+	Tenant         string                     `toml:"tenant" yaml:"tenant"`
+	Namespace      string                     `toml:"namespace" yaml:"namespace"`
+	Timeout        int                        `toml:"timeout" yaml:"timeout"`
+	Authentication PulsarAuthenticationConfig `toml:"authentication" yaml:"authentication"`
+	TLS            PulsarTLSConfig            `toml:"tls" yaml:"tls"`
+}
+
+type PulsarAuthenticationConfig struct {
+	Type        PulsarAuthenticationType `toml:"type" yaml:"type"`
+	Token       string                   `toml:"token" yaml:"token"`
+	TokenFile   string                   `toml:"tokenfile" yaml:"tokenFile"`
+	Certificate string                   `toml:"certificate" yaml:"certificate"`
+	Key         string                   `toml:"key" yaml:"key"`
+}
+
+type PulsarTLSConfig struct {
+	TrustCertsFile   string `toml:"trustcertsfile" yaml:"trustCertsFile"`
+	SkipVerify       *bool  `toml:"skipverify" yaml:"skipVerify"`
+	ValidateHostname *bool  `toml:"validatehostname" yaml:"validateHostname"`
+}
+
+type PulsarAuthenticationType string
+
+const (
+	PulsarNoneAuthentication  PulsarAuthenticationType = "none"
+	PulsarTokenAuthentication PulsarAuthenticationType = "token"
+	PulsarTlsAuthentication   PulsarAuthenticationType = "tls"
+)
+
+// AmqpConfig defines the AMQP 0-9-1 sink. Events are published to the
+// exchange using the topic name as the routing key, TLS is enabled using
+// the amqps:// scheme.
+type AmqpConfig struct {
+	Url        string             `toml:"url" yaml:"url"`
+	Exchange   AmqpExchangeConfig `toml:"exchange" yaml:"exchange"`
+	Persistent *bool              `toml:"persistent" yaml:"persistent"`
+	Timeout    int                `toml:"timeout" yaml:"timeout"`
+	TLS        TLSConfig          `toml:"tls" yaml:"tls"`
+}
+
+type AmqpExchangeConfig struct {
+	Name       string `toml:"name" yaml:"name"`
+	Type       string `toml:"type" yaml:"type"`
+	Declare    *bool  `toml:"declare" yaml:"declare"`
+	Durable    *bool  `toml:"durable" yaml:"durable"`
+	AutoDelete *bool  `toml:"autodelete" yaml:"autoDelete"`
+}
+
+// MqttConfig defines the MQTT sink. TLS is enabled using the
+// mqtts:// scheme.
+type MqttConfig struct {
+	Url      string              `toml:"url" yaml:"url"`
+	Version  MqttProtocolVersion `toml:"version" yaml:"version"`
+	ClientId string              `toml:"clientid" yaml:"clientId"`
+	QoS      *int                `toml:"qos" yaml:"qos"`
+	Retain   *bool               `toml:"retain" yaml:"retain"`
+	Username string              `toml:"username" yaml:"username"`
+	Password string              `toml:"password" yaml:"password"`
+	Timeout  int                 `toml:"timeout" yaml:"timeout"`
+	TLS      TLSConfig           `toml:"tls" yaml:"tls"`
+}
+
+type MqttProtocolVersion string
+
+const (
+	MqttV311 MqttProtocolVersion = "3.1.1"
+	MqttV5   MqttProtocolVersion = "5"
+)
+
+// PubSubConfig defines the Google Cloud Pub/Sub sink. If an endpoint
+// is configured, the sink connects without authentication and TLS,
+// as used by the Pub/Sub emulator.
+type PubSubConfig struct {
+	ProjectId       string            `toml:"projectid" yaml:"projectId"`
+	Endpoint        string            `toml:"endpoint" yaml:"endpoint"`
+	CredentialsFile string            `toml:"credentialsfile" yaml:"credentialsFile"`
+	Timeout         int               `toml:"timeout" yaml:"timeout"`
+	Batch           PubSubBatchConfig `toml:"batch" yaml:"batch"`
+}
+
+type PubSubBatchConfig struct {
+	Count int `toml:"count" yaml:"count"`
+	Bytes int `toml:"bytes" yaml:"bytes"`
+	Delay int `toml:"delay" yaml:"delay"`
+}
+
+// FileConfig defines the file sink. Events are written to per-topic
+// directories, rotated files are optionally compressed.
+type FileConfig struct {
+	Path        string              `toml:"path" yaml:"path"`
+	MaxSize     *string             `toml:"maxsize" yaml:"maxSize"`
+	MaxDuration *int                `toml:"maxduration" yaml:"maxDuration"`
+	Compression FileCompressionType `toml:"compression" yaml:"compression"`
+}
+
+type FileCompressionType string
+
+const (
+	NoneFileCompression FileCompressionType = "none"
+	GzipFileCompression FileCompressionType = "gzip"
+	ZstdFileCompression FileCompressionType = "zstd"
+)
+
 type Config struct {
 	PostgreSQL   PostgreSQLConfig   `toml:"postgresql" yaml:"postgresql"`
 	Sink         SinkConfig         `toml:"sink" yaml:"sink"`
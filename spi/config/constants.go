@@ -23,6 +23,7 @@ const (
 	PropertyPostgresqlPublicationName         = "postgresql.publication.name"
 	PropertyPostgresqlPublicationCreate       = "postgresql.publication.create"
 	PropertyPostgresqlPublicationAutoDrop     = "postgresql.publication.autodrop"
+	PropertyPostgresqlPublicationTables       = "postgresql.publication.tables"
 	PropertyPostgresqlSnapshotInitialMode     = "postgresql.snapshot.initial"
 	PropertyPostgresqlSnapshotBatchsize       = "postgresql.snapshot.batchsize"
 	PropertyPostgresqlReplicationSlotName     = "postgresql.replicationslot.name"
@@ -31,10 +32,54 @@ const (
 	PropertyPostgresqlTxwindowEnabled         = "postgresql.transaction.window.enabled"
 	PropertyPostgresqlTxwindowTimeout         = "postgresql.transaction.window.timeout"
 	PropertyPostgresqlTxwindowMaxsize         = "postgresql.transaction.window.maxsize"
+	PropertyPostgresqlTxwindowSpillPath       = "postgresql.transaction.window.spillpath"
+	PropertyPostgresqlTxStreaming             = "postgresql.transaction.streaming"
+	PropertyPostgresqlTxTwoPhase              = "postgresql.transaction.twophase"
 
 	PropertySink          = "sink.type"
 	PropertySinkTombstone = "sink.tombstone"
 
+	PropertySinkTransactionMetadata        = "sink.transaction.metadata"
+	PropertySinkAsyncEnabled               = "sink.async.enabled"
+	PropertySinkAsyncMaxInflight           = "sink.async.maxinflight"
+	PropertySinkBatchEnabled               = "sink.batch.enabled"
+	PropertySinkBatchMaxSize               = "sink.batch.maxsize"
+	PropertySinkBatchTimeout               = "sink.batch.timeout"
+	PropertySinkSpoolEnabled               = "sink.spool.enabled"
+	PropertySinkSpoolPath                  = "sink.spool.path"
+	PropertySinkSpoolMaxSize               = "sink.spool.maxsize"
+	PropertySinkSpoolSegmentSize           = "sink.spool.segmentsize"
+	PropertySinkDeadLetterType             = "sink.deadletter.type"
+	PropertySinkDeadLetterTopic            = "sink.deadletter.topic"
+	PropertySinkUnwrapEnabled              = "sink.unwrap.enabled"
+	PropertySinkUnwrapDeletes              = "sink.unwrap.deletes"
+	PropertySinkUnwrapFields               = "sink.unwrap.fields"
+	PropertySinkUnwrapPrefix               = "sink.unwrap.prefix"
+	PropertySinkUnwrapDropKeySchema        = "sink.unwrap.dropkeyschema"
+	PropertySinkUnwrapDropValueSchema      = "sink.unwrap.dropvalueschema"
+	PropertySinkEncryptionColumns          = "sink.encryption.columns"
+	PropertySinkEncryptionKeySource        = "sink.encryption.key.source"
+	PropertySinkEncryptionKeyFile          = "sink.encryption.key.file"
+	PropertySinkEncryptionKeyEnv           = "sink.encryption.key.env"
+	PropertySinkEncryptionKeyActive        = "sink.encryption.key.active"
+	PropertySinkOutboxTable                = "sink.outbox.table"
+	PropertySinkOutboxColumnsId            = "sink.outbox.columns.id"
+	PropertySinkOutboxColumnsAggregateType = "sink.outbox.columns.aggregatetype"
+	PropertySinkOutboxColumnsAggregateId   = "sink.outbox.columns.aggregateid"
+	PropertySinkOutboxColumnsType          = "sink.outbox.columns.type"
+	PropertySinkOutboxColumnsPayload       = "sink.outbox.columns.payload"
+	PropertySinkOutboxTopicPrefix          = "sink.outbox.topicprefix"
+	PropertySinkOutboxDelete               = "sink.outbox.delete"
+
+	PropertySinkEncodingType                   = "sink.encoding.type"
+	PropertySinkEncodingSchemaRegistryUrl      = "sink.encoding.schemaregistry.url"
+	PropertySinkEncodingSchemaRegistryUsername = "sink.encoding.schemaregistry.username"
+	PropertySinkEncodingSchemaRegistryPassword = "sink.encoding.schemaregistry.password"
+	PropertySinkEncodingProtobufSchemaTopic    = "sink.encoding.protobuf.schematopic"
+	PropertySinkEncodingProtobufDescriptorPath = "sink.encoding.protobuf.descriptorpath"
+	PropertySinkEncodingCloudEventsMode        = "sink.encoding.cloudevents.mode"
+	PropertySinkEncodingCloudEventsSource      = "sink.encoding.cloudevents.source"
+
 	PropertyStatsEnabled        = "stats.enabled"
 	PropertyStatsPort           = "stats.port"
 	PropertyRuntimeStatsEnabled = "stats.runtime.enabled"
@@ -62,7 +107,9 @@ const (
 	PropertyPostgresqlEventsTruncate = "postgresql.events.truncate"
 	PropertyPostgresqlEventsMessage  = "postgresql.events.message"
 
-	PropertyNamingStrategy = "topic.namingstrategy.type"
+	PropertyNamingStrategy     = "topic.namingstrategy.type"
+	PropertyTopicExpression    = "topic.expression"
+	PropertyTopicKeyExpression = "topic.keyexpression"
 
 	PropertyKafkaBrokers       = "sink.kafka.brokers"
 	PropertyKafkaSaslEnabled   = "sink.kafka.sasl.enabled"
@@ -123,4 +170,52 @@ const (
 	PropertyHttpHeaderAuthenticationHeaderValue = "sink.http.authentication.header.value"
 	PropertyHttpTlsSkipVerify                   = "sink.http.tls.skipverify"
 	PropertyHttpTlsClientAuth                   = "sink.http.tls.clientauth"
+
+	PropertyPulsarUrl                       = "sink.pulsar.url"
+	PropertyPulsarTenant                    = "sink.pulsar.tenant"
+	PropertyPulsarNamespace                 = "sink.pulsar.namespace"
+	PropertyPulsarTimeout                   = "sink.pulsar.timeout"
+	PropertyPulsarAuthenticationType        = "sink.pulsar.authentication.type"
+	PropertyPulsarAuthenticationToken       = "sink.pulsar.authentication.token"
+	PropertyPulsarAuthenticationTokenFile   = "sink.pulsar.authentication.tokenfile"
+	PropertyPulsarAuthenticationCertificate = "sink.pulsar.authentication.certificate"
+	PropertyPulsarAuthenticationKey         = "sink.pulsar.authentication.key"
+	PropertyPulsarTlsTrustCertsFile         = "sink.pulsar.tls.trustcertsfile"
+	PropertyPulsarTlsSkipVerify             = "sink.pulsar.tls.skipverify"
+	PropertyPulsarTlsValidateHostname       = "sink.pulsar.tls.validatehostname"
+
+	PropertyAmqpUrl                = "sink.amqp.url"
+	PropertyAmqpExchangeName       = "sink.amqp.exchange.name"
+	PropertyAmqpExchangeType       = "sink.amqp.exchange.type"
+	PropertyAmqpExchangeDeclare    = "sink.amqp.exchange.declare"
+	PropertyAmqpExchangeDurable    = "sink.amqp.exchange.durable"
+	PropertyAmqpExchangeAutoDelete = "sink.amqp.exchange.autodelete"
+	PropertyAmqpPersistent         = "sink.amqp.persistent"
+	PropertyAmqpTimeout            = "sink.amqp.timeout"
+	PropertyAmqpTlsSkipVerify      = "sink.amqp.tls.skipverify"
+	PropertyAmqpTlsClientAuth      = "sink.amqp.tls.clientauth"
+
+	PropertyMqttUrl           = "sink.mqtt.url"
+	PropertyMqttVersion       = "sink.mqtt.version"
+	PropertyMqttClientId      = "sink.mqtt.clientid"
+	PropertyMqttQoS           = "sink.mqtt.qos"
+	PropertyMqttRetain        = "sink.mqtt.retain"
+	PropertyMqttUsername      = "sink.mqtt.username"
+	PropertyMqttPassword      = "sink.mqtt.password"
+	PropertyMqttTimeout       = "sink.mqtt.timeout"
+	PropertyMqttTlsSkipVerify = "sink.mqtt.tls.skipverify"
+	PropertyMqttTlsClientAuth = "sink.mqtt.tls.clientauth"
+
+	PropertyPubSubProjectId       = "sink.pubsub.projectid"
+	PropertyPubSubEndpoint        = "sink.pubsub.endpoint"
+	PropertyPubSubCredentialsFile = "sink.pubsub.credentialsfile"
+	PropertyPubSubTimeout         = "sink.pubsub.timeout"
+	PropertyPubSubBatchCount      = "sink.pubsub.batch.count"
+	PropertyPubSubBatchBytes      = "sink.pubsub.batch.bytes"
+	PropertyPubSubBatchDelay      = "sink.pubsub.batch.delay"
+
+	PropertyFilePath        = "sink.file.path"
+	PropertyFileMaxSize     = "sink.file.maxsize"
+	PropertyFileMaxDuration = "sink.file.maxduration"
+	PropertyFileCompression = "sink.file.compression"
 )
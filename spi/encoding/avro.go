@@ -0,0 +1,619 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package encoding
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/goccy/go-json"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"math"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterEncoder(config.AvroEncoding, newAvroEncoder)
+}
+
+// avroMagicByte is the leading byte of the Confluent wire format,
+// followed by the 4 byte big endian schema id
+const avroMagicByte byte = 0
+
+type avroSchema struct {
+	id   int
+	root *avroType
+}
+
+// AvroEncoder encodes envelopes (schema and payload) into the Avro binary
+// format, prefixed with the Confluent magic byte and schema id framing.
+// Avro schemas are generated from the envelope schema definitions and
+// registered with the schema registry the first time they are seen.
+// Since schema definitions are created once per table and schema
+// version, the registered id is cached by subject and schema instance.
+type AvroEncoder struct {
+	registry *SchemaRegistryClient
+	schemas  *schema.InstanceCache[*avroSchema]
+}
+
+func NewAvroEncoder(
+	registry *SchemaRegistryClient,
+) *AvroEncoder {
+
+	return &AvroEncoder{
+		registry: registry,
+		schemas:  schema.NewInstanceCache[*avroSchema](schema.DefaultInstanceCacheSize),
+	}
+}
+
+func newAvroEncoder(
+	c *config.Config, _ bool,
+) (Encoder, error) {
+
+	registryUrl := config.GetOrDefault(c, config.PropertySinkEncodingSchemaRegistryUrl, "")
+	if registryUrl == "" {
+		return nil, errors.Errorf("avro encoding requires %s", config.PropertySinkEncodingSchemaRegistryUrl)
+	}
+
+	return NewAvroEncoder(
+		NewSchemaRegistryClient(
+			registryUrl,
+			config.GetOrDefault(c, config.PropertySinkEncodingSchemaRegistryUsername, ""),
+			config.GetOrDefault(c, config.PropertySinkEncodingSchemaRegistryPassword, ""),
+		),
+	), nil
+}
+
+func (a *AvroEncoder) ContentType() string {
+	return "application/vnd.apache.avro+binary"
+}
+
+// Encode encodes key and value, registering the schemas under the
+// subjects <topic>-key and <topic>-value (TopicNameStrategy)
+func (a *AvroEncoder) Encode(
+	topicName string, key, envelope schema.Struct,
+) (*Encoded, error) {
+
+	encoded := &Encoded{}
+	if key != nil {
+		keyData, err := a.Marshal(topicName+"-key", key)
+		if err != nil {
+			return nil, classifyAvroError(err)
+		}
+		encoded.Key = keyData
+	}
+
+	envelopeData, err := a.Marshal(topicName+"-value", envelope)
+	if err != nil {
+		return nil, classifyAvroError(err)
+	}
+	encoded.Value = envelopeData
+	return encoded, nil
+}
+
+// Marshal encodes the payload of the given envelope and registers the
+// schema under the given subject, if not yet known. Envelopes without
+// payload (tombstones) are encoded as nil.
+func (a *AvroEncoder) Marshal(
+	subject string, envelope schema.Struct,
+) ([]byte, error) {
+
+	if envelope == nil {
+		return nil, nil
+	}
+
+	payload, ok := envelope[schema.FieldNamePayload]
+	if !ok || isNil(payload) {
+		return nil, nil
+	}
+
+	schemaDefinition, ok := envelope[schema.FieldNameSchema].(schema.Struct)
+	if !ok {
+		return nil, errors.Errorf("envelope for subject %s has no schema definition", subject)
+	}
+
+	resolved, err := a.resolveSchema(subject, schemaDefinition)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := make([]byte, 5, 256)
+	buffer[0] = avroMagicByte
+	binary.BigEndian.PutUint32(buffer[1:], uint32(resolved.id))
+
+	return resolved.root.encode(buffer, payload)
+}
+
+func (a *AvroEncoder) resolveSchema(
+	subject string, schemaDefinition schema.Struct,
+) (*avroSchema, error) {
+
+	return a.schemas.GetOrCreate(subject, schemaDefinition, func(schemaDefinition schema.Struct) (*avroSchema, error) {
+		root, definition, err := convertAvroSchema(schemaDefinition)
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := a.registry.Register(subject, "AVRO", definition)
+		if err != nil {
+			return nil, err
+		}
+
+		return &avroSchema{
+			id:   id,
+			root: root,
+		}, nil
+	})
+}
+
+// convertAvroSchema converts a schema definition into its Avro schema
+// representation. All fields are generated as nullable unions since
+// payloads may not carry values for required fields, i.e. the after
+// state of a delete event.
+func convertAvroSchema(
+	schemaDefinition schema.Struct,
+) (*avroType, string, error) {
+
+	converter := &avroSchemaConverter{
+		records: make(map[string]*avroType),
+	}
+	root, definition, err := converter.convert(schemaDefinition, "Record")
+	if err != nil {
+		return nil, "", err
+	}
+	if root.kind != schema.STRUCT {
+		return nil, "", errors.Errorf("avro schemas must have a record root, found %s", root.kind)
+	}
+
+	data, err := json.Marshal(definition)
+	if err != nil {
+		return nil, "", errors.Wrap(err, 0)
+	}
+	return root, string(data), nil
+}
+
+type avroField struct {
+	name     string
+	fieldKey string
+	typ      *avroType
+}
+
+type avroType struct {
+	kind   schema.Type
+	fields []avroField
+	items  *avroType
+}
+
+type avroSchemaConverter struct {
+	records map[string]*avroType
+}
+
+func (c *avroSchemaConverter) convert(
+	schemaDefinition schema.Struct, defaultName string,
+) (*avroType, any, error) {
+
+	schemaType := typeOf(schemaDefinition)
+	switch schemaType {
+	case schema.INT8, schema.INT16, schema.INT32:
+		return &avroType{kind: schemaType}, "int", nil
+	case schema.INT64:
+		return &avroType{kind: schemaType}, "long", nil
+	case schema.FLOAT32:
+		return &avroType{kind: schemaType}, "float", nil
+	case schema.FLOAT64:
+		return &avroType{kind: schemaType}, "double", nil
+	case schema.BOOLEAN, schema.STRING, schema.BYTES:
+		return &avroType{kind: schemaType}, string(schemaType), nil
+	case schema.ARRAY, schema.MAP:
+		elementDefinition, ok := schemaDefinition[schema.FieldNameValueSchema].(schema.Struct)
+		if !ok {
+			return nil, nil, errors.Errorf("%s schema %s has no value schema", schemaType, defaultName)
+		}
+		element, elementSchema, err := c.convert(elementDefinition, defaultName+"_value")
+		if err != nil {
+			return nil, nil, err
+		}
+		property := "items"
+		if schemaType == schema.MAP {
+			property = "values"
+		}
+		return &avroType{kind: schemaType, items: element}, map[string]any{
+			"type":   string(schemaType),
+			property: []any{"null", elementSchema},
+		}, nil
+	case schema.STRUCT:
+		return c.convertRecord(schemaDefinition, defaultName)
+	}
+	return nil, nil, errors.Errorf("unsupported schema type '%s' for %s", schemaType, defaultName)
+}
+
+func (c *avroSchemaConverter) convertRecord(
+	schemaDefinition schema.Struct, defaultName string,
+) (*avroType, any, error) {
+
+	name := defaultName
+	if schemaName, ok := schemaDefinition[schema.FieldNameName].(string); ok && schemaName != "" {
+		name = schemaName
+	}
+	fullName := avroFullName(name)
+
+	// Avro names must be unique, and every later usage
+	// has to reference the already defined record
+	if record, present := c.records[fullName]; present {
+		return record, fullName, nil
+	}
+
+	record := &avroType{kind: schema.STRUCT}
+	c.records[fullName] = record
+
+	fieldDefinitions, _ := schemaDefinition[schema.FieldNameFields].([]schema.Struct)
+	fieldDefinitions = slices.Clone(fieldDefinitions)
+	slices.SortStableFunc(fieldDefinitions, func(this, other schema.Struct) int {
+		if result := cmp.Compare(indexOf(this), indexOf(other)); result != 0 {
+			return result
+		}
+		return cmp.Compare(fieldNameOf(this), fieldNameOf(other))
+	})
+
+	fields := make([]any, 0, len(fieldDefinitions))
+	for _, fieldDefinition := range fieldDefinitions {
+		fieldKey := fieldNameOf(fieldDefinition)
+		if fieldKey == "" {
+			return nil, nil, errors.Errorf("record %s contains a field without name", name)
+		}
+
+		// Key schema elements wrap the actual type definition
+		if nested, ok := fieldDefinition[schema.FieldNameSchema].(schema.Struct); ok {
+			if _, present := fieldDefinition[schema.FieldNameType]; !present {
+				fieldDefinition = nested
+			}
+		}
+
+		fieldName := avroName(fieldKey)
+		typ, fieldSchema, err := c.convert(fieldDefinition, fmt.Sprintf("%s_%s", avroName(name), fieldName))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		record.fields = append(record.fields, avroField{
+			name:     fieldName,
+			fieldKey: fieldKey,
+			typ:      typ,
+		})
+		fields = append(fields, map[string]any{
+			"name":    fieldName,
+			"type":    []any{"null", fieldSchema},
+			"default": nil,
+		})
+	}
+
+	definition := map[string]any{
+		"type":   "record",
+		"name":   fullName[strings.LastIndex(fullName, ".")+1:],
+		"fields": fields,
+	}
+	if index := strings.LastIndex(fullName, "."); index > -1 {
+		definition["namespace"] = fullName[:index]
+	}
+	return record, definition, nil
+}
+
+func (t *avroType) encode(
+	buffer []byte, value any,
+) ([]byte, error) {
+
+	value = deref(value)
+	switch t.kind {
+	case schema.INT8, schema.INT16, schema.INT32, schema.INT64:
+		v, err := toInt64(value)
+		if err != nil {
+			return nil, err
+		}
+		return appendLong(buffer, v), nil
+	case schema.FLOAT32:
+		v, err := toFloat64(value)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(buffer, math.Float32bits(float32(v))), nil
+	case schema.FLOAT64:
+		v, err := toFloat64(value)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(buffer, math.Float64bits(v)), nil
+	case schema.BOOLEAN:
+		v, ok := value.(bool)
+		if !ok {
+			return nil, errors.Errorf("value of type %T is not a boolean", value)
+		}
+		if v {
+			return append(buffer, 1), nil
+		}
+		return append(buffer, 0), nil
+	case schema.STRING:
+		v, ok := value.(string)
+		if !ok {
+			v = fmt.Sprint(value)
+		}
+		return append(appendLong(buffer, int64(len(v))), v...), nil
+	case schema.BYTES:
+		var v []byte
+		switch b := value.(type) {
+		case []byte:
+			v = b
+		case string:
+			v = []byte(b)
+		default:
+			return nil, errors.Errorf("value of type %T is not a byte array", value)
+		}
+		return append(appendLong(buffer, int64(len(v))), v...), nil
+	case schema.ARRAY:
+		return t.encodeArray(buffer, value)
+	case schema.MAP:
+		return t.encodeMap(buffer, value)
+	case schema.STRUCT:
+		return t.encodeRecord(buffer, value)
+	}
+	return nil, errors.Errorf("unsupported avro type %s", t.kind)
+}
+
+func (t *avroType) encodeNullable(
+	buffer []byte, value any,
+) ([]byte, error) {
+
+	if isNil(value) {
+		return appendLong(buffer, 0), nil
+	}
+	return t.encode(appendLong(buffer, 1), value)
+}
+
+func (t *avroType) encodeArray(
+	buffer []byte, value any,
+) ([]byte, error) {
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, errors.Errorf("value of type %T is not an array", value)
+	}
+
+	var err error
+	if v.Len() > 0 {
+		buffer = appendLong(buffer, int64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if buffer, err = t.items.encodeNullable(buffer, v.Index(i).Interface()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return appendLong(buffer, 0), nil
+}
+
+func (t *avroType) encodeMap(
+	buffer []byte, value any,
+) ([]byte, error) {
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Map {
+		return nil, errors.Errorf("value of type %T is not a map", value)
+	}
+
+	keys := v.MapKeys()
+	slices.SortFunc(keys, func(this, other reflect.Value) int {
+		return cmp.Compare(fmt.Sprint(this.Interface()), fmt.Sprint(other.Interface()))
+	})
+
+	var err error
+	if len(keys) > 0 {
+		buffer = appendLong(buffer, int64(len(keys)))
+		for _, key := range keys {
+			k := fmt.Sprint(key.Interface())
+			buffer = append(appendLong(buffer, int64(len(k))), k...)
+			if buffer, err = t.items.encodeNullable(buffer, v.MapIndex(key).Interface()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return appendLong(buffer, 0), nil
+}
+
+func (t *avroType) encodeRecord(
+	buffer []byte, value any,
+) ([]byte, error) {
+
+	record, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.Errorf("value of type %T is not a record", value)
+	}
+
+	var err error
+	for _, field := range t.fields {
+		if buffer, err = field.typ.encodeNullable(buffer, record[field.fieldKey]); err != nil {
+			return nil, errors.WrapPrefix(err, fmt.Sprintf("field %s", field.fieldKey), 0)
+		}
+	}
+	return buffer, nil
+}
+
+func classifyAvroError(
+	err error,
+) error {
+
+	// Registry unavailable, the schema may be registered later on
+	var urlError *url.Error
+	if errors.As(err, &urlError) {
+		return err
+	}
+	var registryError *SchemaRegistryError
+	if errors.As(err, &registryError) && registryError.Temporary() {
+		return err
+	}
+	return sink.NonRetryable(err)
+}
+
+func appendLong(
+	buffer []byte, value int64,
+) []byte {
+
+	return binary.AppendUvarint(buffer, uint64((value<<1)^(value>>63)))
+}
+
+func toInt64(
+	value any,
+) (int64, error) {
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return int64(v.Float()), nil
+	case reflect.String:
+		return strconv.ParseInt(v.String(), 10, 64)
+	default:
+		return 0, errors.Errorf("value of type %T is not an integer", value)
+	}
+}
+
+func toFloat64(
+	value any,
+) (float64, error) {
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return strconv.ParseFloat(v.String(), 64)
+	default:
+		return 0, errors.Errorf("value of type %T is not a floating point number", value)
+	}
+}
+
+func deref(
+	value any,
+) any {
+
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	if (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func isNil(
+	value any,
+) bool {
+
+	return deref(value) == nil
+}
+
+func typeOf(
+	schemaDefinition schema.Struct,
+) schema.Type {
+
+	switch t := schemaDefinition[schema.FieldNameType].(type) {
+	case schema.Type:
+		return t
+	case string:
+		return schema.Type(t)
+	}
+	return ""
+}
+
+func indexOf(
+	fieldDefinition schema.Struct,
+) int {
+
+	if index, ok := fieldDefinition[schema.FieldNameIndex].(int); ok && index > -1 {
+		return index
+	}
+	return math.MaxInt
+}
+
+func fieldNameOf(
+	fieldDefinition schema.Struct,
+) string {
+
+	if fieldName, ok := fieldDefinition[schema.FieldNameField].(string); ok {
+		return fieldName
+	}
+	// Key schema elements carry the field name as name
+	if _, ok := fieldDefinition[schema.FieldNameSchema].(schema.Struct); ok {
+		if name, ok := fieldDefinition[schema.FieldNameName].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+func avroFullName(
+	name string,
+) string {
+
+	segments := strings.Split(name, ".")
+	for i, segment := range segments {
+		segments[i] = avroName(segment)
+	}
+	return strings.Join(segments, ".")
+}
+
+func avroName(
+	name string,
+) string {
+
+	builder := strings.Builder{}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			builder.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				builder.WriteRune('_')
+			}
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune('_')
+		}
+	}
+	if builder.Len() == 0 {
+		return "_"
+	}
+	return builder.String()
+}
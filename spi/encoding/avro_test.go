@@ -0,0 +1,153 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package encoding
+
+import (
+	"encoding/binary"
+	"github.com/goccy/go-json"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAvroEncoder_Marshal(
+	t *testing.T,
+) {
+
+	var registrations atomic.Int32
+	var registeredSchema string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/subjects/foo.public.metrics-value/versions", r.URL.Path)
+		assert.Equal(t, schemaRegistryContentType, r.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		request := map[string]any{}
+		assert.NoError(t, json.Unmarshal(body, &request))
+		registeredSchema = request["schema"].(string)
+
+		registrations.Add(1)
+		w.Header().Set("Content-Type", schemaRegistryContentType)
+		_, _ = w.Write([]byte(`{"id":42}`))
+	}))
+	defer server.Close()
+
+	encoder := NewAvroEncoder(NewSchemaRegistryClient(server.URL, "", ""))
+
+	valueSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("foo.public.metrics.Value").
+		Field("id", 0, schema.Int32()).
+		Field("name", 1, schema.String()).
+		Field("tags", 2, schema.NewSchemaBuilder(schema.ARRAY).ValueSchema(schema.String())).
+		Build()
+
+	envelope := schema.Envelope(valueSchema, schema.Struct{
+		"id":   int32(-2),
+		"name": "ab",
+		"tags": []string{"x"},
+	})
+
+	data, err := encoder.Marshal("foo.public.metrics-value", envelope)
+	assert.NoError(t, err)
+
+	assert.Equal(t, byte(0), data[0])
+	assert.Equal(t, uint32(42), binary.BigEndian.Uint32(data[1:5]))
+	assert.Equal(t, []byte{
+		0x02, 0x03, // union index 1, int -2 (zigzag)
+		0x02, 0x04, 'a', 'b', // union index 1, string of length 2
+		0x02, 0x02, 0x02, 0x02, 'x', 0x00, // union index 1, block of 1 item, end of array
+	}, data[5:])
+
+	definition := map[string]any{}
+	assert.NoError(t, json.Unmarshal([]byte(registeredSchema), &definition))
+	assert.Equal(t, "record", definition["type"])
+	assert.Equal(t, "Value", definition["name"])
+	assert.Equal(t, "foo.public.metrics", definition["namespace"])
+	assert.Len(t, definition["fields"], 3)
+
+	// Second message with the same schema must not register again
+	_, err = encoder.Marshal("foo.public.metrics-value", envelope)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), registrations.Load())
+
+	// Tombstones don't carry a value
+	data, err = encoder.Marshal("foo.public.metrics-value", schema.Envelope(valueSchema, nil))
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+}
+
+func TestAvroEncoder_Marshal_Null_Fields(
+	t *testing.T,
+) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":1}`))
+	}))
+	defer server.Close()
+
+	encoder := NewAvroEncoder(NewSchemaRegistryClient(server.URL, "", ""))
+
+	rowSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("foo.Value").
+		Field("value", 0, schema.Float64())
+
+	envelopeSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("foo.Envelope").
+		Field(schema.FieldNameBefore, 0, rowSchema.Clone()).
+		Field(schema.FieldNameAfter, 1, rowSchema.Clone().Required()).
+		Build()
+
+	data, err := encoder.Marshal("foo-value", schema.Envelope(envelopeSchema, schema.Struct{
+		schema.FieldNameBefore: schema.Struct{"value": 1.5},
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x02, 0x02, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f, // before: record, value 1.5
+		0x00, // after: null
+	}, data[5:])
+}
+
+func TestAvroEncoder_Marshal_Registry_Rejection(
+	t *testing.T,
+) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"error_code":409,"message":"incompatible schema"}`))
+	}))
+	defer server.Close()
+
+	encoder := NewAvroEncoder(NewSchemaRegistryClient(server.URL, "", ""))
+
+	valueSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("foo.Value").
+		Field("id", 0, schema.Int64()).
+		Build()
+
+	_, err := encoder.Marshal("foo-value", schema.Envelope(valueSchema, schema.Struct{"id": 1}))
+	assert.Error(t, err)
+
+	registryError, ok := err.(*SchemaRegistryError)
+	assert.True(t, ok)
+	assert.Equal(t, 409, registryError.ErrorCode)
+	assert.Equal(t, "incompatible schema", registryError.Message)
+	assert.False(t, registryError.Temporary())
+}
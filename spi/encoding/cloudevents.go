@@ -0,0 +1,231 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package encoding
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/hashicorp/go-uuid"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"sync"
+	"time"
+)
+
+const (
+	cloudEventsSpecVersion       = "1.0"
+	cloudEventsStructuredType    = "application/cloudevents+json"
+	cloudEventsDefaultSource     = "/timescaledb-event-streamer"
+	cloudEventsHeaderPrefix      = "ce-"
+	cloudEventsContentTypeHeader = "content-type"
+	cloudEventsDataContentType   = "application/json"
+	cloudEventsAttributeData     = "data"
+	cloudEventsAttributeId       = "id"
+	cloudEventsAttributeSource   = "source"
+	cloudEventsAttributeSpec     = "specversion"
+	cloudEventsAttributeType     = "type"
+	cloudEventsAttributeSubject  = "subject"
+	cloudEventsAttributeTime     = "time"
+	cloudEventsAttributeDataType = "datacontenttype"
+)
+
+func init() {
+	RegisterEncoder(config.CloudEventsEncoding, newCloudEventsEncoder)
+}
+
+// CloudEventsEncoder encodes events as CloudEvents 1.0 with the
+// event payload as JSON data. The topic is used as the event type,
+// the source table (if available) as subject, and the LSN and
+// transaction id as the event id. In structured mode, the attributes
+// and data are encoded as a single JSON document. In binary mode,
+// only the data is encoded and attributes are returned as headers,
+// using the ce- prefix of the HTTP and NATS bindings.
+type CloudEventsEncoder struct {
+	encoder *JsonEncoder
+	source  string
+	binary  bool
+	mutex   sync.Mutex
+	lastId  string
+	seq     uint64
+}
+
+func NewCloudEventsEncoder(
+	encoder *JsonEncoder, source string, binary bool,
+) *CloudEventsEncoder {
+
+	return &CloudEventsEncoder{
+		encoder: encoder,
+		source:  source,
+		binary:  binary,
+	}
+}
+
+func newCloudEventsEncoder(
+	c *config.Config, supportsHeaders bool,
+) (Encoder, error) {
+
+	mode := config.GetOrDefault(c, config.PropertySinkEncodingCloudEventsMode, config.StructuredMode)
+	switch mode {
+	case config.StructuredMode:
+	case config.BinaryMode:
+		if !supportsHeaders {
+			return nil, errors.Errorf("CloudEvents binary mode is only supported by the http, kafka, and nats sinks")
+		}
+	default:
+		return nil, errors.Errorf("CloudEvents mode '%s' doesn't exist", mode)
+	}
+
+	return NewCloudEventsEncoder(
+		NewJsonEncoderWithConfig(c),
+		config.GetOrDefault(c, config.PropertySinkEncodingCloudEventsSource, cloudEventsDefaultSource),
+		mode == config.BinaryMode,
+	), nil
+}
+
+func (c *CloudEventsEncoder) ContentType() string {
+	if c.binary {
+		return cloudEventsDataContentType
+	}
+	return cloudEventsStructuredType
+}
+
+// Encode encodes the event. Keys are encoded as plain JSON of
+// the key's payload, since they aren't part of the CloudEvent.
+func (c *CloudEventsEncoder) Encode(
+	topicName string, key, envelope schema.Struct,
+) (*Encoded, error) {
+
+	encoded := &Encoded{}
+	if key != nil {
+		keyData, err := c.encoder.Marshal(key[schema.FieldNamePayload])
+		if err != nil {
+			return nil, sink.NonRetryable(err)
+		}
+		encoded.Key = keyData
+	}
+
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	if payload == nil {
+		return encoded, nil
+	}
+
+	attributes, err := c.attributes(topicName, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.binary {
+		data, err := c.encoder.Marshal(payload)
+		if err != nil {
+			return nil, sink.NonRetryable(err)
+		}
+		encoded.Value = data
+		encoded.Headers = make(map[string]string, len(attributes)+1)
+		for attribute, value := range attributes {
+			encoded.Headers[cloudEventsHeaderPrefix+attribute] = value
+		}
+		encoded.Headers[cloudEventsContentTypeHeader] = cloudEventsDataContentType
+		return encoded, nil
+	}
+
+	event := make(map[string]any, len(attributes)+2)
+	for attribute, value := range attributes {
+		event[attribute] = value
+	}
+	event[cloudEventsAttributeDataType] = cloudEventsDataContentType
+	event[cloudEventsAttributeData] = payload
+
+	data, err := c.encoder.Marshal(event)
+	if err != nil {
+		return nil, sink.NonRetryable(err)
+	}
+	encoded.Value = data
+	return encoded, nil
+}
+
+func (c *CloudEventsEncoder) attributes(
+	topicName string, payload schema.Struct,
+) (map[string]string, error) {
+
+	id, err := c.eventId(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := map[string]string{
+		cloudEventsAttributeId:     id,
+		cloudEventsAttributeSource: c.source,
+		cloudEventsAttributeSpec:   cloudEventsSpecVersion,
+		cloudEventsAttributeType:   topicName,
+	}
+
+	timestamp := time.Now()
+	if ts, ok := payload[schema.FieldNameTimestamp].(int64); ok {
+		timestamp = time.UnixMilli(ts)
+	}
+
+	if source, ok := payload[schema.FieldNameSource].(schema.Struct); ok {
+		schemaName, _ := source[schema.FieldNameSchema].(string)
+		tableName, _ := source[schema.FieldNameTable].(string)
+		if schemaName != "" && tableName != "" {
+			attributes[cloudEventsAttributeSubject] = fmt.Sprintf("%s.%s", schemaName, tableName)
+		}
+		if ts, ok := source[schema.FieldNameTimestamp].(int64); ok {
+			timestamp = time.UnixMilli(ts)
+		}
+	}
+
+	attributes[cloudEventsAttributeTime] = timestamp.UTC().Format(time.RFC3339Nano)
+	return attributes, nil
+}
+
+// eventId generates the id from LSN and transaction id. Since
+// consecutive events may share both (i.e. snapshot events), those
+// are made unique by a sequence suffix. Events without source, such
+// as transaction metadata events, get a random id.
+func (c *CloudEventsEncoder) eventId(
+	payload schema.Struct,
+) (string, error) {
+
+	source, ok := payload[schema.FieldNameSource].(schema.Struct)
+	if !ok {
+		return uuid.GenerateUUID()
+	}
+
+	lsn, ok := source[schema.FieldNameLSN].(string)
+	if !ok {
+		return uuid.GenerateUUID()
+	}
+
+	id := lsn
+	if xid := deref(source[schema.FieldNameTxId]); xid != nil {
+		id = fmt.Sprintf("%s:%v", lsn, xid)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.lastId != id {
+		c.lastId = id
+		c.seq = 0
+		return id, nil
+	}
+
+	c.seq++
+	return fmt.Sprintf("%s:%d", id, c.seq), nil
+}
@@ -0,0 +1,149 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package encoding
+
+import (
+	"github.com/goccy/go-json"
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCloudEventsEncoder_Structured(
+	t *testing.T,
+) {
+
+	encoder, err := NewEncoder(config.CloudEventsEncoding, &config.Config{}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "application/cloudevents+json", encoder.ContentType())
+
+	encoded, err := encoder.Encode("foo.public.metrics", testKey(), testEnvelope(12))
+	assert.NoError(t, err)
+	assert.Nil(t, encoded.Headers)
+	assert.Equal(t, `{"id":1}`, string(encoded.Key))
+
+	event := map[string]any{}
+	assert.NoError(t, json.Unmarshal(encoded.Value, &event))
+	assert.Equal(t, "1.0", event["specversion"])
+	assert.Equal(t, "0/16B3748:12", event["id"])
+	assert.Equal(t, "/timescaledb-event-streamer", event["source"])
+	assert.Equal(t, "foo.public.metrics", event["type"])
+	assert.Equal(t, "public.metrics", event["subject"])
+	assert.Equal(t, "2023-08-01T12:00:00Z", event["time"])
+	assert.Equal(t, "application/json", event["datacontenttype"])
+	assert.Equal(t, "c", event["data"].(map[string]any)["op"])
+
+	// Consecutive events with the same LSN and xid get unique ids
+	encoded, err = encoder.Encode("foo.public.metrics", nil, testEnvelope(12))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(encoded.Value, &event))
+	assert.Equal(t, "0/16B3748:12:1", event["id"])
+}
+
+func TestCloudEventsEncoder_Binary(
+	t *testing.T,
+) {
+
+	c := &config.Config{
+		Sink: config.SinkConfig{
+			Encoding: config.SinkEncodingConfig{
+				Type: config.CloudEventsEncoding,
+				CloudEvents: config.CloudEventsConfig{
+					Mode:   config.BinaryMode,
+					Source: "/test",
+				},
+			},
+		},
+	}
+
+	_, err := NewEncoderWithConfig(c, false)
+	assert.Error(t, err)
+
+	encoder, err := NewEncoderWithConfig(c, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", encoder.ContentType())
+
+	encoded, err := encoder.Encode("foo.public.metrics", nil, testEnvelope(13))
+	assert.NoError(t, err)
+	assert.Nil(t, encoded.Key)
+	assert.Equal(t, map[string]string{
+		"ce-id":          "0/16B3748:13",
+		"ce-source":      "/test",
+		"ce-specversion": "1.0",
+		"ce-type":        "foo.public.metrics",
+		"ce-subject":     "public.metrics",
+		"ce-time":        "2023-08-01T12:00:00Z",
+		"content-type":   "application/json",
+	}, encoded.Headers)
+
+	data := map[string]any{}
+	assert.NoError(t, json.Unmarshal(encoded.Value, &data))
+	assert.Equal(t, "c", data["op"])
+}
+
+func TestEncoderRegistry(
+	t *testing.T,
+) {
+
+	assert.True(t, RegisterEncoder("test", func(_ *config.Config, _ bool) (Encoder, error) {
+		return NewJsonEncoder(false), nil
+	}))
+	assert.False(t, RegisterEncoder("test", nil))
+
+	encoder, err := NewEncoderWithConfig(&config.Config{
+		Sink: config.SinkConfig{
+			Encoding: config.SinkEncodingConfig{
+				Type: "test",
+			},
+		},
+	}, false)
+	assert.NoError(t, err)
+	assert.IsType(t, &JsonEncoder{}, encoder)
+
+	_, err = NewEncoder("unknown", &config.Config{}, false)
+	assert.Error(t, err)
+
+	encoder, err = NewEncoderWithConfig(&config.Config{}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", encoder.ContentType())
+
+	_, err = encoder.Encode("foo", nil, schema.Struct{"invalid": make(chan int)})
+	assert.True(t, sink.IsNonRetryable(err))
+}
+
+func testKey() schema.Struct {
+	return schema.Envelope(schema.Struct{}, schema.Struct{"id": 1})
+}
+
+func testEnvelope(
+	xid uint32,
+) schema.Struct {
+
+	timestamp := time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)
+	source := schema.Source(
+		pglogrepl.LSN(23803720), timestamp, false, "db", "public", "metrics", &xid,
+	)
+	return schema.Envelope(schema.Struct{}, schema.Struct{
+		schema.FieldNameOperation: "c",
+		schema.FieldNameSource:    source,
+		schema.FieldNameTimestamp: timestamp.UnixMilli(),
+	})
+}
@@ -0,0 +1,51 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package encoding
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+)
+
+// Encoded is the wire representation of an event. Headers
+// contain additional metadata which has to be transported
+// alongside the value, e.g. CloudEvents attributes in binary
+// mode. Nil values represent events without payload.
+type Encoded struct {
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// Encoder encodes the key and value envelopes of events
+// into their wire representation. Errors which won't go
+// away when retried are returned as sink.NonRetryableError.
+type Encoder interface {
+	// ContentType returns the MIME type of encoded values
+	ContentType() string
+	// Encode encodes the key and value envelopes of an event
+	// which is sent to the given topic. Sinks which don't make
+	// use of keys pass a nil key, which is encoded as nil.
+	Encode(
+		topicName string, key, envelope schema.Struct,
+	) (*Encoded, error)
+}
+
+// EncoderFactory creates a new Encoder instance. The parameter
+// supportsHeaders defines if the requesting sink is able to
+// transport Encoded.Headers.
+type EncoderFactory = func(c *config.Config, supportsHeaders bool) (Encoder, error)
@@ -20,8 +20,16 @@ package encoding
 import (
 	"github.com/goccy/go-json"
 	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
 )
 
+func init() {
+	RegisterEncoder(config.JsonEncoding, func(c *config.Config, _ bool) (Encoder, error) {
+		return NewJsonEncoderWithConfig(c), nil
+	})
+}
+
 type JsonEncoder struct {
 	marshallerFunction func(value any) ([]byte, error)
 }
@@ -57,6 +65,36 @@ func (j *JsonEncoder) Marshal(
 	return j.marshallerFunction(value)
 }
 
+func (j *JsonEncoder) ContentType() string {
+	return "application/json"
+}
+
+func (j *JsonEncoder) Encode(
+	_ string, key, envelope schema.Struct,
+) (*Encoded, error) {
+
+	encoded := &Encoded{}
+	if key != nil {
+		keyData, err := j.Marshal(key)
+		if err != nil {
+			return nil, sink.NonRetryable(err)
+		}
+		encoded.Key = keyData
+	}
+
+	// Tombstones are encoded without value
+	if envelope == nil {
+		return encoded, nil
+	}
+
+	envelopeData, err := j.Marshal(envelope)
+	if err != nil {
+		return nil, sink.NonRetryable(err)
+	}
+	encoded.Value = envelopeData
+	return encoded, nil
+}
+
 type JsonDecoder struct {
 	unmarshallerFunction func(data []byte, v any) error
 }
@@ -0,0 +1,761 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package encoding
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/moby/sys/atomicwriter"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	// ProtobufMessageHeader is the header carrying the fully
+	// qualified name of the root message of encoded values
+	ProtobufMessageHeader = "protobuf.message"
+	// ProtobufFingerprintHeader is the header carrying the
+	// fingerprint of the descriptor of encoded values
+	ProtobufFingerprintHeader = "protobuf.fingerprint"
+)
+
+func init() {
+	RegisterEncoder(config.ProtobufEncoding, newProtobufEncoder)
+}
+
+// ProtobufDescriptor describes the generated protobuf message
+// of a schema definition. The descriptor set contains all types
+// necessary for consumers to decode the message.
+type ProtobufDescriptor struct {
+	// MessageName is the fully qualified name of the root message
+	MessageName string
+	// Fingerprint uniquely identifies the schema version
+	Fingerprint string
+	// DescriptorSet is the serialized FileDescriptorSet
+	DescriptorSet []byte
+}
+
+// DescriptorPublisher is called for every newly generated descriptor,
+// before the first message using it is encoded
+type DescriptorPublisher func(descriptor *ProtobufDescriptor) error
+
+// NewFileDescriptorPublisher creates a DescriptorPublisher writing the
+// descriptor sets into the given directory, one file per message and
+// schema version (<message name>-<fingerprint>.desc)
+func NewFileDescriptorPublisher(
+	directory string,
+) DescriptorPublisher {
+
+	return func(descriptor *ProtobufDescriptor) error {
+		filename := filepath.Join(
+			directory, fmt.Sprintf("%s-%s.desc", descriptor.MessageName, descriptor.Fingerprint),
+		)
+		return atomicwriter.WriteFile(filename, descriptor.DescriptorSet, 0666)
+	}
+}
+
+// DescriptorPublishingError is returned if the DescriptorPublisher
+// failed to publish a newly generated descriptor
+type DescriptorPublishingError struct {
+	MessageName string
+	Err         error
+}
+
+func (e *DescriptorPublishingError) Error() string {
+	return fmt.Sprintf("failed publishing protobuf descriptor of %s: %s", e.MessageName, e.Err)
+}
+
+func (e *DescriptorPublishingError) Unwrap() error {
+	return e.Err
+}
+
+type protobufSchema struct {
+	root       *protobufType
+	descriptor *ProtobufDescriptor
+}
+
+// ProtobufEncoder encodes the payload of envelopes as binary protobuf
+// messages. Message descriptors are generated dynamically from the
+// envelope schema definitions and handed to the DescriptorPublisher
+// the first time they are seen. Since schema definitions are created
+// once per table and schema version, the descriptors are cached by
+// schema instance.
+type ProtobufEncoder struct {
+	publisher       DescriptorPublisher
+	supportsHeaders bool
+	mutex           sync.Mutex
+	schemas         *schema.InstanceCache[*protobufSchema]
+}
+
+func NewProtobufEncoder(
+	publisher DescriptorPublisher,
+) *ProtobufEncoder {
+
+	return &ProtobufEncoder{
+		publisher: publisher,
+		schemas:   schema.NewInstanceCache[*protobufSchema](schema.DefaultInstanceCacheSize),
+	}
+}
+
+func newProtobufEncoder(
+	c *config.Config, supportsHeaders bool,
+) (Encoder, error) {
+
+	var publisher DescriptorPublisher
+	if descriptorPath := config.GetOrDefault(c, config.PropertySinkEncodingProtobufDescriptorPath, ""); descriptorPath != "" {
+		publisher = NewFileDescriptorPublisher(descriptorPath)
+	}
+
+	encoder := NewProtobufEncoder(publisher)
+	encoder.supportsHeaders = supportsHeaders
+	return encoder, nil
+}
+
+// HasDescriptorPublisher returns true if a DescriptorPublisher
+// is configured for the encoder
+func (p *ProtobufEncoder) HasDescriptorPublisher() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.publisher != nil
+}
+
+// SetDescriptorPublisher sets the DescriptorPublisher, which
+// enables sinks to publish descriptors using their transport
+func (p *ProtobufEncoder) SetDescriptorPublisher(
+	publisher DescriptorPublisher,
+) {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.publisher = publisher
+}
+
+func (p *ProtobufEncoder) ContentType() string {
+	return "application/x-protobuf"
+}
+
+// Encode encodes key and value. If supported by the sink, the
+// headers carry the message name and fingerprint of the value's
+// descriptor to select the matching descriptor set.
+func (p *ProtobufEncoder) Encode(
+	_ string, key, envelope schema.Struct,
+) (*Encoded, error) {
+
+	encoded := &Encoded{}
+	if key != nil {
+		keyData, _, err := p.Marshal(key)
+		if err != nil {
+			return nil, classifyProtobufError(err)
+		}
+		encoded.Key = keyData
+	}
+
+	envelopeData, descriptor, err := p.Marshal(envelope)
+	if err != nil {
+		return nil, classifyProtobufError(err)
+	}
+	encoded.Value = envelopeData
+
+	if descriptor != nil && p.supportsHeaders {
+		encoded.Headers = map[string]string{
+			ProtobufMessageHeader:     descriptor.MessageName,
+			ProtobufFingerprintHeader: descriptor.Fingerprint,
+		}
+	}
+	return encoded, nil
+}
+
+// Marshal encodes the payload of the given envelope and returns the
+// descriptor of the generated message. Envelopes without payload are
+// encoded as nil.
+func (p *ProtobufEncoder) Marshal(
+	envelope schema.Struct,
+) ([]byte, *ProtobufDescriptor, error) {
+
+	if envelope == nil {
+		return nil, nil, nil
+	}
+
+	payload, ok := envelope[schema.FieldNamePayload]
+	if !ok || isNil(payload) {
+		return nil, nil, nil
+	}
+
+	schemaDefinition, ok := envelope[schema.FieldNameSchema].(schema.Struct)
+	if !ok {
+		return nil, nil, errors.Errorf("envelope has no schema definition")
+	}
+
+	resolved, err := p.resolveSchema(schemaDefinition)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message := dynamicpb.NewMessage(resolved.root.descriptor)
+	if err := resolved.root.populate(message, deref(payload)); err != nil {
+		return nil, nil, err
+	}
+
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, 0)
+	}
+	return data, resolved.descriptor, nil
+}
+
+func (p *ProtobufEncoder) resolveSchema(
+	schemaDefinition schema.Struct,
+) (*protobufSchema, error) {
+
+	return p.schemas.GetOrCreate("", schemaDefinition, func(schemaDefinition schema.Struct) (*protobufSchema, error) {
+		root, descriptor, err := convertProtobufSchema(schemaDefinition)
+		if err != nil {
+			return nil, err
+		}
+
+		p.mutex.Lock()
+		publisher := p.publisher
+		p.mutex.Unlock()
+
+		if publisher != nil {
+			if err := publisher(descriptor); err != nil {
+				return nil, &DescriptorPublishingError{
+					MessageName: descriptor.MessageName,
+					Err:         err,
+				}
+			}
+		}
+
+		return &protobufSchema{
+			root:       root,
+			descriptor: descriptor,
+		}, nil
+	})
+}
+
+// convertProtobufSchema generates a proto3 file descriptor from the
+// schema definition. The root record becomes the top-level message,
+// all other records are generated as messages nested into the root.
+// Scalar fields are generated as proto3 optional fields to keep the
+// difference between null and zero values.
+func convertProtobufSchema(
+	schemaDefinition schema.Struct,
+) (*protobufType, *ProtobufDescriptor, error) {
+
+	if typeOf(schemaDefinition) != schema.STRUCT {
+		return nil, nil, errors.Errorf(
+			"protobuf schemas must have a record root, found %s", typeOf(schemaDefinition),
+		)
+	}
+
+	name := "Record"
+	if schemaName, ok := schemaDefinition[schema.FieldNameName].(string); ok && schemaName != "" {
+		name = schemaName
+	}
+	fullName := avroFullName(name)
+	packageName := ""
+	rootName := fullName
+	if index := strings.LastIndex(fullName, "."); index > -1 {
+		packageName = fullName[:index]
+		rootName = fullName[index+1:]
+	}
+
+	typePrefix := "." + rootName
+	if packageName != "" {
+		typePrefix = "." + packageName + typePrefix
+	}
+
+	converter := &protobufSchemaConverter{
+		typePrefix: typePrefix,
+		records:    make(map[string]*protobufType),
+		names:      make(map[string]bool),
+	}
+	root, err := converter.convertRecord(schemaDefinition, name, rootName, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filename := rootName + ".proto"
+	if packageName != "" {
+		filename = strings.ReplaceAll(packageName, ".", "/") + "/" + filename
+	}
+
+	fileDescriptorProto := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String(filename),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{converter.root},
+	}
+	if packageName != "" {
+		fileDescriptorProto.Package = proto.String(packageName)
+	}
+
+	fileDescriptor, err := protodesc.NewFile(fileDescriptorProto, new(protoregistry.Files))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, 0)
+	}
+
+	rootDescriptor := fileDescriptor.Messages().ByName(protoreflect.Name(rootName))
+	for _, record := range converter.records {
+		if record == root {
+			record.descriptor = rootDescriptor
+		} else {
+			record.descriptor = rootDescriptor.Messages().ByName(protoreflect.Name(record.name))
+		}
+	}
+
+	descriptorSet, err := proto.MarshalOptions{Deterministic: true}.Marshal(
+		&descriptorpb.FileDescriptorSet{
+			File: []*descriptorpb.FileDescriptorProto{fileDescriptorProto},
+		},
+	)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, 0)
+	}
+
+	fingerprint := sha256.Sum256(descriptorSet)
+	return root, &ProtobufDescriptor{
+		MessageName:   string(rootDescriptor.FullName()),
+		Fingerprint:   hex.EncodeToString(fingerprint[:8]),
+		DescriptorSet: descriptorSet,
+	}, nil
+}
+
+type protobufField struct {
+	fieldKey string
+	number   protoreflect.FieldNumber
+	typ      *protobufType
+}
+
+type protobufType struct {
+	kind       schema.Type
+	name       string
+	fields     []protobufField
+	items      *protobufType
+	descriptor protoreflect.MessageDescriptor
+}
+
+type protobufSchemaConverter struct {
+	typePrefix string
+	root       *descriptorpb.DescriptorProto
+	records    map[string]*protobufType
+	names      map[string]bool
+}
+
+func (c *protobufSchemaConverter) convertRecord(
+	schemaDefinition schema.Struct, defaultName, messageName string, root bool,
+) (*protobufType, error) {
+
+	name := defaultName
+	if schemaName, ok := schemaDefinition[schema.FieldNameName].(string); ok && schemaName != "" {
+		name = schemaName
+	}
+
+	// Records with the same name share the same message
+	if record, present := c.records[name]; present {
+		return record, nil
+	}
+
+	if !root {
+		messageName = c.uniqueName(messageName)
+	}
+
+	record := &protobufType{kind: schema.STRUCT, name: messageName}
+	c.records[name] = record
+
+	descriptorProto := &descriptorpb.DescriptorProto{
+		Name: proto.String(messageName),
+	}
+	if root {
+		c.root = descriptorProto
+	} else {
+		c.root.NestedType = append(c.root.NestedType, descriptorProto)
+	}
+
+	fieldDefinitions, _ := schemaDefinition[schema.FieldNameFields].([]schema.Struct)
+	fieldDefinitions = slices.Clone(fieldDefinitions)
+	slices.SortStableFunc(fieldDefinitions, func(this, other schema.Struct) int {
+		if result := cmp.Compare(indexOf(this), indexOf(other)); result != 0 {
+			return result
+		}
+		return cmp.Compare(fieldNameOf(this), fieldNameOf(other))
+	})
+
+	for i, fieldDefinition := range fieldDefinitions {
+		fieldKey := fieldNameOf(fieldDefinition)
+		if fieldKey == "" {
+			return nil, errors.Errorf("record %s contains a field without name", name)
+		}
+
+		// Key schema elements wrap the actual type definition
+		if nested, ok := fieldDefinition[schema.FieldNameSchema].(schema.Struct); ok {
+			if _, present := fieldDefinition[schema.FieldNameType]; !present {
+				fieldDefinition = nested
+			}
+		}
+
+		number := protoreflect.FieldNumber(i + 1)
+		fieldName := avroName(fieldKey)
+		fieldDescriptor := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(fieldName),
+			Number: proto.Int32(int32(number)),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+
+		typ, err := c.convertField(descriptorProto, fieldDescriptor, fieldDefinition, fieldKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if typ.kind.IsPrimitive() {
+			fieldDescriptor.Proto3Optional = proto.Bool(true)
+			fieldDescriptor.OneofIndex = proto.Int32(int32(len(descriptorProto.OneofDecl)))
+			descriptorProto.OneofDecl = append(descriptorProto.OneofDecl, &descriptorpb.OneofDescriptorProto{
+				Name: proto.String("_" + fieldName),
+			})
+		}
+
+		descriptorProto.Field = append(descriptorProto.Field, fieldDescriptor)
+		record.fields = append(record.fields, protobufField{
+			fieldKey: fieldKey,
+			number:   number,
+			typ:      typ,
+		})
+	}
+	return record, nil
+}
+
+func (c *protobufSchemaConverter) convertField(
+	parent *descriptorpb.DescriptorProto, fieldDescriptor *descriptorpb.FieldDescriptorProto,
+	fieldDefinition schema.Struct, fieldKey string,
+) (*protobufType, error) {
+
+	schemaType := typeOf(fieldDefinition)
+	switch schemaType {
+	case schema.ARRAY, schema.MAP:
+		elementDefinition, ok := fieldDefinition[schema.FieldNameValueSchema].(schema.Struct)
+		if !ok {
+			return nil, errors.Errorf("%s schema of field %s has no value schema", schemaType, fieldKey)
+		}
+		if elementType := typeOf(elementDefinition); elementType == schema.ARRAY || elementType == schema.MAP {
+			return nil, errors.Errorf(
+				"nested %s in field %s is not supported by protobuf encoding", elementType, fieldKey,
+			)
+		}
+
+		if schemaType == schema.ARRAY {
+			element, err := c.convertElement(fieldDescriptor, elementDefinition, fieldKey)
+			if err != nil {
+				return nil, err
+			}
+			fieldDescriptor.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+			return &protobufType{kind: schemaType, items: element}, nil
+		}
+
+		// Maps are repeated map entry messages nested into the containing message
+		entryName := protobufCamelCase(avroName(fieldKey)) + "Entry"
+		if parent == c.root {
+			entryName = c.uniqueName(entryName)
+		}
+		valueDescriptor := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String("value"),
+			Number: proto.Int32(2),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		element, err := c.convertElement(valueDescriptor, elementDefinition, fieldKey)
+		if err != nil {
+			return nil, err
+		}
+		parent.NestedType = append(parent.NestedType, &descriptorpb.DescriptorProto{
+			Name: proto.String(entryName),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:   proto.String("key"),
+					Number: proto.Int32(1),
+					Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				},
+				valueDescriptor,
+			},
+			Options: &descriptorpb.MessageOptions{
+				MapEntry: proto.Bool(true),
+			},
+		})
+		fieldDescriptor.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		fieldDescriptor.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		fieldDescriptor.TypeName = proto.String(
+			fmt.Sprintf("%s.%s", c.typeName(parent.GetName()), entryName),
+		)
+		return &protobufType{kind: schemaType, items: element}, nil
+	}
+	return c.convertElement(fieldDescriptor, fieldDefinition, fieldKey)
+}
+
+func (c *protobufSchemaConverter) convertElement(
+	fieldDescriptor *descriptorpb.FieldDescriptorProto, elementDefinition schema.Struct, fieldKey string,
+) (*protobufType, error) {
+
+	schemaType := typeOf(elementDefinition)
+	var protoType descriptorpb.FieldDescriptorProto_Type
+	switch schemaType {
+	case schema.INT8, schema.INT16, schema.INT32:
+		protoType = descriptorpb.FieldDescriptorProto_TYPE_INT32
+	case schema.INT64:
+		protoType = descriptorpb.FieldDescriptorProto_TYPE_INT64
+	case schema.FLOAT32:
+		protoType = descriptorpb.FieldDescriptorProto_TYPE_FLOAT
+	case schema.FLOAT64:
+		protoType = descriptorpb.FieldDescriptorProto_TYPE_DOUBLE
+	case schema.BOOLEAN:
+		protoType = descriptorpb.FieldDescriptorProto_TYPE_BOOL
+	case schema.STRING:
+		protoType = descriptorpb.FieldDescriptorProto_TYPE_STRING
+	case schema.BYTES:
+		protoType = descriptorpb.FieldDescriptorProto_TYPE_BYTES
+	case schema.STRUCT:
+		record, err := c.convertRecord(
+			elementDefinition, fieldKey, protobufCamelCase(avroName(fieldKey)), false,
+		)
+		if err != nil {
+			return nil, err
+		}
+		fieldDescriptor.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		fieldDescriptor.TypeName = proto.String(c.typeName(record.name))
+		return record, nil
+	default:
+		return nil, errors.Errorf("unsupported schema type '%s' for field %s", schemaType, fieldKey)
+	}
+
+	fieldDescriptor.Type = protoType.Enum()
+	return &protobufType{kind: schemaType}, nil
+}
+
+func (c *protobufSchemaConverter) typeName(
+	messageName string,
+) string {
+
+	if messageName == c.root.GetName() {
+		return c.typePrefix
+	}
+	return fmt.Sprintf("%s.%s", c.typePrefix, messageName)
+}
+
+func (c *protobufSchemaConverter) uniqueName(
+	messageName string,
+) string {
+
+	candidate := messageName
+	for i := 1; c.names[candidate] || candidate == c.root.GetName(); i++ {
+		candidate = fmt.Sprintf("%s%d", messageName, i)
+	}
+	c.names[candidate] = true
+	return candidate
+}
+
+func (t *protobufType) populate(
+	message protoreflect.Message, value any,
+) error {
+
+	record, ok := value.(map[string]any)
+	if !ok {
+		return errors.Errorf("value of type %T is not a record", value)
+	}
+
+	fields := message.Descriptor().Fields()
+	for _, field := range t.fields {
+		fieldValue := deref(record[field.fieldKey])
+		if fieldValue == nil {
+			continue
+		}
+
+		fieldDescriptor := fields.ByNumber(field.number)
+		if err := field.typ.set(message, fieldDescriptor, fieldValue); err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("field %s", field.fieldKey), 0)
+		}
+	}
+	return nil
+}
+
+func (t *protobufType) set(
+	message protoreflect.Message, fieldDescriptor protoreflect.FieldDescriptor, value any,
+) error {
+
+	switch t.kind {
+	case schema.ARRAY:
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return errors.Errorf("value of type %T is not an array", value)
+		}
+		list := message.Mutable(fieldDescriptor).List()
+		for i := 0; i < v.Len(); i++ {
+			element := list.NewElement()
+			element, err := t.items.value(element, v.Index(i).Interface())
+			if err != nil {
+				return err
+			}
+			list.Append(element)
+		}
+		return nil
+
+	case schema.MAP:
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Map {
+			return errors.Errorf("value of type %T is not a map", value)
+		}
+		entries := message.Mutable(fieldDescriptor).Map()
+		for _, key := range v.MapKeys() {
+			entry := entries.NewValue()
+			entry, err := t.items.value(entry, v.MapIndex(key).Interface())
+			if err != nil {
+				return err
+			}
+			entries.Set(protoreflect.ValueOfString(fmt.Sprint(key.Interface())).MapKey(), entry)
+		}
+		return nil
+
+	case schema.STRUCT:
+		nested := message.NewField(fieldDescriptor)
+		nested, err := t.value(nested, value)
+		if err != nil {
+			return err
+		}
+		message.Set(fieldDescriptor, nested)
+		return nil
+	}
+
+	scalar, err := t.value(protoreflect.Value{}, value)
+	if err != nil {
+		return err
+	}
+	message.Set(fieldDescriptor, scalar)
+	return nil
+}
+
+func (t *protobufType) value(
+	element protoreflect.Value, value any,
+) (protoreflect.Value, error) {
+
+	value = deref(value)
+	if value == nil {
+		return protoreflect.Value{}, errors.Errorf("protobuf cannot represent null elements")
+	}
+
+	switch t.kind {
+	case schema.INT8, schema.INT16, schema.INT32:
+		v, err := toInt64(value)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfInt32(int32(v)), nil
+	case schema.INT64:
+		v, err := toInt64(value)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfInt64(v), nil
+	case schema.FLOAT32:
+		v, err := toFloat64(value)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfFloat32(float32(v)), nil
+	case schema.FLOAT64:
+		v, err := toFloat64(value)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfFloat64(v), nil
+	case schema.BOOLEAN:
+		v, ok := value.(bool)
+		if !ok {
+			return protoreflect.Value{}, errors.Errorf("value of type %T is not a boolean", value)
+		}
+		return protoreflect.ValueOfBool(v), nil
+	case schema.STRING:
+		v, ok := value.(string)
+		if !ok {
+			v = fmt.Sprint(value)
+		}
+		return protoreflect.ValueOfString(v), nil
+	case schema.BYTES:
+		switch b := value.(type) {
+		case []byte:
+			return protoreflect.ValueOfBytes(b), nil
+		case string:
+			return protoreflect.ValueOfBytes([]byte(b)), nil
+		}
+		return protoreflect.Value{}, errors.Errorf("value of type %T is not a byte array", value)
+	case schema.STRUCT:
+		if err := t.populate(element.Message(), value); err != nil {
+			return protoreflect.Value{}, err
+		}
+		return element, nil
+	}
+	return protoreflect.Value{}, errors.Errorf("unsupported protobuf type %s", t.kind)
+}
+
+func classifyProtobufError(
+	err error,
+) error {
+
+	// Keeps the classification of the underlying publisher error
+	var publishingError *DescriptorPublishingError
+	if errors.As(err, &publishingError) {
+		return err
+	}
+	return sink.NonRetryable(err)
+}
+
+func protobufCamelCase(
+	name string,
+) string {
+
+	builder := strings.Builder{}
+	upper := true
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper && r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		upper = false
+		builder.WriteRune(r)
+	}
+	if builder.Len() == 0 {
+		return "Field"
+	}
+	if r := builder.String()[0]; r >= '0' && r <= '9' {
+		return "_" + builder.String()
+	}
+	return builder.String()
+}
@@ -0,0 +1,147 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package encoding
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProtobufEncoder_Marshal(
+	t *testing.T,
+) {
+
+	descriptors := make([]*ProtobufDescriptor, 0)
+	encoder := NewProtobufEncoder(func(descriptor *ProtobufDescriptor) error {
+		descriptors = append(descriptors, descriptor)
+		return nil
+	})
+
+	rowSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("foo.public.metrics.Value").
+		Field("id", 0, schema.Int64()).
+		Field("name", 1, schema.String().Optional()).
+		Field("tags", 2, schema.NewSchemaBuilder(schema.ARRAY).ValueSchema(schema.Int32())).
+		Field("labels", 3, schema.Map().KeySchema(schema.String()).ValueSchema(schema.String())).
+		Field("location", 4, schema.NewSchemaBuilder(schema.STRUCT).
+			SchemaName("io.debezium.data.geometry.Point").
+			Field("x", 0, schema.Float64()).
+			Field("y", 1, schema.Float64()),
+		)
+
+	envelopeSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("foo.public.metrics.Envelope").
+		Field(schema.FieldNameBefore, 0, rowSchema.Clone()).
+		Field(schema.FieldNameAfter, 1, rowSchema.Clone().Required()).
+		Field(schema.FieldNameOperation, 2, schema.String()).
+		Build()
+
+	envelope := schema.Envelope(envelopeSchema, schema.Struct{
+		schema.FieldNameAfter: schema.Struct{
+			"id":       int64(12),
+			"tags":     []int32{1, 2},
+			"labels":   map[string]string{"a": "b"},
+			"location": map[string]any{"x": 1.5, "y": 2.5},
+		},
+		schema.FieldNameOperation: "c",
+	})
+
+	data, descriptor, err := encoder.Marshal(envelope)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo.public.metrics.Envelope", descriptor.MessageName)
+	assert.Len(t, descriptors, 1)
+
+	// Second message with the same schema must not publish again
+	_, _, err = encoder.Marshal(envelope)
+	assert.NoError(t, err)
+	assert.Len(t, descriptors, 1)
+
+	// Decode the message using the published descriptor set only
+	descriptorSet := &descriptorpb.FileDescriptorSet{}
+	assert.NoError(t, proto.Unmarshal(descriptors[0].DescriptorSet, descriptorSet))
+	files, err := protodesc.NewFiles(descriptorSet)
+	assert.NoError(t, err)
+	messageDescriptor, err := files.FindDescriptorByName(protoreflect.FullName(descriptor.MessageName))
+	assert.NoError(t, err)
+
+	message := dynamicpb.NewMessage(messageDescriptor.(protoreflect.MessageDescriptor))
+	assert.NoError(t, proto.Unmarshal(data, message))
+
+	fields := message.Descriptor().Fields()
+	assert.False(t, message.Has(fields.ByName("before")))
+	assert.Equal(t, "c", message.Get(fields.ByName("op")).String())
+
+	after := message.Get(fields.ByName("after")).Message()
+	afterFields := after.Descriptor().Fields()
+	assert.Equal(t, int64(12), after.Get(afterFields.ByName("id")).Int())
+	assert.False(t, after.Has(afterFields.ByName("name")))
+
+	tags := after.Get(afterFields.ByName("tags")).List()
+	assert.Equal(t, 2, tags.Len())
+	assert.Equal(t, int64(2), tags.Get(1).Int())
+
+	labels := after.Get(afterFields.ByName("labels")).Map()
+	assert.Equal(t, "b", labels.Get(protoreflect.ValueOfString("a").MapKey()).String())
+
+	location := after.Get(afterFields.ByName("location")).Message()
+	assert.Equal(t, 2.5, location.Get(location.Descriptor().Fields().ByName("y")).Float())
+}
+
+func TestProtobufEncoder_Null_Elements(
+	t *testing.T,
+) {
+
+	encoder := NewProtobufEncoder(nil)
+
+	valueSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("foo.Value").
+		Field("tags", 0, schema.NewSchemaBuilder(schema.ARRAY).ValueSchema(schema.String())).
+		Build()
+
+	_, _, err := encoder.Marshal(schema.Envelope(valueSchema, schema.Struct{
+		"tags": []*string{nil},
+	}))
+	assert.Error(t, err)
+}
+
+func TestFileDescriptorPublisher(
+	t *testing.T,
+) {
+
+	directory := t.TempDir()
+	encoder := NewProtobufEncoder(NewFileDescriptorPublisher(directory))
+
+	valueSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("foo.Value").
+		Field("id", 0, schema.Int32()).
+		Build()
+
+	_, descriptor, err := encoder.Marshal(schema.Envelope(valueSchema, schema.Struct{"id": 1}))
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(directory, "foo.Value-"+descriptor.Fingerprint+".desc"))
+	assert.NoError(t, err)
+	assert.Equal(t, descriptor.DescriptorSet, data)
+}
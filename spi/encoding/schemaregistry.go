@@ -0,0 +1,145 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package encoding
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/goccy/go-json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+
+// SchemaRegistryError is returned when the schema registry
+// rejected a request, e.g. due to an incompatible schema
+type SchemaRegistryError struct {
+	StatusCode int
+	ErrorCode  int
+	Message    string
+}
+
+func (e *SchemaRegistryError) Error() string {
+	return fmt.Sprintf(
+		"schema registry rejected request with status %d (error code %d): %s",
+		e.StatusCode, e.ErrorCode, e.Message,
+	)
+}
+
+// Temporary returns true if the registry may
+// accept the request when retried later on
+func (e *SchemaRegistryError) Temporary() bool {
+	return e.StatusCode >= 500 ||
+		e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode == http.StatusTooManyRequests
+}
+
+// SchemaRegistryClient is a minimal client for the Confluent
+// compatible schema registry REST API
+type SchemaRegistryClient struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+}
+
+func NewSchemaRegistryClient(
+	registryUrl, username, password string,
+) *SchemaRegistryClient {
+
+	return &SchemaRegistryClient{
+		url:      strings.TrimSuffix(registryUrl, "/"),
+		username: username,
+		password: password,
+		client: &http.Client{
+			Timeout: time.Second * 30,
+		},
+	}
+}
+
+// Register registers the given schema under the subject and returns the
+// globally unique schema id. Registering an already known schema is
+// idempotent and returns the existing id.
+func (s *SchemaRegistryClient) Register(
+	subject, schemaType, schema string,
+) (int, error) {
+
+	request := map[string]any{
+		"schema": schema,
+	}
+	// The registry defaults to AVRO and older versions
+	// don't know the schemaType property at all
+	if schemaType != "" && schemaType != "AVRO" {
+		request["schemaType"] = schemaType
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return 0, err
+	}
+
+	requestUrl := fmt.Sprintf("%s/subjects/%s/versions", s.url, url.PathEscape(subject))
+	req, err := http.NewRequest(http.MethodPost, requestUrl, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", schemaRegistryContentType)
+	req.Header.Set("Accept", schemaRegistryContentType)
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		registryError := &SchemaRegistryError{
+			StatusCode: resp.StatusCode,
+			Message:    string(data),
+		}
+		errorResponse := struct {
+			ErrorCode int    `json:"error_code"`
+			Message   string `json:"message"`
+		}{}
+		if err := json.Unmarshal(data, &errorResponse); err == nil {
+			registryError.ErrorCode = errorResponse.ErrorCode
+			registryError.Message = errorResponse.Message
+		}
+		return 0, registryError
+	}
+
+	response := struct {
+		Id int `json:"id"`
+	}{}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return 0, errors.Wrap(err, 0)
+	}
+	return response.Id, nil
+}
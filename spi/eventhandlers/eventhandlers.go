@@ -58,6 +58,33 @@ type LogicalReplicationEventHandler interface {
 	OnMessageEvent(
 		xld pgtypes.XLogData, msg *pgtypes.LogicalReplicationMessage,
 	) error
+	OnStreamStartEvent(
+		xld pgtypes.XLogData, msg *pgtypes.StreamStartMessage,
+	) error
+	OnStreamStopEvent(
+		xld pgtypes.XLogData, msg *pgtypes.StreamStopMessage,
+	) error
+	OnStreamCommitEvent(
+		xld pgtypes.XLogData, msg *pgtypes.StreamCommitMessage,
+	) error
+	OnStreamAbortEvent(
+		xld pgtypes.XLogData, msg *pgtypes.StreamAbortMessage,
+	) error
+	OnStreamPrepareEvent(
+		xld pgtypes.XLogData, msg *pgtypes.StreamPrepareMessage,
+	) error
+	OnBeginPrepareEvent(
+		xld pgtypes.XLogData, msg *pgtypes.BeginPrepareMessage,
+	) error
+	OnPrepareEvent(
+		xld pgtypes.XLogData, msg *pgtypes.PrepareMessage,
+	) error
+	OnCommitPreparedEvent(
+		xld pgtypes.XLogData, msg *pgtypes.CommitPreparedMessage,
+	) error
+	OnRollbackPreparedEvent(
+		xld pgtypes.XLogData, msg *pgtypes.RollbackPreparedMessage,
+	) error
 }
 
 type RecordReplicationEventHandler interface {
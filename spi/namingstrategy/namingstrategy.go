@@ -37,4 +37,8 @@ type NamingStrategy interface {
 	MessageTopicName(
 		topicPrefix string,
 	) string
+	// TransactionTopicName generates a transaction metadata topic name
+	TransactionTopicName(
+		topicPrefix string,
+	) string
 }
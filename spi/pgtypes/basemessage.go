@@ -22,8 +22,13 @@ import (
 	"encoding/binary"
 	"fmt"
 	"github.com/jackc/pglogrepl"
+	"time"
 )
 
+// microsecFromUnixEpochToY2K is the number of microseconds between
+// the unix epoch and the PostgreSQL epoch (2000-01-01 00:00:00 UTC)
+const microsecFromUnixEpochToY2K = 946684800 * 1000000
+
 type baseMessage struct {
 	msgType pglogrepl.MessageType
 }
@@ -73,3 +78,26 @@ func (m *baseMessage) decodeLSN(
 
 	return pglogrepl.LSN(binary.BigEndian.Uint64(src)), 8
 }
+
+func (m *baseMessage) decodeTime(
+	src []byte,
+) (time.Time, int) {
+
+	microsecSinceY2K := int64(binary.BigEndian.Uint64(src))
+	microsecSinceUnixEpoch := microsecFromUnixEpochToY2K + microsecSinceY2K
+	return time.Unix(0, microsecSinceUnixEpoch*1000), 8
+}
+
+func (m *baseMessage) decodeUint32(
+	src []byte,
+) (uint32, int) {
+
+	return binary.BigEndian.Uint32(src), 4
+}
+
+func (m *baseMessage) lengthError(
+	name string, expectedLen, actualLen int,
+) error {
+
+	return fmt.Errorf("%s must have at least %d bytes, got %d bytes", name, expectedLen, actualLen)
+}
@@ -38,6 +38,15 @@ type XLogData struct {
 	LastBegin    LSN
 	LastCommit   LSN
 	Xid          uint32
+	// StreamXid is only set for changes of an in-progress (streamed)
+	// transaction and contains the (sub-)transaction id of the change
+	StreamXid *uint32
+}
+
+// IsStreamed returns true if the XLogData belongs to a change
+// of an in-progress transaction streamed by PostgreSQL 14+
+func (x XLogData) IsStreamed() bool {
+	return x.StreamXid != nil
 }
 
 type BeginMessage pglogrepl.BeginMessage
@@ -179,3 +188,59 @@ func (m DeleteMessage) String() string {
 	builder.WriteString("}")
 	return builder.String()
 }
+
+type StreamStartMessage pglogrepl.StreamStartMessageV2
+
+func (m StreamStartMessage) String() string {
+	builder := strings.Builder{}
+	builder.WriteString("{")
+	builder.WriteString(fmt.Sprintf("messageType:%s ", m.Type().String()))
+	builder.WriteString(fmt.Sprintf("xid:%d ", m.Xid))
+	builder.WriteString(fmt.Sprintf("firstSegment:%t", m.FirstSegment == 1))
+	builder.WriteString("}")
+	return builder.String()
+}
+
+type StreamStopMessage pglogrepl.StreamStopMessageV2
+
+func (m StreamStopMessage) String() string {
+	builder := strings.Builder{}
+	builder.WriteString("{")
+	builder.WriteString(fmt.Sprintf("messageType:%s", m.Type().String()))
+	builder.WriteString("}")
+	return builder.String()
+}
+
+type StreamCommitMessage pglogrepl.StreamCommitMessageV2
+
+func (m StreamCommitMessage) String() string {
+	builder := strings.Builder{}
+	builder.WriteString("{")
+	builder.WriteString(fmt.Sprintf("messageType:%s ", m.Type().String()))
+	builder.WriteString(fmt.Sprintf("xid:%d ", m.Xid))
+	builder.WriteString(fmt.Sprintf("flags:%d ", m.Flags))
+	builder.WriteString(fmt.Sprintf("commitLSN:%s ", m.CommitLSN))
+	builder.WriteString(fmt.Sprintf("transactionEndLSN:%s ", m.TransactionEndLSN))
+	builder.WriteString(fmt.Sprintf("commitTime:%s", m.CommitTime.String()))
+	builder.WriteString("}")
+	return builder.String()
+}
+
+type StreamAbortMessage pglogrepl.StreamAbortMessageV2
+
+func (m StreamAbortMessage) String() string {
+	builder := strings.Builder{}
+	builder.WriteString("{")
+	builder.WriteString(fmt.Sprintf("messageType:%s ", m.Type().String()))
+	builder.WriteString(fmt.Sprintf("xid:%d ", m.Xid))
+	builder.WriteString(fmt.Sprintf("subXid:%d", m.SubXid))
+	builder.WriteString("}")
+	return builder.String()
+}
+
+// IsTopLevel returns true if the abort message affects the
+// top-level transaction, and false if only a subtransaction
+// was rolled back
+func (m StreamAbortMessage) IsTopLevel() bool {
+	return m.Xid == m.SubXid
+}
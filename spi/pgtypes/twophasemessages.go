@@ -0,0 +1,326 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pgtypes
+
+import (
+	"fmt"
+	"github.com/jackc/pglogrepl"
+	"strings"
+	"time"
+)
+
+// Message types of the two-phase commit related messages sent by
+// pgoutput with protocol version 3+ (PostgreSQL 15+) if two_phase
+// is requested.
+const (
+	MessageTypeBeginPrepare     pglogrepl.MessageType = 'b'
+	MessageTypePrepare          pglogrepl.MessageType = 'P'
+	MessageTypeCommitPrepared   pglogrepl.MessageType = 'K'
+	MessageTypeRollbackPrepared pglogrepl.MessageType = 'r'
+	MessageTypeStreamPrepare    pglogrepl.MessageType = 'p'
+)
+
+// BeginPrepareMessage is the begin message of a prepared transaction.
+type BeginPrepareMessage struct {
+	baseMessage
+	// PrepareLSN is the LSN of the prepare
+	PrepareLSN pglogrepl.LSN
+	// EndPrepareLSN is the end LSN of the prepared transaction
+	EndPrepareLSN pglogrepl.LSN
+	// PrepareTime is the prepare timestamp of the transaction
+	PrepareTime time.Time
+	// Xid is the transaction id
+	Xid uint32
+	// Gid is the user defined global transaction id
+	Gid string
+}
+
+func (m *BeginPrepareMessage) Decode(
+	src []byte,
+) error {
+
+	if len(src) < 29 {
+		return m.lengthError("BeginPrepareMessage", 29, len(src))
+	}
+
+	var low, used int
+	m.PrepareLSN, used = m.decodeLSN(src)
+	low += used
+	m.EndPrepareLSN, used = m.decodeLSN(src[low:])
+	low += used
+	m.PrepareTime, used = m.decodeTime(src[low:])
+	low += used
+	m.Xid, used = m.decodeUint32(src[low:])
+	low += used
+	m.Gid, used = m.decodeString(src[low:])
+	if used < 0 {
+		return m.decodeStringError("BeginPrepareMessage", "Gid")
+	}
+
+	m.SetType(MessageTypeBeginPrepare)
+
+	return nil
+}
+
+func (m *BeginPrepareMessage) String() string {
+	builder := strings.Builder{}
+	builder.WriteString("{")
+	builder.WriteString(fmt.Sprintf("messageType:%s ", messageTypeName(m.Type())))
+	builder.WriteString(fmt.Sprintf("prepareLSN:%s ", m.PrepareLSN))
+	builder.WriteString(fmt.Sprintf("endPrepareLSN:%s ", m.EndPrepareLSN))
+	builder.WriteString(fmt.Sprintf("prepareTime:%s ", m.PrepareTime.String()))
+	builder.WriteString(fmt.Sprintf("xid:%d ", m.Xid))
+	builder.WriteString(fmt.Sprintf("gid:%s", m.Gid))
+	builder.WriteString("}")
+	return builder.String()
+}
+
+// PrepareMessage is the prepare message of a prepared transaction.
+type PrepareMessage struct {
+	baseMessage
+	// Flags currently unused (must be 0)
+	Flags uint8
+	// PrepareLSN is the LSN of the prepare
+	PrepareLSN pglogrepl.LSN
+	// EndPrepareLSN is the end LSN of the prepared transaction
+	EndPrepareLSN pglogrepl.LSN
+	// PrepareTime is the prepare timestamp of the transaction
+	PrepareTime time.Time
+	// Xid is the transaction id
+	Xid uint32
+	// Gid is the user defined global transaction id
+	Gid string
+}
+
+func (m *PrepareMessage) Decode(
+	src []byte,
+) error {
+
+	if err := m.decodePrepare("PrepareMessage", src); err != nil {
+		return err
+	}
+
+	m.SetType(MessageTypePrepare)
+
+	return nil
+}
+
+func (m *PrepareMessage) decodePrepare(
+	name string, src []byte,
+) error {
+
+	if len(src) < 30 {
+		return m.lengthError(name, 30, len(src))
+	}
+
+	var low, used int
+	m.Flags = src[0]
+	low += 1
+	m.PrepareLSN, used = m.decodeLSN(src[low:])
+	low += used
+	m.EndPrepareLSN, used = m.decodeLSN(src[low:])
+	low += used
+	m.PrepareTime, used = m.decodeTime(src[low:])
+	low += used
+	m.Xid, used = m.decodeUint32(src[low:])
+	low += used
+	m.Gid, used = m.decodeString(src[low:])
+	if used < 0 {
+		return m.decodeStringError(name, "Gid")
+	}
+	return nil
+}
+
+func (m *PrepareMessage) String() string {
+	builder := strings.Builder{}
+	builder.WriteString("{")
+	builder.WriteString(fmt.Sprintf("messageType:%s ", messageTypeName(m.Type())))
+	builder.WriteString(fmt.Sprintf("flags:%d ", m.Flags))
+	builder.WriteString(fmt.Sprintf("prepareLSN:%s ", m.PrepareLSN))
+	builder.WriteString(fmt.Sprintf("endPrepareLSN:%s ", m.EndPrepareLSN))
+	builder.WriteString(fmt.Sprintf("prepareTime:%s ", m.PrepareTime.String()))
+	builder.WriteString(fmt.Sprintf("xid:%d ", m.Xid))
+	builder.WriteString(fmt.Sprintf("gid:%s", m.Gid))
+	builder.WriteString("}")
+	return builder.String()
+}
+
+// StreamPrepareMessage is the prepare message of a streamed, prepared
+// transaction. It shares the layout of the PrepareMessage.
+type StreamPrepareMessage struct {
+	PrepareMessage
+}
+
+func (m *StreamPrepareMessage) Decode(
+	src []byte,
+) error {
+
+	if err := m.decodePrepare("StreamPrepareMessage", src); err != nil {
+		return err
+	}
+
+	m.SetType(MessageTypeStreamPrepare)
+
+	return nil
+}
+
+// CommitPreparedMessage is the commit message of a prepared transaction.
+type CommitPreparedMessage struct {
+	baseMessage
+	// Flags currently unused (must be 0)
+	Flags uint8
+	// CommitLSN is the LSN of the commit of the prepared transaction
+	CommitLSN pglogrepl.LSN
+	// EndCommitLSN is the end LSN of the commit of the prepared transaction
+	EndCommitLSN pglogrepl.LSN
+	// CommitTime is the commit timestamp of the transaction
+	CommitTime time.Time
+	// Xid is the transaction id
+	Xid uint32
+	// Gid is the user defined global transaction id
+	Gid string
+}
+
+func (m *CommitPreparedMessage) Decode(
+	src []byte,
+) error {
+
+	if len(src) < 30 {
+		return m.lengthError("CommitPreparedMessage", 30, len(src))
+	}
+
+	var low, used int
+	m.Flags = src[0]
+	low += 1
+	m.CommitLSN, used = m.decodeLSN(src[low:])
+	low += used
+	m.EndCommitLSN, used = m.decodeLSN(src[low:])
+	low += used
+	m.CommitTime, used = m.decodeTime(src[low:])
+	low += used
+	m.Xid, used = m.decodeUint32(src[low:])
+	low += used
+	m.Gid, used = m.decodeString(src[low:])
+	if used < 0 {
+		return m.decodeStringError("CommitPreparedMessage", "Gid")
+	}
+
+	m.SetType(MessageTypeCommitPrepared)
+
+	return nil
+}
+
+func (m *CommitPreparedMessage) String() string {
+	builder := strings.Builder{}
+	builder.WriteString("{")
+	builder.WriteString(fmt.Sprintf("messageType:%s ", messageTypeName(m.Type())))
+	builder.WriteString(fmt.Sprintf("flags:%d ", m.Flags))
+	builder.WriteString(fmt.Sprintf("commitLSN:%s ", m.CommitLSN))
+	builder.WriteString(fmt.Sprintf("endCommitLSN:%s ", m.EndCommitLSN))
+	builder.WriteString(fmt.Sprintf("commitTime:%s ", m.CommitTime.String()))
+	builder.WriteString(fmt.Sprintf("xid:%d ", m.Xid))
+	builder.WriteString(fmt.Sprintf("gid:%s", m.Gid))
+	builder.WriteString("}")
+	return builder.String()
+}
+
+// RollbackPreparedMessage is the rollback message of a prepared transaction.
+type RollbackPreparedMessage struct {
+	baseMessage
+	// Flags currently unused (must be 0)
+	Flags uint8
+	// EndPrepareLSN is the end LSN of the prepared transaction
+	EndPrepareLSN pglogrepl.LSN
+	// EndRollbackLSN is the end LSN of the rollback of the prepared transaction
+	EndRollbackLSN pglogrepl.LSN
+	// PrepareTime is the prepare timestamp of the transaction
+	PrepareTime time.Time
+	// RollbackTime is the rollback timestamp of the transaction
+	RollbackTime time.Time
+	// Xid is the transaction id
+	Xid uint32
+	// Gid is the user defined global transaction id
+	Gid string
+}
+
+func (m *RollbackPreparedMessage) Decode(
+	src []byte,
+) error {
+
+	if len(src) < 38 {
+		return m.lengthError("RollbackPreparedMessage", 38, len(src))
+	}
+
+	var low, used int
+	m.Flags = src[0]
+	low += 1
+	m.EndPrepareLSN, used = m.decodeLSN(src[low:])
+	low += used
+	m.EndRollbackLSN, used = m.decodeLSN(src[low:])
+	low += used
+	m.PrepareTime, used = m.decodeTime(src[low:])
+	low += used
+	m.RollbackTime, used = m.decodeTime(src[low:])
+	low += used
+	m.Xid, used = m.decodeUint32(src[low:])
+	low += used
+	m.Gid, used = m.decodeString(src[low:])
+	if used < 0 {
+		return m.decodeStringError("RollbackPreparedMessage", "Gid")
+	}
+
+	m.SetType(MessageTypeRollbackPrepared)
+
+	return nil
+}
+
+func (m *RollbackPreparedMessage) String() string {
+	builder := strings.Builder{}
+	builder.WriteString("{")
+	builder.WriteString(fmt.Sprintf("messageType:%s ", messageTypeName(m.Type())))
+	builder.WriteString(fmt.Sprintf("flags:%d ", m.Flags))
+	builder.WriteString(fmt.Sprintf("endPrepareLSN:%s ", m.EndPrepareLSN))
+	builder.WriteString(fmt.Sprintf("endRollbackLSN:%s ", m.EndRollbackLSN))
+	builder.WriteString(fmt.Sprintf("prepareTime:%s ", m.PrepareTime.String()))
+	builder.WriteString(fmt.Sprintf("rollbackTime:%s ", m.RollbackTime.String()))
+	builder.WriteString(fmt.Sprintf("xid:%d ", m.Xid))
+	builder.WriteString(fmt.Sprintf("gid:%s", m.Gid))
+	builder.WriteString("}")
+	return builder.String()
+}
+
+// messageTypeName extends the pglogrepl message type names
+// with the names of the two-phase commit message types
+func messageTypeName(
+	msgType pglogrepl.MessageType,
+) string {
+
+	switch msgType {
+	case MessageTypeBeginPrepare:
+		return "BeginPrepare"
+	case MessageTypePrepare:
+		return "Prepare"
+	case MessageTypeCommitPrepared:
+		return "CommitPrepared"
+	case MessageTypeRollbackPrepared:
+		return "RollbackPrepared"
+	case MessageTypeStreamPrepare:
+		return "StreamPrepare"
+	}
+	return msgType.String()
+}
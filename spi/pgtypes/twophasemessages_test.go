@@ -0,0 +1,95 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pgtypes
+
+import (
+	"encoding/binary"
+	"github.com/jackc/pglogrepl"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_ParseXlogData_PrepareMessage(
+	t *testing.T,
+) {
+
+	prepareTime := time.Date(2023, 7, 1, 12, 30, 0, 0, time.UTC)
+
+	data := []byte{byte(MessageTypePrepare), 0}
+	data = binary.BigEndian.AppendUint64(data, 0x1000)
+	data = binary.BigEndian.AppendUint64(data, 0x1080)
+	data = binary.BigEndian.AppendUint64(data, uint64(toPostgresTime(prepareTime)))
+	data = binary.BigEndian.AppendUint32(data, 4711)
+	data = append(data, []byte("gid-1\x00")...)
+
+	msg, err := ParseXlogData(data, nil)
+	assert.NoError(t, err)
+
+	prepareMsg, ok := msg.(*PrepareMessage)
+	assert.True(t, ok)
+	assert.Equal(t, MessageTypePrepare, prepareMsg.Type())
+	assert.Equal(t, pglogrepl.LSN(0x1000), prepareMsg.PrepareLSN)
+	assert.Equal(t, pglogrepl.LSN(0x1080), prepareMsg.EndPrepareLSN)
+	assert.True(t, prepareTime.Equal(prepareMsg.PrepareTime))
+	assert.Equal(t, uint32(4711), prepareMsg.Xid)
+	assert.Equal(t, "gid-1", prepareMsg.Gid)
+}
+
+func Test_ParseXlogData_RollbackPreparedMessage(
+	t *testing.T,
+) {
+
+	prepareTime := time.Date(2023, 7, 1, 12, 30, 0, 0, time.UTC)
+	rollbackTime := prepareTime.Add(time.Minute)
+
+	data := []byte{byte(MessageTypeRollbackPrepared), 0}
+	data = binary.BigEndian.AppendUint64(data, 0x1080)
+	data = binary.BigEndian.AppendUint64(data, 0x2000)
+	data = binary.BigEndian.AppendUint64(data, uint64(toPostgresTime(prepareTime)))
+	data = binary.BigEndian.AppendUint64(data, uint64(toPostgresTime(rollbackTime)))
+	data = binary.BigEndian.AppendUint32(data, 4711)
+	data = append(data, []byte("gid-1\x00")...)
+
+	msg, err := ParseXlogData(data, nil)
+	assert.NoError(t, err)
+
+	rollbackMsg, ok := msg.(*RollbackPreparedMessage)
+	assert.True(t, ok)
+	assert.Equal(t, pglogrepl.LSN(0x1080), rollbackMsg.EndPrepareLSN)
+	assert.Equal(t, pglogrepl.LSN(0x2000), rollbackMsg.EndRollbackLSN)
+	assert.True(t, prepareTime.Equal(rollbackMsg.PrepareTime))
+	assert.True(t, rollbackTime.Equal(rollbackMsg.RollbackTime))
+	assert.Equal(t, uint32(4711), rollbackMsg.Xid)
+	assert.Equal(t, "gid-1", rollbackMsg.Gid)
+}
+
+func Test_ParseXlogData_PrepareMessage_Too_Short(
+	t *testing.T,
+) {
+
+	_, err := ParseXlogData([]byte{byte(MessageTypePrepare), 0, 0, 0}, nil)
+	assert.Error(t, err)
+}
+
+func toPostgresTime(
+	t time.Time,
+) int64 {
+
+	return t.UnixMicro() - microsecFromUnixEpochToY2K
+}
@@ -18,6 +18,8 @@
 package pgtypes
 
 import (
+	"encoding/binary"
+	"github.com/go-errors/errors"
 	"github.com/jackc/pglogrepl"
 )
 
@@ -31,6 +33,19 @@ func ParseXlogData(
 	switch msgType {
 	case MessageTypeLogicalDecodingMessage:
 		decoder = new(LogicalReplicationMessage)
+	case MessageTypeBeginPrepare:
+		decoder = new(BeginPrepareMessage)
+	case MessageTypePrepare:
+		decoder = new(PrepareMessage)
+	case MessageTypeCommitPrepared:
+		decoder = new(CommitPreparedMessage)
+	case MessageTypeRollbackPrepared:
+		decoder = new(RollbackPreparedMessage)
+	case MessageTypeStreamPrepare:
+		decoder = new(StreamPrepareMessage)
+	case pglogrepl.MessageTypeStreamStart, pglogrepl.MessageTypeStreamStop,
+		pglogrepl.MessageTypeStreamCommit, pglogrepl.MessageTypeStreamAbort:
+		return parseStreamControlMessage(data)
 	}
 	if decoder != nil {
 		if err := decoder.Decode(data[1:]); err != nil {
@@ -51,3 +66,77 @@ func ParseXlogData(
 
 	return pglogrepl.Parse(data)
 }
+
+// ParseStreamedXlogData parses a message received between a Stream Start
+// and Stream Stop message of a streamed, in-progress transaction. Apart
+// from the control messages, all messages are prefixed with the
+// (sub-)transaction id, which is returned alongside the decoded message.
+// The returned messages are always the protocol version 1 message types.
+func ParseStreamedXlogData(
+	data []byte,
+) (pglogrepl.Message, uint32, error) {
+
+	msgType := pglogrepl.MessageType(data[0])
+	switch msgType {
+	case pglogrepl.MessageTypeStreamStart, pglogrepl.MessageTypeStreamStop,
+		pglogrepl.MessageTypeStreamCommit, pglogrepl.MessageTypeStreamAbort:
+		msg, err := parseStreamControlMessage(data)
+		return msg, 0, err
+	case MessageTypeLogicalDecodingMessage:
+		if len(data) < 5 {
+			return nil, 0, errors.Errorf("LogicalReplicationMessage in stream too short: %d", len(data))
+		}
+		xid := binary.BigEndian.Uint32(data[1:])
+		msg := new(LogicalReplicationMessage)
+		if err := msg.Decode(data[5:]); err != nil {
+			return nil, 0, err
+		}
+		if msg.IsTransactional() {
+			msg.Xid = &xid
+		}
+		return msg, xid, nil
+	}
+
+	msg, err := pglogrepl.ParseV2(data, true)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch m := msg.(type) {
+	case *pglogrepl.RelationMessageV2:
+		return &m.RelationMessage, m.Xid, nil
+	case *pglogrepl.TypeMessageV2:
+		return &m.TypeMessage, m.Xid, nil
+	case *pglogrepl.InsertMessageV2:
+		return &m.InsertMessage, m.Xid, nil
+	case *pglogrepl.UpdateMessageV2:
+		return &m.UpdateMessage, m.Xid, nil
+	case *pglogrepl.DeleteMessageV2:
+		return &m.DeleteMessage, m.Xid, nil
+	case *pglogrepl.TruncateMessageV2:
+		return &m.TruncateMessage, m.Xid, nil
+	}
+	return msg, 0, nil
+}
+
+func parseStreamControlMessage(
+	data []byte,
+) (pglogrepl.Message, error) {
+
+	msg, err := pglogrepl.ParseV2(data, false)
+	if err != nil {
+		return nil, err
+	}
+
+	switch m := msg.(type) {
+	case *pglogrepl.StreamStartMessageV2:
+		return (*StreamStartMessage)(m), nil
+	case *pglogrepl.StreamStopMessageV2:
+		return (*StreamStopMessage)(m), nil
+	case *pglogrepl.StreamCommitMessageV2:
+		return (*StreamCommitMessage)(m), nil
+	case *pglogrepl.StreamAbortMessageV2:
+		return (*StreamAbortMessage)(m), nil
+	}
+	return msg, nil
+}
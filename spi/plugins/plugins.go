@@ -22,10 +22,13 @@ package plugins
 import (
 	namingstrategyimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/namingstrategy"
 	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/transforming"
 	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
 	"github.com/noctarius/timescaledb-event-streamer/spi/namingstrategy"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
 	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
+	"github.com/noctarius/timescaledb-event-streamer/spi/transform"
 	"plugin"
 )
 
@@ -39,6 +42,12 @@ type ExtensionPoints interface {
 	RegisterSink(
 		name string, factory sink.Factory,
 	) bool
+	RegisterEncoder(
+		name string, factory encoding.EncoderFactory,
+	) bool
+	RegisterTransform(
+		name string, factory transform.Factory,
+	) bool
 }
 
 type PluginInitialize func(extensionPoints ExtensionPoints) error
@@ -88,3 +97,17 @@ func (*extensionPoints) RegisterSink(
 
 	return sinkimpl.RegisterSink(config.SinkType(name), factory)
 }
+
+func (*extensionPoints) RegisterEncoder(
+	name string, factory encoding.EncoderFactory,
+) bool {
+
+	return encoding.RegisterEncoder(config.EncodingType(name), factory)
+}
+
+func (*extensionPoints) RegisterTransform(
+	name string, factory transform.Factory,
+) bool {
+
+	return transforming.RegisterTransform(config.TransformType(name), factory)
+}
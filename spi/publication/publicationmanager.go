@@ -17,7 +17,10 @@
 
 package publication
 
-import "github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/sidechannel"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+)
 
 type PublicationManager interface {
 	PublicationName() string
@@ -38,4 +41,18 @@ type PublicationManager interface {
 	DetachTablesFromPublication(
 		entities ...systemcatalog.SystemEntity,
 	) error
+	// UpdatePublishedTables re-attaches the given, already published
+	// tables whose column list or row filter differs from the configured
+	// projection. It fails if projections are configured for them, but
+	// aren't supported by the PostgreSQL version.
+	UpdatePublishedTables(
+		entities ...systemcatalog.SystemEntity,
+	) error
+	// TableProjection returns the column list and row filter the
+	// given table (or the hypertable of the given chunk) is
+	// published with. The projection is empty if all columns
+	// and rows are published.
+	TableProjection(
+		entity systemcatalog.SystemEntity,
+	) (sidechannel.TableProjection, error)
 }
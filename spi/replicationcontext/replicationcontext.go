@@ -54,11 +54,21 @@ type ReplicationContext interface {
 		xld pgtypes.XLogData, processedLSN *pgtypes.LSN,
 	) error
 	LastProcessedLSN() pgtypes.LSN
+	// HoldProcessedLSN prevents the processed LSN from being advanced
+	// beyond the given LSN until the hold with the same id is released
+	HoldProcessedLSN(
+		id string, lsn pgtypes.LSN,
+	)
+	ReleaseProcessedLSN(
+		id string,
+	)
 	SetPositionLSNs(
 		receivedLSN, processedLSN pgtypes.LSN,
 	)
 
 	InitialSnapshotMode() spiconfig.InitialSnapshotMode
+	TransactionStreamingMode() spiconfig.TransactionStreamingMode
+	TwoPhaseMode() spiconfig.TwoPhaseMode
 	DatabaseUsername() string
 	ReplicationSlotName() string
 	ReplicationSlotCreate() bool
@@ -72,6 +82,8 @@ type ReplicationContext interface {
 	TimescaleVersion() version.TimescaleVersion
 	IsMinimumPostgresVersion() bool
 	IsPG14GE() bool
+	IsPG15GE() bool
+	IsPG16GE() bool
 	IsMinimumTimescaleVersion() bool
 	IsTSDB212GE() bool
 	IsLogicalReplicationEnabled() bool
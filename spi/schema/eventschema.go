@@ -30,6 +30,12 @@ const MessageBlockSchemaName = "io.debezium.connector.postgresql.Message"
 const MessageKeySchemaName = "io.debezium.connector.postgresql.MessageKey"
 const MessageValueSchemaName = "io.debezium.connector.postgresql.MessageValue"
 const TimescaleEventSchemaName = "com.timescale.Event"
+const TransactionKeySchemaName = "io.debezium.connector.common.TransactionMetadataKey"
+const TransactionValueSchemaName = "io.debezium.connector.common.TransactionMetadataValue"
+const TransactionBlockSchemaName = "event.block"
+const TransactionDataCollectionSchemaName = "event.collection"
+const OutboxKeySchemaName = "com.timescale.OutboxKey"
+const OutboxValueSchemaName = "com.timescale.OutboxEvent"
 
 type Operation string
 
@@ -43,6 +49,13 @@ const (
 	OP_TIMESCALE Operation = "$"
 )
 
+type TransactionStatus string
+
+const (
+	TX_BEGIN TransactionStatus = "BEGIN"
+	TX_END   TransactionStatus = "END"
+)
+
 type TimescaleOperation string
 
 const (
@@ -177,6 +190,135 @@ func DecompressionEvent(
 	return event
 }
 
+func BeginTransactionEvent(
+	id string, xid uint32, lsn pglogrepl.LSN, timestamp time.Time,
+) Struct {
+
+	return Struct{
+		FieldNameStatus:    string(TX_BEGIN),
+		FieldNameId:        id,
+		FieldNameTxId:      xid,
+		FieldNameLSN:       lsn.String(),
+		FieldNameTimestamp: timestamp.UnixMilli(),
+	}
+}
+
+func EndTransactionEvent(
+	id string, xid uint32, lsn pglogrepl.LSN, timestamp time.Time,
+	eventCount uint64, dataCollections []Struct,
+) Struct {
+
+	return Struct{
+		FieldNameStatus:          string(TX_END),
+		FieldNameId:              id,
+		FieldNameTxId:            xid,
+		FieldNameLSN:             lsn.String(),
+		FieldNameTimestamp:       timestamp.UnixMilli(),
+		FieldNameEventCount:      eventCount,
+		FieldNameDataCollections: dataCollections,
+	}
+}
+
+func TransactionDataCollection(
+	dataCollection string, eventCount uint64,
+) Struct {
+
+	return Struct{
+		FieldNameDataCollection: dataCollection,
+		FieldNameEventCount:     eventCount,
+	}
+}
+
+// TransactionBlock creates the transaction block added to events
+// which are emitted as part of a transaction
+func TransactionBlock(
+	id string, totalOrder, dataCollectionOrder uint64,
+) Struct {
+
+	return Struct{
+		FieldNameId:                  id,
+		FieldNameTotalOrder:          totalOrder,
+		FieldNameDataCollectionOrder: dataCollectionOrder,
+	}
+}
+
+// TransactionId creates the transaction identifier in the
+// format >>xid:lsn<< with the lsn being the commit LSN
+func TransactionId(
+	xid uint32, lsn pglogrepl.LSN,
+) string {
+
+	return fmt.Sprintf("%d:%d", xid, uint64(lsn))
+}
+
+// DeadLetterEvent wraps an event which couldn't be delivered to its
+// original topic with the error details. If the original envelope can't
+// be encoded, envelope is expected to be its string representation.
+func DeadLetterEvent(
+	topicName string, lsn *string, err error, timestamp time.Time, envelope any,
+) Struct {
+
+	event := Struct{
+		FieldNameTopic:     topicName,
+		FieldNameError:     err.Error(),
+		FieldNameTimestamp: timestamp.UnixMilli(),
+		FieldNameEnvelope:  envelope,
+	}
+	if lsn != nil {
+		event[FieldNameLSN] = *lsn
+	}
+	return event
+}
+
+// EnvelopeLSN returns the LSN from the source block of the given
+// event envelope, or nil if the envelope has no source block
+func EnvelopeLSN(
+	envelope Struct,
+) *string {
+
+	payload, ok := envelope[FieldNamePayload].(Struct)
+	if !ok {
+		return nil
+	}
+	source, ok := payload[FieldNameSource].(Struct)
+	if !ok {
+		return nil
+	}
+	if lsn, ok := source[FieldNameLSN].(string); ok {
+		return &lsn
+	}
+	return nil
+}
+
+func TransactionKey(
+	id string,
+) Struct {
+
+	return Struct{
+		FieldNameId: id,
+	}
+}
+
+func OutboxKey(
+	aggregateId string,
+) Struct {
+
+	return Struct{
+		FieldNameAggregateId: aggregateId,
+	}
+}
+
+func OutboxEvent(
+	id *string, eventType string, payload *string,
+) Struct {
+
+	return Struct{
+		FieldNameId:      id,
+		FieldNameType:    eventType,
+		FieldNamePayload: payload,
+	}
+}
+
 func MessageKey(
 	prefix string,
 ) Struct {
@@ -278,6 +420,7 @@ func EnvelopeSchema(
 		Field(FieldNameBefore, -1, hypertableSchema.Clone()).
 		Field(FieldNameAfter, -1, hypertableSchema.Clone().Required()).
 		Field(FieldNameSource, -1, SourceSchema()).
+		Field(FieldNameTransaction, -1, TransactionBlockSchema()).
 		Field(FieldNameOperation, -1, String().Required()).
 		Field(FieldNameTimescaleOp, -1, String()).
 		Field(FieldNameTimestamp, -1, Int64()).
@@ -305,6 +448,65 @@ func EnvelopeMessageSchema(
 	}
 }
 
+func OutboxKeySchema() Struct {
+	return NewSchemaBuilder(STRUCT).
+		SchemaName(OutboxKeySchemaName).
+		Required().
+		Field(FieldNameAggregateId, 0, String().Required()).
+		Build()
+}
+
+func OutboxValueSchema() Struct {
+	return NewSchemaBuilder(STRUCT).
+		SchemaName(OutboxValueSchemaName).
+		Required().
+		Field(FieldNameId, 0, String()).
+		Field(FieldNameType, 1, String().Required()).
+		Field(FieldNamePayload, 2, String()).
+		Build()
+}
+
+func TransactionKeySchema() Struct {
+	return NewSchemaBuilder(STRUCT).
+		SchemaName(TransactionKeySchemaName).
+		Required().
+		Field(FieldNameId, 0, String().Required()).
+		Build()
+}
+
+func TransactionValueSchema() Struct {
+	dataCollectionSchema := NewSchemaBuilder(STRUCT).
+		SchemaName(TransactionDataCollectionSchemaName).
+		Required().
+		Field(FieldNameDataCollection, 0, String().Required()).
+		Field(FieldNameEventCount, 1, Int64().Required())
+
+	return NewSchemaBuilder(STRUCT).
+		SchemaName(TransactionValueSchemaName).
+		Required().
+		Field(FieldNameStatus, 0, String().Required()).
+		Field(FieldNameId, 1, String().Required()).
+		Field(FieldNameTxId, 2, Int64().Required()).
+		Field(FieldNameLSN, 3, String().Required()).
+		Field(FieldNameTimestamp, 4, Int64().Required()).
+		Field(FieldNameEventCount, 5, Int64()).
+		Field(FieldNameDataCollections, 6, NewSchemaBuilder(ARRAY).
+			Optional().
+			ValueSchema(dataCollectionSchema),
+		).
+		Build()
+}
+
+func TransactionBlockSchema() Builder {
+	return NewSchemaBuilder(STRUCT).
+		FieldName(FieldNameTransaction).
+		SchemaName(TransactionBlockSchemaName).
+		Optional().
+		Field(FieldNameId, 0, String().Required()).
+		Field(FieldNameTotalOrder, 1, Int64().Required()).
+		Field(FieldNameDataCollectionOrder, 2, Int64().Required())
+}
+
 func SourceSchema() Builder {
 	return NewSchemaBuilder(STRUCT).
 		FieldName(FieldNameSource).
@@ -313,12 +515,12 @@ func SourceSchema() Builder {
 		Field(FieldNameVersion, -1, String().Required()).
 		Field(FieldNameConnector, -1, String().Required()).
 		Field(FieldNameName, -1, String().Required()).
-		Field(FieldNameTimestamp, -1, String().Required()).
+		Field(FieldNameTimestamp, -1, Int64().Required()).
 		Field(FieldNameSnapshot, -1, Boolean().DefaultValue(lo.ToPtr("false"))).
 		Field(FieldNameSchema, -1, String().Required()).
 		Field(FieldNameTable, -1, String().Required()).
 		Field(FieldNameTxId, -1, Int64()).
-		Field(FieldNameLSN, -1, Int64()).
+		Field(FieldNameLSN, -1, String()).
 		Field(FieldNameXmin, -1, Int64())
 }
 
@@ -0,0 +1,109 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+)
+
+// DefaultInstanceCacheSize is the number of schema instances
+// kept by the instance caches of encoders and transformations
+const DefaultInstanceCacheSize = 1024
+
+type instanceCacheKey struct {
+	qualifier string
+	instance  uintptr
+}
+
+type instanceCacheEntry[V any] struct {
+	key    instanceCacheKey
+	schema Struct // keeps the schema alive, its address isn't reused while cached
+	value  V
+}
+
+// InstanceCache caches values derived from schema definitions by the
+// schema instance. Since schema definitions are created once per table
+// and schema version, the instance is a cheap and stable cache key. The
+// number of cached instances is bounded, the least recently used instance
+// is evicted, so that outdated schema versions and schemas of dropped
+// tables aren't kept forever.
+type InstanceCache[V any] struct {
+	mutex   sync.Mutex
+	maxSize int
+	entries map[instanceCacheKey]*list.Element
+	lru     *list.List
+}
+
+func NewInstanceCache[V any](
+	maxSize int,
+) *InstanceCache[V] {
+
+	return &InstanceCache[V]{
+		maxSize: maxSize,
+		entries: make(map[instanceCacheKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// GetOrCreate returns the value cached for the schema instance and the
+// optional qualifier, or creates it using the given function. Failed
+// creations aren't cached.
+func (c *InstanceCache[V]) GetOrCreate(
+	qualifier string, schema Struct, fn func(schema Struct) (V, error),
+) (V, error) {
+
+	key := instanceCacheKey{
+		qualifier: qualifier,
+		instance:  reflect.ValueOf(schema).Pointer(),
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, present := c.entries[key]; present {
+		c.lru.MoveToFront(element)
+		return element.Value.(*instanceCacheEntry[V]).value, nil
+	}
+
+	value, err := fn(schema)
+	if err != nil {
+		return value, err
+	}
+
+	c.entries[key] = c.lru.PushFront(&instanceCacheEntry[V]{
+		key:    key,
+		schema: schema,
+		value:  value,
+	})
+
+	for c.lru.Len() > c.maxSize {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*instanceCacheEntry[V]).key)
+	}
+	return value, nil
+}
+
+// Len returns the number of cached schema instances
+func (c *InstanceCache[V]) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lru.Len()
+}
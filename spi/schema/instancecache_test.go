@@ -0,0 +1,95 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInstanceCache_Caches_By_Instance(
+	t *testing.T,
+) {
+
+	cache := NewInstanceCache[int](10)
+	calls := 0
+	create := func(_ Struct) (int, error) {
+		calls++
+		return calls, nil
+	}
+
+	first := Struct{FieldNameType: STRUCT}
+	second := Struct{FieldNameType: STRUCT}
+
+	value, _ := cache.GetOrCreate("", first, create)
+	assert.Equal(t, 1, value)
+	value, _ = cache.GetOrCreate("", first, create)
+	assert.Equal(t, 1, value)
+
+	// Equal, but different schema instances and qualifiers are cached separately
+	value, _ = cache.GetOrCreate("", second, create)
+	assert.Equal(t, 2, value)
+	value, _ = cache.GetOrCreate("subject", first, create)
+	assert.Equal(t, 3, value)
+}
+
+func TestInstanceCache_Evicts_Least_Recently_Used(
+	t *testing.T,
+) {
+
+	cache := NewInstanceCache[string](2)
+	create := func(schema Struct) (string, error) {
+		return schema[FieldNameName].(string), nil
+	}
+
+	first := Struct{FieldNameName: "first"}
+	second := Struct{FieldNameName: "second"}
+	third := Struct{FieldNameName: "third"}
+
+	_, _ = cache.GetOrCreate("", first, create)
+	_, _ = cache.GetOrCreate("", second, create)
+	_, _ = cache.GetOrCreate("", first, create)
+	_, _ = cache.GetOrCreate("", third, create)
+	assert.Equal(t, 2, cache.Len())
+
+	created := false
+	_, _ = cache.GetOrCreate("", first, func(_ Struct) (string, error) {
+		created = true
+		return "", nil
+	})
+	assert.False(t, created)
+
+	_, _ = cache.GetOrCreate("", second, func(_ Struct) (string, error) {
+		created = true
+		return "", nil
+	})
+	assert.True(t, created)
+}
+
+func TestInstanceCache_Doesnt_Cache_Failures(
+	t *testing.T,
+) {
+
+	cache := NewInstanceCache[int](10)
+	_, err := cache.GetOrCreate("", Struct{}, func(_ Struct) (int, error) {
+		return 0, errors.Errorf("failed")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, cache.Len())
+}
@@ -35,6 +35,8 @@ type NameGenerator interface {
 	) string
 	// MessageTopicName generates a message topic name for a replication message
 	MessageTopicName() string
+	// TransactionTopicName generates a topic name for transaction metadata events
+	TransactionTopicName() string
 }
 
 func NewNameGeneratorFromConfig(
@@ -76,3 +78,7 @@ func (n *nameGenerator) SchemaTopicName(
 func (n *nameGenerator) MessageTopicName() string {
 	return n.namingStrategy.MessageTopicName(n.topicPrefix)
 }
+
+func (n *nameGenerator) TransactionTopicName() string {
+	return n.namingStrategy.TransactionTopicName(n.topicPrefix)
+}
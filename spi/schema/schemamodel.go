@@ -79,6 +79,18 @@ const (
 	FieldNameValueSchema FieldName = "valueSchema"
 	FieldNameAllowed     FieldName = "allowed"
 	FieldNameLength      FieldName = "length"
+
+	FieldNameStatus              FieldName = "status"
+	FieldNameId                  FieldName = "id"
+	FieldNameEventCount          FieldName = "event_count"
+	FieldNameDataCollections     FieldName = "data_collections"
+	FieldNameDataCollection      FieldName = "data_collection"
+	FieldNameTotalOrder          FieldName = "total_order"
+	FieldNameDataCollectionOrder FieldName = "data_collection_order"
+	FieldNameTopic               FieldName = "topic"
+	FieldNameError               FieldName = "error"
+	FieldNameEnvelope            FieldName = "envelope"
+	FieldNameAggregateId         FieldName = "aggregateid"
 )
 
 type Struct = map[FieldName]any
@@ -0,0 +1,198 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sidechannel
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"strings"
+	"unicode"
+)
+
+// TableProjection restricts a table to a subset of its columns
+// and rows. It mirrors the column list and row filter a table is
+// attached to the publication with (PostgreSQL 15+), and is used
+// to keep snapshot reads in line with the replicated events. An
+// empty column list selects all columns, an empty row filter
+// selects all rows.
+type TableProjection struct {
+	Columns   []string
+	RowFilter string
+}
+
+// IsEmpty returns true if the projection selects all
+// columns and rows of the table.
+func (tp TableProjection) IsEmpty() bool {
+	return len(tp.Columns) == 0 && tp.RowFilter == ""
+}
+
+// Equal returns true if both projections select the same columns,
+// independent of their order, and have the same row filter.
+func (tp TableProjection) Equal(
+	other TableProjection,
+) bool {
+
+	if len(tp.Columns) != len(other.Columns) || tp.RowFilter != other.RowFilter {
+		return false
+	}
+	selected := make(map[string]bool, len(tp.Columns))
+	for _, column := range tp.Columns {
+		selected[column] = true
+	}
+	for _, column := range other.Columns {
+		if !selected[column] {
+			return false
+		}
+	}
+	return true
+}
+
+// AsSqlColumnList returns the quoted, comma separated column
+// list, or * if all columns are selected.
+func (tp TableProjection) AsSqlColumnList() string {
+	if len(tp.Columns) == 0 {
+		return "*"
+	}
+	return quoteIdentifiers(tp.Columns)
+}
+
+// AsSqlCondition returns the row filter as a parenthesized SQL
+// condition, or an empty string if no row filter is defined.
+func (tp TableProjection) AsSqlCondition() string {
+	if tp.RowFilter == "" {
+		return ""
+	}
+	return fmt.Sprintf("(%s)", tp.RowFilter)
+}
+
+// ValidateReplicaIdentity checks that the projection can be used for
+// tables with the given columns and replica identity columns. PostgreSQL
+// requires column lists to include all replica identity columns, and row
+// filters to only reference replica identity columns. Otherwise, it rejects
+// UPDATE and DELETE statements on the table once it is published.
+func (tp TableProjection) ValidateReplicaIdentity(
+	columns, identityColumns []string,
+) error {
+
+	identity := make(map[string]bool, len(identityColumns))
+	for _, column := range identityColumns {
+		identity[column] = true
+	}
+
+	if len(tp.Columns) > 0 {
+		selected := make(map[string]bool, len(tp.Columns))
+		for _, column := range tp.Columns {
+			selected[column] = true
+		}
+		for _, column := range identityColumns {
+			if !selected[column] {
+				return errors.Errorf("column list doesn't include replica identity column '%s'", column)
+			}
+		}
+	}
+
+	for _, column := range tp.rowFilterColumns(columns) {
+		if !identity[column] {
+			return errors.Errorf("row filter references column '%s', which isn't part of the replica identity", column)
+		}
+	}
+	return nil
+}
+
+// rowFilterColumns returns the given columns referenced by the row
+// filter. Unquoted identifiers are folded to lower case, as PostgreSQL
+// does, string literals are skipped.
+func (tp TableProjection) rowFilterColumns(
+	columns []string,
+) []string {
+
+	identifiers := make(map[string]bool)
+	filter := []rune(tp.RowFilter)
+	for i := 0; i < len(filter); i++ {
+		switch r := filter[i]; {
+		case r == '\'' || r == '"':
+			end := i + 1
+			value := strings.Builder{}
+			for ; end < len(filter); end++ {
+				if filter[end] == r {
+					// Doubled quotes are escaped quotes
+					if end+1 < len(filter) && filter[end+1] == r {
+						value.WriteRune(r)
+						end++
+						continue
+					}
+					break
+				}
+				value.WriteRune(filter[end])
+			}
+			if r == '"' {
+				identifiers[value.String()] = true
+			}
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			end := i
+			for end < len(filter) && (unicode.IsLetter(filter[end]) || unicode.IsDigit(filter[end]) ||
+				filter[end] == '_' || filter[end] == '$') {
+				end++
+			}
+			identifiers[strings.ToLower(string(filter[i:end]))] = true
+			i = end - 1
+		}
+	}
+
+	referenced := make([]string, 0)
+	for _, column := range columns {
+		if identifiers[column] {
+			referenced = append(referenced, column)
+		}
+	}
+	return referenced
+}
+
+// PublicationTable defines a table (or chunk) to be attached
+// to a publication, optionally with a projection.
+type PublicationTable struct {
+	TableProjection
+	Entity systemcatalog.SystemEntity
+}
+
+// AsSqlTableSpec returns the table specification as used by the
+// ALTER PUBLICATION ... ADD TABLE command, e.g.
+// "schema"."table" ("col1","col2") WHERE (filter).
+func (pt PublicationTable) AsSqlTableSpec() string {
+	builder := strings.Builder{}
+	builder.WriteString(pt.Entity.CanonicalName())
+	if len(pt.Columns) > 0 {
+		builder.WriteString(fmt.Sprintf(" (%s)", quoteIdentifiers(pt.Columns)))
+	}
+	if pt.RowFilter != "" {
+		builder.WriteString(fmt.Sprintf(" WHERE %s", pt.AsSqlCondition()))
+	}
+	return builder.String()
+}
+
+func quoteIdentifiers(
+	identifiers []string,
+) string {
+
+	quoted := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		quoted[i] = fmt.Sprintf("\"%s\"", strings.ReplaceAll(identifier, "\"", "\"\""))
+	}
+	return strings.Join(quoted, ",")
+}
@@ -0,0 +1,109 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sidechannel
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTableProjection_Empty(
+	t *testing.T,
+) {
+
+	projection := TableProjection{}
+	assert.True(t, projection.IsEmpty())
+	assert.Equal(t, "*", projection.AsSqlColumnList())
+	assert.Equal(t, "", projection.AsSqlCondition())
+}
+
+func TestTableProjection_Columns_And_Filter(
+	t *testing.T,
+) {
+
+	projection := TableProjection{
+		Columns:   []string{"ts", "value", "weird\"name"},
+		RowFilter: "value > 10",
+	}
+	assert.False(t, projection.IsEmpty())
+	assert.Equal(t, `"ts","value","weird""name"`, projection.AsSqlColumnList())
+	assert.Equal(t, "(value > 10)", projection.AsSqlCondition())
+}
+
+func TestTableProjection_Equal(
+	t *testing.T,
+) {
+
+	projection := TableProjection{Columns: []string{"ts", "value"}, RowFilter: "(value > 10)"}
+	assert.True(t, projection.Equal(TableProjection{Columns: []string{"value", "ts"}, RowFilter: "(value > 10)"}))
+	assert.False(t, projection.Equal(TableProjection{Columns: []string{"ts"}, RowFilter: "(value > 10)"}))
+	assert.False(t, projection.Equal(TableProjection{Columns: []string{"ts", "device"}, RowFilter: "(value > 10)"}))
+	assert.False(t, projection.Equal(TableProjection{Columns: []string{"ts", "value"}}))
+	assert.True(t, TableProjection{}.Equal(TableProjection{Columns: []string{}}))
+}
+
+func TestPublicationTable_AsSqlTableSpec(
+	t *testing.T,
+) {
+
+	hypertable := systemcatalog.NewHypertable(
+		1, "public", "metrics", "_timescaledb_internal", "_hyper_1", nil, 0, nil, nil, pgtypes.DEFAULT,
+	)
+
+	table := PublicationTable{Entity: hypertable}
+	assert.Equal(t, `"public"."metrics"`, table.AsSqlTableSpec())
+
+	table.Columns = []string{"ts", "value"}
+	assert.Equal(t, `"public"."metrics" ("ts","value")`, table.AsSqlTableSpec())
+
+	table.RowFilter = "value > 10"
+	assert.Equal(t, `"public"."metrics" ("ts","value") WHERE (value > 10)`, table.AsSqlTableSpec())
+
+	table.Columns = nil
+	assert.Equal(t, `"public"."metrics" WHERE (value > 10)`, table.AsSqlTableSpec())
+}
+
+func TestTableProjection_ValidateReplicaIdentity(
+	t *testing.T,
+) {
+
+	columns := []string{"ts", "id", "value", "Mixed"}
+	identityColumns := []string{"ts", "id"}
+
+	projection := TableProjection{Columns: []string{"ts", "id", "value"}, RowFilter: "id > 10"}
+	assert.NoError(t, projection.ValidateReplicaIdentity(columns, identityColumns))
+
+	// Column lists must include all replica identity columns
+	projection = TableProjection{Columns: []string{"ts", "value"}}
+	assert.Error(t, projection.ValidateReplicaIdentity(columns, identityColumns))
+
+	// Row filters must only reference replica identity columns
+	projection = TableProjection{RowFilter: "value > 10"}
+	assert.Error(t, projection.ValidateReplicaIdentity(columns, identityColumns))
+	projection = TableProjection{RowFilter: `"Mixed" IS NOT NULL`}
+	assert.Error(t, projection.ValidateReplicaIdentity(columns, identityColumns))
+
+	// String literals and unquoted identifiers not matching a column aren't references
+	projection = TableProjection{RowFilter: "ID = 1 AND ts > now() - '1 value'::interval AND mixed IS NULL"}
+	assert.NoError(t, projection.ValidateReplicaIdentity(columns, identityColumns))
+
+	// With REPLICA IDENTITY FULL, all columns are replica identity columns
+	projection = TableProjection{RowFilter: "value > 10"}
+	assert.NoError(t, projection.ValidateReplicaIdentity(columns, columns))
+}
@@ -89,31 +89,51 @@ type SideChannel interface {
 		tables ...*systemcatalog.PgTable,
 	) error
 	AttachTablesToPublication(
-		publicationName string, entities ...systemcatalog.SystemEntity,
+		publicationName string, tables ...PublicationTable,
 	) error
 	DetachTablesFromPublication(
 		publicationName string, entities ...systemcatalog.SystemEntity,
 	) error
 	SnapshotChunkTable(
 		rowDecoderFactory pgtypes.RowDecoderFactory, chunk *systemcatalog.Chunk,
-		snapshotBatchSize int, cb SnapshotRowCallback,
+		projection TableProjection, snapshotBatchSize int, cb SnapshotRowCallback,
 	) (lsn pgtypes.LSN, err error)
 	FetchTableSnapshotBatch(
 		rowDecoderFactory pgtypes.RowDecoderFactory, table systemcatalog.BaseTable,
-		snapshotName string, snapshotBatchSize int, cb SnapshotRowCallback,
+		projection TableProjection, snapshotName string, snapshotBatchSize int, cb SnapshotRowCallback,
 	) error
 	ReadSnapshotHighWatermark(
-		rowDecoderFactory pgtypes.RowDecoderFactory, table systemcatalog.BaseTable, snapshotName string,
+		rowDecoderFactory pgtypes.RowDecoderFactory, table systemcatalog.BaseTable,
+		projection TableProjection, snapshotName string,
 	) (values map[string]any, err error)
+	DeleteRows(
+		entity systemcatalog.SystemEntity, column string, values []any,
+	) (deleted int64, err error)
 	ReadReplicaIdentity(
 		schemaName, tableName string,
 	) (identity pgtypes.ReplicaIdentity, err error)
+	ReadReplicaIdentityColumns(
+		schemaName, tableName string,
+	) (columns, identityColumns []string, err error)
 	ReadContinuousAggregate(
 		materializedHypertableId int32,
 	) (viewSchema, viewName string, found bool, err error)
 	ReadPublishedTables(
 		publicationName string,
 	) (entities []systemcatalog.SystemEntity, err error)
+	// ReadPublishedTableProjections returns the column lists and row
+	// filters of the published tables by their canonical name. It
+	// requires PostgreSQL 15 or later.
+	ReadPublishedTableProjections(
+		publicationName string,
+	) (projections map[string]TableProjection, err error)
+	// ReplacePublishedTables re-attaches already published tables with
+	// their projection in a single transaction, and returns the tables
+	// whose published projection actually changed. If none changed,
+	// the transaction is rolled back.
+	ReplacePublishedTables(
+		publicationName string, tables ...PublicationTable,
+	) (changed []PublicationTable, err error)
 	ReadReplicationSlot(
 		slotName string,
 	) (pluginName, slotType string, restartLsn, confirmedFlushLsn pgtypes.LSN, err error)
@@ -0,0 +1,148 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sink
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+)
+
+// NonRetryableError marks an emission error which will fail again
+// when retried, for example an event which can't be encoded or is
+// permanently rejected by the target system.
+type NonRetryableError struct {
+	Err error
+}
+
+// NonRetryable marks the given error as non-retryable. Sinks use it
+// to classify errors which can't be resolved by retrying.
+func NonRetryable(
+	err error,
+) error {
+
+	if err == nil {
+		return nil
+	}
+	return &NonRetryableError{Err: err}
+}
+
+// IsNonRetryable returns true if the error, or any error it wraps,
+// was marked as non-retryable
+func IsNonRetryable(
+	err error,
+) bool {
+
+	var nonRetryableError *NonRetryableError
+	return errors.As(err, &nonRetryableError)
+}
+
+func (e *NonRetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *NonRetryableError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError is returned by batch sinks which can't emit a batch
+// atomically, if only some of its records failed. It carries the
+// errors of the failed records by their index in the batch, all
+// other records were emitted.
+type BatchError struct {
+	Errors map[int]error
+}
+
+// NewBatchError creates a batch error from the errors of the failed
+// records, or returns nil if no record failed. The batch error is
+// non-retryable if all failed records were rejected permanently.
+func NewBatchError(
+	errs map[int]error,
+) error {
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	batchErr := &BatchError{Errors: errs}
+	for _, err := range errs {
+		if !IsNonRetryable(err) {
+			return batchErr
+		}
+	}
+	return NonRetryable(batchErr)
+}
+
+// AsBatchError returns the batch error the given error is,
+// or wraps, if any
+func AsBatchError(
+	err error,
+) (*BatchError, bool) {
+
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr, true
+	}
+	return nil, false
+}
+
+// RemapBatchError maps the record indices of a batch error, returned
+// for a sub-batch, to the given indices of the records in the original
+// batch. Other errors are returned as is.
+func RemapBatchError(
+	err error, indices []int,
+) error {
+
+	batchErr, ok := AsBatchError(err)
+	if !ok {
+		return err
+	}
+
+	errs := make(map[int]error, len(batchErr.Errors))
+	for index, recordErr := range batchErr.Errors {
+		errs[indices[index]] = recordErr
+	}
+	return NewBatchError(errs)
+}
+
+// AwaitBatch waits for the futures of all records of a batch and
+// returns a batch error for the failed records, if any
+func AwaitBatch(
+	futures []Future,
+) error {
+
+	errs := make(map[int]error)
+	for index, future := range futures {
+		<-future.Done()
+		if err := future.Err(); err != nil {
+			errs[index] = err
+		}
+	}
+	return NewBatchError(errs)
+}
+
+func (e *BatchError) Error() string {
+	first := -1
+	for index := range e.Errors {
+		if first == -1 || index < first {
+			first = index
+		}
+	}
+	return fmt.Sprintf(
+		"%d records of the batch failed, first record %d: %s", len(e.Errors), first, e.Errors[first],
+	)
+}
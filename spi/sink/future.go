@@ -0,0 +1,82 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sink
+
+import "sync"
+
+// Future represents the pending result of an asynchronously
+// emitted event
+type Future interface {
+	// Done returns a channel which is closed as soon as the
+	// emission is completed, either successfully or failed
+	Done() <-chan struct{}
+	// Err returns the error of a failed emission, or nil if
+	// the emission was successful or isn't completed yet
+	Err() error
+}
+
+// CompletableFuture is a Future implementation which is
+// completed by the sink when the emission is acknowledged
+// by the target system
+type CompletableFuture struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func NewCompletableFuture() *CompletableFuture {
+	return &CompletableFuture{
+		done: make(chan struct{}),
+	}
+}
+
+// CompletedFuture returns an already completed Future
+// with the given error (or nil for a successful result)
+func CompletedFuture(
+	err error,
+) Future {
+
+	future := NewCompletableFuture()
+	future.Complete(err)
+	return future
+}
+
+// Complete completes the future with the given error, or nil
+// for a successful emission. Only the first call has an effect.
+func (f *CompletableFuture) Complete(
+	err error,
+) {
+
+	f.once.Do(func() {
+		f.err = err
+		close(f.done)
+	})
+}
+
+func (f *CompletableFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+func (f *CompletableFuture) Err() error {
+	select {
+	case <-f.done:
+		return f.err
+	default:
+		return nil
+	}
+}
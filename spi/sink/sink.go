@@ -33,6 +33,37 @@ type Sink interface {
 	) error
 }
 
+// AsyncSink is an optional extension to the Sink interface. Sinks
+// implementing it accept events asynchronously and complete the returned
+// Future when the event is acknowledged by the target system. Events
+// emitted to the same topic must be delivered in the order of the calls.
+type AsyncSink interface {
+	Sink
+	EmitAsync(
+		context Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+	) Future
+}
+
+// Record is a single event of a batch handed to a BatchSink
+type Record struct {
+	Timestamp time.Time
+	TopicName string
+	Key       schema.Struct
+	Envelope  schema.Struct
+}
+
+// BatchSink is an optional extension to the Sink interface. Sinks
+// implementing it receive multiple events at once and emit them using
+// the native batch API of the target system. Records are in emission
+// order. Sinks which can't emit a batch atomically report the failed
+// records of a partially emitted batch using a BatchError.
+type BatchSink interface {
+	Sink
+	EmitBatch(
+		context Context, records []Record,
+	) error
+}
+
 type SinkFunc func(context Context, timestamp time.Time, topicName string, key, envelope schema.Struct) error
 
 func (sf SinkFunc) Start() error {
@@ -49,3 +80,24 @@ func (sf SinkFunc) Emit(
 
 	return sf(context, timestamp, topicName, key, envelope)
 }
+
+// EmitEach emits the records of a batch one by one, for sinks which
+// don't implement BatchSink. Records after a failed one aren't emitted,
+// to keep their order, and are reported as failed by a BatchError.
+func EmitEach(
+	s Sink, context Context, records []Record,
+) error {
+
+	for index, record := range records {
+		if err := s.Emit(
+			context, record.Timestamp, record.TopicName, record.Key, record.Envelope,
+		); err != nil {
+			errs := make(map[int]error, len(records)-index)
+			for ; index < len(records); index++ {
+				errs[index] = err
+			}
+			return NewBatchError(errs)
+		}
+	}
+	return nil
+}
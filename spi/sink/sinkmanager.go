@@ -28,4 +28,16 @@ type Manager interface {
 	Emit(
 		timestamp time.Time, topicName string, key, envelope schema.Struct,
 	) error
+	// EmitAsync emits the event asynchronously if the underlying sink
+	// implements AsyncSink, otherwise the event is emitted synchronously
+	// and an already completed Future is returned.
+	EmitAsync(
+		timestamp time.Time, topicName string, key, envelope schema.Struct,
+	) Future
+	// EmitBatch emits all records at once if the underlying sink
+	// implements BatchSink, otherwise the records are emitted one
+	// by one.
+	EmitBatch(
+		records []Record,
+	) error
 }
@@ -34,6 +34,12 @@ type Stream interface {
 	Emit(
 		key, envelope schema.Struct,
 	) error
+	EmitAsync(
+		key, envelope schema.Struct,
+	) sink.Future
+	Record(
+		key, envelope schema.Struct,
+	) sink.Record
 }
 
 type tableStreamImpl struct {
@@ -104,6 +110,25 @@ func (s *tableStreamImpl) Emit(
 	return s.sinkManager.Emit(time.Now(), s.topicName, key, envelope)
 }
 
+func (s *tableStreamImpl) EmitAsync(
+	key, envelope schema.Struct,
+) sink.Future {
+
+	return s.sinkManager.EmitAsync(time.Now(), s.topicName, key, envelope)
+}
+
+func (s *tableStreamImpl) Record(
+	key, envelope schema.Struct,
+) sink.Record {
+
+	return sink.Record{
+		Timestamp: time.Now(),
+		TopicName: s.topicName,
+		Key:       key,
+		Envelope:  envelope,
+	}
+}
+
 type messageStreamImpl struct {
 	sinkManager sink.Manager
 
@@ -152,3 +177,216 @@ func (m *messageStreamImpl) Emit(
 
 	return m.sinkManager.Emit(time.Now(), m.topicName, key, envelope)
 }
+
+func (m *messageStreamImpl) EmitAsync(
+	key, envelope schema.Struct,
+) sink.Future {
+
+	return m.sinkManager.EmitAsync(time.Now(), m.topicName, key, envelope)
+}
+
+func (m *messageStreamImpl) Record(
+	key, envelope schema.Struct,
+) sink.Record {
+
+	return sink.Record{
+		Timestamp: time.Now(),
+		TopicName: m.topicName,
+		Key:       key,
+		Envelope:  envelope,
+	}
+}
+
+type transactionStreamImpl struct {
+	sinkManager sink.Manager
+
+	topicName      string
+	keySchema      schema.Struct
+	envelopeSchema schema.Struct
+}
+
+func NewTransactionStream(
+	nameGenerator schema.NameGenerator, sinkManager sink.Manager,
+) Stream {
+
+	return &transactionStreamImpl{
+		sinkManager: sinkManager,
+
+		topicName:      nameGenerator.TransactionTopicName(),
+		keySchema:      schema.TransactionKeySchema(),
+		envelopeSchema: schema.TransactionValueSchema(),
+	}
+}
+
+func (t *transactionStreamImpl) KeySchema() schema.Struct {
+	return t.keySchema
+}
+
+func (t *transactionStreamImpl) PayloadSchema() schema.Struct {
+	return t.envelopeSchema
+}
+
+func (t *transactionStreamImpl) Key(
+	values map[string]any,
+) (schema.Struct, error) {
+
+	id, present := values[schema.FieldNameId]
+	if !present {
+		return nil, errors.Errorf("id not set for transaction event")
+	}
+	return schema.TransactionKey(id.(string)), nil
+}
+
+func (t *transactionStreamImpl) Emit(
+	key, envelope schema.Struct,
+) error {
+
+	return t.sinkManager.Emit(time.Now(), t.topicName, key, envelope)
+}
+
+func (t *transactionStreamImpl) EmitAsync(
+	key, envelope schema.Struct,
+) sink.Future {
+
+	return t.sinkManager.EmitAsync(time.Now(), t.topicName, key, envelope)
+}
+
+func (t *transactionStreamImpl) Record(
+	key, envelope schema.Struct,
+) sink.Record {
+
+	return sink.Record{
+		Timestamp: time.Now(),
+		TopicName: t.topicName,
+		Key:       key,
+		Envelope:  envelope,
+	}
+}
+
+type outboxStreamImpl struct {
+	sinkManager sink.Manager
+
+	topicName      string
+	keySchema      schema.Struct
+	envelopeSchema schema.Struct
+}
+
+func NewOutboxStream(
+	sinkManager sink.Manager, topicName string,
+) Stream {
+
+	return &outboxStreamImpl{
+		sinkManager: sinkManager,
+
+		topicName:      topicName,
+		keySchema:      schema.OutboxKeySchema(),
+		envelopeSchema: schema.OutboxValueSchema(),
+	}
+}
+
+func (o *outboxStreamImpl) KeySchema() schema.Struct {
+	return o.keySchema
+}
+
+func (o *outboxStreamImpl) PayloadSchema() schema.Struct {
+	return o.envelopeSchema
+}
+
+func (o *outboxStreamImpl) Key(
+	values map[string]any,
+) (schema.Struct, error) {
+
+	aggregateId, present := values[string(schema.FieldNameAggregateId)]
+	if !present {
+		return nil, errors.Errorf("aggregate id not set for outbox event")
+	}
+	return schema.OutboxKey(aggregateId.(string)), nil
+}
+
+func (o *outboxStreamImpl) Emit(
+	key, envelope schema.Struct,
+) error {
+
+	return o.sinkManager.Emit(time.Now(), o.topicName, key, envelope)
+}
+
+func (o *outboxStreamImpl) EmitAsync(
+	key, envelope schema.Struct,
+) sink.Future {
+
+	return o.sinkManager.EmitAsync(time.Now(), o.topicName, key, envelope)
+}
+
+func (o *outboxStreamImpl) Record(
+	key, envelope schema.Struct,
+) sink.Record {
+
+	return sink.Record{
+		Timestamp: time.Now(),
+		TopicName: o.topicName,
+		Key:       key,
+		Envelope:  envelope,
+	}
+}
+
+type aggregateStreamImpl struct {
+	sinkManager sink.Manager
+
+	topicName      string
+	keySchema      schema.Struct
+	envelopeSchema schema.Struct
+}
+
+func NewAggregateStream(
+	sinkManager sink.Manager, topicName string, keySchema, payloadSchema schema.Struct,
+) Stream {
+
+	return &aggregateStreamImpl{
+		sinkManager: sinkManager,
+
+		topicName:      topicName,
+		keySchema:      keySchema,
+		envelopeSchema: payloadSchema,
+	}
+}
+
+func (a *aggregateStreamImpl) KeySchema() schema.Struct {
+	return a.keySchema
+}
+
+func (a *aggregateStreamImpl) PayloadSchema() schema.Struct {
+	return a.envelopeSchema
+}
+
+func (a *aggregateStreamImpl) Key(
+	values map[string]any,
+) (schema.Struct, error) {
+
+	return values, nil
+}
+
+func (a *aggregateStreamImpl) Emit(
+	key, envelope schema.Struct,
+) error {
+
+	return a.sinkManager.Emit(time.Now(), a.topicName, key, envelope)
+}
+
+func (a *aggregateStreamImpl) EmitAsync(
+	key, envelope schema.Struct,
+) sink.Future {
+
+	return a.sinkManager.EmitAsync(time.Now(), a.topicName, key, envelope)
+}
+
+func (a *aggregateStreamImpl) Record(
+	key, envelope schema.Struct,
+) sink.Record {
+
+	return sink.Record{
+		Timestamp: time.Now(),
+		TopicName: a.topicName,
+		Key:       key,
+		Envelope:  envelope,
+	}
+}
@@ -25,7 +25,10 @@ import (
 )
 
 const (
-	messageStreamName = "::internal::message::stream::"
+	messageStreamName     = "::internal::message::stream::"
+	transactionStreamName = "::internal::transaction::stream::"
+	outboxStreamPrefix    = "::internal::outbox::stream::"
+	aggregateStreamPrefix = "::internal::aggregate::stream::"
 )
 
 type Manager interface {
@@ -37,6 +40,16 @@ type Manager interface {
 	GetOrCreateStream(
 		table schema.TableAlike,
 	) Stream
+	GetOrCreateTransactionStream() Stream
+	GetOrCreateOutboxStream(
+		topicName string,
+	) Stream
+	GetOrCreateAggregateStream(
+		topicName string, keySchema, payloadSchema schema.Struct,
+	) Stream
+	EmitBatch(
+		records []sink.Record,
+	) error
 }
 
 type streamManager struct {
@@ -92,6 +105,54 @@ func (s *streamManager) GetOrCreateStream(
 	return s.createStream(table)
 }
 
+func (s *streamManager) GetOrCreateTransactionStream() Stream {
+	s.streamsMutex.Lock()
+	defer s.streamsMutex.Unlock()
+	if stream, present := s.streams[transactionStreamName]; present {
+		return stream
+	}
+	stream := NewTransactionStream(s.nameGenerator, s.sinkManager)
+	s.streams[transactionStreamName] = stream
+	return stream
+}
+
+func (s *streamManager) GetOrCreateOutboxStream(
+	topicName string,
+) Stream {
+
+	s.streamsMutex.Lock()
+	defer s.streamsMutex.Unlock()
+	streamName := outboxStreamPrefix + topicName
+	if stream, present := s.streams[streamName]; present {
+		return stream
+	}
+	stream := NewOutboxStream(s.sinkManager, topicName)
+	s.streams[streamName] = stream
+	return stream
+}
+
+func (s *streamManager) GetOrCreateAggregateStream(
+	topicName string, keySchema, payloadSchema schema.Struct,
+) Stream {
+
+	s.streamsMutex.Lock()
+	defer s.streamsMutex.Unlock()
+	streamName := aggregateStreamPrefix + topicName
+	if stream, present := s.streams[streamName]; present {
+		return stream
+	}
+	stream := NewAggregateStream(s.sinkManager, topicName, keySchema, payloadSchema)
+	s.streams[streamName] = stream
+	return stream
+}
+
+func (s *streamManager) EmitBatch(
+	records []sink.Record,
+) error {
+
+	return s.sinkManager.EmitBatch(records)
+}
+
 func (s *streamManager) getStream(
 	table schema.TableAlike,
 ) (stream Stream, present bool) {
@@ -0,0 +1,44 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transform
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+)
+
+// Transform modifies the key and value envelopes of an event before it
+// is emitted. Schemas are shared between all events of the same table
+// and must never be modified in place, transforms return derived copies
+// instead. Payloads are owned by the event.
+type Transform interface {
+	Transform(
+		key, value schema.Struct,
+	) (schema.Struct, schema.Struct, error)
+}
+
+type TransformFunc func(key, value schema.Struct) (schema.Struct, schema.Struct, error)
+
+func (tf TransformFunc) Transform(
+	key, value schema.Struct,
+) (schema.Struct, schema.Struct, error) {
+
+	return tf(key, value)
+}
+
+// Factory creates a new Transform instance from its configuration
+type Factory = func(c config.TransformConfig) (Transform, error)
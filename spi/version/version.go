@@ -35,6 +35,7 @@ const (
 	PG_MIN_VERSION   PostgresVersion  = 130000
 	PG_14_VERSION    PostgresVersion  = 140000
 	PG_15_VERSION    PostgresVersion  = 150000
+	PG_16_VERSION    PostgresVersion  = 160000
 )
 
 var (
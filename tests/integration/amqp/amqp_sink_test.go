@@ -0,0 +1,313 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package amqp
+
+import (
+	"context"
+	"encoding/json"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/amqp"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/tests/integration"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/containers"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+const routingKey = "events.public.metrics"
+
+type AmqpIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestAmqpIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(AmqpIntegrationTestSuite))
+}
+
+type amqpMetadata struct {
+	key          string
+	deliveryMode uint8
+}
+
+func (aits *AmqpIntegrationTestSuite) Test_Amqp_Sink_Persistent_Deliveries() {
+	exchangeName := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	integration.RunSinkTest(&aits.TestRunner, integration.SinkTest{
+		Name:      "Test_Amqp_Sink_Persistent_Deliveries",
+		Container: containers.SetupRabbitMqContainer,
+		Configure: func(ctx *integration.SinkTestContext, config *sysconfig.SystemConfig) {
+			config.Sink.Type = spiconfig.Amqp
+			config.Sink.Amqp = spiconfig.AmqpConfig{
+				Url: ctx.Address,
+				Exchange: spiconfig.AmqpExchangeConfig{
+					Name: exchangeName,
+				},
+			}
+		},
+		Test: func(ctx *integration.SinkTestContext) error {
+			connection, err := amqp.Dial(ctx.Address)
+			if err != nil {
+				return err
+			}
+			defer connection.Close()
+
+			channel, err := connection.Channel()
+			if err != nil {
+				return err
+			}
+
+			// The exchange was declared by the sink when the streamer started
+			deliveries, err := consume(channel, exchangeName, ctx.TopicName("."))
+			if err != nil {
+				return err
+			}
+
+			collector := integration.NewEnvelopeCollector[amqpMetadata](10)
+			go func() {
+				for delivery := range deliveries {
+					if err := collector.Collect(delivery.Body, amqpMetadata{
+						key:          delivery.Headers["key"].(string),
+						deliveryMode: delivery.DeliveryMode,
+					}); err != nil {
+						delivery.Nack(false, false)
+						ctx.T().Error(err)
+						continue
+					}
+					delivery.Ack(false)
+				}
+			}()
+
+			if err := ctx.InsertRows(10); err != nil {
+				return err
+			}
+
+			if err := collector.Await(); err != nil {
+				return err
+			}
+
+			assert.Equal(ctx.T(), []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, collector.Values())
+			for _, metadata := range collector.Metadata() {
+				assert.NotEmpty(ctx.T(), metadata.key)
+				assert.Equal(ctx.T(), amqp.Persistent, metadata.deliveryMode)
+			}
+			return nil
+		},
+	})
+}
+
+func (aits *AmqpIntegrationTestSuite) Test_Amqp_Sink_Nack_Is_Retryable() {
+	_, url := integration.StartContainer(
+		aits.T(), "Test_Amqp_Sink_Nack_Is_Retryable", containers.SetupRabbitMqContainer,
+	)
+
+	exchangeName := lo.RandomString(10, lo.LowerCaseLettersCharset)
+	s := integration.NewSink(aits.T(), spiconfig.SinkConfig{
+		Type: spiconfig.Amqp,
+		Amqp: spiconfig.AmqpConfig{
+			Url:     url,
+			Timeout: 10,
+			Exchange: spiconfig.AmqpExchangeConfig{
+				Name: exchangeName,
+			},
+		},
+	})
+
+	connection, channel := dial(aits.T(), url)
+	defer connection.Close()
+
+	// The broker negatively acknowledges messages routed to a full
+	// queue which rejects new publishes on overflow
+	if _, err := bindQueue(channel, exchangeName, routingKey, amqp.Table{
+		amqp.QueueMaxLenArg:   1,
+		amqp.QueueOverflowArg: amqp.QueueOverflowRejectPublish,
+	}); err != nil {
+		aits.T().Fatal(err)
+	}
+
+	key, envelope := integration.SinkTestRecord(time.Now(), 1)
+	assert.NoError(aits.T(), s.Emit(nil, time.Now(), routingKey, key, envelope))
+
+	key, envelope = integration.SinkTestRecord(time.Now(), 2)
+	err := s.Emit(nil, time.Now(), routingKey, key, envelope)
+	assert.ErrorContains(aits.T(), err, "message was not acknowledged by the broker")
+	assert.False(aits.T(), sink.IsNonRetryable(err))
+}
+
+func (aits *AmqpIntegrationTestSuite) Test_Amqp_Sink_Reopens_Closed_Channel() {
+	_, url := integration.StartContainer(
+		aits.T(), "Test_Amqp_Sink_Reopens_Closed_Channel", containers.SetupRabbitMqContainer,
+	)
+
+	exchangeName := lo.RandomString(10, lo.LowerCaseLettersCharset)
+	s := integration.NewSink(aits.T(), spiconfig.SinkConfig{
+		Type: spiconfig.Amqp,
+		Amqp: spiconfig.AmqpConfig{
+			Url:     url,
+			Timeout: 10,
+			Exchange: spiconfig.AmqpExchangeConfig{
+				Name:    exchangeName,
+				Declare: lo.ToPtr(false),
+			},
+		},
+	})
+
+	// Publishing to a missing exchange closes the channel
+	key, envelope := integration.SinkTestRecord(time.Now(), 1)
+	err := s.Emit(nil, time.Now(), routingKey, key, envelope)
+	assert.Error(aits.T(), err)
+	assert.True(aits.T(), sink.IsNonRetryable(err))
+
+	connection, channel := dial(aits.T(), url)
+	defer connection.Close()
+
+	if err := channel.ExchangeDeclare(
+		exchangeName, amqp.ExchangeTopic, true, false, false, false, nil,
+	); err != nil {
+		aits.T().Fatal(err)
+	}
+
+	deliveries, err := consume(channel, exchangeName, routingKey)
+	if err != nil {
+		aits.T().Fatal(err)
+	}
+
+	key, envelope = integration.SinkTestRecord(time.Now(), 2)
+	assert.NoError(aits.T(), s.Emit(nil, time.Now(), routingKey, key, envelope))
+
+	assertDelivered(aits.T(), deliveries, 2)
+}
+
+func (aits *AmqpIntegrationTestSuite) Test_Amqp_Sink_Reconnects_Closed_Connection() {
+	container, url := integration.StartContainer(
+		aits.T(), "Test_Amqp_Sink_Reconnects_Closed_Connection", containers.SetupRabbitMqContainer,
+	)
+
+	exchangeName := lo.RandomString(10, lo.LowerCaseLettersCharset)
+	s := integration.NewSink(aits.T(), spiconfig.SinkConfig{
+		Type: spiconfig.Amqp,
+		Amqp: spiconfig.AmqpConfig{
+			Url:     url,
+			Timeout: 10,
+			Exchange: spiconfig.AmqpExchangeConfig{
+				Name: exchangeName,
+			},
+		},
+	})
+
+	key, envelope := integration.SinkTestRecord(time.Now(), 1)
+	assert.NoError(aits.T(), s.Emit(nil, time.Now(), routingKey, key, envelope))
+
+	// Force close the connection of the sink on the broker side
+	if exitCode, _, err := container.Exec(context.Background(), []string{
+		"rabbitmqctl", "close_all_connections", "closed by test",
+	}); err != nil || exitCode != 0 {
+		aits.T().Fatalf("failed to close connections: exit code %d, %v", exitCode, err)
+	}
+
+	connection, channel := dial(aits.T(), url)
+	defer connection.Close()
+
+	deliveries, err := consume(channel, exchangeName, routingKey)
+	if err != nil {
+		aits.T().Fatal(err)
+	}
+
+	// The sink may not have noticed the closed connection on the first
+	// publish, but reconnects on one of the following
+	assert.Eventually(aits.T(), func() bool {
+		key, envelope := integration.SinkTestRecord(time.Now(), 2)
+		return s.Emit(nil, time.Now(), routingKey, key, envelope) == nil
+	}, time.Minute, time.Second)
+
+	assertDelivered(aits.T(), deliveries, 2)
+}
+
+func dial(
+	t *testing.T, url string,
+) (*amqp.Connection, *amqp.Channel) {
+
+	connection, err := amqp.Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel, err := connection.Channel()
+	if err != nil {
+		connection.Close()
+		t.Fatal(err)
+	}
+	return connection, channel
+}
+
+// bindQueue declares an exclusive queue with the given arguments
+// and binds it to the exchange using the routing key
+func bindQueue(
+	channel *amqp.Channel, exchangeName, routingKey string, arguments amqp.Table,
+) (string, error) {
+
+	queue, err := channel.QueueDeclare("", false, true, true, false, arguments)
+	if err != nil {
+		return "", err
+	}
+
+	if err := channel.QueueBind(queue.Name, routingKey, exchangeName, false, nil); err != nil {
+		return "", err
+	}
+	return queue.Name, nil
+}
+
+// consume binds an exclusive queue to the exchange using the
+// routing key and consumes its messages
+func consume(
+	channel *amqp.Channel, exchangeName, routingKey string,
+) (<-chan amqp.Delivery, error) {
+
+	queueName, err := bindQueue(channel, exchangeName, routingKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return channel.Consume(queueName, "", true, true, false, false, nil)
+}
+
+// assertDelivered asserts that the next delivery carries the given value
+func assertDelivered(
+	t *testing.T, deliveries <-chan amqp.Delivery, value int,
+) {
+
+	select {
+	case delivery := <-deliveries:
+		envelope := testsupport.Envelope{}
+		if err := json.Unmarshal(delivery.Body, &envelope); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, float64(value), envelope.Payload.After["val"])
+		assert.NotEmpty(t, delivery.Headers["key"])
+	case <-time.After(time.Minute):
+		t.Fatalf("message with value %d wasn't delivered", value)
+	}
+}
@@ -0,0 +1,267 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"github.com/go-errors/errors"
+	"github.com/klauspost/compress/zstd"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/tests/integration"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const activeFileName = "events.ndjson"
+
+type FileIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestFileIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(FileIntegrationTestSuite))
+}
+
+func (fits *FileIntegrationTestSuite) Test_File_Sink_Rotates_By_Size_With_Gzip() {
+	fits.runSizeRotationTest("Test_File_Sink_Rotates_By_Size_With_Gzip", spiconfig.GzipFileCompression)
+}
+
+func (fits *FileIntegrationTestSuite) Test_File_Sink_Rotates_By_Size_With_Zstd() {
+	fits.runSizeRotationTest("Test_File_Sink_Rotates_By_Size_With_Zstd", spiconfig.ZstdFileCompression)
+}
+
+func (fits *FileIntegrationTestSuite) Test_File_Sink_Rotates_By_Duration() {
+	path := fits.T().TempDir()
+
+	integration.RunSinkTest(&fits.TestRunner, integration.SinkTest{
+		Name: "Test_File_Sink_Rotates_By_Duration",
+		Configure: func(_ *integration.SinkTestContext, config *sysconfig.SystemConfig) {
+			config.Sink.Type = spiconfig.File
+			config.Sink.File = spiconfig.FileConfig{
+				Path:        path,
+				MaxDuration: lo.ToPtr(1),
+			}
+		},
+		Test: func(ctx *integration.SinkTestContext) error {
+			directory := filepath.Join(path, ctx.TopicName("."))
+
+			if err := ctx.InsertRows(5); err != nil {
+				return err
+			}
+			if _, err := awaitEvents(directory, 5, false); err != nil {
+				return err
+			}
+
+			// The updates are written after the rotation interval passed
+			time.Sleep(time.Second * 2)
+			if err := ctx.UpdateRows(10); err != nil {
+				return err
+			}
+
+			collector, err := awaitEvents(directory, 10, false)
+			if err != nil {
+				return err
+			}
+
+			files := collector.GroupBy(func(fileName string) string {
+				return fileName
+			})
+			assert.GreaterOrEqual(ctx.T(), len(files), 2)
+			for fileName, envelopes := range files {
+				operations := lo.Uniq(lo.Map(envelopes, func(envelope testsupport.Envelope, _ int) schema.Operation {
+					return envelope.Payload.Op
+				}))
+				assert.Len(ctx.T(), operations, 1, "file %s holds events written 2s apart", fileName)
+			}
+			return nil
+		},
+	})
+}
+
+func (fits *FileIntegrationTestSuite) runSizeRotationTest(
+	name string, compression spiconfig.FileCompressionType,
+) {
+
+	path := fits.T().TempDir()
+
+	integration.RunSinkTest(&fits.TestRunner, integration.SinkTest{
+		Name: name,
+		Configure: func(_ *integration.SinkTestContext, config *sysconfig.SystemConfig) {
+			config.Sink.Type = spiconfig.File
+			config.Sink.File = spiconfig.FileConfig{
+				Path:        path,
+				MaxSize:     lo.ToPtr("1KB"),
+				Compression: compression,
+			}
+		},
+		Test: func(ctx *integration.SinkTestContext) error {
+			directory := filepath.Join(path, ctx.TopicName("."))
+
+			if err := ctx.InsertRows(50); err != nil {
+				return err
+			}
+
+			// Rotated files are compressed in the background,
+			// polling until all rotated files are compressed
+			collector, err := awaitEvents(directory, 50, true)
+			if err != nil {
+				return err
+			}
+
+			files := collector.GroupBy(func(fileName string) string {
+				return fileName
+			})
+			compressedFiles := 0
+			for fileName, envelopes := range files {
+				if fileName != activeFileName {
+					assert.True(ctx.T(), strings.HasSuffix(fileName, compressionSuffix(compression)), fileName)
+					compressedFiles++
+				}
+
+				// Events are written in order, across all files
+				// and within each of them
+				values := lo.Map(envelopes, func(envelope testsupport.Envelope, _ int) int {
+					return int(envelope.Payload.After["val"].(float64))
+				})
+				assert.IsIncreasing(ctx.T(), values, fileName)
+			}
+			assert.Positive(ctx.T(), compressedFiles)
+			assert.ElementsMatch(ctx.T(), lo.RangeFrom(1, 50), collector.Values())
+			return nil
+		},
+	})
+}
+
+// awaitEvents polls the files of the topic directory until the expected
+// number of events was written, and if requested, all rotated files
+// were compressed. The file name of each event is collected as metadata.
+func awaitEvents(
+	directory string, expected int, compressed bool,
+) (*integration.EnvelopeCollector[string], error) {
+
+	var lastErr error
+	deadline := time.Now().Add(time.Minute)
+	for time.Now().Before(deadline) {
+		collector, complete, err := readEvents(directory, expected, compressed)
+		if err == nil && complete && len(collector.Envelopes()) == expected {
+			return collector, nil
+		}
+		lastErr = err
+		time.Sleep(time.Millisecond * 100)
+	}
+	return nil, errors.Errorf("timed out waiting for %d events in '%s': %v", expected, directory, lastErr)
+}
+
+// readEvents reads the events of all files in the topic directory. The
+// result is incomplete if compression was requested and rotated files
+// weren't compressed yet.
+func readEvents(
+	directory string, expected int, compressed bool,
+) (*integration.EnvelopeCollector[string], bool, error) {
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, false, err
+	}
+
+	collector := integration.NewEnvelopeCollector[string](expected)
+	complete := true
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if strings.HasSuffix(fileName, ".tmp") {
+			complete = false
+			continue
+		}
+		if compressed && fileName != activeFileName && strings.HasSuffix(fileName, ".ndjson") {
+			complete = false
+			continue
+		}
+		if err := readFile(filepath.Join(directory, fileName), func(line []byte) error {
+			return collector.Collect(line, fileName)
+		}); err != nil {
+			return nil, false, err
+		}
+	}
+	return collector, complete, nil
+}
+
+func readFile(
+	path string, fn func(line []byte) error,
+) error {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case strings.HasSuffix(path, ".zst"):
+		zstdReader, err := zstd.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func compressionSuffix(
+	compression spiconfig.FileCompressionType,
+) string {
+
+	switch compression {
+	case spiconfig.GzipFileCompression:
+		return ".ndjson.gz"
+	case spiconfig.ZstdFileCompression:
+		return ".ndjson.zst"
+	}
+	return ".ndjson"
+}
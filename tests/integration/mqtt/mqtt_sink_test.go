@@ -0,0 +1,219 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/mqtt"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/tests/integration"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/containers"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type MqttIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestMqttIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(MqttIntegrationTestSuite))
+}
+
+type mqttMetadata struct {
+	userProperties paho.UserProperties
+	contentType    string
+	retained       bool
+}
+
+func (mits *MqttIntegrationTestSuite) Test_Mqtt_Sink_V5_User_Properties() {
+	mits.runMqttSinkTest("Test_Mqtt_Sink_V5_User_Properties", spiconfig.MqttV5,
+		func(ctx *integration.SinkTestContext, collector *integration.EnvelopeCollector[mqttMetadata]) {
+			for _, metadata := range collector.Metadata() {
+				assert.NotEmpty(ctx.T(), metadata.userProperties.Get("key"))
+				assert.Equal(ctx.T(), "c", metadata.userProperties.Get("op"))
+				assert.Equal(ctx.T(), "application/json", metadata.contentType)
+			}
+		},
+	)
+}
+
+func (mits *MqttIntegrationTestSuite) Test_Mqtt_Sink_V311_Without_Properties() {
+	mits.runMqttSinkTest("Test_Mqtt_Sink_V311_Without_Properties", spiconfig.MqttV311,
+		func(ctx *integration.SinkTestContext, collector *integration.EnvelopeCollector[mqttMetadata]) {
+			// MQTT 3.1.1 publications have no properties,
+			// the broker doesn't add any when forwarding
+			for _, metadata := range collector.Metadata() {
+				assert.Empty(ctx.T(), metadata.userProperties)
+				assert.Empty(ctx.T(), metadata.contentType)
+			}
+		},
+	)
+}
+
+func (mits *MqttIntegrationTestSuite) Test_Mqtt_Sink_Retained_Messages() {
+	_, mqttUrl := integration.StartContainer(
+		mits.T(), "Test_Mqtt_Sink_Retained_Messages", containers.SetupMosquittoContainer,
+	)
+
+	for _, version := range []spiconfig.MqttProtocolVersion{spiconfig.MqttV311, spiconfig.MqttV5} {
+		mits.Run(string(version), func() {
+			s := integration.NewSink(mits.T(), spiconfig.SinkConfig{
+				Type: spiconfig.Mqtt,
+				Mqtt: spiconfig.MqttConfig{
+					Url:      mqttUrl,
+					Version:  version,
+					ClientId: lo.RandomString(10, lo.LowerCaseLettersCharset),
+					Retain:   lo.ToPtr(true),
+				},
+			})
+
+			topicName := fmt.Sprintf("%s.public.metrics", lo.RandomString(10, lo.LowerCaseLettersCharset))
+			key, envelope := integration.SinkTestRecord(time.Now(), 42)
+			if err := s.Emit(nil, time.Now(), topicName, key, envelope); err != nil {
+				mits.T().Fatal(err)
+			}
+
+			// Subscribers connecting after the publication
+			// receive the retained message of the topic
+			collector := integration.NewEnvelopeCollector[mqttMetadata](1)
+			mits.subscribe(mqttUrl, mqttTopicName(topicName), collector)
+
+			if err := collector.Await(); err != nil {
+				mits.T().Fatal(err)
+			}
+			assert.Equal(mits.T(), []int{42}, collector.Values())
+			assert.True(mits.T(), collector.Metadata()[0].retained)
+		})
+	}
+}
+
+func (mits *MqttIntegrationTestSuite) runMqttSinkTest(
+	name string, version spiconfig.MqttProtocolVersion,
+	assertion func(ctx *integration.SinkTestContext, collector *integration.EnvelopeCollector[mqttMetadata]),
+) {
+
+	integration.RunSinkTest(&mits.TestRunner, integration.SinkTest{
+		Name:      name,
+		Container: containers.SetupMosquittoContainer,
+		Configure: func(ctx *integration.SinkTestContext, config *sysconfig.SystemConfig) {
+			config.Sink.Type = spiconfig.Mqtt
+			config.Sink.Mqtt = spiconfig.MqttConfig{
+				Url:     ctx.Address,
+				Version: version,
+			}
+		},
+		Test: func(ctx *integration.SinkTestContext) error {
+			collector := integration.NewEnvelopeCollector[mqttMetadata](10)
+			mits.subscribe(ctx.Address, ctx.TopicName("/"), collector)
+
+			if err := ctx.InsertRows(10); err != nil {
+				return err
+			}
+
+			if err := collector.Await(); err != nil {
+				return err
+			}
+
+			assert.Equal(ctx.T(), []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, collector.Values())
+			assertion(ctx, collector)
+			return nil
+		},
+	})
+}
+
+// subscribe connects an MQTT 5 client subscribed to the topic, which
+// collects the received messages, and returns once it is subscribed
+func (mits *MqttIntegrationTestSuite) subscribe(
+	mqttUrl, topicName string, collector *integration.EnvelopeCollector[mqttMetadata],
+) {
+
+	serverUrl, err := url.Parse(mqttUrl)
+	if err != nil {
+		mits.T().Fatal(err)
+	}
+
+	subscribed := make(chan struct{})
+	subscribedOnce := sync.Once{}
+	connection, err := autopaho.NewConnection(context.Background(), autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{serverUrl},
+		KeepAlive:                     30,
+		CleanStartOnInitialConnection: true,
+		OnConnectionUp: func(connection *autopaho.ConnectionManager, _ *paho.Connack) {
+			if _, err := connection.Subscribe(context.Background(), &paho.Subscribe{
+				Subscriptions: []paho.SubscribeOptions{{Topic: topicName, QoS: 1}},
+			}); err != nil {
+				mits.T().Error(err)
+			}
+			subscribedOnce.Do(func() {
+				close(subscribed)
+			})
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: lo.RandomString(10, lo.LowerCaseLettersCharset),
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(received paho.PublishReceived) (bool, error) {
+					metadata := mqttMetadata{
+						retained: received.Packet.Retain,
+					}
+					if properties := received.Packet.Properties; properties != nil {
+						metadata.userProperties = properties.User
+						metadata.contentType = properties.ContentType
+					}
+					if err := collector.Collect(received.Packet.Payload, metadata); err != nil {
+						mits.T().Error(err)
+					}
+					return true, nil
+				},
+			},
+		},
+	})
+	if err != nil {
+		mits.T().Fatal(err)
+	}
+	mits.T().Cleanup(func() {
+		connection.Disconnect(context.Background())
+	})
+
+	select {
+	case <-subscribed:
+	case <-time.After(time.Minute):
+		mits.T().Fatal("subscription timed out")
+	}
+}
+
+func mqttTopicName(
+	topicName string,
+) string {
+
+	return strings.ReplaceAll(topicName, ".", "/")
+}
@@ -0,0 +1,224 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"cloud.google.com/go/pubsub"
+	"context"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/pubsub"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/tests/integration"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/containers"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/testcontainers/testcontainers-go"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"testing"
+	"time"
+)
+
+const projectId = "test-project"
+
+type PubSubIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestPubSubIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(PubSubIntegrationTestSuite))
+}
+
+type pubSubMetadata struct {
+	orderingKey string
+	attributes  map[string]string
+}
+
+func (psits *PubSubIntegrationTestSuite) Test_PubSub_Sink_Ordering_Keys() {
+	integration.RunSinkTest(&psits.TestRunner, integration.SinkTest{
+		Name:      "Test_PubSub_Sink_Ordering_Keys",
+		Container: setupPubSubEmulatorContainer,
+		Configure: func(ctx *integration.SinkTestContext, config *sysconfig.SystemConfig) {
+			config.Sink.Type = spiconfig.PubSub
+			config.Sink.PubSub = spiconfig.PubSubConfig{
+				ProjectId: projectId,
+				Endpoint:  ctx.Address,
+			}
+		},
+		Test: func(ctx *integration.SinkTestContext) error {
+			client, err := newClient(ctx.Address)
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			// Events of 5 rows, each inserted and updated twice
+			collector := integration.NewEnvelopeCollector[pubSubMetadata](15)
+			cancel, err := subscribe(client, ctx.TopicName("."), func(message *pubsub.Message) {
+				if err := collector.Collect(message.Data, pubSubMetadata{
+					orderingKey: message.OrderingKey,
+					attributes:  message.Attributes,
+				}); err != nil {
+					ctx.T().Error(err)
+				}
+			})
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			if err := ctx.InsertRows(5); err != nil {
+				return err
+			}
+			for i := 0; i < 2; i++ {
+				if err := ctx.UpdateRows(10); err != nil {
+					return err
+				}
+			}
+
+			if err := collector.Await(); err != nil {
+				return err
+			}
+
+			// The events of a row share the ordering key of the row's primary
+			// key and are delivered in order, across the keys the order of
+			// delivery isn't guaranteed
+			integration.AssertRowHistories(ctx.T(), collector.GroupBy(func(metadata pubSubMetadata) string {
+				return metadata.orderingKey
+			}), 5, 2, 10)
+
+			for _, metadata := range collector.Metadata() {
+				assert.NotEmpty(ctx.T(), metadata.orderingKey)
+				assert.NotContains(ctx.T(), metadata.attributes, "tombstone")
+			}
+			return nil
+		},
+	})
+}
+
+func (psits *PubSubIntegrationTestSuite) Test_PubSub_Sink_Resumes_Ordering_Key_After_Failure() {
+	_, endpoint := integration.StartContainer(
+		psits.T(), "Test_PubSub_Sink_Resumes_Ordering_Key_After_Failure", setupPubSubEmulatorContainer,
+	)
+
+	s := integration.NewSink(psits.T(), spiconfig.SinkConfig{
+		Type: spiconfig.PubSub,
+		PubSub: spiconfig.PubSubConfig{
+			ProjectId: projectId,
+			Endpoint:  endpoint,
+		},
+	})
+
+	topicName := lo.RandomString(10, lo.LowerCaseLettersCharset)
+	timestamp := time.Date(2023, 3, 25, 0, 0, 0, 0, time.UTC)
+
+	// Publishing to a missing topic can't succeed by retrying
+	key, envelope := integration.SinkTestRecord(timestamp, 1)
+	err := s.Emit(nil, time.Now(), topicName, key, envelope)
+	assert.Error(psits.T(), err)
+	assert.True(psits.T(), sink.IsNonRetryable(err))
+
+	client, err := newClient(endpoint)
+	if err != nil {
+		psits.T().Fatal(err)
+	}
+	defer client.Close()
+
+	collector := integration.NewEnvelopeCollector[pubSubMetadata](1)
+	cancel, err := subscribe(client, topicName, func(message *pubsub.Message) {
+		if err := collector.Collect(message.Data, pubSubMetadata{
+			orderingKey: message.OrderingKey,
+		}); err != nil {
+			psits.T().Error(err)
+		}
+	})
+	if err != nil {
+		psits.T().Fatal(err)
+	}
+	defer cancel()
+
+	// Publishing of the ordering key was paused by the failure, the
+	// retried message of the same key needs to be accepted again
+	key, envelope = integration.SinkTestRecord(timestamp, 2)
+	assert.NoError(psits.T(), s.Emit(nil, time.Now(), topicName, key, envelope))
+
+	if err := collector.Await(); err != nil {
+		psits.T().Fatal(err)
+	}
+	assert.Equal(psits.T(), []int{2}, collector.Values())
+}
+
+func setupPubSubEmulatorContainer() (testcontainers.Container, string, error) {
+	return containers.SetupPubSubEmulatorContainer(projectId)
+}
+
+func newClient(
+	endpoint string,
+) (*pubsub.Client, error) {
+
+	return pubsub.NewClient(context.Background(), projectId,
+		option.WithEndpoint(endpoint),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+}
+
+// subscribe creates the topic, unless it exists, and an ordered subscription
+// to it, and receives its messages until the returned function is called
+func subscribe(
+	client *pubsub.Client, topicName string, handler func(message *pubsub.Message),
+) (context.CancelFunc, error) {
+
+	topic := client.Topic(topicName)
+	exists, err := topic.Exists(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if topic, err = client.CreateTopic(context.Background(), topicName); err != nil {
+			return nil, err
+		}
+	}
+
+	subscription, err := client.CreateSubscription(context.Background(),
+		lo.RandomString(10, lo.LowerCaseLettersCharset),
+		pubsub.SubscriptionConfig{
+			Topic:                 topic,
+			EnableMessageOrdering: true,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	receiveContext, cancel := context.WithCancel(context.Background())
+	go subscription.Receive(receiveContext,
+		func(_ context.Context, message *pubsub.Message) {
+			message.Ack()
+			handler(message)
+		},
+	)
+	return cancel, nil
+}
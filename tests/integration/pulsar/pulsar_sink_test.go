@@ -0,0 +1,138 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pulsar
+
+import (
+	"context"
+	"fmt"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/tests/integration"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/containers"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type PulsarIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestPulsarIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(PulsarIntegrationTestSuite))
+}
+
+type pulsarMetadata struct {
+	key       string
+	consumer  int
+	eventTime time.Time
+}
+
+func (pits *PulsarIntegrationTestSuite) Test_Pulsar_Sink_Key_Shared_Ordering() {
+	integration.RunSinkTest(&pits.TestRunner, integration.SinkTest{
+		Name:      "Test_Pulsar_Sink_Key_Shared_Ordering",
+		Container: containers.SetupPulsarContainer,
+		Configure: func(ctx *integration.SinkTestContext, config *sysconfig.SystemConfig) {
+			config.Sink.Type = spiconfig.Pulsar
+			config.Sink.Pulsar = spiconfig.PulsarConfig{
+				Url: ctx.Address,
+			}
+		},
+		Test: func(ctx *integration.SinkTestContext) error {
+			client, err := pulsar.NewClient(pulsar.ClientOptions{URL: ctx.Address})
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			// Events of 5 rows, each inserted and updated twice
+			collector := integration.NewEnvelopeCollector[pulsarMetadata](15)
+
+			// Two consumers on a key shared subscription, the broker dispatches
+			// all messages of a key to the same consumer, in order
+			subscriptionName := lo.RandomString(10, lo.LowerCaseLettersCharset)
+			for i := 0; i < 2; i++ {
+				consumer, err := client.Subscribe(pulsar.ConsumerOptions{
+					Topic:                       fmt.Sprintf("persistent://public/default/%s", ctx.TopicName(".")),
+					SubscriptionName:            subscriptionName,
+					Type:                        pulsar.KeyShared,
+					SubscriptionInitialPosition: pulsar.SubscriptionPositionEarliest,
+				})
+				if err != nil {
+					return err
+				}
+				defer consumer.Close()
+
+				go func(consumerId int) {
+					for {
+						msg, err := consumer.Receive(context.Background())
+						if err != nil {
+							return
+						}
+
+						if err := collector.Collect(msg.Payload(), pulsarMetadata{
+							key:       msg.Key(),
+							consumer:  consumerId,
+							eventTime: msg.EventTime(),
+						}); err != nil {
+							consumer.Nack(msg)
+							ctx.T().Error(err)
+							continue
+						}
+						consumer.Ack(msg)
+					}
+				}(i)
+			}
+
+			if err := ctx.InsertRows(5); err != nil {
+				return err
+			}
+			for i := 0; i < 2; i++ {
+				if err := ctx.UpdateRows(10); err != nil {
+					return err
+				}
+			}
+
+			if err := collector.Await(); err != nil {
+				return err
+			}
+
+			integration.AssertRowHistories(ctx.T(), collector.GroupBy(func(metadata pulsarMetadata) string {
+				return metadata.key
+			}), 5, 2, 10)
+
+			consumersByKey := make(map[string]int)
+			for _, metadata := range collector.Metadata() {
+				assert.NotEmpty(ctx.T(), metadata.key)
+				assert.False(ctx.T(), metadata.eventTime.IsZero())
+				if consumer, present := consumersByKey[metadata.key]; present {
+					assert.Equal(ctx.T(), consumer, metadata.consumer, "key %s dispatched to both consumers", metadata.key)
+				}
+				consumersByKey[metadata.key] = metadata.consumer
+			}
+			return nil
+		},
+	})
+}
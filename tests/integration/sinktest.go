@@ -0,0 +1,362 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// SinkTest describes an end-to-end test of a sink. The streamer replicates
+// the changes of a fresh hypertable into the sink, while the test consumes
+// the events from the system behind the sink. The hypertable consists of
+// the columns ts (timestamptz, primary key) and val (integer).
+type SinkTest struct {
+	// Name is used as the name of the test's logger
+	Name string
+	// Container starts the system behind the sink, if any, and
+	// returns the address the sink and the consumer connect to
+	Container func() (testcontainers.Container, string, error)
+	// Configure configures the sink of the streamer
+	Configure func(ctx *SinkTestContext, config *sysconfig.SystemConfig)
+	// Test runs the test after the streamer was started
+	Test func(ctx *SinkTestContext) error
+}
+
+// SinkTestContext carries the state of a running SinkTest
+type SinkTestContext struct {
+	testrunner.Context
+	runner      *testrunner.TestRunner
+	Logger      *logging.Logger
+	Container   testcontainers.Container
+	Address     string
+	TopicPrefix string
+	SchemaName  string
+	TableName   string
+}
+
+// RunSinkTest runs the given test. The container is started before the
+// streamer, its output is forwarded to the test's logger, and it is
+// terminated after the test.
+func RunSinkTest(
+	runner *testrunner.TestRunner, test SinkTest,
+) {
+
+	logger, err := logging.NewLogger(test.Name)
+	if err != nil {
+		runner.T().Fatal(err)
+	}
+
+	sinkTestContext := &SinkTestContext{
+		runner:      runner,
+		Logger:      logger,
+		TopicPrefix: lo.RandomString(10, lo.LowerCaseLettersCharset),
+	}
+
+	runner.RunTest(
+		func(ctx testrunner.Context) error {
+			sinkTestContext.Context = ctx
+			return test.Test(sinkTestContext)
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			schemaName, tableName, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			sinkTestContext.SchemaName = schemaName
+			sinkTestContext.TableName = tableName
+
+			if test.Container != nil {
+				container, address, err := startContainer(logger, test.Container)
+				if err != nil {
+					return err
+				}
+				sinkTestContext.Container = container
+				sinkTestContext.Address = address
+			}
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = sinkTestContext.TopicPrefix
+				test.Configure(sinkTestContext, config)
+			})
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(_ testrunner.Context) error {
+			if sinkTestContext.Container != nil {
+				sinkTestContext.Container.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
+
+// StartContainer starts the system behind a sink for tests which emit
+// into the sink directly, without running the streamer. The container
+// is terminated when the test finishes.
+func StartContainer(
+	t *testing.T, name string, setup func() (testcontainers.Container, string, error),
+) (testcontainers.Container, string) {
+
+	logger, err := logging.NewLogger(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container, address, err := startContainer(logger, setup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		container.Terminate(context.Background())
+	})
+	return container, address
+}
+
+// NewSink creates and starts a sink of the given configuration to emit
+// into directly. The sink is stopped when the test finishes. The package
+// of the sink needs to be imported to register it.
+func NewSink(
+	t *testing.T, sinkConfig spiconfig.SinkConfig,
+) sink.Sink {
+
+	s, err := sinkimpl.NewSink(sinkConfig.Type, &spiconfig.Config{Sink: sinkConfig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := s.Stop(); err != nil {
+			t.Error(err)
+		}
+	})
+	return s
+}
+
+func startContainer(
+	logger *logging.Logger, setup func() (testcontainers.Container, string, error),
+) (testcontainers.Container, string, error) {
+
+	container, address, err := setup()
+	if err != nil {
+		return nil, "", errors.Wrap(err, 0)
+	}
+
+	container.FollowOutput(&testrunner.ContainerLogForwarder{Logger: logger})
+	container.StartLogProducer(context.Background())
+	return container, address, nil
+}
+
+// T returns the test's testing.T
+func (c *SinkTestContext) T() *testing.T {
+	return c.runner.T()
+}
+
+// TopicName returns the topic name of the hypertable's events,
+// using the given separator between prefix, schema, and table
+func (c *SinkTestContext) TopicName(
+	separator string,
+) string {
+
+	return strings.Join([]string{c.TopicPrefix, c.SchemaName, c.TableName}, separator)
+}
+
+// InsertRows inserts rows with the values 1 to count, one minute apart
+func (c *SinkTestContext) InsertRows(
+	count int,
+) error {
+
+	_, err := c.Exec(context.Background(),
+		fmt.Sprintf(
+			"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:00:00'::TIMESTAMPTZ + INTERVAL '%d minute', INTERVAL '1 minute') t(ts)",
+			c.TableName, count-1,
+		),
+	)
+	return err
+}
+
+// UpdateRows adds the given increment to the values of all rows,
+// in a transaction of its own
+func (c *SinkTestContext) UpdateRows(
+	increment int,
+) error {
+
+	_, err := c.Exec(context.Background(),
+		fmt.Sprintf("UPDATE \"%s\" SET val = val + %d", c.TableName, increment),
+	)
+	return err
+}
+
+// SinkTestRecord creates a key and a create event envelope, as emitted
+// for a row of the test hypertable, to emit into sinks directly
+func SinkTestRecord(
+	ts time.Time, value int,
+) (key, envelope schema.Struct) {
+
+	key = schema.Struct{
+		schema.FieldNamePayload: schema.Struct{
+			"ts": ts.Format(time.RFC3339Nano),
+		},
+	}
+	envelope = schema.Struct{
+		schema.FieldNamePayload: schema.Struct{
+			schema.FieldNameOperation: string(schema.OP_CREATE),
+			schema.FieldNameAfter: schema.Struct{
+				"ts":  ts.Format(time.RFC3339Nano),
+				"val": value,
+			},
+		},
+	}
+	return key, envelope
+}
+
+// EnvelopeCollector collects the consumed envelopes and the sink specific
+// metadata of their messages, and signals once the expected number of
+// envelopes was collected. It's safe to be used by concurrent consumers.
+type EnvelopeCollector[M any] struct {
+	mutex     sync.Mutex
+	expected  int
+	waiter    *waiting.Waiter
+	envelopes []testsupport.Envelope
+	metadata  []M
+}
+
+func NewEnvelopeCollector[M any](
+	expected int,
+) *EnvelopeCollector[M] {
+
+	return &EnvelopeCollector[M]{
+		expected:  expected,
+		waiter:    waiting.NewWaiterWithTimeout(time.Minute),
+		envelopes: make([]testsupport.Envelope, 0, expected),
+		metadata:  make([]M, 0, expected),
+	}
+}
+
+// Collect decodes the JSON encoded envelope and adds it together
+// with the metadata of the message
+func (c *EnvelopeCollector[M]) Collect(
+	data []byte, metadata M,
+) error {
+
+	envelope := testsupport.Envelope{}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.envelopes = append(c.envelopes, envelope)
+	c.metadata = append(c.metadata, metadata)
+	if len(c.envelopes) == c.expected {
+		c.waiter.Signal()
+	}
+	return nil
+}
+
+// Await waits until the expected number of envelopes was collected
+func (c *EnvelopeCollector[M]) Await() error {
+	return c.waiter.Await()
+}
+
+// Envelopes returns the collected envelopes in order of their collection
+func (c *EnvelopeCollector[M]) Envelopes() []testsupport.Envelope {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]testsupport.Envelope{}, c.envelopes...)
+}
+
+// Metadata returns the collected metadata in order of their collection
+func (c *EnvelopeCollector[M]) Metadata() []M {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]M{}, c.metadata...)
+}
+
+// GroupBy groups the collected envelopes by the string derived from
+// the metadata of their messages, keeping the order of their collection
+func (c *EnvelopeCollector[M]) GroupBy(
+	fn func(metadata M) string,
+) map[string][]testsupport.Envelope {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	groups := make(map[string][]testsupport.Envelope)
+	for i, envelope := range c.envelopes {
+		key := fn(c.metadata[i])
+		groups[key] = append(groups[key], envelope)
+	}
+	return groups
+}
+
+// AssertRowHistories asserts that every group holds the history of a single
+// row in order: its create event followed by the given number of update
+// events, each of which incremented the value by the given increment
+func AssertRowHistories(
+	t assert.TestingT, groups map[string][]testsupport.Envelope, rows, updates, increment int,
+) {
+
+	assert.Len(t, groups, rows)
+	for key, envelopes := range groups {
+		if !assert.Len(t, envelopes, updates+1, "history of key %s", key) {
+			continue
+		}
+		first := int(envelopes[0].Payload.After["val"].(float64))
+		for i, envelope := range envelopes {
+			expectedOp := schema.OP_UPDATE
+			if i == 0 {
+				expectedOp = schema.OP_CREATE
+			}
+			assert.Equal(t, expectedOp, envelope.Payload.Op, "history of key %s", key)
+			assert.Equal(t, first+i*increment, int(envelope.Payload.After["val"].(float64)), "history of key %s", key)
+		}
+	}
+}
+
+// Values returns the val column of the after rows of the collected envelopes
+func (c *EnvelopeCollector[M]) Values() []int {
+	return lo.Map(c.Envelopes(), func(envelope testsupport.Envelope, _ int) int {
+		return int(envelope.Payload.After["val"].(float64))
+	})
+}
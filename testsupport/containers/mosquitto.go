@@ -0,0 +1,68 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package containers
+
+import (
+	"context"
+	"fmt"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const mqttProtocol = "mqtt"
+
+func SetupMosquittoContainer() (testcontainers.Container, string, error) {
+	containerRequest := testcontainers.ContainerRequest{
+		Image:        "eclipse-mosquitto:2.0",
+		ExposedPorts: []string{"1883/tcp"},
+		Cmd:          []string{"mosquitto", "-c", "/mosquitto-no-auth.conf"},
+		WaitingFor:   wait.NewLogStrategy("running"),
+	}
+
+	logger, err := logging.NewLogger("testcontainers")
+	if err != nil {
+		return nil, "", err
+	}
+
+	container, err := testcontainers.GenericContainer(
+		context.Background(),
+		testcontainers.GenericContainerRequest{
+			ContainerRequest: containerRequest,
+			Started:          true,
+			Logger:           logger,
+		},
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	host, err := container.Host(context.Background())
+	if err != nil {
+		container.Terminate(context.Background())
+		return nil, "", err
+	}
+
+	mqttPort, err := container.MappedPort(context.Background(), "1883/tcp")
+	if err != nil {
+		container.Terminate(context.Background())
+		return nil, "", err
+	}
+
+	return container, fmt.Sprintf("%s://%s:%d", mqttProtocol, host, mqttPort.Int()), nil
+}
@@ -0,0 +1,71 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package containers
+
+import (
+	"context"
+	"fmt"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+func SetupPubSubEmulatorContainer(
+	projectId string,
+) (testcontainers.Container, string, error) {
+
+	containerRequest := testcontainers.ContainerRequest{
+		Image:        "gcr.io/google.com/cloudsdktool/google-cloud-cli:emulators",
+		ExposedPorts: []string{"8085/tcp"},
+		Cmd: []string{
+			"gcloud", "beta", "emulators", "pubsub", "start",
+			"--host-port=0.0.0.0:8085", fmt.Sprintf("--project=%s", projectId),
+		},
+		WaitingFor: wait.NewLogStrategy("Server started"),
+	}
+
+	logger, err := logging.NewLogger("testcontainers")
+	if err != nil {
+		return nil, "", err
+	}
+
+	container, err := testcontainers.GenericContainer(
+		context.Background(),
+		testcontainers.GenericContainerRequest{
+			ContainerRequest: containerRequest,
+			Started:          true,
+			Logger:           logger,
+		},
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	host, err := container.Host(context.Background())
+	if err != nil {
+		container.Terminate(context.Background())
+		return nil, "", err
+	}
+
+	pubSubPort, err := container.MappedPort(context.Background(), "8085/tcp")
+	if err != nil {
+		container.Terminate(context.Background())
+		return nil, "", err
+	}
+
+	return container, fmt.Sprintf("%s:%d", host, pubSubPort.Int()), nil
+}
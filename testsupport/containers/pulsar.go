@@ -0,0 +1,77 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package containers
+
+import (
+	"context"
+	"fmt"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"io"
+	"strings"
+	"time"
+)
+
+const pulsarProtocol = "pulsar"
+
+func SetupPulsarContainer() (testcontainers.Container, string, error) {
+	containerRequest := testcontainers.ContainerRequest{
+		Image:        "apachepulsar/pulsar:3.0.0",
+		ExposedPorts: []string{"6650/tcp", "8080/tcp"},
+		Cmd:          []string{"bin/pulsar", "standalone", "--no-functions-worker", "--no-stream-storage"},
+		WaitingFor: wait.ForHTTP("/admin/v2/clusters").
+			WithPort("8080/tcp").
+			WithStartupTimeout(time.Minute * 3).
+			WithResponseMatcher(func(body io.Reader) bool {
+				clusters, err := io.ReadAll(body)
+				return err == nil && strings.Contains(string(clusters), "standalone")
+			}),
+	}
+
+	logger, err := logging.NewLogger("testcontainers")
+	if err != nil {
+		return nil, "", err
+	}
+
+	container, err := testcontainers.GenericContainer(
+		context.Background(),
+		testcontainers.GenericContainerRequest{
+			ContainerRequest: containerRequest,
+			Started:          true,
+			Logger:           logger,
+		},
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	host, err := container.Host(context.Background())
+	if err != nil {
+		container.Terminate(context.Background())
+		return nil, "", err
+	}
+
+	pulsarPort, err := container.MappedPort(context.Background(), "6650/tcp")
+	if err != nil {
+		container.Terminate(context.Background())
+		return nil, "", err
+	}
+
+	return container, fmt.Sprintf("%s://%s:%d", pulsarProtocol, host, pulsarPort.Int()), nil
+}